@@ -31,7 +31,10 @@ var agentCmd = &cobra.Command{
 	Hidden: true,
 }
 
+var agentCSIEndpoint string
+
 func init() {
+	agentCmd.Flags().StringVar(&agentCSIEndpoint, "csi-endpoint", "", "the unix socket endpoint of the node service of the CSI driver. the service is not served if empty")
 	flags.SetFlagsFromEnv(agentCmd.Flags(), "ROOK")
 	agentCmd.RunE = startAgent
 }
@@ -55,7 +58,7 @@ func startAgent(cmd *cobra.Command, args []string) error {
 	context.APIExtensionClientset = apiExtClientset
 	context.RookClientset = rookClientset
 
-	agent := agent.New(context)
+	agent := agent.New(context, agentCSIEndpoint)
 	err = agent.Run()
 	if err != nil {
 		terminateFatal(fmt.Errorf("failed to run rook agent. %+v\n", err))
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/csi"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var csiCmd = &cobra.Command{
+	Use:    "csi",
+	Short:  "Runs the controller service of the rook CSI driver",
+	Hidden: true,
+}
+
+var csiEndpoint string
+
+func init() {
+	csiCmd.Flags().StringVar(&csiEndpoint, "csi-endpoint", "unix:///csi/"+csi.SocketFile, "the unix socket endpoint of the controller service")
+	flags.SetFlagsFromEnv(csiCmd.Flags(), RookEnvVarPrefix)
+
+	csiCmd.RunE = startCSIController
+}
+
+func startCSIController(cmd *cobra.Command, args []string) error {
+
+	setLogLevel()
+
+	logStartupInfo(csiCmd.Flags())
+
+	clientset, apiExtClientset, rookClientset, err := getClientset()
+	if err != nil {
+		terminateFatal(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+
+	logger.Info("starting rook CSI controller")
+	context := createContext()
+	context.NetworkInfo = clusterd.NetworkInfo{}
+	context.ConfigDir = k8sutil.DataDir
+	context.Clientset = clientset
+	context.APIExtensionClientset = apiExtClientset
+	context.RookClientset = rookClientset
+	volumeAttachment, err := attachment.New(context)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	// the attachments are recorded in the namespace of the agents, which is the namespace of the controller
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	driver := csi.NewDriver(csiEndpoint)
+	controller := csi.NewControllerServer(context, volumeAttachment, namespace)
+	if err := driver.Start(csi.NewIdentityServer(true), controller, nil); err != nil {
+		terminateFatal(fmt.Errorf("failed to run the CSI controller. %+v", err))
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGTERM)
+	<-sigc
+	logger.Infof("shutdown signal received, exiting...")
+	driver.Stop()
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/daemon/ceph/mds"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var filesystemCmd = &cobra.Command{
+	Use:    "filesystem",
+	Short:  "Manages the directories of the volumes provisioned from a shared file system",
+	Hidden: true,
+}
+var createVolumeDirCmd = &cobra.Command{
+	Use:    "create-volume-dir",
+	Short:  "Creates the directory of a volume in the file system with a quota",
+	Hidden: true,
+}
+var deleteVolumeDirCmd = &cobra.Command{
+	Use:    "delete-volume-dir",
+	Short:  "Removes the directory of a volume and its content from the file system",
+	Hidden: true,
+}
+var (
+	volumeFSName     string
+	volumePath       string
+	volumeQuotaBytes int64
+)
+
+func addVolumeDirFlags(command *cobra.Command) {
+	command.Flags().StringVar(&volumeFSName, "fs-name", "", "name of the file system of the volume")
+	command.Flags().StringVar(&volumePath, "volume-path", "", "path of the directory of the volume in the file system")
+	addCephFlags(command)
+}
+
+func init() {
+	addVolumeDirFlags(createVolumeDirCmd)
+	createVolumeDirCmd.Flags().Int64Var(&volumeQuotaBytes, "quota-bytes", 0, "the quota of the directory in bytes")
+	flags.SetFlagsFromEnv(createVolumeDirCmd.Flags(), RookEnvVarPrefix)
+
+	addVolumeDirFlags(deleteVolumeDirCmd)
+	flags.SetFlagsFromEnv(deleteVolumeDirCmd.Flags(), RookEnvVarPrefix)
+
+	filesystemCmd.AddCommand(createVolumeDirCmd, deleteVolumeDirCmd)
+
+	createVolumeDirCmd.RunE = createVolumeDir
+	deleteVolumeDirCmd.RunE = deleteVolumeDir
+}
+
+func createVolumeDir(cmd *cobra.Command, args []string) error {
+	required := []string{"mon-endpoints", "cluster-name", "admin-secret", "fs-name", "volume-path"}
+	if err := flags.VerifyRequiredFlags(cmd, required); err != nil {
+		return err
+	}
+	if volumeQuotaBytes <= 0 {
+		return fmt.Errorf("quota-bytes must be greater than 0")
+	}
+
+	setLogLevel()
+
+	logStartupInfo(cmd.Flags())
+
+	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
+	if err := mds.CreateVolumeDir(createContext(), &clusterInfo, volumeFSName, volumePath, volumeQuotaBytes); err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
+
+func deleteVolumeDir(cmd *cobra.Command, args []string) error {
+	required := []string{"mon-endpoints", "cluster-name", "admin-secret", "fs-name", "volume-path"}
+	if err := flags.VerifyRequiredFlags(cmd, required); err != nil {
+		return err
+	}
+
+	setLogLevel()
+
+	logStartupInfo(cmd.Flags())
+
+	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
+	if err := mds.DeleteVolumeDir(createContext(), &clusterInfo, volumeFSName, volumePath); err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
@@ -59,6 +59,7 @@ type config struct {
 	devices            string
 	directories        string
 	metadataDevice     string
+	blockDevicePath    string
 	dataDir            string
 	forceFormat        bool
 	location           string
@@ -97,8 +98,11 @@ func addCommands() {
 	rootCmd.AddCommand(mgrCmd)
 	rootCmd.AddCommand(rgwCmd)
 	rootCmd.AddCommand(mdsCmd)
+	rootCmd.AddCommand(filesystemCmd)
+	rootCmd.AddCommand(rbdMirrorCmd)
 	rootCmd.AddCommand(apiCmd)
 	rootCmd.AddCommand(agentCmd)
+	rootCmd.AddCommand(csiCmd)
 	rootCmd.AddCommand(operatorCmd)
 }
 
@@ -19,7 +19,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/daemon/ceph/osd"
@@ -27,6 +30,7 @@ import (
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/flags"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 )
 
 var osdCmd = &cobra.Command{
@@ -34,9 +38,24 @@ var osdCmd = &cobra.Command{
 	Short:  "Generates osd config and runs the osd daemon",
 	Hidden: true,
 }
+var prepareOSDCmd = &cobra.Command{
+	Use:    "prepare",
+	Short:  "Prepares the devices and directories of a node for osds without running them",
+	Hidden: true,
+}
+var startOSDCmd = &cobra.Command{
+	Use:    "start",
+	Short:  "Runs a single osd daemon that was prepared on the node",
+	Hidden: true,
+}
 var (
-	osdDataDeviceFilter string
-	ownerRefID          string
+	osdDataDeviceFilter  string
+	ownerRefID           string
+	osdID                int
+	migrateOSDID         int
+	deviceHealthInterval time.Duration
+	recoveryPolicy       rookalpha.OSDRecoveryPolicy
+	topologyLabels       string
 )
 
 func addOSDFlags(command *cobra.Command) {
@@ -44,8 +63,10 @@ func addOSDFlags(command *cobra.Command) {
 	command.Flags().StringVar(&ownerRefID, "cluster-id", "", "the UID of the cluster CRD that owns this cluster")
 	command.Flags().StringVar(&osdDataDeviceFilter, "data-device-filter", "", "a regex filter for the device names to use, or \"all\"")
 	command.Flags().StringVar(&cfg.directories, "data-directories", "", "comma separated list of directory paths to use for storage")
+	command.Flags().StringVar(&cfg.blockDevicePath, "block-device-path", "", "path of the raw block device of a volume claim to use whole for an osd")
 	command.Flags().StringVar(&cfg.metadataDevice, "metadata-device", "", "device to use for metadata (e.g. a high performance SSD/NVMe device)")
 	command.Flags().StringVar(&cfg.location, "location", "", "location of this node for CRUSH placement")
+	command.Flags().StringVar(&topologyLabels, "topology-labels", "", "the node labels to add to the CRUSH location (e.g. zone=failure-domain.beta.kubernetes.io/zone)")
 	command.Flags().BoolVar(&cfg.forceFormat, "force-format", false,
 		"true to force the format of any specified devices, even if they already have a filesystem.  BE CAREFUL!")
 	command.Flags().StringVar(&cfg.nodeName, "node-name", os.Getenv("HOSTNAME"), "the host name of the node")
@@ -55,27 +76,147 @@ func addOSDFlags(command *cobra.Command) {
 	command.Flags().IntVar(&cfg.storeConfig.DatabaseSizeMB, "osd-database-size", osd.DBDefaultSizeMB, "default size (MB) for OSD database (bluestore)")
 	command.Flags().IntVar(&cfg.storeConfig.JournalSizeMB, "osd-journal-size", osd.JournalDefaultSizeMB, "default size (MB) for OSD journal (filestore)")
 	command.Flags().StringVar(&cfg.storeConfig.StoreType, "osd-store", osd.DefaultStore, "type of backing OSD store to use (bluestore or filestore)")
+	command.Flags().StringVar(&cfg.storeConfig.ProvisionScheme, "osd-provision-scheme", osd.PartitionScheme, "how the OSD devices are provisioned (partition or lvm)")
 }
 
 func init() {
 	addOSDFlags(osdCmd)
 	addCephFlags(osdCmd)
+	osdCmd.Flags().DurationVar(&deviceHealthInterval, "device-health-interval", 0, "how often to collect the SMART data of the osd devices (0 to disable)")
+	osdCmd.Flags().IntVar(&recoveryPolicy.RestartGracePeriodSeconds, "restart-grace-period-seconds", 0, "how long an osd must be down before its process is restarted")
+	osdCmd.Flags().IntVar(&recoveryPolicy.MaxRestartAttempts, "max-restart-attempts", 0, "how many times the process of a down osd is restarted before giving up")
+	osdCmd.Flags().IntVar(&recoveryPolicy.RestartBackoffSeconds, "restart-backoff-seconds", 0, "how long to wait after a restart of a down osd before the next attempt")
+	osdCmd.Flags().IntVar(&recoveryPolicy.MarkOutAfterSeconds, "mark-out-after-seconds", 0, "how long an osd must be down before it is marked out (0 to leave it to ceph)")
 	flags.SetFlagsFromEnv(osdCmd.Flags(), RookEnvVarPrefix)
 
+	addOSDFlags(prepareOSDCmd)
+	addCephFlags(prepareOSDCmd)
+	prepareOSDCmd.Flags().IntVar(&migrateOSDID, "migrate-osd-id", -1, "the id of a destroyed filestore osd to create again as bluestore")
+	flags.SetFlagsFromEnv(prepareOSDCmd.Flags(), RookEnvVarPrefix)
+
+	startOSDCmd.Flags().IntVar(&osdID, "osd-id", -1, "the id of the osd to run")
+	startOSDCmd.Flags().StringVar(&ownerRefID, "cluster-id", "", "the UID of the cluster CRD that owns this cluster")
+	startOSDCmd.Flags().StringVar(&cfg.location, "location", "", "location of this node for CRUSH placement")
+	startOSDCmd.Flags().StringVar(&topologyLabels, "topology-labels", "", "the node labels to add to the CRUSH location (e.g. zone=failure-domain.beta.kubernetes.io/zone)")
+	startOSDCmd.Flags().StringVar(&cfg.nodeName, "node-name", os.Getenv("HOSTNAME"), "the host name of the node")
+	startOSDCmd.Flags().DurationVar(&deviceHealthInterval, "device-health-interval", 0, "how often to collect the SMART data of the osd devices (0 to disable)")
+	addCephFlags(startOSDCmd)
+	flags.SetFlagsFromEnv(startOSDCmd.Flags(), RookEnvVarPrefix)
+
+	osdCmd.AddCommand(prepareOSDCmd, startOSDCmd)
+
 	osdCmd.RunE = startOSD
+	prepareOSDCmd.RunE = prepareOSD
+	startOSDCmd.RunE = startOSDDaemon
 }
 
+// run all the osds on the node in a single pod
 func startOSD(cmd *cobra.Command, args []string) error {
-	required := []string{"cluster-name", "cluster-id", "mon-endpoints", "mon-secret", "admin-secret", "node-name", "public-ipv4", "private-ipv4"}
-	if err := flags.VerifyRequiredFlags(osdCmd, required); err != nil {
+	context, agent, err := createOSDAgent(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = osd.Run(context, agent, deviceHealthInterval, recoveryPolicy)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
+
+// prepare the osds on the node, which will be run by the operator in a pod per osd
+func prepareOSD(cmd *cobra.Command, args []string) error {
+	context, agent, err := createOSDAgent(cmd)
+	if err != nil {
 		return err
 	}
 
+	if migrateOSDID != -1 {
+		if err := osd.PrepareMigration(context, agent, migrateOSDID); err != nil {
+			terminateFatal(err)
+		}
+	}
+
+	err = osd.Provision(context, agent)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
+
+// run a single osd that was prepared on the node
+func startOSDDaemon(cmd *cobra.Command, args []string) error {
+	required := []string{"osd-id", "cluster-name", "cluster-id", "mon-endpoints", "mon-secret", "admin-secret", "node-name", "public-ipv4", "private-ipv4"}
+	if err := flags.VerifyRequiredFlags(cmd, required); err != nil {
+		return err
+	}
+
+	setLogLevel()
+
+	logStartupInfo(cmd.Flags())
+
+	clientset, _, rookClientset, err := getClientset()
+	if err != nil {
+		terminateFatal(fmt.Errorf("failed to init k8s client. %+v\n", err))
+	}
+
+	context := createContext()
+	context.Clientset = clientset
+	context.RookClientset = rookClientset
+
+	crushLocation, err := getCrushLocation(clientset)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
+	ownerRef := cluster.ClusterOwnerRef(clusterInfo.Name, ownerRefID)
+	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, ownerRef)
+
+	err = osd.StartOSD(context, &clusterInfo, kv, cfg.nodeName, crushLocation, osdID, deviceHealthInterval)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
+
+// gets the crush location of the node from the location setting and the topology labels of the node
+func getCrushLocation(clientset kubernetes.Interface) (string, error) {
+	location := cfg.location
+	if topologyLabels != "" {
+		labels, err := k8sutil.ParseTopologyLabels(topologyLabels)
+		if err != nil {
+			return "", fmt.Errorf("invalid topology labels. %+v", err)
+		}
+		topology, err := k8sutil.GetNodeTopologyLocation(clientset, cfg.nodeName, labels)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the topology of node %s. %+v", cfg.nodeName, err)
+		}
+		logger.Infof("topology of node %s: %s", cfg.nodeName, topology)
+		location = k8sutil.MergeLocation(location, topology)
+	}
+
+	locArgs, err := client.FormatLocation(location, cfg.nodeName)
+	if err != nil {
+		return "", fmt.Errorf("invalid location. %+v", err)
+	}
+	return strings.Join(locArgs, " "), nil
+}
+
+func createOSDAgent(cmd *cobra.Command) (*clusterd.Context, *osd.OsdAgent, error) {
+	required := []string{"cluster-name", "cluster-id", "mon-endpoints", "mon-secret", "admin-secret", "node-name", "public-ipv4", "private-ipv4"}
+	if err := flags.VerifyRequiredFlags(cmd, required); err != nil {
+		return nil, nil, err
+	}
+
 	var dataDevices string
 	var usingDeviceFilter bool
 	if osdDataDeviceFilter != "" {
 		if cfg.devices != "" {
-			return fmt.Errorf("Only one of --data-devices and --data-device-filter can be specified.")
+			return nil, nil, fmt.Errorf("Only one of --data-devices and --data-device-filter can be specified.")
 		}
 
 		dataDevices = osdDataDeviceFilter
@@ -86,7 +227,7 @@ func startOSD(cmd *cobra.Command, args []string) error {
 
 	setLogLevel()
 
-	logStartupInfo(osdCmd.Flags())
+	logStartupInfo(cmd.Flags())
 
 	clientset, _, rookClientset, err := getClientset()
 	if err != nil {
@@ -97,23 +238,17 @@ func startOSD(cmd *cobra.Command, args []string) error {
 	context.Clientset = clientset
 	context.RookClientset = rookClientset
 
-	locArgs, err := client.FormatLocation(cfg.location, cfg.nodeName)
+	crushLocation, err := getCrushLocation(clientset)
 	if err != nil {
-		terminateFatal(fmt.Errorf("invalid location. %+v\n", err))
+		terminateFatal(err)
 	}
-	crushLocation := strings.Join(locArgs, " ")
 
 	forceFormat := false
 	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
 	ownerRef := cluster.ClusterOwnerRef(clusterInfo.Name, ownerRefID)
 	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, ownerRef)
-	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, cfg.metadataDevice, cfg.directories, forceFormat,
-		crushLocation, cfg.storeConfig, &clusterInfo, cfg.nodeName, kv)
+	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, cfg.metadataDevice, cfg.directories, cfg.blockDevicePath,
+		forceFormat, crushLocation, cfg.storeConfig, &clusterInfo, cfg.nodeName, kv)
 
-	err = osd.Run(context, agent)
-	if err != nil {
-		terminateFatal(err)
-	}
-
-	return nil
+	return context, agent, nil
 }
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/daemon/ceph/rbd"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rbdMirrorName    string
+	rbdMirrorKeyring string
+)
+
+var rbdMirrorCmd = &cobra.Command{
+	Use:    "rbd-mirror",
+	Short:  "Generates rbd-mirror config and runs the rbd-mirror daemon",
+	Hidden: true,
+}
+
+func init() {
+	rbdMirrorCmd.Flags().StringVar(&rbdMirrorName, "rbd-mirror-name", "", "the rbd-mirror name")
+	rbdMirrorCmd.Flags().StringVar(&rbdMirrorKeyring, "rbd-mirror-keyring", "", "the rbd-mirror keyring")
+	addCephFlags(rbdMirrorCmd)
+
+	flags.SetFlagsFromEnv(rbdMirrorCmd.Flags(), RookEnvVarPrefix)
+
+	rbdMirrorCmd.RunE = startRBDMirror
+}
+
+func startRBDMirror(cmd *cobra.Command, args []string) error {
+	required := []string{"mon-endpoints", "cluster-name", "mon-secret", "admin-secret", "public-ipv4", "private-ipv4",
+		"rbd-mirror-name", "rbd-mirror-keyring"}
+	if err := flags.VerifyRequiredFlags(rbdMirrorCmd, required); err != nil {
+		return err
+	}
+
+	setLogLevel()
+
+	logStartupInfo(rbdMirrorCmd.Flags())
+
+	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
+	config := &rbd.MirrorConfig{
+		Name:        rbdMirrorName,
+		Keyring:     rbdMirrorKeyring,
+		ClusterInfo: &clusterInfo,
+	}
+
+	err := rbd.RunMirror(createContext(), config)
+	if err != nil {
+		terminateFatal(err)
+	}
+
+	return nil
+}
@@ -20,12 +20,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/rpc"
 	"os"
 	"strings"
 
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
 	"github.com/rook/rook/pkg/model"
+	"github.com/rook/rook/pkg/util/sys"
 	"github.com/spf13/cobra"
 	k8smount "k8s.io/kubernetes/pkg/util/mount"
 	"k8s.io/kubernetes/pkg/util/version"
@@ -92,6 +94,17 @@ func handleMount(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Grow the filesystem in case the volume was expanded while it was not mounted
+	err = redirectStdout(
+		client,
+		func() error {
+			return sys.GrowFilesystem(devicePath, globalVolumeMountPath, opts.FsType, executor)
+		},
+	)
+	if err != nil {
+		log(client, fmt.Sprintf("WARNING: failed to grow the filesystem of volume %s/%s: %v", opts.Pool, opts.Image, err), false)
+	}
+
 	// Mount the global mount path to pod mount dir
 	err = mount(client, mounter, globalVolumeMountPath, opts)
 	if err != nil {
@@ -200,15 +213,6 @@ func mountCephFS(client *rpc.Client, opts *flexvolume.AttachOptions) error {
 		return fmt.Errorf("Rook: Attach filesystem %s failed: cluster is not provided", opts.FsName)
 	}
 
-	// Get client access info
-	var clientAccessInfo model.ClientAccessInfo
-	err := client.Call("Controller.GetClientAccessInfo", opts.ClusterName, &clientAccessInfo)
-	if err != nil {
-		errorMsg := fmt.Sprintf("Attach filesystem %s on cluster %s failed: %v", opts.FsName, opts.ClusterName, err)
-		log(client, errorMsg, true)
-		return fmt.Errorf("Rook: %v", errorMsg)
-	}
-
 	// if a path has not been provided, just use the root of the filesystem.
 	// otherwise, ensure that the provided path starts with the path separator char.
 	path := string(os.PathSeparator)
@@ -219,6 +223,20 @@ func mountCephFS(client *rpc.Client, opts *flexvolume.AttachOptions) error {
 		}
 	}
 
+	if useCephFuse(client, opts.Mounter) {
+		opts.Path = path
+		return mountCephFSFuse(client, opts)
+	}
+
+	// Get client access info
+	var clientAccessInfo model.ClientAccessInfo
+	err := client.Call("Controller.GetClientAccessInfo", opts.ClusterName, &clientAccessInfo)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Attach filesystem %s on cluster %s failed: %v", opts.FsName, opts.ClusterName, err)
+		log(client, errorMsg, true)
+		return fmt.Errorf("Rook: %v", errorMsg)
+	}
+
 	options := []string{fmt.Sprintf("name=%s", clientAccessInfo.UserName), fmt.Sprintf("secret=%s", clientAccessInfo.SecretKey)}
 
 	// Get kernel version
@@ -244,10 +262,24 @@ func mountCephFS(client *rpc.Client, opts *flexvolume.AttachOptions) error {
 		}
 	}
 
-	devicePath := fmt.Sprintf("%s:%s", strings.Join(clientAccessInfo.MonAddresses, ","), path)
+	monitors := strings.Join(clientAccessInfo.MonAddresses, ",")
+	devicePath := fmt.Sprintf("%s:%s", monitors, path)
+	mounter := getMounter()
+
+	// a provisioned volume is mounted with the client restricted to its path, which was created by the provisioner
+	if opts.Client != "" {
+		var volumeAccessInfo model.ClientAccessInfo
+		err = client.Call("Controller.GetFilesystemClientAccessInfo", opts, &volumeAccessInfo)
+		if err != nil {
+			errorMsg := fmt.Sprintf("Attach filesystem %s on cluster %s failed to get client %s: %v", opts.FsName, opts.ClusterName, opts.Client, err)
+			log(client, errorMsg, true)
+			return fmt.Errorf("Rook: %v", errorMsg)
+		}
+		options[0] = fmt.Sprintf("name=%s", volumeAccessInfo.UserName)
+		options[1] = fmt.Sprintf("secret=%s", volumeAccessInfo.SecretKey)
+	}
 
 	log(client, fmt.Sprintf("mounting ceph filesystem %s on %s to %s", opts.FsName, devicePath, opts.MountDir), false)
-	mounter := getMounter()
 	err = redirectStdout(
 		client,
 		func() error {
@@ -279,3 +311,63 @@ func mountCephFS(client *rpc.Client, opts *flexvolume.AttachOptions) error {
 
 	return err
 }
+
+// useCephFuse returns whether the filesystem is mounted with ceph-fuse instead of the kernel client. Without a mounter
+// in the volume options, ceph-fuse is used when the ceph kernel module cannot be loaded on the node.
+func useCephFuse(client *rpc.Client, mounter string) bool {
+	switch mounter {
+	case flexvolume.MounterFuse:
+		return true
+	case flexvolume.MounterKernel:
+		return false
+	}
+
+	if hasKernelFilesystem(cephFS) {
+		return false
+	}
+	if err := sys.LoadKernelModule(cephFS, nil, executor); err != nil {
+		log(client, fmt.Sprintf("failed to load the ceph kernel module, the filesystem will be mounted with ceph-fuse: %v", err), false)
+		return true
+	}
+	return !hasKernelFilesystem(cephFS)
+}
+
+// hasKernelFilesystem checks if a filesystem type is supported by the kernel of the node
+func hasKernelFilesystem(fsType string) bool {
+	buf, err := ioutil.ReadFile("/proc/filesystems")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == fsType {
+			return true
+		}
+	}
+	return false
+}
+
+// mountCephFSFuse calls the agent to mount the filesystem with ceph-fuse, since the ceph-fuse daemon must keep running
+// after the driver exits
+func mountCephFSFuse(client *rpc.Client, opts *flexvolume.AttachOptions) error {
+	log(client, fmt.Sprintf("mounting ceph filesystem %s on %s to %s with ceph-fuse", opts.FsName, opts.Path, opts.MountDir), false)
+
+	mounter := getMounter()
+	notMnt, err := mounter.Interface.IsLikelyNotMountPoint(opts.MountDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !notMnt {
+		// Directory is already mounted
+		return nil
+	}
+
+	err = client.Call("Controller.MountFilesystemFuse", opts, nil)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Attach filesystem %s on cluster %s with ceph-fuse failed: %v", opts.FsName, opts.ClusterName, err)
+		log(client, errorMsg, true)
+		return fmt.Errorf("Rook: %v", errorMsg)
+	}
+	log(client, fmt.Sprintf("ceph filesystem %s has been mounted with ceph-fuse", opts.FsName), false)
+	return nil
+}
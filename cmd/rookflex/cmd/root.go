@@ -31,7 +31,8 @@ import (
 )
 
 const (
-	cephFS = "ceph"
+	cephFS       = "ceph"
+	cephFuseType = "fuse.ceph-fuse"
 )
 
 var RootCmd = &cobra.Command{
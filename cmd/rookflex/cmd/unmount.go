@@ -58,6 +58,12 @@ func handleUnmount(cmd *cobra.Command, args []string) error {
 		return unmountCephFS(client, mounter, mountDir)
 	}
 
+	// Check if it's a cephfs mounted with ceph-fuse. The ceph-fuse daemon exits when it is unmounted.
+	err = executor.ExecuteCommand(false, "", "df", "--type", cephFuseType, mountDir)
+	if err == nil {
+		return unmountCephFS(client, mounter, mountDir)
+	}
+
 	var opts = &flexvolume.AttachOptions{
 		MountDir: args[0],
 	}
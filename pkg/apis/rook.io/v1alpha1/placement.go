@@ -70,3 +70,6 @@ func (p PlacementSpec) GetMon() Placement { return p.All.Merge(p.Mon) }
 
 // GetOSD returns the placement for the OSD service
 func (p PlacementSpec) GetOSD() Placement { return p.All.Merge(p.OSD) }
+
+// GetRBDMirror returns the placement for the rbd-mirror daemons
+func (p PlacementSpec) GetRBDMirror() Placement { return p.All.Merge(p.RBDMirror) }
@@ -18,10 +18,16 @@ package v1alpha1
 import "github.com/rook/rook/pkg/model"
 
 func (p *PoolSpec) ToModel(name string) *model.Pool {
-	pool := &model.Pool{Name: name, FailureDomain: p.FailureDomain}
+	pool := &model.Pool{Name: name, FailureDomain: p.FailureDomain, Parameters: p.Parameters}
+	pool.Quotas = model.PoolQuotas{MaxBytes: p.Quotas.MaxBytes, MaxObjects: p.Quotas.MaxObjects}
+	pool.Compression = model.PoolCompression{
+		Mode:          p.Compression.Mode,
+		Algorithm:     p.Compression.Algorithm,
+		RequiredRatio: p.Compression.RequiredRatio,
+	}
 	r := p.Replication()
 	if r != nil {
-		pool.ReplicatedConfig.Size = r.Size
+		pool.ReplicatedConfig = model.ReplicatedPoolConfig{Size: r.Size, MinSize: r.MinSize, CrushRoot: r.CrushRoot, PrimaryZone: r.PrimaryZone}
 		pool.Type = model.Replicated
 	} else {
 		ec := p.ErasureCode()
@@ -48,3 +54,14 @@ func (p *PoolSpec) ErasureCode() *ErasureCodedSpec {
 	}
 	return nil
 }
+
+// Width returns the number of osds each object of the pool is stored on
+func (p *PoolSpec) Width() uint {
+	if r := p.Replication(); r != nil {
+		return r.Size
+	}
+	if ec := p.ErasureCode(); ec != nil {
+		return ec.DataChunks + ec.CodingChunks
+	}
+	return 1
+}
@@ -55,6 +55,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Cluster{},
 		&ClusterList{},
+		&CrushMap{},
+		&CrushMapList{},
 		&Pool{},
 		&PoolList{},
 		&Filesystem{},
@@ -65,6 +67,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&ObjectstoreList{},
 		&VolumeAttachment{},
 		&VolumeAttachmentList{},
+		&VolumeSnapshot{},
+		&VolumeSnapshotList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -17,7 +17,19 @@ limitations under the License.
 // Package osd for the Ceph OSDs.
 package v1alpha1
 
-const bluestore = "bluestore"
+import "time"
+
+const (
+	bluestore                          = "bluestore"
+	defaultDeviceHealthIntervalMinutes = 60
+	defaultRestartGracePeriodSeconds   = 600
+	defaultMaxRestartAttempts          = 3
+	defaultRestartBackoffSeconds       = 300
+
+	// the well known labels of the nodes for their failure domains
+	regionLabel = "failure-domain.beta.kubernetes.io/region"
+	zoneLabel   = "failure-domain.beta.kubernetes.io/zone"
+)
 
 // AnyUseAllDevices gets whether to use all devices
 func (s *StorageSpec) AnyUseAllDevices() bool {
@@ -66,11 +78,26 @@ func (s *StorageSpec) ResolveNode(nodeName string) *Node {
 
 	// now resolve all properties that haven't already been set on the node
 	s.resolveNodeSelection(node)
-	s.resolveNodeConfig(node)
+	s.resolveConfig(&node.Config)
 
 	return node
 }
 
+// Fully resolves the config of the given volume claim set. Config that is not specified on the set is taken
+// from the cluster, or the default values if the cluster does not specify it either.
+func (s *StorageSpec) ResolveVolumeClaimSet(name string) *VolumeClaimSet {
+	for i := range s.VolumeClaimSets {
+		if s.VolumeClaimSets[i].Name == name {
+			set := &(s.VolumeClaimSets[i])
+			s.resolveConfig(&set.Config)
+			return set
+		}
+	}
+
+	// a volume claim set with the given name was not found
+	return nil
+}
+
 func (s *StorageSpec) resolveNodeSelection(node *Node) {
 	resolveString(&(node.Selection.DeviceFilter), s.Selection.DeviceFilter, "")
 	resolveString(&(node.Selection.MetadataDevice), s.Selection.MetadataDevice, "")
@@ -89,12 +116,68 @@ func (s *StorageSpec) resolveNodeSelection(node *Node) {
 	}
 }
 
-func (s *StorageSpec) resolveNodeConfig(node *Node) {
-	resolveString(&(node.Config.StoreConfig.StoreType), s.Config.StoreConfig.StoreType, bluestore)
-	resolveInt(&(node.Config.StoreConfig.DatabaseSizeMB), s.Config.StoreConfig.DatabaseSizeMB, 0)
-	resolveInt(&(node.Config.StoreConfig.WalSizeMB), s.Config.StoreConfig.WalSizeMB, 0)
-	resolveInt(&(node.Config.StoreConfig.JournalSizeMB), s.Config.StoreConfig.JournalSizeMB, 0)
-	resolveString(&(node.Config.Location), s.Config.Location, "")
+func (s *StorageSpec) resolveConfig(config *Config) {
+	resolveString(&(config.StoreConfig.StoreType), s.Config.StoreConfig.StoreType, bluestore)
+	resolveInt(&(config.StoreConfig.DatabaseSizeMB), s.Config.StoreConfig.DatabaseSizeMB, 0)
+	resolveInt(&(config.StoreConfig.WalSizeMB), s.Config.StoreConfig.WalSizeMB, 0)
+	resolveInt(&(config.StoreConfig.JournalSizeMB), s.Config.StoreConfig.JournalSizeMB, 0)
+	resolveString(&(config.StoreConfig.ProvisionScheme), s.Config.StoreConfig.ProvisionScheme, "")
+	resolveString(&(config.Location), s.Config.Location, "")
+}
+
+// GetInterval returns how often the SMART data of the OSD devices is collected
+func (d *DeviceHealthSpec) GetInterval() time.Duration {
+	if d.IntervalMinutes <= 0 {
+		return defaultDeviceHealthIntervalMinutes * time.Minute
+	}
+	return time.Duration(d.IntervalMinutes) * time.Minute
+}
+
+// GetRestartGracePeriod returns how long an OSD must be down before its pod is restarted
+func (p *OSDRecoveryPolicy) GetRestartGracePeriod() time.Duration {
+	if p.RestartGracePeriodSeconds <= 0 {
+		return defaultRestartGracePeriodSeconds * time.Second
+	}
+	return time.Duration(p.RestartGracePeriodSeconds) * time.Second
+}
+
+// GetMaxRestartAttempts returns how many times the pod of a down OSD is restarted before giving up
+func (p *OSDRecoveryPolicy) GetMaxRestartAttempts() int {
+	if p.MaxRestartAttempts <= 0 {
+		return defaultMaxRestartAttempts
+	}
+	return p.MaxRestartAttempts
+}
+
+// GetRestartBackoff returns how long to wait before the next restart after the given number of attempts.
+// The backoff doubles with each attempt.
+func (p *OSDRecoveryPolicy) GetRestartBackoff(attempts int) time.Duration {
+	backoff := time.Duration(p.RestartBackoffSeconds) * time.Second
+	if p.RestartBackoffSeconds <= 0 {
+		backoff = defaultRestartBackoffSeconds * time.Second
+	}
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// GetMarkOutAfter returns how long an OSD must be down before the operator marks it out, or 0 if
+// the operator does not mark out the down OSDs
+func (p *OSDRecoveryPolicy) GetMarkOutAfter() time.Duration {
+	if p.MarkOutAfterSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(p.MarkOutAfterSeconds) * time.Second
+}
+
+// GetLabels returns the node label for each CRUSH bucket type, including the well known region and zone labels
+func (t *TopologySpec) GetLabels() map[string]string {
+	labels := map[string]string{"region": regionLabel, "zone": zoneLabel}
+	for bucketType, label := range t.Labels {
+		labels[bucketType] = label
+	}
+	return labels
 }
 
 func (s *Selection) GetUseAllDevices() bool {
@@ -17,6 +17,7 @@ package v1alpha1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -239,3 +240,80 @@ func TestClusterDirectoriesInherit(t *testing.T) {
 	assert.NotNil(t, node)
 	assert.Equal(t, []Directory{{Path: "/rook/datadir4"}}, node.Directories)
 }
+
+func TestResolveVolumeClaimSet(t *testing.T) {
+	// a non existing set should return nil
+	storageSpec := StorageSpec{}
+	set := storageSpec.ResolveVolumeClaimSet("fake set")
+	assert.Nil(t, set)
+
+	// a set with no config defined should inherit it from the cluster storage spec
+	storageSpec = StorageSpec{
+		Config: Config{
+			Location: "root=default,row=a",
+			StoreConfig: StoreConfig{
+				StoreType:      "filestore",
+				JournalSizeMB:  1024,
+				DatabaseSizeMB: 0,
+			},
+		},
+		VolumeClaimSets: []VolumeClaimSet{
+			{Name: "set1", Count: 3},
+			{Name: "set2", Count: 1, Config: Config{StoreConfig: StoreConfig{StoreType: bluestore}}},
+		},
+	}
+
+	set = storageSpec.ResolveVolumeClaimSet("set1")
+	assert.NotNil(t, set)
+	assert.Equal(t, 3, set.Count)
+	assert.Equal(t, "filestore", set.Config.StoreConfig.StoreType)
+	assert.Equal(t, 1024, set.Config.StoreConfig.JournalSizeMB)
+	assert.Equal(t, "root=default,row=a", set.Config.Location)
+
+	// config on the set takes precedence over the cluster config
+	set = storageSpec.ResolveVolumeClaimSet("set2")
+	assert.NotNil(t, set)
+	assert.Equal(t, bluestore, set.Config.StoreConfig.StoreType)
+	assert.Equal(t, "root=default,row=a", set.Config.Location)
+}
+
+func TestDeviceHealthInterval(t *testing.T) {
+	health := DeviceHealthSpec{}
+	assert.Equal(t, 60*time.Minute, health.GetInterval())
+
+	health.IntervalMinutes = 5
+	assert.Equal(t, 5*time.Minute, health.GetInterval())
+}
+
+func TestRecoveryPolicy(t *testing.T) {
+	policy := OSDRecoveryPolicy{}
+	assert.Equal(t, 600*time.Second, policy.GetRestartGracePeriod())
+	assert.Equal(t, 3, policy.GetMaxRestartAttempts())
+	assert.Equal(t, 300*time.Second, policy.GetRestartBackoff(1))
+	assert.Equal(t, time.Duration(0), policy.GetMarkOutAfter())
+
+	// the backoff doubles after each attempt
+	policy = OSDRecoveryPolicy{RestartGracePeriodSeconds: 30, MaxRestartAttempts: 5, RestartBackoffSeconds: 10, MarkOutAfterSeconds: 900}
+	assert.Equal(t, 30*time.Second, policy.GetRestartGracePeriod())
+	assert.Equal(t, 5, policy.GetMaxRestartAttempts())
+	assert.Equal(t, 10*time.Second, policy.GetRestartBackoff(1))
+	assert.Equal(t, 20*time.Second, policy.GetRestartBackoff(2))
+	assert.Equal(t, 40*time.Second, policy.GetRestartBackoff(3))
+	assert.Equal(t, 900*time.Second, policy.GetMarkOutAfter())
+}
+
+func TestTopologyLabels(t *testing.T) {
+	topology := TopologySpec{}
+	assert.Equal(t, map[string]string{
+		"region": "failure-domain.beta.kubernetes.io/region",
+		"zone":   "failure-domain.beta.kubernetes.io/zone",
+	}, topology.GetLabels())
+
+	// the well known labels can be replaced and other bucket types added
+	topology.Labels = map[string]string{"zone": "example.com/zone", "rack": "example.com/rack"}
+	assert.Equal(t, map[string]string{
+		"region": "failure-domain.beta.kubernetes.io/region",
+		"zone":   "example.com/zone",
+		"rack":   "example.com/rack",
+	}, topology.GetLabels())
+}
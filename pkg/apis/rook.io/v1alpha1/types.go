@@ -33,7 +33,8 @@ import (
 type Cluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              ClusterSpec `json:"spec"`
+	Spec              ClusterSpec   `json:"spec"`
+	Status            ClusterStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -65,6 +66,57 @@ type ClusterSpec struct {
 
 	// Resources set resource requests and limits
 	Resources ResourceSpec `json:"resources,omitempty"`
+
+	// The rbd-mirror daemons that mirror the images of the pools with mirroring enabled
+	RBDMirroring RBDMirroringSpec `json:"rbdMirroring,omitempty"`
+}
+
+// RBDMirroringSpec represents the rbd-mirror daemons of a cluster
+type RBDMirroringSpec struct {
+	// The number of rbd-mirror daemons to run. No daemons are started if not set.
+	Workers int `json:"workers"`
+}
+
+// ClusterStatus is the observed state of the cluster reported by the operator
+type ClusterStatus struct {
+	// The progress of the migration of the OSDs to another store type, if one was started
+	StoreMigration *StoreMigrationStatus `json:"storeMigration,omitempty"`
+}
+
+// StoreMigrationState is the state of a store migration
+type StoreMigrationState string
+
+const (
+	// StoreMigrationInProgress means the OSDs are still being migrated one at a time
+	StoreMigrationInProgress StoreMigrationState = "InProgress"
+	// StoreMigrationCompleted means all the OSDs were migrated
+	StoreMigrationCompleted StoreMigrationState = "Completed"
+	// StoreMigrationFailed means the migration stopped on an OSD and needs attention
+	StoreMigrationFailed StoreMigrationState = "Failed"
+)
+
+// StoreMigrationStatus reports the progress of the migration of the OSDs from one store type to another
+type StoreMigrationStatus struct {
+	// The store type the OSDs are migrated to
+	TargetStoreType string `json:"targetStoreType"`
+
+	// The state of the migration
+	State StoreMigrationState `json:"state"`
+
+	// The OSD currently being migrated, or -1 if none
+	CurrentOSD int `json:"currentOSD"`
+
+	// The step of the migration of the current OSD
+	Phase string `json:"phase,omitempty"`
+
+	// Details about the last step, such as the reason the migration failed
+	Message string `json:"message,omitempty"`
+
+	// The OSDs that were migrated
+	Completed []int `json:"completed,omitempty"`
+
+	// The OSDs still waiting to be migrated
+	Pending []int `json:"pending,omitempty"`
 }
 
 type ResourceSpec struct {
@@ -72,15 +124,67 @@ type ResourceSpec struct {
 	Mgr v1.ResourceRequirements `json:"mgr,omitempty"`
 	Mon v1.ResourceRequirements `json:"mon,omitempty"`
 	OSD v1.ResourceRequirements `json:"osd,omitempty"`
+
+	RBDMirror v1.ResourceRequirements `json:"rbdmirror,omitempty"`
 }
 
 type StorageSpec struct {
 	Nodes       []Node `json:"nodes,omitempty"`
 	UseAllNodes bool   `json:"useAllNodes,omitempty"`
+
+	// Sets of OSDs that are backed by persistent volume claims rather than the devices and directories of a node
+	VolumeClaimSets []VolumeClaimSet `json:"volumeClaimSets,omitempty"`
+
+	// Settings for monitoring the health of the OSD devices
+	DeviceHealth DeviceHealthSpec `json:"deviceHealth,omitempty"`
+
+	// The policy for recovering the OSDs that are down
+	RecoveryPolicy OSDRecoveryPolicy `json:"recoveryPolicy,omitempty"`
+
+	// Settings for deriving the CRUSH location of the OSDs from the labels of their nodes
+	Topology TopologySpec `json:"topology,omitempty"`
 	Selection
 	Config
 }
 
+// DeviceHealthSpec configures the collection of SMART data from the OSD devices
+type DeviceHealthSpec struct {
+	// Whether to collect the SMART data of the devices of each OSD
+	Enabled bool `json:"enabled,omitempty"`
+
+	// How often the SMART data is collected (default: 60)
+	IntervalMinutes int `json:"intervalMinutes,omitempty"`
+
+	// Whether to mark out an OSD when the SMART data of one of its devices predicts a failure
+	MarkOutOnPredictedFailure bool `json:"markOutOnPredictedFailure,omitempty"`
+}
+
+// OSDRecoveryPolicy controls how the operator recovers the OSDs that are down
+type OSDRecoveryPolicy struct {
+	// How long an OSD must be down before its pod is restarted (default: 600)
+	RestartGracePeriodSeconds int `json:"restartGracePeriodSeconds,omitempty"`
+
+	// How many times the pod of a down OSD is restarted before the operator gives up and flags its device as failed (default: 3)
+	MaxRestartAttempts int `json:"maxRestartAttempts,omitempty"`
+
+	// How long to wait after a restart before the next attempt. The wait doubles after each attempt (default: 300)
+	RestartBackoffSeconds int `json:"restartBackoffSeconds,omitempty"`
+
+	// How long an OSD must be down before the operator marks it out. If not set, ceph marks out the down OSDs
+	// after its own interval (mon_osd_down_out_interval).
+	MarkOutAfterSeconds int `json:"markOutAfterSeconds,omitempty"`
+}
+
+// TopologySpec configures how the CRUSH location of the OSDs is derived from the labels of their nodes
+type TopologySpec struct {
+	// Whether to set the CRUSH location of the OSDs from the labels of their nodes
+	Enabled bool `json:"enabled,omitempty"`
+
+	// The node label to use for each CRUSH bucket type (e.g. rack: topology.example.com/rack). The region and zone
+	// are taken from the well known failure domain labels of the nodes unless they are mapped to other labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
 type Node struct {
 	Name      string                  `json:"name,omitempty"`
 	Devices   []Device                `json:"devices,omitempty"`
@@ -89,6 +193,22 @@ type Node struct {
 	Config
 }
 
+// VolumeClaimSet describes a set of OSDs where each OSD consumes a claim created from the template
+type VolumeClaimSet struct {
+	// The name of the set, which is the prefix for the names of the claims and OSDs
+	Name string `json:"name"`
+
+	// The number of OSDs (and claims) in the set
+	Count int `json:"count"`
+
+	// The template for the claims. The storage class, access modes and requested size of each claim come from the template.
+	VolumeClaimTemplate v1.PersistentVolumeClaim `json:"volumeClaimTemplate"`
+
+	// The resource requirements for the OSD pods of the set
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+	Config
+}
+
 type Device struct {
 	Name string `json:"name,omitempty"`
 }
@@ -119,6 +239,8 @@ type StoreConfig struct {
 	WalSizeMB      int    `json:"walSizeMB,omitempty"`
 	DatabaseSizeMB int    `json:"databaseSizeMB,omitempty"`
 	JournalSizeMB  int    `json:"journalSizeMB,omitempty"`
+	// ProvisionScheme is how the devices are divided for the OSDs: "partition" (default) or "lvm"
+	ProvisionScheme string `json:"provisionScheme,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -130,6 +252,7 @@ type PlacementSpec struct {
 	Mgr             Placement `json:"mgr,omitempty"`
 	Mon             Placement `json:"mon,omitempty"`
 	OSD             Placement `json:"osd,omitempty"`
+	RBDMirror       Placement `json:"rbdmirror,omitempty"`
 }
 
 // +genclient
@@ -139,7 +262,8 @@ type PlacementSpec struct {
 type Pool struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              PoolSpec `json:"spec"`
+	Spec              PoolSpec   `json:"spec"`
+	Status            PoolStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -160,12 +284,112 @@ type PoolSpec struct {
 
 	// The erasure code setteings
 	ErasureCoded ErasureCodedSpec `json:"erasureCoded"`
+
+	// The percentage of the data in the cluster that is expected to be stored in the pool. If set, the number of
+	// placement groups is computed from the number of osds and is increased as osds are added.
+	ExpectedDataPercent uint `json:"expectedDataPercent,omitempty"`
+
+	// The quotas of the pool
+	Quotas QuotaSpec `json:"quotas,omitempty"`
+
+	// The inline compression settings of the pool, which only apply to bluestore osds
+	Compression CompressionSpec `json:"compression,omitempty"`
+
+	// Other properties to set on the pool with "ceph osd pool set", such as "nodeep-scrub": "1"
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// The rbd mirroring of the images in the pool to the pools of the same name in the peer clusters
+	Mirroring MirroringSpec `json:"mirroring,omitempty"`
+}
+
+// MirroringSpec represents the rbd mirroring settings of a pool
+type MirroringSpec struct {
+	// The mirroring mode: "pool" to mirror all the images with journaling enabled, or "image" to mirror only the
+	// images that are enabled for mirroring. Mirroring is disabled if not set.
+	Mode string `json:"mode,omitempty"`
+
+	// The clusters the images are mirrored from
+	Peers []MirroringPeerSpec `json:"peers,omitempty"`
+}
+
+// MirroringPeerSpec represents a peer cluster of the rbd mirroring of a pool
+type MirroringPeerSpec struct {
+	// The name of the secret with the cluster name, client name, mon endpoints, and key of the peer cluster
+	SecretName string `json:"secretName"`
+}
+
+// QuotaSpec represents the quotas of a pool. A quota of 0 is unlimited.
+type QuotaSpec struct {
+	// The maximum number of bytes in the pool
+	MaxBytes uint64 `json:"maxBytes,omitempty"`
+
+	// The maximum number of objects in the pool
+	MaxObjects uint64 `json:"maxObjects,omitempty"`
+}
+
+// CompressionSpec represents the inline compression settings of a pool
+type CompressionSpec struct {
+	// The compression mode: none, passive, aggressive, or force. If not set, the compression of the pool is not changed.
+	Mode string `json:"mode,omitempty"`
+
+	// The compression algorithm: snappy, zlib, zstd, or lz4
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// The compressed size must be below this ratio of the original size for the compressed data to be stored
+	RequiredRatio float64 `json:"requiredRatio,omitempty"`
+}
+
+// PoolState is the state of a pool after the spec was applied
+type PoolState string
+
+const (
+	// PoolCreated means the pool was created or updated with the spec
+	PoolCreated PoolState = "Created"
+	// PoolFailed means the spec is not valid or could not be applied to the pool
+	PoolFailed PoolState = "Failed"
+)
+
+// PoolStatus represents the result of applying the spec to the pool
+type PoolStatus struct {
+	State   PoolState `json:"state,omitempty"`
+	Message string    `json:"message,omitempty"`
+
+	// The mirroring status of the images in the pool if mirroring is enabled
+	Mirroring *MirroringStatus `json:"mirroring,omitempty"`
+}
+
+// MirroringStatus represents the mirroring status of the images in a pool as reported by the rbd-mirror daemons
+type MirroringStatus struct {
+	// The overall health of the mirroring of the pool, such as OK, WARNING, or ERROR
+	Health string `json:"health,omitempty"`
+
+	// The status of each mirrored image
+	Images []ImageMirroringStatus `json:"images,omitempty"`
+}
+
+// ImageMirroringStatus represents the mirroring status of an image
+type ImageMirroringStatus struct {
+	Name string `json:"name"`
+
+	// The state of the image, such as up+replaying or up+stopped
+	State string `json:"state"`
+
+	Description string `json:"description,omitempty"`
 }
 
 // ReplicationSpec represents the spec for replication in a pool
 type ReplicatedSpec struct {
 	// Number of copies per object in a replicated storage pool, including the object itself (required for replicated pool type)
 	Size uint `json:"size"`
+
+	// The number of copies that must be available for the pool to accept writes (default: ceph picks size - size/2)
+	MinSize uint `json:"minSize,omitempty"`
+
+	// The crush root the copies are placed under (default: "default")
+	CrushRoot string `json:"crushRoot,omitempty"`
+
+	// The zone of the primary copy, which serves the reads. The other copies are placed in the other zones, one per zone.
+	PrimaryZone string `json:"primaryZone,omitempty"`
 }
 
 // ErasureCodeSpec represents the spec for erasure code in a pool
@@ -184,10 +408,118 @@ type ErasureCodedSpec struct {
 // +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+type CrushMap struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              CrushMapSpec   `json:"spec"`
+	Status            CrushMapStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type CrushMapList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []CrushMap `json:"items"`
+}
+
+// CrushMapSpec represents the buckets, rules, tunables, and osd weights declared for the crush map of the cluster
+// in the same namespace
+type CrushMapSpec struct {
+	// The tunables profile, such as optimal, hammer, or firefly
+	Tunables string `json:"tunables,omitempty"`
+
+	// The buckets to add to the crush hierarchy
+	Buckets []CrushBucketSpec `json:"buckets,omitempty"`
+
+	// The rules to place the data of the pools
+	Rules []CrushRuleSpec `json:"rules,omitempty"`
+
+	// The crush weights of the osds
+	OSDWeights []OSDWeightSpec `json:"osdWeights,omitempty"`
+
+	// Whether to only report the changes in the status without applying them
+	Preview bool `json:"preview,omitempty"`
+}
+
+// CrushBucketSpec represents a bucket in the crush hierarchy
+type CrushBucketSpec struct {
+	// The name of the bucket
+	Name string `json:"name"`
+
+	// The type of the bucket, such as datacenter or rack
+	Type string `json:"type"`
+
+	// The name of the bucket this bucket is placed under (default: the default root)
+	Parent string `json:"parent,omitempty"`
+}
+
+// CrushRuleSpec represents a crush rule
+type CrushRuleSpec struct {
+	// The name of the rule
+	Name string `json:"name"`
+
+	// The type of pools the rule is for: replicated or erasure (default: replicated)
+	Type string `json:"type,omitempty"`
+
+	// The steps of the rule, starting with a take step and ending with an emit step
+	Steps []CrushRuleStep `json:"steps"`
+}
+
+// CrushRuleStep represents a single step of a crush rule
+type CrushRuleStep struct {
+	// The operation of the step: take, choose, chooseleaf, or emit
+	Op string `json:"op"`
+
+	// The bucket to start from in a take step
+	Item string `json:"item,omitempty"`
+
+	// The number of buckets to choose. 0 is the number of replicas of the pool, and a negative number is
+	// that many less than the number of replicas.
+	Count int `json:"count,omitempty"`
+
+	// The type of the buckets to choose
+	Type string `json:"type,omitempty"`
+}
+
+// OSDWeightSpec represents the crush weight of an osd
+type OSDWeightSpec struct {
+	// The id of the osd
+	ID int `json:"id"`
+
+	// The crush weight of the osd, usually its size in TiB
+	Weight float64 `json:"weight"`
+}
+
+// CrushMapState is the state of the crush map reconciliation
+type CrushMapState string
+
+const (
+	// CrushMapPreview means the changes were computed but not applied
+	CrushMapPreview CrushMapState = "Preview"
+	// CrushMapApplied means the changes were applied to the crush map
+	CrushMapApplied CrushMapState = "Applied"
+	// CrushMapFailed means the spec is not valid or the changes could not be applied
+	CrushMapFailed CrushMapState = "Failed"
+)
+
+// CrushMapStatus represents the result of the crush map reconciliation
+type CrushMapStatus struct {
+	State   CrushMapState `json:"state,omitempty"`
+	Changes []string      `json:"changes,omitempty"`
+	Message string        `json:"message,omitempty"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 type VolumeAttachment struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
 	Attachments       []Attachment `json:"attachments"`
+	// the clients of other nodes that were blacklisted before the volume was attached read-write to a new node
+	FencedClients []FencedClient `json:"fencedClients,omitempty"`
 }
 
 type Attachment struct {
@@ -197,6 +529,14 @@ type Attachment struct {
 	ClusterName  string `json:"clusterName"`
 	MountDir     string `json:"mountDir"`
 	ReadOnly     bool   `json:"readOnly"`
+	// the address of the ceph client that mapped the volume on the node, which is fenced when the volume fails over
+	ClientAddress string `json:"clientAddress,omitempty"`
+}
+
+type FencedClient struct {
+	Node    string      `json:"node"`
+	Address string      `json:"address"`
+	Time    metav1.Time `json:"time"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -211,6 +551,52 @@ type VolumeAttachmentList struct {
 // +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+type VolumeSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              VolumeSnapshotSpec   `json:"spec"`
+	Status            VolumeSnapshotStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type VolumeSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []VolumeSnapshot `json:"items"`
+}
+
+// VolumeSnapshotSpec represents the volume to snapshot
+type VolumeSnapshotSpec struct {
+	// The name of the persistent volume claim in the same namespace whose rbd image is snapshotted
+	PersistentVolumeClaimName string `json:"persistentVolumeClaimName"`
+}
+
+// VolumeSnapshotState is the state of a volume snapshot
+type VolumeSnapshotState string
+
+const (
+	// VolumeSnapshotCreated means the rbd snapshot was created and can be restored
+	VolumeSnapshotCreated VolumeSnapshotState = "Created"
+	// VolumeSnapshotFailed means the rbd snapshot could not be created
+	VolumeSnapshotFailed VolumeSnapshotState = "Failed"
+)
+
+// VolumeSnapshotStatus represents the rbd snapshot taken of the volume
+type VolumeSnapshotStatus struct {
+	State       VolumeSnapshotState `json:"state,omitempty"`
+	ClusterName string              `json:"clusterName,omitempty"`
+	Pool        string              `json:"pool,omitempty"`
+	Image       string              `json:"image,omitempty"`
+	Snapshot    string              `json:"snapshot,omitempty"`
+	Size        uint64              `json:"size,omitempty"`
+	Message     string              `json:"message,omitempty"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 type Filesystem struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
@@ -47,6 +47,7 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -109,6 +110,7 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	in.Placement.DeepCopyInto(&out.Placement)
 	in.Storage.DeepCopyInto(&out.Storage)
 	in.Resources.DeepCopyInto(&out.Resources)
+	out.RBDMirroring = in.RBDMirroring
 	return
 }
 
@@ -122,6 +124,47 @@ func (in *ClusterSpec) DeepCopy() *ClusterSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
+	*out = *in
+	if in.StoreMigration != nil {
+		in, out := &in.StoreMigration, &out.StoreMigration
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(StoreMigrationStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
+func (in *ClusterStatus) DeepCopy() *ClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompressionSpec) DeepCopyInto(out *CompressionSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompressionSpec.
+func (in *CompressionSpec) DeepCopy() *CompressionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CompressionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
@@ -139,6 +182,176 @@ func (in *Config) DeepCopy() *Config {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushBucketSpec) DeepCopyInto(out *CrushBucketSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushBucketSpec.
+func (in *CrushBucketSpec) DeepCopy() *CrushBucketSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushBucketSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushMap) DeepCopyInto(out *CrushMap) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushMap.
+func (in *CrushMap) DeepCopy() *CrushMap {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CrushMap) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushMapList) DeepCopyInto(out *CrushMapList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CrushMap, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushMapList.
+func (in *CrushMapList) DeepCopy() *CrushMapList {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushMapList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CrushMapList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushMapSpec) DeepCopyInto(out *CrushMapSpec) {
+	*out = *in
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]CrushBucketSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]CrushRuleSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.OSDWeights != nil {
+		in, out := &in.OSDWeights, &out.OSDWeights
+		*out = make([]OSDWeightSpec, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushMapSpec.
+func (in *CrushMapSpec) DeepCopy() *CrushMapSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushMapSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushMapStatus) DeepCopyInto(out *CrushMapStatus) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushMapStatus.
+func (in *CrushMapStatus) DeepCopy() *CrushMapStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushMapStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushRuleSpec) DeepCopyInto(out *CrushRuleSpec) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]CrushRuleStep, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushRuleSpec.
+func (in *CrushRuleSpec) DeepCopy() *CrushRuleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushRuleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushRuleStep) DeepCopyInto(out *CrushRuleStep) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushRuleStep.
+func (in *CrushRuleStep) DeepCopy() *CrushRuleStep {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushRuleStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Device) DeepCopyInto(out *Device) {
 	*out = *in
@@ -155,6 +368,22 @@ func (in *Device) DeepCopy() *Device {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceHealthSpec) DeepCopyInto(out *DeviceHealthSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceHealthSpec.
+func (in *DeviceHealthSpec) DeepCopy() *DeviceHealthSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceHealthSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Directory) DeepCopyInto(out *Directory) {
 	*out = *in
@@ -187,6 +416,23 @@ func (in *ErasureCodedSpec) DeepCopy() *ErasureCodedSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FencedClient) DeepCopyInto(out *FencedClient) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FencedClient.
+func (in *FencedClient) DeepCopy() *FencedClient {
+	if in == nil {
+		return nil
+	}
+	out := new(FencedClient)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Filesystem) DeepCopyInto(out *Filesystem) {
 	*out = *in
@@ -252,11 +498,13 @@ func (in *FilesystemList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FilesystemSpec) DeepCopyInto(out *FilesystemSpec) {
 	*out = *in
-	out.MetadataPool = in.MetadataPool
+	in.MetadataPool.DeepCopyInto(&out.MetadataPool)
 	if in.DataPools != nil {
 		in, out := &in.DataPools, &out.DataPools
 		*out = make([]PoolSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	in.MetadataServer.DeepCopyInto(&out.MetadataServer)
 	return
@@ -290,6 +538,22 @@ func (in *GatewaySpec) DeepCopy() *GatewaySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageMirroringStatus) DeepCopyInto(out *ImageMirroringStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageMirroringStatus.
+func (in *ImageMirroringStatus) DeepCopy() *ImageMirroringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageMirroringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetadataServerSpec) DeepCopyInto(out *MetadataServerSpec) {
 	*out = *in
@@ -308,6 +572,64 @@ func (in *MetadataServerSpec) DeepCopy() *MetadataServerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringPeerSpec) DeepCopyInto(out *MirroringPeerSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringPeerSpec.
+func (in *MirroringPeerSpec) DeepCopy() *MirroringPeerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringPeerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringSpec) DeepCopyInto(out *MirroringSpec) {
+	*out = *in
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]MirroringPeerSpec, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringSpec.
+func (in *MirroringSpec) DeepCopy() *MirroringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringStatus) DeepCopyInto(out *MirroringStatus) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]ImageMirroringStatus, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringStatus.
+func (in *MirroringStatus) DeepCopy() *MirroringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Node) DeepCopyInto(out *Node) {
 	*out = *in
@@ -397,8 +719,8 @@ func (in *ObjectStoreList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectStoreSpec) DeepCopyInto(out *ObjectStoreSpec) {
 	*out = *in
-	out.MetadataPool = in.MetadataPool
-	out.DataPool = in.DataPool
+	in.MetadataPool.DeepCopyInto(&out.MetadataPool)
+	in.DataPool.DeepCopyInto(&out.DataPool)
 	in.Gateway.DeepCopyInto(&out.Gateway)
 	return
 }
@@ -447,6 +769,38 @@ func (in *ObjectstoreList) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDRecoveryPolicy) DeepCopyInto(out *OSDRecoveryPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDRecoveryPolicy.
+func (in *OSDRecoveryPolicy) DeepCopy() *OSDRecoveryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDRecoveryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDWeightSpec) DeepCopyInto(out *OSDWeightSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDWeightSpec.
+func (in *OSDWeightSpec) DeepCopy() *OSDWeightSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDWeightSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Placement) DeepCopyInto(out *Placement) {
 	*out = *in
@@ -516,6 +870,7 @@ func (in *PlacementSpec) DeepCopyInto(out *PlacementSpec) {
 	in.Mgr.DeepCopyInto(&out.Mgr)
 	in.Mon.DeepCopyInto(&out.Mon)
 	in.OSD.DeepCopyInto(&out.OSD)
+	in.RBDMirror.DeepCopyInto(&out.RBDMirror)
 	return
 }
 
@@ -543,7 +898,8 @@ func (in *Pool) DeepCopyInto(out *Pool) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -605,6 +961,16 @@ func (in *PoolSpec) DeepCopyInto(out *PoolSpec) {
 	*out = *in
 	out.Replicated = in.Replicated
 	out.ErasureCoded = in.ErasureCoded
+	out.Quotas = in.Quotas
+	out.Compression = in.Compression
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Mirroring.DeepCopyInto(&out.Mirroring)
 	return
 }
 
@@ -618,6 +984,63 @@ func (in *PoolSpec) DeepCopy() *PoolSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolStatus) DeepCopyInto(out *PoolStatus) {
+	*out = *in
+	if in.Mirroring != nil {
+		in, out := &in.Mirroring, &out.Mirroring
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(MirroringStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolStatus.
+func (in *PoolStatus) DeepCopy() *PoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuotaSpec) DeepCopyInto(out *QuotaSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaSpec.
+func (in *QuotaSpec) DeepCopy() *QuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBDMirroringSpec) DeepCopyInto(out *RBDMirroringSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBDMirroringSpec.
+func (in *RBDMirroringSpec) DeepCopy() *RBDMirroringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RBDMirroringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReplicatedSpec) DeepCopyInto(out *ReplicatedSpec) {
 	*out = *in
@@ -641,6 +1064,7 @@ func (in *ResourceSpec) DeepCopyInto(out *ResourceSpec) {
 	in.Mgr.DeepCopyInto(&out.Mgr)
 	in.Mon.DeepCopyInto(&out.Mon)
 	in.OSD.DeepCopyInto(&out.OSD)
+	in.RBDMirror.DeepCopyInto(&out.RBDMirror)
 	return
 }
 
@@ -694,6 +1118,16 @@ func (in *StorageSpec) DeepCopyInto(out *StorageSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.VolumeClaimSets != nil {
+		in, out := &in.VolumeClaimSets, &out.VolumeClaimSets
+		*out = make([]VolumeClaimSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.DeviceHealth = in.DeviceHealth
+	out.RecoveryPolicy = in.RecoveryPolicy
+	in.Topology.DeepCopyInto(&out.Topology)
 	in.Selection.DeepCopyInto(&out.Selection)
 	out.Config = in.Config
 	return
@@ -725,6 +1159,55 @@ func (in *StoreConfig) DeepCopy() *StoreConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StoreMigrationStatus) DeepCopyInto(out *StoreMigrationStatus) {
+	*out = *in
+	if in.Completed != nil {
+		in, out := &in.Completed, &out.Completed
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.Pending != nil {
+		in, out := &in.Pending, &out.Pending
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StoreMigrationStatus.
+func (in *StoreMigrationStatus) DeepCopy() *StoreMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StoreMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologySpec) DeepCopyInto(out *TopologySpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologySpec.
+func (in *TopologySpec) DeepCopy() *TopologySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VolumeAttachment) DeepCopyInto(out *VolumeAttachment) {
 	*out = *in
@@ -735,6 +1218,13 @@ func (in *VolumeAttachment) DeepCopyInto(out *VolumeAttachment) {
 		*out = make([]Attachment, len(*in))
 		copy(*out, *in)
 	}
+	if in.FencedClients != nil {
+		in, out := &in.FencedClients, &out.FencedClients
+		*out = make([]FencedClient, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -790,3 +1280,117 @@ func (in *VolumeAttachmentList) DeepCopyObject() runtime.Object {
 		return nil
 	}
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeClaimSet) DeepCopyInto(out *VolumeClaimSet) {
+	*out = *in
+	in.VolumeClaimTemplate.DeepCopyInto(&out.VolumeClaimTemplate)
+	in.Resources.DeepCopyInto(&out.Resources)
+	out.Config = in.Config
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeClaimSet.
+func (in *VolumeClaimSet) DeepCopy() *VolumeClaimSet {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeClaimSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSnapshot) DeepCopyInto(out *VolumeSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSnapshot.
+func (in *VolumeSnapshot) DeepCopy() *VolumeSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VolumeSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSnapshotList) DeepCopyInto(out *VolumeSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VolumeSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSnapshotList.
+func (in *VolumeSnapshotList) DeepCopy() *VolumeSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VolumeSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSnapshotSpec) DeepCopyInto(out *VolumeSnapshotSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSnapshotSpec.
+func (in *VolumeSnapshotSpec) DeepCopy() *VolumeSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSnapshotStatus) DeepCopyInto(out *VolumeSnapshotStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSnapshotStatus.
+func (in *VolumeSnapshotStatus) DeepCopy() *VolumeSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
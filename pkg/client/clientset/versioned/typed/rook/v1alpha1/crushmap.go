@@ -0,0 +1,155 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	scheme "github.com/rook/rook/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// CrushMapsGetter has a method to return a CrushMapInterface.
+// A group's client should implement this interface.
+type CrushMapsGetter interface {
+	CrushMaps(namespace string) CrushMapInterface
+}
+
+// CrushMapInterface has methods to work with CrushMap resources.
+type CrushMapInterface interface {
+	Create(*v1alpha1.CrushMap) (*v1alpha1.CrushMap, error)
+	Update(*v1alpha1.CrushMap) (*v1alpha1.CrushMap, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.CrushMap, error)
+	List(opts v1.ListOptions) (*v1alpha1.CrushMapList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CrushMap, err error)
+	CrushMapExpansion
+}
+
+// crushMaps implements CrushMapInterface
+type crushMaps struct {
+	client rest.Interface
+	ns     string
+}
+
+// newCrushMaps returns a CrushMaps
+func newCrushMaps(c *RookV1alpha1Client, namespace string) *crushMaps {
+	return &crushMaps{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the crushMap, and returns the corresponding crushMap object, and an error if there is any.
+func (c *crushMaps) Get(name string, options v1.GetOptions) (result *v1alpha1.CrushMap, err error) {
+	result = &v1alpha1.CrushMap{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of CrushMaps that match those selectors.
+func (c *crushMaps) List(opts v1.ListOptions) (result *v1alpha1.CrushMapList, err error) {
+	result = &v1alpha1.CrushMapList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested crushMaps.
+func (c *crushMaps) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a crushMap and creates it.  Returns the server's representation of the crushMap, and an error, if there is any.
+func (c *crushMaps) Create(crushMap *v1alpha1.CrushMap) (result *v1alpha1.CrushMap, err error) {
+	result = &v1alpha1.CrushMap{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		Body(crushMap).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a crushMap and updates it. Returns the server's representation of the crushMap, and an error, if there is any.
+func (c *crushMaps) Update(crushMap *v1alpha1.CrushMap) (result *v1alpha1.CrushMap, err error) {
+	result = &v1alpha1.CrushMap{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		Name(crushMap.Name).
+		Body(crushMap).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the crushMap and deletes it. Returns an error if one occurs.
+func (c *crushMaps) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *crushMaps) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("crushmaps").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched crushMap.
+func (c *crushMaps) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CrushMap, err error) {
+	result = &v1alpha1.CrushMap{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("crushmaps").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	v1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeCrushMaps implements CrushMapInterface
+type FakeCrushMaps struct {
+	Fake *FakeRookV1alpha1
+	ns   string
+}
+
+var crushmapsResource = schema.GroupVersionResource{Group: "rook.io", Version: "v1alpha1", Resource: "crushmaps"}
+
+var crushmapsKind = schema.GroupVersionKind{Group: "rook.io", Version: "v1alpha1", Kind: "CrushMap"}
+
+// Get takes name of the crushMap, and returns the corresponding crushMap object, and an error if there is any.
+func (c *FakeCrushMaps) Get(name string, options v1.GetOptions) (result *v1alpha1.CrushMap, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(crushmapsResource, c.ns, name), &v1alpha1.CrushMap{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CrushMap), err
+}
+
+// List takes label and field selectors, and returns the list of CrushMaps that match those selectors.
+func (c *FakeCrushMaps) List(opts v1.ListOptions) (result *v1alpha1.CrushMapList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(crushmapsResource, crushmapsKind, c.ns, opts), &v1alpha1.CrushMapList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.CrushMapList{}
+	for _, item := range obj.(*v1alpha1.CrushMapList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested crushMaps.
+func (c *FakeCrushMaps) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(crushmapsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a crushMap and creates it.  Returns the server's representation of the crushMap, and an error, if there is any.
+func (c *FakeCrushMaps) Create(crushMap *v1alpha1.CrushMap) (result *v1alpha1.CrushMap, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(crushmapsResource, c.ns, crushMap), &v1alpha1.CrushMap{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CrushMap), err
+}
+
+// Update takes the representation of a crushMap and updates it. Returns the server's representation of the crushMap, and an error, if there is any.
+func (c *FakeCrushMaps) Update(crushMap *v1alpha1.CrushMap) (result *v1alpha1.CrushMap, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(crushmapsResource, c.ns, crushMap), &v1alpha1.CrushMap{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CrushMap), err
+}
+
+// Delete takes name of the crushMap and deletes it. Returns an error if one occurs.
+func (c *FakeCrushMaps) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(crushmapsResource, c.ns, name), &v1alpha1.CrushMap{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeCrushMaps) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(crushmapsResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.CrushMapList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched crushMap.
+func (c *FakeCrushMaps) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CrushMap, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(crushmapsResource, c.ns, name, data, subresources...), &v1alpha1.CrushMap{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CrushMap), err
+}
@@ -30,6 +30,10 @@ func (c *FakeRookV1alpha1) Clusters(namespace string) v1alpha1.ClusterInterface
 	return &FakeClusters{c, namespace}
 }
 
+func (c *FakeRookV1alpha1) CrushMaps(namespace string) v1alpha1.CrushMapInterface {
+	return &FakeCrushMaps{c, namespace}
+}
+
 func (c *FakeRookV1alpha1) Filesystems(namespace string) v1alpha1.FilesystemInterface {
 	return &FakeFilesystems{c, namespace}
 }
@@ -46,6 +50,10 @@ func (c *FakeRookV1alpha1) VolumeAttachments(namespace string) v1alpha1.VolumeAt
 	return &FakeVolumeAttachments{c, namespace}
 }
 
+func (c *FakeRookV1alpha1) VolumeSnapshots(namespace string) v1alpha1.VolumeSnapshotInterface {
+	return &FakeVolumeSnapshots{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeRookV1alpha1) RESTClient() rest.Interface {
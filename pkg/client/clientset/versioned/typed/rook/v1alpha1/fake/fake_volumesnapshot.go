@@ -0,0 +1,126 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	v1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeVolumeSnapshots implements VolumeSnapshotInterface
+type FakeVolumeSnapshots struct {
+	Fake *FakeRookV1alpha1
+	ns   string
+}
+
+var volumesnapshotsResource = schema.GroupVersionResource{Group: "rook.io", Version: "v1alpha1", Resource: "volumesnapshots"}
+
+var volumesnapshotsKind = schema.GroupVersionKind{Group: "rook.io", Version: "v1alpha1", Kind: "VolumeSnapshot"}
+
+// Get takes name of the volumeSnapshot, and returns the corresponding volumeSnapshot object, and an error if there is any.
+func (c *FakeVolumeSnapshots) Get(name string, options v1.GetOptions) (result *v1alpha1.VolumeSnapshot, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(volumesnapshotsResource, c.ns, name), &v1alpha1.VolumeSnapshot{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VolumeSnapshot), err
+}
+
+// List takes label and field selectors, and returns the list of VolumeSnapshots that match those selectors.
+func (c *FakeVolumeSnapshots) List(opts v1.ListOptions) (result *v1alpha1.VolumeSnapshotList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(volumesnapshotsResource, volumesnapshotsKind, c.ns, opts), &v1alpha1.VolumeSnapshotList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.VolumeSnapshotList{}
+	for _, item := range obj.(*v1alpha1.VolumeSnapshotList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested volumeSnapshots.
+func (c *FakeVolumeSnapshots) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(volumesnapshotsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a volumeSnapshot and creates it.  Returns the server's representation of the volumeSnapshot, and an error, if there is any.
+func (c *FakeVolumeSnapshots) Create(volumeSnapshot *v1alpha1.VolumeSnapshot) (result *v1alpha1.VolumeSnapshot, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(volumesnapshotsResource, c.ns, volumeSnapshot), &v1alpha1.VolumeSnapshot{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VolumeSnapshot), err
+}
+
+// Update takes the representation of a volumeSnapshot and updates it. Returns the server's representation of the volumeSnapshot, and an error, if there is any.
+func (c *FakeVolumeSnapshots) Update(volumeSnapshot *v1alpha1.VolumeSnapshot) (result *v1alpha1.VolumeSnapshot, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(volumesnapshotsResource, c.ns, volumeSnapshot), &v1alpha1.VolumeSnapshot{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VolumeSnapshot), err
+}
+
+// Delete takes name of the volumeSnapshot and deletes it. Returns an error if one occurs.
+func (c *FakeVolumeSnapshots) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(volumesnapshotsResource, c.ns, name), &v1alpha1.VolumeSnapshot{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeVolumeSnapshots) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(volumesnapshotsResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.VolumeSnapshotList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched volumeSnapshot.
+func (c *FakeVolumeSnapshots) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.VolumeSnapshot, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(volumesnapshotsResource, c.ns, name, data, subresources...), &v1alpha1.VolumeSnapshot{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VolumeSnapshot), err
+}
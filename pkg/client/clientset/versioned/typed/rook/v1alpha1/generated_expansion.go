@@ -18,6 +18,8 @@ package v1alpha1
 
 type ClusterExpansion interface{}
 
+type CrushMapExpansion interface{}
+
 type FilesystemExpansion interface{}
 
 type ObjectStoreExpansion interface{}
@@ -25,3 +27,5 @@ type ObjectStoreExpansion interface{}
 type PoolExpansion interface{}
 
 type VolumeAttachmentExpansion interface{}
+
+type VolumeSnapshotExpansion interface{}
@@ -26,10 +26,12 @@ import (
 type RookV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ClustersGetter
+	CrushMapsGetter
 	FilesystemsGetter
 	ObjectStoresGetter
 	PoolsGetter
 	VolumeAttachmentsGetter
+	VolumeSnapshotsGetter
 }
 
 // RookV1alpha1Client is used to interact with features provided by the rook.io group.
@@ -41,6 +43,10 @@ func (c *RookV1alpha1Client) Clusters(namespace string) ClusterInterface {
 	return newClusters(c, namespace)
 }
 
+func (c *RookV1alpha1Client) CrushMaps(namespace string) CrushMapInterface {
+	return newCrushMaps(c, namespace)
+}
+
 func (c *RookV1alpha1Client) Filesystems(namespace string) FilesystemInterface {
 	return newFilesystems(c, namespace)
 }
@@ -57,6 +63,10 @@ func (c *RookV1alpha1Client) VolumeAttachments(namespace string) VolumeAttachmen
 	return newVolumeAttachments(c, namespace)
 }
 
+func (c *RookV1alpha1Client) VolumeSnapshots(namespace string) VolumeSnapshotInterface {
+	return newVolumeSnapshots(c, namespace)
+}
+
 // NewForConfig creates a new RookV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*RookV1alpha1Client, error) {
 	config := *c
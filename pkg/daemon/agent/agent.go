@@ -26,9 +26,11 @@ import (
 	"github.com/coreos/pkg/capnslog"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/agent/cluster"
+	"github.com/rook/rook/pkg/daemon/agent/csi"
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume/manager/ceph"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/api/core/v1"
 )
 
@@ -37,11 +39,13 @@ var logger = capnslog.NewPackageLogger("github.com/rook/rook", "rook-agent")
 // Agent represent all the references needed to manage a Rook agent
 type Agent struct {
 	context *clusterd.Context
+	// the endpoint of the node service of the CSI driver, which is not served if the endpoint is empty
+	csiEndpoint string
 }
 
 // New creates an Agent instance
-func New(context *clusterd.Context) *Agent {
-	return &Agent{context: context}
+func New(context *clusterd.Context, csiEndpoint string) *Agent {
+	return &Agent{context: context, csiEndpoint: csiEndpoint}
 }
 
 // Run the agent
@@ -64,6 +68,16 @@ func (a *Agent) Run() error {
 
 	flexvolumeServer.Start()
 
+	// serve the node service of the CSI driver with the same volume manager as the flex driver
+	var csiDriver *csi.Driver
+	if a.csiEndpoint != "" {
+		csiDriver = csi.NewDriver(a.csiEndpoint)
+		nodeServer := csi.NewNodeServer(os.Getenv(k8sutil.NodeNameEnvVar), flexvolumeController)
+		if err := csiDriver.Start(csi.NewIdentityServer(false), nil, nodeServer); err != nil {
+			return fmt.Errorf("failed to start the CSI driver: %+v", err)
+		}
+	}
+
 	// create a cluster controller and tell it to start watching for changes to clusters
 	clusterController := cluster.NewClusterController(
 		a.context,
@@ -73,6 +87,14 @@ func (a *Agent) Run() error {
 	stopChan := make(chan struct{})
 	clusterController.StartWatch(v1.NamespaceAll, stopChan)
 
+	// grow the filesystems of the attached volumes when they are expanded
+	expandController := flexvolume.NewExpandController(flexvolumeController)
+	go expandController.Run(stopChan)
+
+	// clean up the attachments and devices left behind by pods that were force deleted
+	garbageCollector := flexvolume.NewGarbageCollector(flexvolumeController)
+	go garbageCollector.Run(stopChan)
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGTERM)
 	for {
@@ -80,6 +102,9 @@ func (a *Agent) Run() error {
 		case <-sigc:
 			logger.Infof("shutdown signal received, exiting...")
 			flexvolumeServer.Stop()
+			if csiDriver != nil {
+				csiDriver.Stop()
+			}
 			close(stopChan)
 			return nil
 		}
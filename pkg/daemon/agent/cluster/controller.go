@@ -97,7 +97,8 @@ func (c *ClusterController) handleClusterDelete(cluster *rookalpha.Cluster, retr
 	// find volume attachments in the deleted cluster that are attached to this node
 	for _, vol := range vols.Items {
 		for _, a := range vol.Attachments {
-			if a.Node == node && a.ClusterName == cluster.Namespace {
+			// the attachments of the CSI driver have no mount dir and are detached by Kubernetes through the driver
+			if a.Node == node && a.ClusterName == cluster.Namespace && a.MountDir != "" {
 				logger.Infof("volume %s has an attachment belonging to deleted cluster %s, will clean it up now. mountDir: %s",
 					vol.Name, cluster.Namespace, a.MountDir)
 
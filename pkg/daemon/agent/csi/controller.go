@@ -0,0 +1,322 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"fmt"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/mon"
+	"github.com/rook/rook/pkg/operator/provisioner"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// the size of the volumes that do not request a size
+	defaultVolumeSize = int64(1024 * 1024 * 1024)
+	// rbd creates images with a size in MB
+	imageSizeUnit = int64(1024 * 1024)
+)
+
+// writeConnectionConfig writes the config and admin keyring of a cluster to the config dir so that the rbd commands
+// can connect to the cluster
+var writeConnectionConfig = func(context *clusterd.Context, clusterName string) error {
+	clusterInfo, _, _, err := mon.LoadClusterInfo(context, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to load the info of cluster %s. %+v", clusterName, err)
+	}
+	return mon.WriteConnectionConfig(context, clusterInfo)
+}
+
+// ControllerServer creates and deletes the images of the rook block volumes, and records the nodes they are attached to
+// in their VolumeAttachment CRDs with the same rules as the flex driver, so that a read-write volume is only attached to
+// one node at a time no matter which driver attached it.
+type ControllerServer struct {
+	context          *clusterd.Context
+	volumeAttachment attachment.Attachment
+	// the namespace of the VolumeAttachment CRDs, which is the namespace of the agents
+	namespace string
+}
+
+// NewControllerServer creates the controller service of the driver
+func NewControllerServer(context *clusterd.Context, volumeAttachment attachment.Attachment, namespace string) *ControllerServer {
+	return &ControllerServer{
+		context:          context,
+		volumeAttachment: volumeAttachment,
+		namespace:        namespace,
+	}
+}
+
+// CreateVolume creates the image of a block volume with the parameters of its storage class, which are the parameters
+// of the rook.io/block provisioner. An image that was already created for the volume is returned as is.
+func (s *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	name := req.GetName()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume name is missing")
+	}
+	for _, capability := range req.GetVolumeCapabilities() {
+		if err := validateCapability(capability); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid capability for volume %s. %+v", name, err)
+		}
+	}
+
+	options, err := provisioner.BlockImageOptions(req.GetParameters(), name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters for volume %s. %+v", name, err)
+	}
+	clusterName := options[flexvolume.ClusterNameKey]
+	pool := options[flexvolume.PoolKey]
+
+	size := req.GetCapacityRange().GetRequiredBytes()
+	if size == 0 {
+		size = defaultVolumeSize
+	}
+	// round up to the size of the image that rbd creates
+	size = (size + imageSizeUnit - 1) / imageSizeUnit * imageSizeUnit
+	if limit := req.GetCapacityRange().GetLimitBytes(); limit != 0 && size > limit {
+		return nil, status.Errorf(codes.OutOfRange, "volume %s of %d bytes exceeds the limit of %d bytes", name, size, limit)
+	}
+
+	if err := writeConnectionConfig(s.context, clusterName); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	image, err := getImage(s.context, clusterName, pool, name)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if image != nil {
+		if image.Size < uint64(size) {
+			return nil, status.Errorf(codes.AlreadyExists, "volume %s already exists with %d bytes", name, image.Size)
+		}
+		logger.Infof("volume %s already exists in pool %s", name, pool)
+		size = int64(image.Size)
+	} else {
+		if err := provisioner.CreateBlockImage(s.context, req.GetParameters(), name, size); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create volume %s. %+v", name, err)
+		}
+		logger.Infof("created volume %s in pool %s of cluster %s", name, pool, clusterName)
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			Id:            volumeID(clusterName, pool, name),
+			CapacityBytes: size,
+			Attributes:    options,
+		},
+	}, nil
+}
+
+// DeleteVolume deletes the image of a block volume. A volume that does not exist is already deleted.
+func (s *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is missing")
+	}
+	clusterName, pool, name, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		// the volume was not created by this driver
+		logger.Warningf("not deleting volume %s. %+v", req.GetVolumeId(), err)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if err := writeConnectionConfig(s.context, clusterName); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	image, err := getImage(s.context, clusterName, pool, name)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if image == nil {
+		logger.Infof("volume %s is already deleted", req.GetVolumeId())
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if err := provisioner.DeleteBlockImage(s.context, clusterName, pool, name); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete volume %s. %+v", req.GetVolumeId(), err)
+	}
+	logger.Infof("deleted volume %s", req.GetVolumeId())
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// ControllerPublishVolume records the attachment of a volume to a node. A volume is attached read-write to only one
+// node, and is not attached read-only while it is attached read-write.
+func (s *ControllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	clusterName, _, name, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	node := req.GetNodeId()
+	if node == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "node id is missing to attach volume %s", name)
+	}
+	if err := validateCapability(req.GetVolumeCapability()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid capability to attach volume %s. %+v", name, err)
+	}
+	readOnly := req.GetReadonly() || isReadOnly(req.GetVolumeCapability())
+
+	volumeAttachment, err := s.volumeAttachment.Get(s.namespace, name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, status.Errorf(codes.Internal, "failed to get volume CRD %s. %+v", name, err)
+		}
+		// the attachments of the CSI driver are recorded for the node, without a pod and mount dir
+		volumeAttachment = rookalpha.NewVolumeAttachment(name, s.namespace, node, "", "", clusterName, "", readOnly)
+		if err := s.volumeAttachment.Create(volumeAttachment); err != nil {
+			if errors.IsAlreadyExists(err) {
+				return nil, status.Errorf(codes.Aborted, "volume %s is being attached by another request", name)
+			}
+			return nil, status.Errorf(codes.Internal, "failed to create volume CRD %s. %+v", name, err)
+		}
+		logger.Infof("attached volume %s to node %s", name, node)
+		return &csi.ControllerPublishVolumeResponse{}, nil
+	}
+
+	for _, a := range volumeAttachment.Attachments {
+		if a.Node == node && a.MountDir == "" {
+			logger.Infof("volume %s is already attached to node %s", name, node)
+			return &csi.ControllerPublishVolumeResponse{}, nil
+		}
+	}
+	for _, a := range volumeAttachment.Attachments {
+		if !a.ReadOnly || !readOnly {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %s is already attached to node %s", name, a.Node)
+		}
+	}
+
+	volumeAttachment.Attachments = append(volumeAttachment.Attachments, rookalpha.Attachment{
+		Node:        node,
+		ClusterName: clusterName,
+		ReadOnly:    readOnly,
+	})
+	if err := s.volumeAttachment.Update(volumeAttachment); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update volume CRD %s. %+v", name, err)
+	}
+	logger.Infof("attached volume %s to node %s", name, node)
+	return &csi.ControllerPublishVolumeResponse{}, nil
+}
+
+// ControllerUnpublishVolume removes the attachment of a volume to a node
+func (s *ControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	_, _, name, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	node := req.GetNodeId()
+
+	volumeAttachment, err := s.volumeAttachment.Get(s.namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get volume CRD %s. %+v", name, err)
+	}
+
+	// the volume is detached from all the nodes if the node is not set
+	attachments := []rookalpha.Attachment{}
+	for _, a := range volumeAttachment.Attachments {
+		if a.MountDir == "" && (node == "" || a.Node == node) {
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	if len(attachments) == len(volumeAttachment.Attachments) {
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	if len(attachments) == 0 {
+		err = s.volumeAttachment.Delete(s.namespace, name)
+	} else {
+		volumeAttachment.Attachments = attachments
+		err = s.volumeAttachment.Update(volumeAttachment)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove the attachment of volume %s to node %s. %+v", name, node, err)
+	}
+	logger.Infof("detached volume %s from node %s", name, node)
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+// ValidateVolumeCapabilities returns whether a volume can be used with all the capabilities
+func (s *ControllerServer) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	clusterName, pool, name, err := parseVolumeID(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := writeConnectionConfig(s.context, clusterName); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	image, err := getImage(s.context, clusterName, pool, name)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if image == nil {
+		return nil, status.Errorf(codes.NotFound, "volume %s does not exist", req.GetVolumeId())
+	}
+
+	for _, capability := range req.GetVolumeCapabilities() {
+		if err := validateCapability(capability); err != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Supported: false, Message: err.Error()}, nil
+		}
+	}
+	return &csi.ValidateVolumeCapabilitiesResponse{Supported: true}, nil
+}
+
+// ListVolumes is not supported
+func (s *ControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// GetCapacity is not supported
+func (s *ControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// ControllerGetCapabilities returns that the driver creates and deletes volumes, and attaches and detaches them
+func (s *ControllerServer) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+	capabilities := []*csi.ControllerServiceCapability{}
+	for _, rpc := range []csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+	} {
+		capabilities = append(capabilities, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{Type: rpc},
+			},
+		})
+	}
+	return &csi.ControllerGetCapabilitiesResponse{Capabilities: capabilities}, nil
+}
+
+// getImage returns the image of a volume, or nil if the image does not exist
+func getImage(context *clusterd.Context, clusterName, pool, name string) (*ceph.CephBlockImage, error) {
+	images, err := ceph.ListImages(context, clusterName, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the images of pool %s. %+v", pool, err)
+	}
+	for i := range images {
+		if images[i].Name == name {
+			return &images[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"testing"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func errorCode(err error) codes.Code {
+	s, _ := status.FromError(err)
+	return s.Code()
+}
+
+func mountCapability(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+	}
+}
+
+func TestCreateDeleteVolume(t *testing.T) {
+	writeConnectionConfig = func(context *clusterd.Context, clusterName string) error {
+		assert.Equal(t, "rook", clusterName)
+		return nil
+	}
+
+	images := "[]"
+	created := []string{}
+	deleted := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "rbd", command)
+			switch args[0] {
+			case "ls":
+				return images, nil
+			case "create":
+				created = append(created, args[1])
+				images = `[{"image":"pvc-1","size":1048576,"format":2}]`
+			case "rm":
+				deleted = append(deleted, args[1])
+				images = "[]"
+			case "snap":
+				return "[]", nil
+			}
+			return "", nil
+		},
+	}
+	s := NewControllerServer(&clusterd.Context{Clientset: test.New(3), Executor: executor}, &attachment.MockAttachment{}, "rook-system")
+	ctx := context.Background()
+
+	// the size is rounded up to the MB of the image
+	req := &csi.CreateVolumeRequest{
+		Name:               "pvc-1",
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 1000},
+		VolumeCapabilities: []*csi.VolumeCapability{mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)},
+		Parameters:         map[string]string{"pool": "replicapool", "mounter": "rbd-nbd"},
+	}
+	resp, err := s.CreateVolume(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "rook/replicapool/pvc-1", resp.Volume.Id)
+	assert.Equal(t, int64(1048576), resp.Volume.CapacityBytes)
+	assert.Equal(t, "replicapool", resp.Volume.Attributes["pool"])
+	assert.Equal(t, "rbd-nbd", resp.Volume.Attributes["mounter"])
+	assert.Equal(t, []string{"replicapool/pvc-1"}, created)
+
+	// the image that was already created is returned
+	resp, err = s.CreateVolume(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "rook/replicapool/pvc-1", resp.Volume.Id)
+	assert.Equal(t, 1, len(created))
+
+	// a larger volume with the name of an existing volume cannot be created
+	req.CapacityRange.RequiredBytes = 2 * 1048576
+	_, err = s.CreateVolume(ctx, req)
+	assert.Equal(t, codes.AlreadyExists, errorCode(err))
+
+	// block volumes cannot be written by multiple nodes
+	req.VolumeCapabilities = []*csi.VolumeCapability{mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER)}
+	_, err = s.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, errorCode(err))
+
+	// the parameters of the block provisioner are validated
+	req.VolumeCapabilities = nil
+	req.Parameters = map[string]string{"pool": "replicapool", "foo": "bar"}
+	_, err = s.CreateVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, errorCode(err))
+
+	// the image is deleted from the pool and cluster of the volume id
+	_, err = s.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "rook/replicapool/pvc-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"replicapool/pvc-1"}, deleted)
+
+	// a volume that is already deleted is not deleted again
+	_, err = s.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "rook/replicapool/pvc-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deleted))
+}
+
+func TestPublishVolume(t *testing.T) {
+	attachments := map[string]*rookalpha.VolumeAttachment{}
+	volumeAttachment := &attachment.MockAttachment{
+		MockGet: func(namespace, name string) (*rookalpha.VolumeAttachment, error) {
+			assert.Equal(t, "rook-system", namespace)
+			if a, ok := attachments[name]; ok {
+				return a.DeepCopy(), nil
+			}
+			return nil, errors.NewNotFound(schema.GroupResource{}, name)
+		},
+		MockCreate: func(volumeAttachment *rookalpha.VolumeAttachment) error {
+			attachments[volumeAttachment.Name] = volumeAttachment
+			return nil
+		},
+		MockUpdate: func(volumeAttachment *rookalpha.VolumeAttachment) error {
+			attachments[volumeAttachment.Name] = volumeAttachment
+			return nil
+		},
+		MockDelete: func(namespace, name string) error {
+			delete(attachments, name)
+			return nil
+		},
+	}
+	s := NewControllerServer(&clusterd.Context{}, volumeAttachment, "rook-system")
+	ctx := context.Background()
+	publish := func(node string, mode csi.VolumeCapability_AccessMode_Mode) error {
+		_, err := s.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+			VolumeId:         "rook/replicapool/pvc-1",
+			NodeId:           node,
+			VolumeCapability: mountCapability(mode),
+		})
+		return err
+	}
+	unpublish := func(node string) error {
+		_, err := s.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+			VolumeId: "rook/replicapool/pvc-1",
+			NodeId:   node,
+		})
+		return err
+	}
+
+	// a read-write volume is attached to a single node
+	assert.Nil(t, publish("node1", csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+	assert.Nil(t, publish("node1", csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+	assert.Equal(t, 1, len(attachments["pvc-1"].Attachments))
+	assert.Equal(t, rookalpha.Attachment{Node: "node1", ClusterName: "rook"}, attachments["pvc-1"].Attachments[0])
+	err := publish("node2", csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	assert.Equal(t, codes.FailedPrecondition, errorCode(err))
+	err = publish("node2", csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY)
+	assert.Equal(t, codes.FailedPrecondition, errorCode(err))
+
+	// the volume attachment is deleted with the last attachment
+	assert.Nil(t, unpublish("node1"))
+	assert.Equal(t, 0, len(attachments))
+	assert.Nil(t, unpublish("node1"))
+
+	// a read-only volume is attached to multiple nodes, but not read-write at the same time
+	assert.Nil(t, publish("node1", csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY))
+	assert.Nil(t, publish("node2", csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY))
+	assert.Equal(t, 2, len(attachments["pvc-1"].Attachments))
+	err = publish("node3", csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	assert.Equal(t, codes.FailedPrecondition, errorCode(err))
+
+	// the attachments of the flex driver are not removed
+	attachments["pvc-1"].Attachments = append(attachments["pvc-1"].Attachments,
+		rookalpha.Attachment{Node: "node1", PodNamespace: "default", PodName: "pod1", MountDir: "/var/lib/kubelet/pods/pod1/volumes/rook.io~rook/pvc-1", ReadOnly: true})
+	assert.Nil(t, unpublish("node1"))
+	assert.Nil(t, unpublish("node2"))
+	assert.Equal(t, 1, len(attachments["pvc-1"].Attachments))
+	assert.Equal(t, "pod1", attachments["pvc-1"].Attachments[0].PodName)
+
+	// the volume id records the cluster, pool and image
+	err = publish("node1", csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	assert.Equal(t, codes.FailedPrecondition, errorCode(err))
+	_, err = s.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "pvc-1",
+		NodeId:           "node1",
+		VolumeCapability: mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+	})
+	assert.Equal(t, codes.InvalidArgument, errorCode(err))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package csi implements a Container Storage Interface driver for rook block volumes.
+package csi
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/coreos/pkg/capnslog"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DriverName is the name of the rook CSI driver for block volumes
+	DriverName = "rbd.csi.rook.io"
+	// SocketFile is the name of the unix socket the driver listens on
+	SocketFile = "csi.sock"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "csi")
+
+// Driver serves the CSI services of the rook block volumes on a unix socket. The controller service is served in the
+// CSI controller deployment next to the external provisioner and attacher, and the node service is served by the
+// agents next to the driver registrar.
+type Driver struct {
+	endpoint string
+	server   *grpc.Server
+}
+
+// NewDriver creates a driver that listens on the endpoint, such as unix:///csi/csi.sock
+func NewDriver(endpoint string) *Driver {
+	return &Driver{endpoint: endpoint}
+}
+
+// Start serves the identity service and the controller or node service. The services that are nil are not served.
+func (d *Driver) Start(identity csi.IdentityServer, controller csi.ControllerServer, node csi.NodeServer) error {
+	socketPath, err := parseEndpoint(d.endpoint)
+	if err != nil {
+		return err
+	}
+
+	// remove the socket that was left behind by the previous driver
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the socket %s. %+v", socketPath, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0750); err != nil {
+		return fmt.Errorf("failed to create the dir of the socket %s. %+v", socketPath, err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on the socket %s. %+v", socketPath, err)
+	}
+
+	d.server = grpc.NewServer()
+	csi.RegisterIdentityServer(d.server, identity)
+	if controller != nil {
+		csi.RegisterControllerServer(d.server, controller)
+	}
+	if node != nil {
+		csi.RegisterNodeServer(d.server, node)
+	}
+
+	go func() {
+		if err := d.server.Serve(listener); err != nil {
+			logger.Errorf("CSI driver %s stopped serving on %s. %+v", DriverName, socketPath, err)
+		}
+	}()
+	logger.Infof("CSI driver %s listening on %s", DriverName, socketPath)
+	return nil
+}
+
+// Stop stops serving the services of the driver
+func (d *Driver) Stop() {
+	if d.server != nil {
+		d.server.GracefulStop()
+	}
+}
+
+// parseEndpoint returns the path of the socket of a unix endpoint
+func parseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid CSI endpoint %s. %+v", endpoint, err)
+	}
+	if u.Scheme != "unix" {
+		return "", fmt.Errorf("invalid CSI endpoint %s. only unix sockets are supported", endpoint)
+	}
+	// the path of unix://csi.sock is in the host of the url
+	socketPath := u.Host + u.Path
+	if socketPath == "" {
+		return "", fmt.Errorf("invalid CSI endpoint %s. the socket path is missing", endpoint)
+	}
+	return socketPath, nil
+}
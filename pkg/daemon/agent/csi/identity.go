@@ -0,0 +1,60 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/rook/rook/pkg/version"
+	"golang.org/x/net/context"
+)
+
+// IdentityServer returns the name and version of the driver and whether the driver serves the controller service
+type IdentityServer struct {
+	controller bool
+}
+
+// NewIdentityServer creates the identity service of a driver that serves the controller service or the node service
+func NewIdentityServer(controller bool) *IdentityServer {
+	return &IdentityServer{controller: controller}
+}
+
+// GetPluginInfo returns the name of the driver and the version of rook
+func (s *IdentityServer) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{
+		Name:          DriverName,
+		VendorVersion: version.Version,
+	}, nil
+}
+
+// GetPluginCapabilities returns whether the driver serves the controller service
+func (s *IdentityServer) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
+	capabilities := []*csi.PluginCapability{}
+	if s.controller {
+		capabilities = append(capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
+				},
+			},
+		})
+	}
+	return &csi.GetPluginCapabilitiesResponse{Capabilities: capabilities}, nil
+}
+
+// Probe returns that the driver is ready as soon as it serves its services
+func (s *IdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8smount "k8s.io/kubernetes/pkg/util/mount"
+)
+
+// the file system of the mounted volumes that do not request one
+const defaultFsType = "ext4"
+
+// NodeServer maps the images of the rook block volumes on the node with the volume manager of the agent. The mounted
+// volumes are formatted and mounted on their staging path and bind mounted to the pods, and the devices of the raw block
+// volumes are bind mounted to the pods.
+type NodeServer struct {
+	nodeID     string
+	controller *flexvolume.Controller
+	mounter    *k8smount.SafeFormatAndMount
+}
+
+// NewNodeServer creates the node service of the driver on a node
+func NewNodeServer(nodeID string, controller *flexvolume.Controller) *NodeServer {
+	return &NodeServer{
+		nodeID:     nodeID,
+		controller: controller,
+		mounter: &k8smount.SafeFormatAndMount{
+			Interface: k8smount.New("" /* default mount path */),
+			Exec:      k8smount.NewOsExec(),
+		},
+	}
+}
+
+// NodeStageVolume maps the image of a volume on the node, and formats and mounts a mounted volume on its staging path
+func (s *NodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	stagingPath := req.GetStagingTargetPath()
+	if stagingPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "staging path is missing")
+	}
+	capability := req.GetVolumeCapability()
+	if err := validateCapability(capability); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts, err := attachOptions(req.GetVolumeId(), req.GetVolumeAttributes())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	devicePath, err := s.controller.MapVolume(opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if capability.GetBlock() != nil {
+		// the device of a raw block volume is published to the pods without a file system
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	notMnt, err := s.mounter.IsLikelyNotMountPoint(stagingPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, status.Errorf(codes.Internal, "failed to check the staging path %s. %+v", stagingPath, err)
+		}
+		if err := os.MkdirAll(stagingPath, 0750); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create the staging path %s. %+v", stagingPath, err)
+		}
+		notMnt = true
+	}
+	if !notMnt {
+		logger.Infof("volume %s is already staged on %s", req.GetVolumeId(), stagingPath)
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	fsType := capability.GetMount().GetFsType()
+	if fsType == "" {
+		fsType = defaultFsType
+	}
+	options := capability.GetMount().GetMountFlags()
+	if isReadOnly(capability) {
+		options = append(options, "ro")
+	}
+	if err := s.mounter.FormatAndMount(devicePath, stagingPath, fsType, options); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to mount volume %s [%s] on %s. %+v", devicePath, fsType, stagingPath, err)
+	}
+	logger.Infof("staged volume %s of device %s on %s", req.GetVolumeId(), devicePath, stagingPath)
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+// NodeUnstageVolume unmounts a volume from its staging path and unmaps its image from the node
+func (s *NodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	stagingPath := req.GetStagingTargetPath()
+	if stagingPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "staging path is missing")
+	}
+	opts, err := attachOptions(req.GetVolumeId(), nil)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.unmount(stagingPath); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := s.controller.UnmapVolume(opts, false /* force */); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	logger.Infof("unstaged volume %s from %s", req.GetVolumeId(), stagingPath)
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume bind mounts the staging path of a mounted volume, or the device of a raw block volume, to the pod
+func (s *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	targetPath := req.GetTargetPath()
+	if targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is missing")
+	}
+	capability := req.GetVolumeCapability()
+	if err := validateCapability(capability); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts, err := attachOptions(req.GetVolumeId(), req.GetVolumeAttributes())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var source string
+	if capability.GetBlock() != nil {
+		// the image is already mapped when the volume was staged, so its device is returned
+		source, err = s.controller.MapVolume(opts)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		// the device is bind mounted on a file
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0750); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create the dir of the target path %s. %+v", targetPath, err)
+		}
+		file, err := os.OpenFile(targetPath, os.O_CREATE, 0640)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create the target path %s. %+v", targetPath, err)
+		}
+		file.Close()
+	} else {
+		source = req.GetStagingTargetPath()
+		if source == "" {
+			return nil, status.Error(codes.InvalidArgument, "staging path is missing")
+		}
+		if err := os.MkdirAll(targetPath, 0750); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create the target path %s. %+v", targetPath, err)
+		}
+	}
+
+	notMnt, err := s.mounter.IsLikelyNotMountPoint(targetPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check the target path %s. %+v", targetPath, err)
+	}
+	if !notMnt {
+		logger.Infof("volume %s is already published on %s", req.GetVolumeId(), targetPath)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	options := []string{"bind"}
+	if req.GetReadonly() || isReadOnly(capability) {
+		options = append(options, "ro")
+	}
+	if err := s.mounter.Mount(source, targetPath, "", options); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to mount %s on %s. %+v", source, targetPath, err)
+	}
+	logger.Infof("published volume %s on %s", req.GetVolumeId(), targetPath)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts a volume from the pod
+func (s *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	targetPath := req.GetTargetPath()
+	if targetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is missing")
+	}
+	if err := s.unmount(targetPath); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	logger.Infof("unpublished volume %s from %s", req.GetVolumeId(), targetPath)
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// NodeGetId returns the name of the node, which the volumes are attached to
+func (s *NodeServer) NodeGetId(ctx context.Context, req *csi.NodeGetIdRequest) (*csi.NodeGetIdResponse, error) {
+	return &csi.NodeGetIdResponse{NodeId: s.nodeID}, nil
+}
+
+// NodeGetCapabilities returns that the volumes are staged before they are published
+func (s *NodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// unmount unmounts a path if it is mounted and removes it
+func (s *NodeServer) unmount(mountPath string) error {
+	notMnt, err := s.mounter.IsLikelyNotMountPoint(mountPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to check the mount path %s. %+v", mountPath, err)
+	}
+	if !notMnt {
+		if err := s.mounter.Unmount(mountPath); err != nil {
+			return fmt.Errorf("failed to unmount %s. %+v", mountPath, err)
+		}
+	}
+	if err := os.Remove(mountPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the mount path %s. %+v", mountPath, err)
+	}
+	return nil
+}
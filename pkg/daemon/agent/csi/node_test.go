@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/manager"
+	"github.com/rook/rook/pkg/operator/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	k8smount "k8s.io/kubernetes/pkg/util/mount"
+)
+
+func newTestNodeServer(volumeManager *manager.FakeVolumeManager) (*NodeServer, *k8smount.FakeMounter) {
+	controller := flexvolume.NewController(&clusterd.Context{Clientset: test.New(3)}, &attachment.MockAttachment{}, volumeManager)
+	s := NewNodeServer("node1", controller)
+	mounter := &k8smount.FakeMounter{}
+	s.mounter = &k8smount.SafeFormatAndMount{
+		Interface: mounter,
+		Exec: k8smount.NewFakeExec(func(cmd string, args ...string) ([]byte, error) {
+			return nil, nil
+		}),
+	}
+	return s, mounter
+}
+
+func TestStagePublishVolume(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpDir)
+	stagingPath := path.Join(tmpDir, "globalmount")
+	targetPath := path.Join(tmpDir, "pods", "pod1", "mount")
+
+	detached := ""
+	volumeManager := &manager.FakeVolumeManager{
+		FakeAttach: func(image, pool, clusterName, mounter string) (string, error) {
+			assert.Equal(t, "rbd-nbd", mounter)
+			return "/dev/nbd0", nil
+		},
+		FakeDetach: func(image, pool, clusterName string, force bool) error {
+			detached = clusterName + "/" + pool + "/" + image
+			return nil
+		},
+	}
+	s, mounter := newTestNodeServer(volumeManager)
+	ctx := context.Background()
+	capability := mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+	attributes := map[string]string{"pool": "replicapool", "mounter": "rbd-nbd"}
+
+	// the device is formatted and mounted on the staging path
+	_, err := s.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          "rook/replicapool/pvc-1",
+		StagingTargetPath: stagingPath,
+		VolumeCapability:  capability,
+		VolumeAttributes:  attributes,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mounter.MountPoints))
+	assert.Equal(t, "/dev/nbd0", mounter.MountPoints[0].Device)
+	assert.Equal(t, stagingPath, mounter.MountPoints[0].Path)
+	assert.Equal(t, "ext4", mounter.MountPoints[0].Type)
+
+	// the staging path is bind mounted to the pod
+	_, err = s.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeId:          "rook/replicapool/pvc-1",
+		StagingTargetPath: stagingPath,
+		TargetPath:        targetPath,
+		VolumeCapability:  capability,
+		VolumeAttributes:  attributes,
+		Readonly:          true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mounter.MountPoints))
+	assert.Equal(t, stagingPath, mounter.MountPoints[1].Device)
+	assert.Equal(t, targetPath, mounter.MountPoints[1].Path)
+	assert.Equal(t, []string{"bind", "ro"}, mounter.MountPoints[1].Opts)
+
+	// the volume is unmounted from the pod and the staging path, and its image is unmapped
+	_, err = s.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: "rook/replicapool/pvc-1", TargetPath: targetPath})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mounter.MountPoints))
+	_, err = os.Stat(targetPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = s.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "rook/replicapool/pvc-1", StagingTargetPath: stagingPath})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mounter.MountPoints))
+	assert.Equal(t, "rook/replicapool/pvc-1", detached)
+}
+
+func TestPublishBlockVolume(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpDir)
+	stagingPath := path.Join(tmpDir, "globalmount")
+	targetPath := path.Join(tmpDir, "pods", "pod1", "block")
+
+	s, mounter := newTestNodeServer(&manager.FakeVolumeManager{})
+	ctx := context.Background()
+	capability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	// the device of a raw block volume is not formatted and mounted
+	_, err := s.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          "rook/replicapool/pvc-1",
+		StagingTargetPath: stagingPath,
+		VolumeCapability:  capability,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(mounter.MountPoints))
+
+	// the device is bind mounted on a file of the pod
+	_, err = s.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeId:          "rook/replicapool/pvc-1",
+		StagingTargetPath: stagingPath,
+		TargetPath:        targetPath,
+		VolumeCapability:  capability,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mounter.MountPoints))
+	assert.Equal(t, "/pvc-1/replicapool/rook", mounter.MountPoints[0].Device)
+	assert.Equal(t, targetPath, mounter.MountPoints[0].Path)
+	info, err := os.Stat(targetPath)
+	assert.Nil(t, err)
+	assert.False(t, info.IsDir())
+}
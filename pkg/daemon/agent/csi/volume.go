@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"fmt"
+	"strings"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+)
+
+// volumeID returns the ID of a block volume, which records the cluster, pool and image of the volume since the CSI
+// requests that delete and unpublish a volume only have its ID
+func volumeID(clusterName, pool, image string) string {
+	return strings.Join([]string{clusterName, pool, image}, "/")
+}
+
+// parseVolumeID returns the cluster, pool and image of a block volume from its ID
+func parseVolumeID(id string) (string, string, string, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid volume id %s. expected <cluster>/<pool>/<image>", id)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// attachOptions returns the options that a block volume is mapped with on the nodes from its ID and the attributes
+// that were returned when it was created
+func attachOptions(id string, attributes map[string]string) (flexvolume.AttachOptions, error) {
+	clusterName, pool, image, err := parseVolumeID(id)
+	if err != nil {
+		return flexvolume.AttachOptions{}, err
+	}
+	return flexvolume.AttachOptions{
+		ClusterName: clusterName,
+		Pool:        pool,
+		Image:       image,
+		VolumeName:  image,
+		Mounter:     attributes[flexvolume.MounterKey],
+		Encrypted:   attributes[flexvolume.EncryptedKey],
+	}, nil
+}
+
+// validateCapability returns an error if a volume cannot be used with a capability. The block volumes are raw block
+// or mounted volumes, and they can only be written by a single node.
+func validateCapability(capability *csi.VolumeCapability) error {
+	if capability == nil {
+		return fmt.Errorf("volume capability is missing")
+	}
+	if capability.GetBlock() == nil && capability.GetMount() == nil {
+		return fmt.Errorf("volume access type must be block or mount")
+	}
+	switch mode := capability.GetAccessMode().GetMode(); mode {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return nil
+	default:
+		return fmt.Errorf("volume access mode %s is not supported", mode)
+	}
+}
+
+// isReadOnly returns whether a volume is only read with a capability
+func isReadOnly(capability *csi.VolumeCapability) bool {
+	mode := capability.GetAccessMode().GetMode()
+	return mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY ||
+		mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package csi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeID(t *testing.T) {
+	id := volumeID("rook", "replicapool", "pvc-1")
+	assert.Equal(t, "rook/replicapool/pvc-1", id)
+
+	clusterName, pool, image, err := parseVolumeID(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "rook", clusterName)
+	assert.Equal(t, "replicapool", pool)
+	assert.Equal(t, "pvc-1", image)
+
+	for _, invalid := range []string{"", "pvc-1", "replicapool/pvc-1", "rook//pvc-1", "rook/replicapool/pvc-1/foo"} {
+		_, _, _, err = parseVolumeID(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	socketPath, err := parseEndpoint("unix:///csi/csi.sock")
+	assert.Nil(t, err)
+	assert.Equal(t, "/csi/csi.sock", socketPath)
+
+	socketPath, err = parseEndpoint("unix://csi.sock")
+	assert.Nil(t, err)
+	assert.Equal(t, "csi.sock", socketPath)
+
+	_, err = parseEndpoint("tcp://127.0.0.1:10000")
+	assert.NotNil(t, err)
+	_, err = parseEndpoint("unix://")
+	assert.NotNil(t, err)
+}
@@ -18,8 +18,8 @@ limitations under the License.
 package flexvolume
 
 import (
-	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -29,9 +29,8 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	cephclient "github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/model"
-	"github.com/rook/rook/pkg/operator/agent"
-	"github.com/rook/rook/pkg/operator/cluster"
 	"github.com/rook/rook/pkg/operator/cluster/ceph/mon"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/api/core/v1"
@@ -39,13 +38,31 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
-	StorageClassKey       = "storageClass"
-	PoolKey               = "pool"
-	ImageKey              = "image"
-	kubeletDefaultRootDir = "/var/lib/kubelet"
+	StorageClassKey  = "storageClass"
+	PoolKey          = "pool"
+	ImageKey         = "image"
+	ClusterNameKey   = "clusterName"
+	FsNameKey        = "fsName"
+	PathKey          = "path"
+	ClientKey        = "client"
+	DataPoolKey      = "dataPool"
+	ImageFeaturesKey = "imageFeatures"
+	ImageFormatKey   = "imageFormat"
+	ObjectSizeKey    = "objectSize"
+	StripeUnitKey    = "stripeUnit"
+	StripeCountKey   = "stripeCount"
+	MounterKey       = "mounter"
+	EncryptedKey     = "encrypted"
+
+	// ClusterNameAnnotation records the cluster on the rook volumes provisioned before the cluster was in their options
+	ClusterNameAnnotation = "rook.io/clusterName"
+
+	// the key of the cephx client key in the secrets of the clients restricted to a file system volume
+	filesystemClientSecretKey = "key"
 )
 
 var driverLogger = capnslog.NewPackageLogger("github.com/rook/rook", "flexdriver")
@@ -124,6 +141,24 @@ func (c *Controller) Attach(attachOpts AttachOptions, devicePath *string) error
 
 					logger.Infof("Volume attachment record %s/%s is orphaned. Updating record with new attachment information for pod %s/%s", volumeattachObj.Namespace, volumeattachObj.Name, attachOpts.PodNamespace, attachOpts.Pod)
 
+					// The orphaned node may still have the volume mapped and be writing to it. Fence its client
+					// before the volume is attached read-write to this node.
+					if attachment.Node != node {
+						clients := []string{}
+						if attachment.ClientAddress != "" {
+							clients = append(clients, attachment.ClientAddress)
+						}
+						fenced, err := c.volumeManager.Fence(attachOpts.Image, attachOpts.Pool, attachOpts.ClusterName, clients)
+						if err != nil {
+							return fmt.Errorf("failed to fence volume %s on node %s. %+v", crdName, attachment.Node, err)
+						}
+						for _, address := range fenced {
+							logger.Infof("fenced client %s of volume %s on node %s", address, crdName, attachment.Node)
+							volumeattachObj.FencedClients = append(volumeattachObj.FencedClients,
+								rookalpha.FencedClient{Node: attachment.Node, Address: address, Time: metav1.Now()})
+						}
+					}
+
 					// Attachment is orphaned. Update attachment record and proceed with attaching
 					attachment.Node = node
 					attachment.MountDir = attachOpts.MountDir
@@ -131,6 +166,7 @@ func (c *Controller) Attach(attachOpts AttachOptions, devicePath *string) error
 					attachment.PodName = attachOpts.Pod
 					attachment.ClusterName = attachOpts.ClusterName
 					attachment.ReadOnly = attachOpts.RW == ReadOnly
+					attachment.ClientAddress = ""
 					err = c.volumeAttachment.Update(volumeattachObj)
 					if err != nil {
 						return fmt.Errorf("failed to update volume CRD %s. %+v", crdName, err)
@@ -165,9 +201,73 @@ func (c *Controller) Attach(attachOpts AttachOptions, devicePath *string) error
 			}
 		}
 	}
-	*devicePath, err = c.volumeManager.Attach(attachOpts.Image, attachOpts.Pool, attachOpts.ClusterName)
+	*devicePath, err = c.MapVolume(attachOpts)
 	if err != nil {
-		return fmt.Errorf("failed to attach volume %s/%s: %+v", attachOpts.Pool, attachOpts.Image, err)
+		return err
+	}
+	c.recordClientAddress(namespace, crdName, node, attachOpts)
+	return nil
+}
+
+// recordClientAddress records the address of the ceph client that mapped the image of a volume in the attachment of the
+// node, so that the client can be fenced if the volume fails over to another node. The volume stays attached when the
+// address cannot be recorded, and only the clients that watch the image are fenced then.
+func (c *Controller) recordClientAddress(namespace, crdName, node string, attachOpts AttachOptions) {
+	address, err := c.volumeManager.ClientAddress(attachOpts.Image, attachOpts.Pool, attachOpts.ClusterName)
+	if err != nil || address == "" {
+		logger.Warningf("failed to get the client address of volume %s on node %s. %+v", crdName, node, err)
+		return
+	}
+
+	volumeattachObj, err := c.volumeAttachment.Get(namespace, crdName)
+	if err != nil {
+		logger.Warningf("failed to get volume CRD %s to record the client address. %+v", crdName, err)
+		return
+	}
+	for i := range volumeattachObj.Attachments {
+		a := &volumeattachObj.Attachments[i]
+		if a.Node == node && a.MountDir == attachOpts.MountDir {
+			if a.ClientAddress == address {
+				return
+			}
+			a.ClientAddress = address
+			if err := c.volumeAttachment.Update(volumeattachObj); err != nil {
+				logger.Warningf("failed to record the client address %s of volume %s. %+v", address, crdName, err)
+				return
+			}
+			logger.Infof("recorded client address %s of volume %s on node %s", address, crdName, node)
+			return
+		}
+	}
+}
+
+// MapVolume maps the image of a block volume on the node and returns the device the volume is formatted and mounted
+// on. The attachment of the volume is not recorded, which the callers do before the volume is mapped.
+func (c *Controller) MapVolume(attachOpts AttachOptions) (string, error) {
+	devicePath, err := c.volumeManager.Attach(attachOpts.Image, attachOpts.Pool, attachOpts.ClusterName, attachOpts.Mounter)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach volume %s/%s: %+v", attachOpts.Pool, attachOpts.Image, err)
+	}
+
+	// an encrypted volume is formatted and mounted on its opened LUKS device
+	if attachOpts.Encrypted == "true" {
+		devicePath, err = c.openEncryptedDevice(attachOpts, devicePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to attach volume %s/%s: %+v", attachOpts.Pool, attachOpts.Image, err)
+		}
+	}
+	return devicePath, nil
+}
+
+// UnmapVolume closes the encrypted device of a block volume and unmaps its image from the node
+func (c *Controller) UnmapVolume(detachOpts AttachOptions, force bool) error {
+	if err := c.closeEncryptedDevice(detachOpts.Pool, detachOpts.Image); err != nil {
+		return fmt.Errorf("Failed to detach volume %s/%s: %+v", detachOpts.Pool, detachOpts.Image, err)
+	}
+
+	err := c.volumeManager.Detach(detachOpts.Image, detachOpts.Pool, detachOpts.ClusterName, force)
+	if err != nil {
+		return fmt.Errorf("Failed to detach volume %s/%s: %+v", detachOpts.Pool, detachOpts.Image, err)
 	}
 	return nil
 }
@@ -182,9 +282,8 @@ func (c *Controller) DetachForce(detachOpts AttachOptions, _ *struct{} /* void r
 }
 
 func (c *Controller) doDetach(detachOpts AttachOptions, force bool) error {
-	err := c.volumeManager.Detach(detachOpts.Image, detachOpts.Pool, detachOpts.ClusterName, force)
-	if err != nil {
-		return fmt.Errorf("Failed to detach volume %s/%s: %+v", detachOpts.Pool, detachOpts.Image, err)
+	if err := c.UnmapVolume(detachOpts, force); err != nil {
+		return err
 	}
 
 	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
@@ -240,16 +339,33 @@ func (c *Controller) Log(message LogMessage, _ *struct{} /* void reply */) error
 	return nil
 }
 
-func (c *Controller) parseClusterName(storageClassName string) (string, error) {
-	sc, err := c.context.Clientset.Storage().StorageClasses().Get(storageClassName, metav1.GetOptions{})
+// GetVolumeClusterName returns the name of the cluster a rook volume was provisioned in. The volumes provisioned
+// before the cluster name was recorded in their options have it in an annotation, or else in their storage class.
+func GetVolumeClusterName(clientset kubernetes.Interface, pv *v1.PersistentVolume) (string, error) {
+	if pv.Spec.FlexVolume != nil {
+		if clusterName := pv.Spec.FlexVolume.Options[ClusterNameKey]; clusterName != "" {
+			return clusterName, nil
+		}
+	}
+	if clusterName := pv.Annotations[ClusterNameAnnotation]; clusterName != "" {
+		return clusterName, nil
+	}
+	if pv.Spec.FlexVolume == nil || pv.Spec.FlexVolume.Options[StorageClassKey] == "" {
+		return "", fmt.Errorf("persistent volume %s has no cluster name or storage class", pv.Name)
+	}
+	return parseClusterName(clientset, pv.Spec.FlexVolume.Options[StorageClassKey])
+}
+
+func parseClusterName(clientset kubernetes.Interface, storageClassName string) (string, error) {
+	sc, err := clientset.StorageV1().StorageClasses().Get(storageClassName, metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
 	clusterName, ok := sc.Parameters["clusterName"]
 	if !ok {
 		// Defaults to rook if not found
-		logger.Infof("clusterName not specified in the storage class %s. Defaulting to '%s'", storageClassName, cluster.DefaultClusterName)
-		return cluster.DefaultClusterName, nil
+		logger.Infof("clusterName not specified in the storage class %s. Defaulting to '%s'", storageClassName, k8sutil.DefaultClusterName)
+		return k8sutil.DefaultClusterName, nil
 	}
 	return clusterName, nil
 }
@@ -304,9 +420,15 @@ func (c *Controller) GetAttachInfoFromMountDir(mountDir string, attachOptions *A
 	if attachOptions.StorageClass == "" {
 		attachOptions.StorageClass = pv.Spec.PersistentVolumeSource.FlexVolume.Options[StorageClassKey]
 	}
-	attachOptions.ClusterName, err = c.parseClusterName(attachOptions.StorageClass)
+	if attachOptions.Mounter == "" {
+		attachOptions.Mounter = pv.Spec.PersistentVolumeSource.FlexVolume.Options[MounterKey]
+	}
+	if attachOptions.Encrypted == "" {
+		attachOptions.Encrypted = pv.Spec.PersistentVolumeSource.FlexVolume.Options[EncryptedKey]
+	}
+	attachOptions.ClusterName, err = GetVolumeClusterName(c.context.Clientset, pv)
 	if err != nil {
-		return fmt.Errorf("Failed to parse clusterName from storageClass %s: %+v", attachOptions.StorageClass, err)
+		return fmt.Errorf("Failed to get clusterName of volume %s: %+v", pv.Name, err)
 	}
 	return nil
 }
@@ -337,40 +459,103 @@ func (c *Controller) GetClientAccessInfo(clusterName string, clientAccessInfo *m
 	return nil
 }
 
-// GetKernelVersion returns the kernel version of the current node.
-func (c *Controller) GetKernelVersion(_ *struct{} /* no inputs */, kernelVersion *string) error {
-	nodeName := os.Getenv(k8sutil.NodeNameEnvVar)
-	node, err := c.context.Clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+// GetFilesystemClientAccessInfo obtains the monitor endpoints and the credentials of the cephx client that is
+// restricted to the path of a provisioned file system volume
+func (c *Controller) GetFilesystemClientAccessInfo(opts AttachOptions, clientAccessInfo *model.ClientAccessInfo) error {
+	if opts.Client == "" {
+		return fmt.Errorf("no client is provided for filesystem %s", opts.FsName)
+	}
+	if err := c.GetClientAccessInfo(opts.ClusterName, clientAccessInfo); err != nil {
+		return err
+	}
+
+	secretName := FilesystemClientSecretName(opts.Client)
+	secret, err := c.context.Clientset.CoreV1().Secrets(opts.ClusterName).Get(secretName, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get kernel version from node information for node %s: %+v", nodeName, err)
+		return fmt.Errorf("failed to get secret %s of client %s in cluster %s: %+v", secretName, opts.Client, opts.ClusterName, err)
 	}
-	*kernelVersion = node.Status.NodeInfo.KernelVersion
+	key, ok := secret.Data[filesystemClientSecretKey]
+	if !ok {
+		return fmt.Errorf("secret %s has no key for client %s", secretName, opts.Client)
+	}
+
+	clientAccessInfo.UserName = opts.Client
+	clientAccessInfo.SecretKey = string(key)
 	return nil
 }
 
-// getKubeletRootDir queries the kubelet configuration to find the kubelet root dir. Defaults to /var/lib/kubelet
-func (c *Controller) getKubeletRootDir() string {
-	nodeConfigURI, err := k8sutil.NodeConfigURI()
+// MountFilesystemFuse mounts a file system volume to its mount dir with ceph-fuse, for the nodes where the ceph kernel
+// module is not available. The ceph-fuse daemon runs in the agent, and its mount is propagated to the kubelet dir of
+// the host.
+func (c *Controller) MountFilesystemFuse(opts AttachOptions, _ *struct{} /* void reply */) error {
+	var clientAccessInfo model.ClientAccessInfo
+	if err := c.GetClientAccessInfo(opts.ClusterName, &clientAccessInfo); err != nil {
+		return err
+	}
+	monitors := strings.Join(clientAccessInfo.MonAddresses, ",")
+
+	// a provisioned volume is mounted with the client restricted to its path, which was created by the provisioner
+	if opts.Client != "" {
+		if err := c.GetFilesystemClientAccessInfo(opts, &clientAccessInfo); err != nil {
+			return err
+		}
+	}
+
+	keyring, err := writeClientKeyring(clientAccessInfo)
 	if err != nil {
-		logger.Warningf(err.Error())
-		return kubeletDefaultRootDir
+		return err
 	}
+	defer os.Remove(keyring)
 
-	// determining where the path of the kubelet root dir and flexvolume dir on the node
-	nodeConfig, err := c.context.Clientset.Core().RESTClient().Get().RequestURI(nodeConfigURI).DoRaw()
+	if err := os.MkdirAll(opts.MountDir, 0750); err != nil {
+		return fmt.Errorf("failed to create mount dir %s: %+v", opts.MountDir, err)
+	}
+	logger.Infof("mounting path %s of filesystem %s to %s with ceph-fuse", opts.Path, opts.FsName, opts.MountDir)
+	return cephclient.MountFilesystemFuse(c.context, opts.FsName, opts.Path, opts.MountDir, clientAccessInfo.UserName, keyring, monitors)
+}
+
+// writes a temporary keyring with the key of a client
+func writeClientKeyring(clientAccessInfo model.ClientAccessInfo) (string, error) {
+	keyringFile, err := ioutil.TempFile("", clientAccessInfo.UserName+".keyring")
 	if err != nil {
-		logger.Warningf("unable to query node configuration: %v", err)
-		return kubeletDefaultRootDir
+		return "", fmt.Errorf("failed to create keyring for client %s: %+v", clientAccessInfo.UserName, err)
 	}
-	configKubelet := agent.NodeConfigKubelet{}
-	if err := json.Unmarshal(nodeConfig, &configKubelet); err != nil {
-		logger.Warningf("unable to parse node config from Kubelet: %+v", err)
-		return kubeletDefaultRootDir
+	defer keyringFile.Close()
+
+	keyring := fmt.Sprintf("[client.%s]\n\tkey = %s\n", clientAccessInfo.UserName, clientAccessInfo.SecretKey)
+	if _, err := keyringFile.WriteString(keyring); err != nil {
+		os.Remove(keyringFile.Name())
+		return "", fmt.Errorf("failed to write keyring for client %s: %+v", clientAccessInfo.UserName, err)
+	}
+	return keyringFile.Name(), nil
+}
+
+// FilesystemClientSecretName returns the name of the secret that stores the key of the cephx client of a file system volume
+func FilesystemClientSecretName(client string) string {
+	return fmt.Sprintf("rook-ceph-client-%s", client)
+}
+
+// FilesystemClientSecretData returns the data of the secret that stores the key of the cephx client of a file system volume
+func FilesystemClientSecretData(key string) map[string][]byte {
+	return map[string][]byte{filesystemClientSecretKey: []byte(key)}
+}
+
+// GetKernelVersion returns the kernel version of the current node.
+func (c *Controller) GetKernelVersion(_ *struct{} /* no inputs */, kernelVersion *string) error {
+	nodeName := os.Getenv(k8sutil.NodeNameEnvVar)
+	node, err := c.context.Clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get kernel version from node information for node %s: %+v", nodeName, err)
 	}
+	*kernelVersion = node.Status.NodeInfo.KernelVersion
+	return nil
+}
 
-	// in k8s 1.8 it does not appear possible to change the default root dir
+// getKubeletRootDir returns the kubelet root dir that the operator discovered for the agent. Defaults to /var/lib/kubelet
+func (c *Controller) getKubeletRootDir() string {
+	// in k8s 1.8 the root dir is not in the node configuration
 	// see https://github.com/rook/rook/issues/1282
-	return kubeletDefaultRootDir
+	return k8sutil.KubeletRootDir()
 }
 
 // getPodAndPVNameFromMountDir parses pod information from the mountDir
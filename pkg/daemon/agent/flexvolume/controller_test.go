@@ -398,11 +398,12 @@ func TestOrphanAttachOriginalPodDoesntExist(t *testing.T) {
 		},
 		Attachments: []rookalpha.Attachment{
 			{
-				Node:         "otherNode",
-				PodNamespace: "Default",
-				PodName:      "oldPod",
-				MountDir:     "/tmt/test",
-				ReadOnly:     false,
+				Node:          "otherNode",
+				PodNamespace:  "Default",
+				PodName:       "oldPod",
+				MountDir:      "/tmt/test",
+				ReadOnly:      false,
+				ClientAddress: "10.0.0.6:0/4321",
 			},
 		},
 	}
@@ -414,10 +415,20 @@ func TestOrphanAttachOriginalPodDoesntExist(t *testing.T) {
 	assert.Nil(t, err)
 
 	devicePath := ""
+	fencedVolume := ""
 	controller := &Controller{
 		context:          context,
 		volumeAttachment: att,
-		volumeManager:    &manager.FakeVolumeManager{},
+		volumeManager: &manager.FakeVolumeManager{
+			FakeFence: func(image, pool, clusterName string, clients []string) ([]string, error) {
+				fencedVolume = pool + "/" + image
+				assert.Equal(t, []string{"10.0.0.6:0/4321"}, clients)
+				return []string{"10.0.0.6:0/4321", "10.0.0.4:0/1234"}, nil
+			},
+			FakeClientAddress: func(image, pool, clusterName string) (string, error) {
+				return "10.0.0.5:0/5678", nil
+			},
+		},
 	}
 
 	err = controller.Attach(opts, &devicePath)
@@ -436,6 +447,16 @@ func TestOrphanAttachOriginalPodDoesntExist(t *testing.T) {
 			Node:         "node1",
 		}, volAtt.Attachments,
 	), "VolumeAttachment crd does not contain expected attachment")
+
+	// the recorded client of the orphaned node is fenced before the volume is attached
+	assert.Equal(t, "testpool/image123", fencedVolume)
+	assert.Equal(t, 2, len(volAtt.FencedClients))
+	assert.Equal(t, "otherNode", volAtt.FencedClients[0].Node)
+	assert.Equal(t, "10.0.0.6:0/4321", volAtt.FencedClients[0].Address)
+	assert.Equal(t, "10.0.0.4:0/1234", volAtt.FencedClients[1].Address)
+
+	// the client of this node is recorded once the volume is mapped
+	assert.Equal(t, "10.0.0.5:0/5678", volAtt.Attachments[0].ClientAddress)
 }
 
 func TestOrphanAttachOriginalPodNameSame(t *testing.T) {
@@ -793,14 +814,17 @@ func TestParseClusterName(t *testing.T) {
 		Parameters:  map[string]string{"pool": "testpool", "clusterName": "testCluster", "fsType": "ext3"},
 	}
 	clientset.StorageV1().StorageClasses().Create(&sc)
-	volumeAttachment, err := attachment.New(context)
-	assert.Nil(t, err)
 
-	fc := &Controller{
-		context:          context,
-		volumeAttachment: volumeAttachment,
+	// the volumes provisioned before the cluster was recorded in their options get it from their storage class
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-123"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+			Driver:  "rook.io/rook",
+			Options: map[string]string{"pool": "testpool", "image": "pvc-123", "storageClass": "rook-storageclass"},
+		}}},
 	}
-	clusterName, _ := fc.parseClusterName("rook-storageclass")
+	clusterName, err := GetVolumeClusterName(context.Clientset, pv)
+	assert.Nil(t, err)
 	assert.Equal(t, "testCluster", clusterName)
 }
 
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ExpandController grows the filesystems of the rook volumes attached to this node when the operator expands them
+type ExpandController struct {
+	controller *Controller
+}
+
+// NewExpandController creates a controller that grows the filesystems of the expanded volumes
+func NewExpandController(controller *Controller) *ExpandController {
+	return &ExpandController{controller: controller}
+}
+
+// Run watches the persistent volumes until the stop channel is closed
+func (e *ExpandController) Run(stopCh chan struct{}) {
+	logger.Infof("watching the persistent volumes for volume expansions")
+	source := cache.NewListWatchFromClient(e.controller.context.Clientset.CoreV1().RESTClient(), "persistentvolumes", v1.NamespaceAll, fields.Everything())
+	_, controller := cache.NewInformer(source, &v1.PersistentVolume{}, 0, cache.ResourceEventHandlerFuncs{
+		UpdateFunc: e.onUpdate,
+	})
+	controller.Run(stopCh)
+}
+
+func (e *ExpandController) onUpdate(oldObj, newObj interface{}) {
+	oldPV := oldObj.(*v1.PersistentVolume)
+	pv := newObj.(*v1.PersistentVolume)
+
+	flex := pv.Spec.FlexVolume
+	if flex == nil || flex.Driver != fmt.Sprintf("%s/%s", FlexvolumeVendor, FlexvolumeDriver) || flex.Options[ImageKey] == "" {
+		return
+	}
+	oldCapacity := oldPV.Spec.Capacity[v1.ResourceStorage]
+	capacity := pv.Spec.Capacity[v1.ResourceStorage]
+	if capacity.Cmp(oldCapacity) <= 0 {
+		return
+	}
+
+	if err := e.growFilesystem(pv); err != nil {
+		logger.Errorf("failed to grow the filesystem of volume %s. %+v", pv.Name, err)
+	}
+}
+
+// grows the filesystem of the volume if it is attached to this node. The filesystem of a volume that is not attached
+// is grown when the volume is next mounted.
+func (e *ExpandController) growFilesystem(pv *v1.PersistentVolume) error {
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	node := os.Getenv(k8sutil.NodeNameEnvVar)
+
+	volumeAttach, err := e.controller.volumeAttachment.Get(namespace, pv.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get volume CRD %s. %+v", pv.Name, err)
+	}
+	attached := false
+	for _, a := range volumeAttach.Attachments {
+		if a.Node == node {
+			attached = true
+		}
+	}
+	if !attached {
+		return nil
+	}
+
+	flex := pv.Spec.FlexVolume
+	clusterName, err := GetVolumeClusterName(e.controller.context.Clientset, pv)
+	if err != nil {
+		return fmt.Errorf("failed to get clusterName of volume %s. %+v", pv.Name, err)
+	}
+	var globalMountPath string
+	if err := e.controller.GetGlobalMountPath(pv.Name, &globalMountPath); err != nil {
+		return err
+	}
+
+	capacity := pv.Spec.Capacity[v1.ResourceStorage]
+	logger.Infof("growing the filesystem of volume %s to %s", pv.Name, capacity.String())
+	encrypted := flex.Options[EncryptedKey] == "true"
+	return e.controller.volumeManager.Expand(flex.Options[ImageKey], flex.Options[PoolKey], clusterName, globalMountPath, flex.FSType, uint64(capacity.Value()), encrypted)
+}
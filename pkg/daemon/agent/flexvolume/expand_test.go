@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"os"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/manager"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/operator/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpandOnlyAttachedVolumes(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+	os.Setenv(k8sutil.NodeNameEnvVar, "node1")
+	defer os.Unsetenv(k8sutil.NodeNameEnvVar)
+
+	expanded := false
+	var volumeAttachment *rookalpha.VolumeAttachment
+	controller := &Controller{
+		context: &clusterd.Context{Clientset: test.New(3)},
+		volumeAttachment: &attachment.MockAttachment{
+			MockGet: func(namespace, name string) (*rookalpha.VolumeAttachment, error) {
+				if volumeAttachment == nil {
+					return nil, errors.NewNotFound(v1.Resource("volumeattachment"), name)
+				}
+				return volumeAttachment, nil
+			},
+		},
+		volumeManager: &manager.FakeVolumeManager{
+			FakeExpand: func(image, pool, clusterName, mountPath, fsType string, size uint64, encrypted bool) error {
+				expanded = true
+				return nil
+			},
+		},
+	}
+	e := NewExpandController(controller)
+
+	oldPV := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-123"},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+				Driver:  "rook.io/rook",
+				Options: map[string]string{"pool": "testpool", "image": "pvc-123", "storageClass": "storageclass1"},
+			}},
+		},
+	}
+	pv := oldPV.DeepCopy()
+
+	// nothing to grow when the capacity did not change
+	e.onUpdate(oldPV, pv)
+	assert.False(t, expanded)
+
+	// nothing to grow when the volume is not attached
+	pv.Spec.Capacity[v1.ResourceStorage] = resource.MustParse("2Gi")
+	e.onUpdate(oldPV, pv)
+	assert.False(t, expanded)
+
+	// nothing to grow when the volume is attached to another node
+	volumeAttachment = rookalpha.NewVolumeAttachment("pvc-123", "rook-system", "node2", "ns", "pod1", "testCluster", "/mnt/pvc-123", false)
+	err := e.growFilesystem(pv)
+	assert.Nil(t, err)
+	assert.False(t, expanded)
+}
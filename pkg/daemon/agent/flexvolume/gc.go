@@ -0,0 +1,339 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	cephclient "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/util"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	gcInterval = 5 * time.Minute
+)
+
+var (
+	// the mount table of the host, which the agent can read since it runs in the host PID namespace
+	hostMountsPath = "/proc/1/mounts"
+	hostProcPath   = "/proc"
+	gcSysBlockPath = util.SysBlockPathDefault
+	// the devices of the images mapped by the rbd kernel module
+	gcSysBusRBDPath = "/sys/bus/rbd/devices"
+)
+
+// GarbageCollector periodically cleans up the volumes of this node that are left behind when pods are force deleted or
+// when the node goes down before its volumes are unmounted. The attachments whose pods no longer exist on this node are
+// removed from the VolumeAttachment CRDs, and the images of rook volumes that are neither attached nor in use are
+// unmapped.
+type GarbageCollector struct {
+	controller *Controller
+	// the devices that were unused at the previous collection. A device is only unmapped if it is still unused at the
+	// next collection, since an image is mapped before its device is mounted.
+	unusedDevices map[string]bool
+}
+
+// mappedDevice is a device of this node where an image is mapped by the rbd kernel module or by an rbd-nbd daemon
+type mappedDevice struct {
+	// the cluster, pool and name of the image
+	image string
+	path  string
+	nbd   bool
+}
+
+// hostMounts are the mount points and the mounted devices of the host
+type hostMounts struct {
+	mountPoints map[string]bool
+	devices     map[string]bool
+}
+
+// NewGarbageCollector creates a garbage collector for the volumes of this node
+func NewGarbageCollector(controller *Controller) *GarbageCollector {
+	return &GarbageCollector{controller: controller, unusedDevices: map[string]bool{}}
+}
+
+// Run collects the stale volumes periodically until the stop channel is closed
+func (g *GarbageCollector) Run(stopCh chan struct{}) {
+	logger.Infof("collecting the stale volume attachments and devices every %s", gcInterval)
+	wait.Until(g.collect, gcInterval, stopCh)
+}
+
+func (g *GarbageCollector) collect() {
+	mounts, err := getHostMounts()
+	if err != nil {
+		logger.Errorf("failed to collect stale volumes. %+v", err)
+		return
+	}
+
+	attachedVolumes, err := g.removeOrphanedAttachments(mounts)
+	if err != nil {
+		logger.Errorf("failed to remove orphaned volume attachments. %+v", err)
+		return
+	}
+
+	if err := g.unmapUnusedDevices(attachedVolumes, mounts); err != nil {
+		logger.Errorf("failed to unmap unused devices. %+v", err)
+	}
+}
+
+// removeOrphanedAttachments removes the attachments of this node whose pods no longer exist on this node and whose
+// mount dirs are not mounted. The names of the volumes that are still attached to this node are returned.
+func (g *GarbageCollector) removeOrphanedAttachments(mounts *hostMounts) (map[string]bool, error) {
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	node := os.Getenv(k8sutil.NodeNameEnvVar)
+
+	volumeAttachments, err := g.controller.volumeAttachment.List(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume attachments in namespace %s. %+v", namespace, err)
+	}
+
+	attachedVolumes := map[string]bool{}
+	for i := range volumeAttachments.Items {
+		volumeAttachment := &volumeAttachments.Items[i]
+		attachments := []rookalpha.Attachment{}
+		for _, a := range volumeAttachment.Attachments {
+			// the attachments of the CSI driver have no mount dir and are removed when Kubernetes detaches the volume
+			if a.Node == node && a.MountDir != "" {
+				orphaned, err := g.isOrphaned(a, node, mounts)
+				if err != nil {
+					return nil, err
+				}
+				if orphaned {
+					logger.Infof("removing orphaned attachment of volume %s for pod %s/%s", volumeAttachment.Name, a.PodNamespace, a.PodName)
+					continue
+				}
+			}
+			if a.Node == node {
+				attachedVolumes[volumeAttachment.Name] = true
+			}
+			attachments = append(attachments, a)
+		}
+		if len(attachments) == len(volumeAttachment.Attachments) {
+			continue
+		}
+
+		if len(attachments) == 0 {
+			err = g.controller.volumeAttachment.Delete(namespace, volumeAttachment.Name)
+		} else {
+			volumeAttachment.Attachments = attachments
+			err = g.controller.volumeAttachment.Update(volumeAttachment)
+		}
+		if err != nil {
+			// another agent may have updated the attachments at the same time. they are removed at the next collection.
+			logger.Warningf("failed to remove the orphaned attachments of volume %s. %+v", volumeAttachment.Name, err)
+		}
+	}
+	return attachedVolumes, nil
+}
+
+// an attachment is orphaned when its mount dir is not mounted and its pod was deleted or rescheduled to another node
+func (g *GarbageCollector) isOrphaned(a rookalpha.Attachment, node string, mounts *hostMounts) (bool, error) {
+	if mounts.mountPoints[a.MountDir] {
+		return false, nil
+	}
+	pod, err := g.controller.context.Clientset.CoreV1().Pods(a.PodNamespace).Get(a.PodName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get pod %s/%s. %+v", a.PodNamespace, a.PodName, err)
+	}
+	return pod.Spec.NodeName != node, nil
+}
+
+// unmapUnusedDevices unmaps the images of rook volumes that are not attached to this node, not mounted, and not held
+// by another device such as an encrypted volume, if they were already unused at the previous collection. The images
+// mapped by the rbd kernel module and by rbd-nbd daemons are both collected.
+func (g *GarbageCollector) unmapUnusedDevices(attachedVolumes map[string]bool, mounts *hostMounts) error {
+	volumeImages, clusterNames, err := g.getVolumeImages()
+	if err != nil {
+		return err
+	}
+	if len(volumeImages) == 0 {
+		g.unusedDevices = map[string]bool{}
+		return nil
+	}
+	devices, err := g.getMappedDevices(clusterNames)
+	if err != nil {
+		return err
+	}
+
+	unusedDevices := map[string]bool{}
+	for _, device := range devices {
+		volumeName, ok := volumeImages[device.image]
+		if !ok || attachedVolumes[volumeName] || mounts.devices[device.path] || hasHolders(device.path) {
+			// not the image of a rook volume, or still in use
+			continue
+		}
+		if !g.unusedDevices[device.path] {
+			unusedDevices[device.path] = true
+			continue
+		}
+
+		logger.Infof("unmapping unused device %s of volume %s", device.path, volumeName)
+		if device.nbd {
+			err = cephclient.UnMapImageNBD(g.controller.context, device.path)
+		} else {
+			err = cephclient.UnMapDevice(g.controller.context, device.path)
+		}
+		if err != nil {
+			logger.Warningf("failed to unmap unused device %s. %+v", device.path, err)
+		}
+	}
+	g.unusedDevices = unusedDevices
+	return nil
+}
+
+// getVolumeImages returns the names of the rook block volumes by the cluster, pool and name of their images, and the
+// names of the clusters of the volumes
+func (g *GarbageCollector) getVolumeImages() (map[string]string, map[string]bool, error) {
+	clientset := g.controller.context.Clientset
+	pvs, err := clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list persistent volumes. %+v", err)
+	}
+	driver := fmt.Sprintf("%s/%s", FlexvolumeVendor, FlexvolumeDriver)
+	images := map[string]string{}
+	clusterNames := map[string]bool{}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		flex := pv.Spec.FlexVolume
+		if flex == nil || flex.Driver != driver || flex.Options[ImageKey] == "" {
+			continue
+		}
+		clusterName, err := GetVolumeClusterName(clientset, pv)
+		if err != nil {
+			logger.Warningf("failed to get the cluster of volume %s. %+v", pv.Name, err)
+			continue
+		}
+		images[imageKey(clusterName, flex.Options[PoolKey], flex.Options[ImageKey])] = pv.Name
+		clusterNames[clusterName] = true
+	}
+	return images, clusterNames, nil
+}
+
+// getMappedDevices returns the devices of this node where the images of the given clusters are mapped. The images
+// mapped by the rbd kernel module are matched to their cluster by its fsid, and the images mapped by rbd-nbd by the
+// cluster name their daemon was started with.
+func (g *GarbageCollector) getMappedDevices(clusterNames map[string]bool) ([]mappedDevice, error) {
+	mappedImages, err := cephclient.ListMappedImages(g.controller.context)
+	if err != nil {
+		return nil, err
+	}
+	devices := []mappedDevice{}
+	if len(mappedImages) > 0 {
+		clustersByFSID := g.getClustersByFSID(clusterNames)
+		for _, image := range mappedImages {
+			fsid, err := ioutil.ReadFile(path.Join(gcSysBusRBDPath, image.ID, "cluster_fsid"))
+			if err != nil {
+				logger.Warningf("failed to get the cluster of device %s. %+v", image.Device, err)
+				continue
+			}
+			clusterName, ok := clustersByFSID[strings.TrimSpace(string(fsid))]
+			if !ok {
+				continue
+			}
+			devices = append(devices, mappedDevice{image: imageKey(clusterName, image.Pool, image.Name), path: image.Device})
+		}
+	}
+
+	// the nbd module may not be loaded on the node, in which case no image is mapped with rbd-nbd
+	nbdImages, err := cephclient.ListMappedImagesNBD(g.controller.context)
+	if err != nil {
+		logger.Warningf("failed to list the images mapped with rbd-nbd. %+v", err)
+		return devices, nil
+	}
+	for _, image := range nbdImages {
+		clusterName, err := getNBDClusterName(image.PID)
+		if err != nil {
+			logger.Warningf("failed to get the cluster of device %s. %+v", image.Device, err)
+			continue
+		}
+		if clusterNames[clusterName] {
+			devices = append(devices, mappedDevice{image: imageKey(clusterName, image.Pool, image.Name), path: image.Device, nbd: true})
+		}
+	}
+	return devices, nil
+}
+
+// getClustersByFSID returns the names of the clusters by their fsid. The clusters whose info cannot be loaded are
+// skipped, so their devices are not unmapped.
+func (g *GarbageCollector) getClustersByFSID(clusterNames map[string]bool) map[string]string {
+	clusters := map[string]string{}
+	for clusterName := range clusterNames {
+		clusterInfo, _, _, err := mon.LoadClusterInfo(g.controller.context, clusterName)
+		if err != nil {
+			logger.Warningf("failed to load the info of cluster %s. %+v", clusterName, err)
+			continue
+		}
+		clusters[clusterInfo.FSID] = clusterName
+	}
+	return clusters
+}
+
+// getNBDClusterName returns the cluster name an rbd-nbd daemon was started with, from its command line in the host
+// PID namespace
+func getNBDClusterName(pid string) (string, error) {
+	cmdline, err := ioutil.ReadFile(path.Join(hostProcPath, pid, "cmdline"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the command line of rbd-nbd daemon %s. %+v", pid, err)
+	}
+	for _, arg := range strings.Split(string(cmdline), "\x00") {
+		if strings.HasPrefix(arg, "--cluster=") {
+			return strings.TrimPrefix(arg, "--cluster="), nil
+		}
+	}
+	return "", fmt.Errorf("rbd-nbd daemon %s has no cluster name", pid)
+}
+
+func imageKey(clusterName, pool, image string) string {
+	return fmt.Sprintf("%s/%s/%s", clusterName, pool, image)
+}
+
+// a device has holders when another device is built on it, such as the LUKS device of an encrypted volume
+func hasHolders(devicePath string) bool {
+	holders, err := ioutil.ReadDir(path.Join(gcSysBlockPath, filepath.Base(devicePath), "holders"))
+	return err == nil && len(holders) > 0
+}
+
+func getHostMounts() (*hostMounts, error) {
+	buf, err := ioutil.ReadFile(hostMountsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mounts of the host. %+v", err)
+	}
+	mounts := &hostMounts{mountPoints: map[string]bool{}, devices: map[string]bool{}}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		mounts.devices[fields[0]] = true
+		mounts.mountPoints[fields[1]] = true
+	}
+	return mounts, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCollectStaleVolumes(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+	os.Setenv(k8sutil.NodeNameEnvVar, "node1")
+	defer os.Unsetenv(k8sutil.NodeNameEnvVar)
+
+	// pvc-1 is mounted, and pvc-2 is not mounted anymore
+	tmpDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpDir)
+	hostMountsPath = path.Join(tmpDir, "mounts")
+	defer func() { hostMountsPath = "/proc/1/mounts" }()
+	ioutil.WriteFile(hostMountsPath, []byte("/dev/rbd1 /var/lib/kubelet/pods/pod1/volumes/rook.io~rook/pvc-1 ext4 rw,relatime 0 0\n"), 0644)
+	gcSysBlockPath = tmpDir
+	defer func() { gcSysBlockPath = "/sys/block" }()
+
+	// the devices of the rbd kernel module and the rbd-nbd daemons are matched to their cluster. /dev/rbd5 and
+	// /dev/nbd1 map an image with the same name in another cluster.
+	gcSysBusRBDPath = path.Join(tmpDir, "devices")
+	defer func() { gcSysBusRBDPath = "/sys/bus/rbd/devices" }()
+	for id, fsid := range map[string]string{"1": "fsid1", "2": "fsid1", "3": "fsid1", "4": "fsid1", "5": "fsid2"} {
+		os.MkdirAll(path.Join(gcSysBusRBDPath, id), 0755)
+		ioutil.WriteFile(path.Join(gcSysBusRBDPath, id, "cluster_fsid"), []byte(fsid+"\n"), 0644)
+	}
+	hostProcPath = tmpDir
+	defer func() { hostProcPath = "/proc" }()
+	for pid, clusterName := range map[string]string{"100": "rook", "101": "other"} {
+		os.MkdirAll(path.Join(hostProcPath, pid), 0755)
+		ioutil.WriteFile(path.Join(hostProcPath, pid, "cmdline"), []byte("rbd-nbd\x00map\x00replicapool/pvc-2\x00--id\x00admin\x00--cluster="+clusterName+"\x00"), 0644)
+	}
+
+	clientset := test.New(3)
+	for _, pv := range []string{"pvc-1", "pvc-2", "pvc-3"} {
+		clientset.CoreV1().PersistentVolumes().Create(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pv},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+				Driver:  "rook.io/rook",
+				Options: map[string]string{"pool": "replicapool", "image": pv, "clusterName": "rook"},
+			}}},
+		})
+	}
+	clientset.CoreV1().Secrets("rook").Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon", Namespace: "rook"},
+		Data:       map[string][]byte{"cluster-name": []byte("rook"), "fsid": []byte("fsid1")},
+	})
+	clientset.CoreV1().Pods("default").Create(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node1"},
+	})
+
+	volumeAttachments := &rookalpha.VolumeAttachmentList{Items: []rookalpha.VolumeAttachment{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "rook-system"},
+			Attachments: []rookalpha.Attachment{
+				{Node: "node1", PodNamespace: "default", PodName: "pod1", MountDir: "/var/lib/kubelet/pods/pod1/volumes/rook.io~rook/pvc-1"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-2", Namespace: "rook-system"},
+			Attachments: []rookalpha.Attachment{
+				{Node: "node1", PodNamespace: "default", PodName: "pod2", MountDir: "/var/lib/kubelet/pods/pod2/volumes/rook.io~rook/pvc-2"},
+				{Node: "node2", PodNamespace: "default", PodName: "pod3", MountDir: "/var/lib/kubelet/pods/pod3/volumes/rook.io~rook/pvc-2", ReadOnly: true},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-3", Namespace: "rook-system"},
+			Attachments: []rookalpha.Attachment{
+				{Node: "node1", PodNamespace: "default", PodName: "pod4", MountDir: "/var/lib/kubelet/pods/pod4/volumes/rook.io~rook/pvc-3"},
+			},
+		},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "pvc-4", Namespace: "rook-system"},
+			Attachments: []rookalpha.Attachment{{Node: "node1"}},
+		},
+	}}
+	var updated *rookalpha.VolumeAttachment
+	deleted := ""
+	unmapped := []string{}
+	controller := &Controller{
+		context: &clusterd.Context{
+			Clientset: clientset,
+			Executor: &exectest.MockExecutor{
+				MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+					if command == "rbd" && args[0] == "showmapped" {
+						return `[{"id":"1","pool":"replicapool","name":"pvc-1","snap":"-","device":"/dev/rbd1"},` +
+							`{"id":"2","pool":"replicapool","name":"pvc-2","snap":"-","device":"/dev/rbd2"},` +
+							`{"id":"3","pool":"replicapool","name":"pvc-3","snap":"-","device":"/dev/rbd3"},` +
+							`{"id":"4","pool":"otherpool","name":"image4","snap":"-","device":"/dev/rbd4"},` +
+							`{"id":"5","pool":"replicapool","name":"pvc-2","snap":"-","device":"/dev/rbd5"}]`, nil
+					}
+					if command == "rbd-nbd" && args[0] == "list-mapped" {
+						return "pid pool        image snap device\n" +
+							"100 replicapool pvc-2 -    /dev/nbd0\n" +
+							"101 replicapool pvc-2 -    /dev/nbd1\n", nil
+					}
+					assert.Equal(t, "unmap", args[0])
+					unmapped = append(unmapped, args[1])
+					return "", nil
+				},
+			},
+		},
+		volumeAttachment: &attachment.MockAttachment{
+			MockList: func(namespace string) (*rookalpha.VolumeAttachmentList, error) {
+				assert.Equal(t, "rook-system", namespace)
+				return volumeAttachments.DeepCopy(), nil
+			},
+			MockUpdate: func(volumeAttachment *rookalpha.VolumeAttachment) error {
+				updated = volumeAttachment
+				return nil
+			},
+			MockDelete: func(namespace, name string) error {
+				deleted = name
+				return nil
+			},
+		},
+	}
+	g := NewGarbageCollector(controller)
+
+	// the attachments of the deleted pods are removed, but the devices are only unmapped at the next collection. the
+	// attachment of pvc-4 by the CSI driver is kept until Kubernetes detaches it.
+	g.collect()
+	assert.Equal(t, "pvc-3", deleted)
+	assert.Equal(t, "pvc-2", updated.Name)
+	assert.Equal(t, 1, len(updated.Attachments))
+	assert.Equal(t, "node2", updated.Attachments[0].Node)
+	assert.Equal(t, 0, len(unmapped))
+
+	// the devices of the volumes that are still unused are unmapped, except the device held by an encrypted volume and
+	// the devices of the other cluster
+	volumeAttachments.Items = volumeAttachments.Items[:1]
+	os.MkdirAll(path.Join(tmpDir, "rbd3", "holders", "dm-0"), 0755)
+	g.collect()
+	assert.Equal(t, []string{"/dev/rbd2", "/dev/nbd0"}, unmapped)
+}
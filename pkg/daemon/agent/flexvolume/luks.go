@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	cryptsetupTool = "cryptsetup"
+
+	// the key of the passphrase in the secrets of the encrypted volumes
+	volumeKeySecretKey = "passphrase"
+)
+
+// the dir where device mapper creates the devices of the opened LUKS volumes
+var devMapperDir = "/dev/mapper"
+
+// VolumeKeySecretName returns the name of the secret that stores the passphrase of an encrypted block volume
+func VolumeKeySecretName(image string) string {
+	return fmt.Sprintf("rook-ceph-volume-key-%s", image)
+}
+
+// VolumeKeySecretData returns the data of the secret that stores the passphrase of an encrypted block volume
+func VolumeKeySecretData(passphrase string) map[string][]byte {
+	return map[string][]byte{volumeKeySecretKey: []byte(passphrase)}
+}
+
+// the name of the device mapper device of an encrypted volume
+func encryptedDeviceName(pool, image string) string {
+	return fmt.Sprintf("rook-%s-%s", pool, image)
+}
+
+// EncryptedDevicePath returns the path of the opened LUKS device of an encrypted volume
+func EncryptedDevicePath(pool, image string) string {
+	return path.Join(devMapperDir, encryptedDeviceName(pool, image))
+}
+
+// ResizeEncryptedDevice grows the opened LUKS device of an encrypted volume to the new size of its image, so that its
+// filesystem can be grown. The volumes are formatted with LUKS1, whose devices are resized without the passphrase.
+func ResizeEncryptedDevice(context *clusterd.Context, pool, image string) (string, error) {
+	name := encryptedDeviceName(pool, image)
+	if err := context.Executor.ExecuteCommand(false, "", cryptsetupTool, "resize", name); err != nil {
+		return "", fmt.Errorf("failed to resize encrypted volume %s/%s. %+v", pool, image, err)
+	}
+	logger.Infof("resized encrypted volume %s/%s", pool, image)
+	return EncryptedDevicePath(pool, image), nil
+}
+
+// openEncryptedDevice opens the LUKS device of an encrypted volume on top of its mapped image, and returns the path of
+// the opened device. The image is formatted with LUKS the first time it is opened, and only if it has no data so that
+// an unencrypted volume is never overwritten.
+func (c *Controller) openEncryptedDevice(opts AttachOptions, devicePath string) (string, error) {
+	name := encryptedDeviceName(opts.Pool, opts.Image)
+	encryptedPath := EncryptedDevicePath(opts.Pool, opts.Image)
+	if _, err := os.Stat(encryptedPath); err == nil {
+		logger.Infof("encrypted volume %s/%s is already open on %s", opts.Pool, opts.Image, encryptedPath)
+		return encryptedPath, nil
+	}
+
+	keyFile, err := c.writeVolumeKey(opts)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(keyFile)
+
+	if err := c.context.Executor.ExecuteCommand(false, "", cryptsetupTool, "isLuks", devicePath); err != nil {
+		output, _ := c.context.Executor.ExecuteCommandWithOutput(false, "", "blkid", "-p", devicePath)
+		if strings.TrimSpace(output) != "" {
+			return "", fmt.Errorf("volume %s/%s is not formatted with LUKS and has data on %s: %s", opts.Pool, opts.Image, devicePath, output)
+		}
+
+		logger.Infof("formatting encrypted volume %s/%s with LUKS on %s", opts.Pool, opts.Image, devicePath)
+		// LUKS1 is requested explicitly since the LUKS2 default of newer cryptsetup versions needs the passphrase to
+		// resize the device when the volume is expanded
+		err = c.context.Executor.ExecuteCommand(false, "", cryptsetupTool, "-q", "luksFormat", "--type", "luks1", "--key-file="+keyFile, devicePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to format volume %s/%s with LUKS. %+v", opts.Pool, opts.Image, err)
+		}
+	}
+
+	err = c.context.Executor.ExecuteCommand(false, "", cryptsetupTool, "luksOpen", "--key-file="+keyFile, devicePath, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open encrypted volume %s/%s. %+v", opts.Pool, opts.Image, err)
+	}
+	logger.Infof("opened encrypted volume %s/%s on %s", opts.Pool, opts.Image, encryptedPath)
+	return encryptedPath, nil
+}
+
+// closeEncryptedDevice closes the LUKS device of a volume if it is open, so that its image can be unmapped
+func (c *Controller) closeEncryptedDevice(pool, image string) error {
+	name := encryptedDeviceName(pool, image)
+	if _, err := os.Stat(path.Join(devMapperDir, name)); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := c.context.Executor.ExecuteCommand(false, "", cryptsetupTool, "luksClose", name); err != nil {
+		return fmt.Errorf("failed to close encrypted volume %s/%s. %+v", pool, image, err)
+	}
+	logger.Infof("closed encrypted volume %s/%s", pool, image)
+	return nil
+}
+
+// writes the passphrase of an encrypted volume from its secret to a temporary key file
+func (c *Controller) writeVolumeKey(opts AttachOptions) (string, error) {
+	secretName := VolumeKeySecretName(opts.Image)
+	secret, err := c.context.Clientset.CoreV1().Secrets(opts.ClusterName).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s of encrypted volume %s/%s in cluster %s. %+v", secretName, opts.Pool, opts.Image, opts.ClusterName, err)
+	}
+	passphrase, ok := secret.Data[volumeKeySecretKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no passphrase for volume %s/%s", secretName, opts.Pool, opts.Image)
+	}
+
+	keyFile, err := ioutil.TempFile("", opts.Image+".key")
+	if err != nil {
+		return "", fmt.Errorf("failed to create key file for volume %s/%s. %+v", opts.Pool, opts.Image, err)
+	}
+	defer keyFile.Close()
+	if _, err := keyFile.Write(passphrase); err != nil {
+		os.Remove(keyFile.Name())
+		return "", fmt.Errorf("failed to write key file for volume %s/%s. %+v", opts.Pool, opts.Image, err)
+	}
+	return keyFile.Name(), nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flexvolume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOpenEncryptedDevice(t *testing.T) {
+	mapperDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(mapperDir)
+	devMapperDir = mapperDir
+	defer func() { devMapperDir = "/dev/mapper" }()
+
+	clientset := fake.NewSimpleClientset()
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-volume-key-image1", Namespace: "mycluster"},
+		Data:       VolumeKeySecretData("secret-passphrase"),
+	}
+	clientset.CoreV1().Secrets("mycluster").Create(secret)
+
+	isLuks := false
+	blkidOutput := ""
+	var commands []string
+	var formatArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			assert.Equal(t, "cryptsetup", command)
+			commands = append(commands, args[0])
+			if len(args) > 1 && args[1] == "luksFormat" {
+				formatArgs = args
+			}
+			if args[0] == "isLuks" && !isLuks {
+				return errors.New("not a luks device")
+			}
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "--key-file=") {
+					key, err := ioutil.ReadFile(strings.TrimPrefix(arg, "--key-file="))
+					assert.Nil(t, err)
+					assert.Equal(t, "secret-passphrase", string(key))
+				}
+			}
+			return nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "blkid", command)
+			return blkidOutput, nil
+		},
+	}
+	c := &Controller{context: &clusterd.Context{Clientset: clientset, Executor: executor}}
+	opts := AttachOptions{Image: "image1", Pool: "pool1", ClusterName: "mycluster"}
+
+	// an empty device is formatted with LUKS before it is opened
+	devicePath, err := c.openEncryptedDevice(opts, "/dev/rbd3")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(mapperDir, "rook-pool1-image1"), devicePath)
+	// the batch mode flag comes before luksFormat
+	assert.Equal(t, []string{"isLuks", "-q", "luksOpen"}, commands)
+	// the device is formatted with LUKS1, which is resized without the passphrase
+	assert.Equal(t, []string{"-q", "luksFormat", "--type", "luks1"}, formatArgs[:4])
+	assert.Equal(t, "/dev/rbd3", formatArgs[5])
+
+	// a device with data that is not formatted with LUKS is not overwritten
+	commands = nil
+	blkidOutput = "/dev/rbd3: UUID=\"1234\" TYPE=\"ext4\""
+	_, err = c.openEncryptedDevice(opts, "/dev/rbd3")
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"isLuks"}, commands)
+
+	// a LUKS device is only opened
+	commands = nil
+	isLuks = true
+	_, err = c.openEncryptedDevice(opts, "/dev/rbd3")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"isLuks", "luksOpen"}, commands)
+
+	// the device is not opened again
+	commands = nil
+	ioutil.WriteFile(path.Join(mapperDir, "rook-pool1-image1"), []byte{}, 0644)
+	devicePath, err = c.openEncryptedDevice(opts, "/dev/rbd3")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(mapperDir, "rook-pool1-image1"), devicePath)
+	assert.Equal(t, 0, len(commands))
+
+	// the open device is closed
+	err = c.closeEncryptedDevice("pool1", "image1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"luksClose"}, commands)
+
+	// a volume that is not open is not closed
+	commands = nil
+	err = c.closeEncryptedDevice("pool1", "image2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the passphrase is required
+	_, err = c.openEncryptedDevice(AttachOptions{Image: "image2", Pool: "pool1", ClusterName: "mycluster"}, "/dev/rbd4")
+	assert.NotNil(t, err)
+}
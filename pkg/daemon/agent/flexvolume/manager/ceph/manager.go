@@ -18,12 +18,17 @@ package ceph
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
 	cephclient "github.com/rook/rook/pkg/daemon/ceph/client"
 	cephmon "github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/daemon/ceph/util"
@@ -34,15 +39,22 @@ import (
 
 const (
 	findDevicePathMaxRetries = 10
+	deviceSizeMaxRetries     = 10
 	rbdKernelModuleName      = "rbd"
+	nbdKernelModuleName      = "nbd"
 )
 
+// the sysfs dir where the size of the block devices is found
+var sysBlockPath = "/sys/block"
+
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "ceph-volumeattacher")
 
 // VolumeManager represents an object for perform volume attachment requests for Ceph volumes
 type VolumeManager struct {
 	context          *clusterd.Context
 	devicePathFinder model.DevicePathFinder
+	// the volumes are mapped with rbd-nbd by default when the rbd kernel module cannot be loaded
+	krbdUnavailable bool
 }
 
 type devicePathFinder struct{}
@@ -73,16 +85,16 @@ func (vm *VolumeManager) Init() error {
 	}
 
 	// load the rbd kernel module with options
-	// TODO: should this fail if modprobe fails?
 	if err := sys.LoadKernelModule(rbdKernelModuleName, opts, vm.context.Executor); err != nil {
-		logger.Noticef("failed to load kernel module %s: %+v", rbdKernelModuleName, err)
+		logger.Noticef("failed to load kernel module %s, volumes will be mapped with %s by default: %+v", rbdKernelModuleName, flexvolume.MounterNBD, err)
+		vm.krbdUnavailable = true
 	}
 
 	return nil
 }
 
-// Attach a ceph image to the node
-func (vm *VolumeManager) Attach(image, pool, clusterName string) (string, error) {
+// Attach a ceph image to the node with the rbd kernel module or with rbd-nbd
+func (vm *VolumeManager) Attach(image, pool, clusterName, mounter string) (string, error) {
 
 	// check if the volume is already attached
 	devicePath, err := vm.isAttached(image, pool, clusterName)
@@ -102,6 +114,17 @@ func (vm *VolumeManager) Attach(image, pool, clusterName string) (string, error)
 		return "", fmt.Errorf("failed to load cluster information from cluster %s: %+v", clusterName, err)
 	}
 
+	if vm.getMounter(mounter) == flexvolume.MounterNBD {
+		if err := sys.LoadKernelModule(nbdKernelModuleName, nil, vm.context.Executor); err != nil {
+			logger.Noticef("failed to load kernel module %s: %+v", nbdKernelModuleName, err)
+		}
+		devicePath, err := cephclient.MapImageNBD(vm.context, image, pool, clusterName, keyring, monitors)
+		if err != nil {
+			return "", fmt.Errorf("failed to map image %s/%s cluster %s. %+v", pool, image, clusterName, err)
+		}
+		return devicePath, nil
+	}
+
 	err = cephclient.MapImage(vm.context, image, pool, clusterName, keyring, monitors)
 	if err != nil {
 		return "", fmt.Errorf("failed to map image %s/%s cluster %s. %+v", pool, image, clusterName, err)
@@ -142,6 +165,14 @@ func (vm *VolumeManager) Detach(image, pool, clusterName string, force bool) err
 	}
 
 	logger.Infof("detaching volume %s/%s cluster %s", pool, image, clusterName)
+	if isNBDDevice(devicePath) {
+		if err := cephclient.UnMapImageNBD(vm.context, devicePath); err != nil {
+			return fmt.Errorf("failed to detach volume %s/%s cluster %s. %+v", pool, image, clusterName, err)
+		}
+		logger.Infof("detached volume %s/%s", pool, image)
+		return nil
+	}
+
 	monitors, keyring, err := getClusterInfo(vm.context, clusterName)
 	defer os.Remove(keyring)
 	if err != nil {
@@ -156,6 +187,207 @@ func (vm *VolumeManager) Detach(image, pool, clusterName string, force bool) err
 	return nil
 }
 
+// Fence blacklists the clients of another node that may still write to an image, such as a node that still has the
+// image mapped after its pod was deleted, so that they cannot write to the image once it is attached to this node. The
+// clients that the other node recorded when it mapped the image are blacklisted even if they no longer watch the image,
+// such as when their watch timed out during a network partition, as well as the clients of the other nodes that watch
+// the image. The clients of this node are not blacklisted. The addresses of the blacklisted clients are returned.
+func (vm *VolumeManager) Fence(image, pool, clusterName string, clients []string) ([]string, error) {
+	monitors, keyring, err := getClusterInfo(vm.context, clusterName)
+	defer os.Remove(keyring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cluster information from cluster %s: %+v", clusterName, err)
+	}
+
+	watchers, err := cephclient.GetImageWatchers(vm.context, image, pool, clusterName, keyring, monitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the clients of volume %s/%s: %+v", pool, image, err)
+	}
+	local, err := localAddresses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the addresses of the node: %+v", err)
+	}
+	_, remote, err := splitWatchers(watchers, local)
+	if err != nil {
+		return nil, err
+	}
+
+	fenced := []string{}
+	blacklisted := map[string]bool{}
+	for _, address := range append(clients, remote...) {
+		if blacklisted[address] {
+			continue
+		}
+		host, err := clientHost(address)
+		if err != nil {
+			return nil, err
+		}
+		if local[host] {
+			continue
+		}
+
+		logger.Infof("blacklisting client at %s of volume %s/%s", address, pool, image)
+		if err := cephclient.BlacklistClient(vm.context, clusterName, address, keyring, monitors); err != nil {
+			return nil, fmt.Errorf("failed to fence volume %s/%s: %+v", pool, image, err)
+		}
+		blacklisted[address] = true
+		fenced = append(fenced, address)
+	}
+	return fenced, nil
+}
+
+// ClientAddress returns the address of the client of this node that watches a mapped image, which is recorded in the
+// attachment of the volume so that the client can be fenced even after it stopped watching the image
+func (vm *VolumeManager) ClientAddress(image, pool, clusterName string) (string, error) {
+	monitors, keyring, err := getClusterInfo(vm.context, clusterName)
+	defer os.Remove(keyring)
+	if err != nil {
+		return "", fmt.Errorf("failed to load cluster information from cluster %s: %+v", clusterName, err)
+	}
+
+	watchers, err := cephclient.GetImageWatchers(vm.context, image, pool, clusterName, keyring, monitors)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the clients of volume %s/%s: %+v", pool, image, err)
+	}
+	local, err := localAddresses()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the addresses of the node: %+v", err)
+	}
+	localWatchers, _, err := splitWatchers(watchers, local)
+	if err != nil {
+		return "", err
+	}
+	if len(localWatchers) == 0 {
+		return "", fmt.Errorf("no client of this node watches volume %s/%s", pool, image)
+	}
+	return localWatchers[0], nil
+}
+
+// splitWatchers returns the addresses of the clients of this node and of the other nodes that watch an image
+func splitWatchers(watchers []cephclient.ImageWatcher, local map[string]bool) ([]string, []string, error) {
+	localWatchers := []string{}
+	remoteWatchers := []string{}
+	for _, watcher := range watchers {
+		host, err := clientHost(watcher.Address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid address %s of client %d: %+v", watcher.Address, watcher.Client, err)
+		}
+		if local[host] {
+			localWatchers = append(localWatchers, watcher.Address)
+		} else {
+			remoteWatchers = append(remoteWatchers, watcher.Address)
+		}
+	}
+	return localWatchers, remoteWatchers, nil
+}
+
+// clientHost returns the IP of a client address, which is ip:port/nonce
+func clientHost(address string) (string, error) {
+	host, _, err := net.SplitHostPort(strings.Split(address, "/")[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid client address %s: %+v", address, err)
+	}
+	return host, nil
+}
+
+// the IP addresses of the node, which are the addresses of its ceph clients since the agent runs on the host network
+var localAddresses = getLocalAddresses
+
+func getLocalAddresses() (map[string]bool, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]bool{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			local[ipNet.IP.String()] = true
+		}
+	}
+	return local, nil
+}
+
+// Expand grows the filesystem of an attached volume to the new size of its image. The kernel updates the size of the
+// device when the image is resized, after which the LUKS device of an encrypted volume is resized, and the filesystem
+// is grown in the mount namespace of the host where it is mounted.
+func (vm *VolumeManager) Expand(image, pool, clusterName, mountPath, fsType string, size uint64, encrypted bool) error {
+	devicePath, err := vm.isAttached(image, pool, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to check if volume %s/%s is attached cluster %s. %+v", pool, image, clusterName, err)
+	}
+	if devicePath == "" {
+		return fmt.Errorf("volume %s/%s is not attached cluster %s", pool, image, clusterName)
+	}
+
+	// poll until the device has the new size of the image
+	retryCount := 0
+	for {
+		deviceSize, err := getDeviceSize(devicePath)
+		if err != nil {
+			return err
+		}
+		if deviceSize >= size {
+			break
+		}
+
+		retryCount++
+		if retryCount >= deviceSizeMaxRetries {
+			return fmt.Errorf("exceeded retry count while waiting for device %s to grow from %d to %d bytes", devicePath, deviceSize, size)
+		}
+		logger.Infof("device %s has %d bytes, waiting for %d bytes", devicePath, deviceSize, size)
+		<-time.After(time.Second)
+	}
+
+	if encrypted {
+		// the filesystem of an encrypted volume is on its LUKS device
+		devicePath, err = flexvolume.ResizeEncryptedDevice(vm.context, pool, image)
+		if err != nil {
+			return err
+		}
+	}
+
+	tool, args, err := sys.GrowFilesystemCommand(devicePath, mountPath, fsType)
+	if err != nil {
+		return err
+	}
+	logger.Infof("growing the filesystem of volume %s/%s on %s", pool, image, devicePath)
+	hostArgs := append([]string{"--target", "1", "--mount", "--", tool}, args...)
+	cmd := fmt.Sprintf("grow filesystem on %s", devicePath)
+	if err := vm.context.Executor.ExecuteCommand(false, cmd, "nsenter", hostArgs...); err != nil {
+		return fmt.Errorf("failed to grow the filesystem of volume %s/%s. %+v", pool, image, err)
+	}
+	return nil
+}
+
+// gets the size in bytes of a block device from the number of 512 byte sectors in sysfs
+func getDeviceSize(devicePath string) (uint64, error) {
+	sizePath := path.Join(sysBlockPath, filepath.Base(devicePath), "size")
+	buf, err := ioutil.ReadFile(sizePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the size of device %s. %+v", devicePath, err)
+	}
+	sectors, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the size of device %s. %+v", devicePath, err)
+	}
+	return sectors * 512, nil
+}
+
+// the mounter of a volume defaults to krbd unless the rbd kernel module is not available
+func (vm *VolumeManager) getMounter(mounter string) string {
+	if mounter == "" {
+		if vm.krbdUnavailable {
+			return flexvolume.MounterNBD
+		}
+		return flexvolume.MounterKRBD
+	}
+	return mounter
+}
+
+func isNBDDevice(devicePath string) bool {
+	return strings.HasPrefix(devicePath, util.DevicePathPrefix+util.NBDDevicePrefix)
+}
+
 // Check if the volume is attached
 func (vm *VolumeManager) isAttached(image, pool, clusterName string) (string, error) {
 	devicePath, err := vm.devicePathFinder.FindDevicePath(image, pool, clusterName)
@@ -189,8 +421,17 @@ func getClusterInfo(context *clusterd.Context, clusterName string) (string, stri
 	return strings.Join(monEndpoints, ","), keyringFile.Name(), nil
 }
 
-// FindDevicePath polls and wait for the mapped ceph image device to show up
+// FindDevicePath polls and wait for the mapped ceph image device to show up. The image is either mapped by the rbd
+// kernel module or by an rbd-nbd daemon.
 func (f *devicePathFinder) FindDevicePath(image, pool, clusterName string) (string, error) {
+	nbdDevice, err := util.FindNBDMappedDevice(image, pool, util.SysBlockPathDefault, util.ProcPathDefault)
+	if err != nil {
+		return "", fmt.Errorf("failed to find nbd mapped image: %+v", err)
+	}
+	if nbdDevice != "" {
+		return util.DevicePathPrefix + nbdDevice, nil
+	}
+
 	mappedFile, err := util.FindRBDMappedFile(image, pool, util.RBDSysBusPathDefault)
 	if err != nil {
 		return "", fmt.Errorf("failed to find mapped image: %+v", err)
@@ -134,6 +134,8 @@ func TestAttach(t *testing.T) {
 			assert.Contains(t, args[7], "10.0.0.1:6790", fmt.Sprintf("But '%s' does contain '%s'", args[7], "10.0.0.1:6790"))
 			assert.Contains(t, args[7], "10.0.0.2:6790", fmt.Sprintf("But '%s' does contain '%s'", args[7], "10.0.0.2:6790"))
 			assert.Contains(t, args[7], "10.0.0.3:6790", fmt.Sprintf("But '%s' does contain '%s'", args[7], "10.0.0.3:6790"))
+			// the image gets its own client so that fencing it does not fence the other images of the node
+			assert.Equal(t, []string{"-o", "noshare"}, args[9:])
 			return "", nil
 		},
 	}
@@ -152,7 +154,7 @@ func TestAttach(t *testing.T) {
 	}
 	mon.CreateOrLoadClusterInfo(context, clusterName, &metav1.OwnerReference{})
 
-	devicePath, err := vm.Attach("image1", "testpool", clusterName)
+	devicePath, err := vm.Attach("image1", "testpool", clusterName, "")
 	assert.Equal(t, "/dev/rbd3", devicePath)
 	assert.Nil(t, err)
 }
@@ -165,7 +167,7 @@ func TestAttachAlreadyExists(t *testing.T) {
 			called:   0,
 		},
 	}
-	devicePath, err := vm.Attach("image1", "testpool", "testCluster")
+	devicePath, err := vm.Attach("image1", "testpool", "testCluster", "")
 	assert.Equal(t, "/dev/rbd3", devicePath)
 	assert.Nil(t, err)
 }
@@ -233,3 +235,186 @@ func TestAlreadyDetached(t *testing.T) {
 	err := vm.Detach("image1", "testpool", "testCluster", false)
 	assert.Nil(t, err)
 }
+
+func TestAttachDetachNBD(t *testing.T) {
+	clientset := test.New(3)
+	clusterName := "testCluster"
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	cm := &v1.ConfigMap{
+		Data: map[string]string{
+			"data": "rook-ceph-mon0=10.0.0.1:6790",
+		},
+	}
+	cm.Name = "rook-ceph-mon-endpoints"
+	clientset.CoreV1().ConfigMaps(clusterName).Create(cm)
+
+	modprobeModule := ""
+	var nbdArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			assert.Equal(t, "modprobe", command)
+			modprobeModule = args[0]
+			return nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if strings.Contains(command, "ceph-authtool") {
+				cephtest.CreateConfigDir(path.Join(configDir, clusterName))
+			}
+			if command == "nsenter" {
+				// systemd is not running on the host
+				return "", fmt.Errorf("systemd-run: command not found")
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "rbd-nbd", command)
+			nbdArgs = args
+			return "/dev/nbd0\n", nil
+		},
+	}
+
+	context := &clusterd.Context{
+		Clientset: clientset,
+		Executor:  executor,
+		ConfigDir: configDir,
+	}
+	vm := &VolumeManager{
+		context: context,
+		devicePathFinder: &fakeDevicePathFinder{
+			response: []string{"", "/dev/nbd0"},
+			called:   0,
+		},
+		krbdUnavailable: true,
+	}
+	mon.CreateOrLoadClusterInfo(context, clusterName, &metav1.OwnerReference{})
+
+	// the image is mapped with rbd-nbd since the rbd kernel module is not available
+	devicePath, err := vm.Attach("image1", "testpool", clusterName, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/nbd0", devicePath)
+	assert.Equal(t, "nbd", modprobeModule)
+	assert.Equal(t, "map", nbdArgs[0])
+	assert.Equal(t, "testpool/image1", nbdArgs[1])
+
+	// the nbd device is unmapped without the mounter
+	err = vm.Detach("image1", "testpool", clusterName, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"unmap", "/dev/nbd0"}, nbdArgs)
+}
+
+func TestFence(t *testing.T) {
+	clientset := test.New(3)
+	clusterName := "testCluster"
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	cm := &v1.ConfigMap{
+		Data: map[string]string{
+			"data": "rook-ceph-mon0=10.0.0.1:6790",
+		},
+	}
+	cm.Name = "rook-ceph-mon-endpoints"
+	clientset.CoreV1().ConfigMaps(clusterName).Create(cm)
+
+	localAddresses = func() (map[string]bool, error) {
+		return map[string]bool{"10.0.0.5": true}, nil
+	}
+	defer func() { localAddresses = getLocalAddresses }()
+
+	blacklisted := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if strings.Contains(command, "ceph-authtool") {
+				cephtest.CreateConfigDir(path.Join(configDir, clusterName))
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" {
+				assert.Equal(t, "status", args[0])
+				return `{"watchers":[{"address":"10.0.0.4:0/1234","client":4100},{"address":"10.0.0.5:0/5678","client":4200}]}`, nil
+			}
+			assert.Equal(t, "ceph", command)
+			blacklisted = append(blacklisted, args[3])
+			return "", nil
+		},
+	}
+
+	context := &clusterd.Context{
+		Clientset: clientset,
+		Executor:  executor,
+		ConfigDir: configDir,
+	}
+	vm := &VolumeManager{context: context}
+	mon.CreateOrLoadClusterInfo(context, clusterName, &metav1.OwnerReference{})
+
+	// only the client of the other node is blacklisted
+	fenced, err := vm.Fence("image1", "testpool", clusterName, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.4:0/1234"}, fenced)
+	assert.Equal(t, []string{"10.0.0.4:0/1234"}, blacklisted)
+
+	// the recorded clients are blacklisted even if they no longer watch the image, and each client only once
+	blacklisted = []string{}
+	fenced, err = vm.Fence("image1", "testpool", clusterName, []string{"10.0.0.6:0/4321", "10.0.0.4:0/1234"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.6:0/4321", "10.0.0.4:0/1234"}, fenced)
+	assert.Equal(t, fenced, blacklisted)
+
+	// the client of this node that watches the image is its address
+	address, err := vm.ClientAddress("image1", "testpool", clusterName)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.5:0/5678", address)
+}
+
+func TestExpand(t *testing.T) {
+	sysDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(sysDir)
+	sysBlockPath = sysDir
+	defer func() { sysBlockPath = "/sys/block" }()
+	os.MkdirAll(path.Join(sysDir, "rbd3"), 0755)
+	ioutil.WriteFile(path.Join(sysDir, "rbd3", "size"), []byte("4194304\n"), 0644) // 2GiB
+
+	growArgs := []string{}
+	resized := ""
+	vm := &VolumeManager{
+		context: &clusterd.Context{
+			Executor: &exectest.MockExecutor{
+				MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+					if command == "cryptsetup" {
+						assert.Equal(t, "resize", args[0])
+						resized = args[1]
+						return nil
+					}
+					assert.Equal(t, "nsenter", command)
+					growArgs = args
+					return nil
+				},
+			},
+		},
+		devicePathFinder: &fakeDevicePathFinder{
+			response: []string{"/dev/rbd3", "/dev/rbd3", "/dev/rbd3", ""},
+			called:   0,
+		},
+	}
+
+	// the filesystem is grown in the mount namespace of the host
+	err := vm.Expand("image1", "testpool", "testCluster", "/mnt/image1", "ext4", uint64(2147483648), false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--target", "1", "--mount", "--", "resize2fs", "/dev/rbd3"}, growArgs)
+
+	err = vm.Expand("image1", "testpool", "testCluster", "/mnt/image1", "xfs", uint64(2147483648), false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--target", "1", "--mount", "--", "xfs_growfs", "/mnt/image1"}, growArgs)
+	assert.Equal(t, "", resized)
+
+	// the LUKS device of an encrypted volume is resized before its filesystem is grown
+	err = vm.Expand("image1", "testpool", "testCluster", "/mnt/image1", "ext4", uint64(2147483648), true)
+	assert.Nil(t, err)
+	assert.Equal(t, "rook-testpool-image1", resized)
+	assert.Equal(t, []string{"--target", "1", "--mount", "--", "resize2fs", "/dev/mapper/rook-testpool-image1"}, growArgs)
+
+	// the volume must be attached
+	err = vm.Expand("image1", "testpool", "testCluster", "/mnt/image1", "ext4", uint64(2147483648), false)
+	assert.NotNil(t, err)
+}
@@ -20,9 +20,12 @@ import "fmt"
 
 // FakeVolumeManager represents a fake (mocked) implementation of the VolumeManager interface for testing.
 type FakeVolumeManager struct {
-	FakeInit   func() error
-	FakeAttach func(image, pool, clusterName string) (string, error)
-	FakeDetach func(image, pool, clusterName string, force bool) error
+	FakeInit          func() error
+	FakeAttach        func(image, pool, clusterName, mounter string) (string, error)
+	FakeDetach        func(image, pool, clusterName string, force bool) error
+	FakeFence         func(image, pool, clusterName string, clients []string) ([]string, error)
+	FakeClientAddress func(image, pool, clusterName string) (string, error)
+	FakeExpand        func(image, pool, clusterName, mountPath, fsType string, size uint64, encrypted bool) error
 }
 
 // Init initializes the FakeVolumeManager
@@ -34,9 +37,9 @@ func (f *FakeVolumeManager) Init() error {
 }
 
 // Attach a volume image to the node
-func (f *FakeVolumeManager) Attach(image, pool, clusterName string) (string, error) {
+func (f *FakeVolumeManager) Attach(image, pool, clusterName, mounter string) (string, error) {
 	if f.FakeAttach != nil {
-		return f.FakeAttach(image, pool, clusterName)
+		return f.FakeAttach(image, pool, clusterName, mounter)
 	}
 	return fmt.Sprintf("/%s/%s/%s", image, pool, clusterName), nil
 }
@@ -48,3 +51,27 @@ func (f *FakeVolumeManager) Detach(image, pool, clusterName string, force bool)
 	}
 	return nil
 }
+
+// Fence blacklists the recorded clients and the clients of the other nodes where a volume image is mapped
+func (f *FakeVolumeManager) Fence(image, pool, clusterName string, clients []string) ([]string, error) {
+	if f.FakeFence != nil {
+		return f.FakeFence(image, pool, clusterName, clients)
+	}
+	return []string{}, nil
+}
+
+// ClientAddress returns the address of the client of the node that maps a volume image
+func (f *FakeVolumeManager) ClientAddress(image, pool, clusterName string) (string, error) {
+	if f.FakeClientAddress != nil {
+		return f.FakeClientAddress(image, pool, clusterName)
+	}
+	return "", nil
+}
+
+// Expand grows the filesystem of a volume attached to the node
+func (f *FakeVolumeManager) Expand(image, pool, clusterName, mountPath, fsType string, size uint64, encrypted bool) error {
+	if f.FakeExpand != nil {
+		return f.FakeExpand(image, pool, clusterName, mountPath, fsType, size, encrypted)
+	}
+	return nil
+}
@@ -21,11 +21,27 @@ const (
 	ReadWrite = "rw"
 )
 
+// The mounters that attach the volumes. When a volume has no mounter, the kernel mounters are used if the node
+// supports them, or else the user space mounters.
+const (
+	// MounterKRBD maps block volumes with the rbd kernel module
+	MounterKRBD = "krbd"
+	// MounterNBD maps block volumes to nbd devices with an rbd-nbd daemon
+	MounterNBD = "rbd-nbd"
+	// MounterKernel mounts file system volumes with the ceph kernel module
+	MounterKernel = "kernel"
+	// MounterFuse mounts file system volumes with a ceph-fuse daemon
+	MounterFuse = "fuse"
+)
+
 // VolumeManager handles flexvolume plugin storage operations
 type VolumeManager interface {
 	Init() error
-	Attach(image, pool, clusterName string) (string, error)
+	Attach(image, pool, clusterName, mounter string) (string, error)
 	Detach(image, pool, clusterName string, force bool) error
+	Fence(image, pool, clusterName string, clients []string) ([]string, error)
+	ClientAddress(image, pool, clusterName string) (string, error)
+	Expand(image, pool, clusterName, mountPath, fsType string, size uint64, encrypted bool) error
 }
 
 type VolumeController interface {
@@ -44,7 +60,10 @@ type AttachOptions struct {
 	StorageClass string `json:"storageClass"`
 	MountDir     string `json:"mountDir"`
 	FsName       string `json:"fsName"`
-	Path         string `json:"path"` // Path within the CephFS to mount
+	Path         string `json:"path"`      // Path within the CephFS to mount
+	Client       string `json:"client"`    // cephx client restricted to the path of a provisioned CephFS volume
+	Mounter      string `json:"mounter"`   // krbd or rbd-nbd for block volumes, kernel or fuse for CephFS
+	Encrypted    string `json:"encrypted"` // whether the block volume is encrypted with LUKS
 	RW           string `json:"kubernetes.io/readwrite"`
 	FsType       string `json:"kubernetes.io/fsType"`
 	VolumeName   string `json:"kubernetes.io/pvOrVolumeName"` // only available on 1.7
@@ -105,7 +105,7 @@ func TestCreateFileSystemHandler(t *testing.T) {
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
 			logger.Infof("Command: %s %v", command, args)
 			if args[1] == "pool" {
-				if args[2] == "create" || args[2] == "set" || args[2] == "application" {
+				if args[2] == "create" || args[2] == "set" || args[2] == "set-quota" || args[2] == "application" {
 					return "", nil
 				}
 			}
@@ -166,6 +166,10 @@ func TestCreatePoolHandler(t *testing.T) {
 			return "", nil
 		case args[1] == "pool" && args[2] == "create":
 			return "", nil
+		case args[1] == "pool" && args[2] == "set-quota":
+			return "", nil
+		case args[1] == "pool" && args[2] == "set" && args[4] == "compression_mode":
+			return "", nil
 		case args[1] == "pool" && args[2] == "application" && args[3] == "enable":
 			assert.Equal(t, "ecPool1", args[4])
 			assert.Equal(t, "ecPool1", args[5])
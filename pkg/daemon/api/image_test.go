@@ -218,6 +218,8 @@ func TestDeleteImageHandler(t *testing.T) {
 	}
 	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
 		switch {
+		case command == "rbd" && args[0] == "snap" && args[1] == "ls":
+			return "[]", nil
 		case command == "rbd" && args[0] == "rm":
 			return "", nil
 		}
@@ -241,6 +243,8 @@ func TestDeleteImageHandlerFailure(t *testing.T) {
 	w := httptest.NewRecorder()
 	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
 		switch {
+		case command == "rbd" && args[0] == "snap" && args[1] == "ls":
+			return "[]", nil
 		case command == "rbd" && args[0] == "rm":
 			return "mock failure", fmt.Errorf("mock failure to remove image")
 		}
@@ -78,6 +78,7 @@ func createCollectors(context *clusterd.Context, clusterName string) []prometheu
 		collectors.NewClusterHealthCollector(context, clusterName),
 		collectors.NewMonitorCollector(context, clusterName),
 		collectors.NewOSDCollector(context, clusterName),
+		collectors.NewDeviceHealthCollector(context, clusterName),
 		collectors.NewPoolUsageCollector(context, clusterName),
 	}
 }
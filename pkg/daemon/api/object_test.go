@@ -48,7 +48,7 @@ func TestCreateObjectStoreHandler(t *testing.T) {
 				return `{"key":"mykey"}`, nil
 			}
 			if args[1] == "pool" {
-				if args[2] == "create" {
+				if args[2] == "create" || args[2] == "set-quota" || (args[2] == "set" && args[4] == "compression_mode") {
 					return "", nil
 				}
 				if args[2] == "set" && args[4] == "size" {
@@ -21,11 +21,19 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
 
+const (
+	// the range of pool sizes of the default rule, which is also given to new rules when there is no other rule
+	// of their type
+	defaultCrushRuleMinSize = 1
+	defaultCrushRuleMaxSize = 10
+)
+
 const defaultCrushMap = `# begin crush map
 tunable choose_local_tries 0
 tunable choose_local_fallback_tries 0
@@ -46,8 +54,9 @@ type 5 pdu
 type 6 pod
 type 7 room
 type 8 datacenter
-type 9 region
-type 10 root
+type 9 zone
+type 10 region
+type 11 root
 
 # default bucket
 root default {
@@ -60,8 +69,8 @@ root default {
 rule replicated_ruleset {
 	ruleset 0
 	type replicated
-	min_size 1
-	max_size 10
+	min_size %d
+	max_size %d
 	step take default
 	step chooseleaf firstn 0 type host
 	step emit
@@ -171,7 +180,7 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 	defer os.Remove(decompiledMap.Name())
 
 	// write the default decompiled crush map to the temp file
-	_, err = decompiledMap.WriteString(defaultCrushMap)
+	_, err = decompiledMap.WriteString(fmt.Sprintf(defaultCrushMap, defaultCrushRuleMinSize, defaultCrushRuleMaxSize))
 	if err != nil {
 		return "", fmt.Errorf("failed to write decompiled crush map to %s: %+v", decompiledMap.Name(), err)
 	}
@@ -200,6 +209,302 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 	return "", nil
 }
 
+// AddCrushType adds a bucket type to the crush map if it is not already defined. The new type is inserted before the
+// next type and the types are numbered again, which is safe since the buckets and rules refer to the types by name.
+func AddCrushType(context *clusterd.Context, clusterName, typeName, nextType string) error {
+	crushMap, err := GetCrushMap(context, clusterName)
+	if err != nil {
+		return err
+	}
+	for _, t := range crushMap.Types {
+		if t.Name == typeName {
+			return nil
+		}
+	}
+
+	err = editCrushMap(context, clusterName, func(decompiledMap string) (string, error) {
+		return insertCrushType(decompiledMap, typeName, nextType), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add crush type %s. %+v", typeName, err)
+	}
+
+	logger.Infof("added crush type %s", typeName)
+	return nil
+}
+
+// SetCrushRule adds the rule to the crush map, or replaces the steps of the rule if it already exists. The steps
+// are in the format of the decompiled crush map, such as "chooseleaf firstn 0 type host".
+func SetCrushRule(context *clusterd.Context, clusterName, name, ruleType string, steps []string) error {
+	err := editCrushMap(context, clusterName, func(decompiledMap string) (string, error) {
+		return replaceCrushRule(decompiledMap, name, ruleType, steps)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set crush rule %s. %+v", name, err)
+	}
+
+	logger.Infof("set crush rule %s", name)
+	return nil
+}
+
+// gets the current crush map of the cluster in its decompiled text form, changes it with the edit func, and sets the
+// compiled result on the cluster. The decompiled map must be edited for the changes that have no ceph command.
+func editCrushMap(context *clusterd.Context, clusterName string, edit func(string) (string, error)) error {
+	// get the current crush map and decompile it
+	compiledMap, err := ioutil.TempFile("", "")
+	if err != nil {
+		return fmt.Errorf("failed to open compiled crush map temp file: %+v", err)
+	}
+	defer compiledMap.Close()
+	defer os.Remove(compiledMap.Name())
+
+	args := []string{"osd", "getcrushmap", "-o", compiledMap.Name()}
+	if output, err := ExecuteCephCommandPlainNoOutputFile(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to get crushmap: %+v. %s", err, string(output))
+	}
+
+	decompiledMap := compiledMap.Name() + ".txt"
+	defer os.Remove(decompiledMap)
+	if output, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, "-d", compiledMap.Name(), "-o", decompiledMap); err != nil {
+		return fmt.Errorf("failed to decompile crushmap: %+v. %s", err, output)
+	}
+
+	contents, err := ioutil.ReadFile(decompiledMap)
+	if err != nil {
+		return fmt.Errorf("failed to read decompiled crushmap: %+v", err)
+	}
+	edited, err := edit(string(contents))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(decompiledMap, []byte(edited), 0644); err != nil {
+		return fmt.Errorf("failed to write decompiled crushmap: %+v", err)
+	}
+
+	// compile the updated crush map and set it on the cluster
+	if output, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, "-c", decompiledMap, "-o", compiledMap.Name()); err != nil {
+		return fmt.Errorf("failed to compile crushmap: %+v. %s", err, output)
+	}
+	if output, err := SetCrushMap(context, clusterName, compiledMap.Name()); err != nil {
+		return fmt.Errorf("failed to set crushmap: %+v. %s", err, output)
+	}
+
+	return nil
+}
+
+// replaces the rule with the given name in the decompiled crush map, keeping its id, or adds the rule with a new id
+// if it does not exist. The replaced rule keeps its min and max size. A new rule gets the sizes of the other rules
+// of the same type, which are the sizes ceph gave to the rules it created.
+func replaceCrushRule(decompiledMap, name, ruleType string, steps []string) (string, error) {
+	lines := strings.Split(decompiledMap, "\n")
+	result := []string{}
+	ruleIndex := -1
+	ruleID := -1
+	maxID := -1
+	inRule := false
+	currentRule := ""
+	rules := map[string]*crushRuleSize{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "rule" && fields[2] == "{" {
+			inRule = true
+			currentRule = fields[1]
+			rules[currentRule] = &crushRuleSize{}
+			if currentRule == name {
+				ruleIndex = len(result)
+			}
+		}
+		if inRule && len(fields) == 2 {
+			switch fields[0] {
+			case "id", "ruleset":
+				id, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return "", fmt.Errorf("invalid id of rule %s. %+v", currentRule, err)
+				}
+				if id > maxID {
+					maxID = id
+				}
+				if currentRule == name {
+					ruleID = id
+				}
+			case "type":
+				rules[currentRule].ruleType = fields[1]
+			case "min_size", "max_size":
+				size, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return "", fmt.Errorf("invalid %s of rule %s. %+v", fields[0], currentRule, err)
+				}
+				if fields[0] == "min_size" {
+					rules[currentRule].min = size
+				} else {
+					rules[currentRule].max = size
+				}
+			}
+		}
+
+		// the lines of the rule being replaced are dropped
+		if !inRule || currentRule != name {
+			result = append(result, line)
+		}
+		if inRule && len(fields) == 1 && fields[0] == "}" {
+			inRule = false
+		}
+	}
+
+	if ruleIndex == -1 {
+		// new rules are added before the end of the map
+		ruleIndex = len(result)
+		for i, line := range result {
+			if strings.TrimSpace(line) == "# end crush map" {
+				ruleIndex = i
+				break
+			}
+		}
+		ruleID = maxID + 1
+	}
+
+	size := newCrushRuleSize(rules, name, ruleType)
+	rule := []string{
+		fmt.Sprintf("rule %s {", name),
+		fmt.Sprintf("\tid %d", ruleID),
+		fmt.Sprintf("\ttype %s", ruleType),
+		fmt.Sprintf("\tmin_size %d", size.min),
+		fmt.Sprintf("\tmax_size %d", size.max),
+	}
+	for _, step := range steps {
+		rule = append(rule, fmt.Sprintf("\tstep %s", step))
+	}
+	rule = append(rule, "}")
+
+	result = append(result[:ruleIndex], append(rule, result[ruleIndex:]...)...)
+	return strings.Join(result, "\n"), nil
+}
+
+// the range of pool sizes a crush rule applies to
+type crushRuleSize struct {
+	ruleType string
+	min      int
+	max      int
+}
+
+// gets the sizes of the rule with the given name if it exists, or else the widest sizes of the other rules of the
+// same type. The sizes of the default rule of ceph are used only if there is no rule of the type.
+func newCrushRuleSize(rules map[string]*crushRuleSize, name, ruleType string) crushRuleSize {
+	if existing, ok := rules[name]; ok && existing.max > 0 {
+		return *existing
+	}
+
+	size := crushRuleSize{ruleType: ruleType}
+	for _, r := range rules {
+		if r.ruleType != ruleType || r.max == 0 {
+			continue
+		}
+		if size.max == 0 || r.min < size.min {
+			size.min = r.min
+		}
+		if r.max > size.max {
+			size.max = r.max
+		}
+	}
+	if size.max == 0 {
+		size.min = defaultCrushRuleMinSize
+		size.max = defaultCrushRuleMaxSize
+	}
+	return size
+}
+
+// GetCrushTunablesProfile gets the name of the tunables profile of the crush map
+func GetCrushTunablesProfile(context *clusterd.Context, clusterName string) (string, error) {
+	args := []string{"osd", "crush", "show-tunables"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to get crush tunables. %+v", err)
+	}
+
+	var tunables struct {
+		Profile string `json:"profile"`
+	}
+	if err := json.Unmarshal(buf, &tunables); err != nil {
+		return "", fmt.Errorf("failed to unmarshal crush tunables. %+v", err)
+	}
+	return tunables.Profile, nil
+}
+
+// CrushAddBucket adds a bucket of the given type to the crush map. The bucket is not in the hierarchy until it is moved.
+func CrushAddBucket(context *clusterd.Context, clusterName, name, bucketType string) error {
+	args := []string{"osd", "crush", "add-bucket", name, bucketType}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to add crush bucket %s. %+v", name, err)
+	}
+	return nil
+}
+
+// CrushReweightOSD sets the crush weight of the osd
+func CrushReweightOSD(context *clusterd.Context, clusterName string, id int, weight float64) error {
+	args := []string{"osd", "crush", "reweight", fmt.Sprintf("osd.%d", id), strconv.FormatFloat(weight, 'f', -1, 64)}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to reweight osd %d. %+v", id, err)
+	}
+	return nil
+}
+
+// inserts the type in the types of the decompiled crush map before the next type, or after the last type if the
+// next type is not found
+func insertCrushType(decompiledMap, typeName, nextType string) string {
+	result := []string{}
+	types := []string{}
+	typesIndex := -1
+	for _, line := range strings.Split(decompiledMap, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "type" {
+			// the types are written again where the first one was found
+			if typesIndex == -1 {
+				typesIndex = len(result)
+			}
+			types = append(types, fields[2])
+			continue
+		}
+		result = append(result, line)
+	}
+	if typesIndex == -1 {
+		typesIndex = 0
+	}
+
+	typeLines := formatCrushTypes(types, typeName, nextType)
+	result = append(result[:typesIndex], append(typeLines, result[typesIndex:]...)...)
+	return strings.Join(result, "\n")
+}
+
+func formatCrushTypes(types []string, typeName, nextType string) []string {
+	ordered := []string{}
+	inserted := false
+	for _, t := range types {
+		if t == nextType && !inserted {
+			ordered = append(ordered, typeName)
+			inserted = true
+		}
+		ordered = append(ordered, t)
+	}
+	if !inserted {
+		ordered = append(ordered, typeName)
+	}
+
+	lines := []string{}
+	for i, t := range ordered {
+		lines = append(lines, fmt.Sprintf("type %d %s", i, t))
+	}
+	return lines
+}
+
+// CrushMoveBucket moves a bucket such as a host to the given location in the crush map
+func CrushMoveBucket(context *clusterd.Context, clusterName, name string, location []string) error {
+	args := append([]string{"osd", "crush", "move", name}, location...)
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to move crush bucket %s to %v. %+v", name, location, err)
+	}
+	return nil
+}
+
 func FormatLocation(location, hostName string) ([]string, error) {
 	var pairs []string
 	if location == "" {
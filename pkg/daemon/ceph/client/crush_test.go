@@ -17,6 +17,7 @@ package client
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -273,3 +274,90 @@ func TestCrushLocation(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "is not in a valid format")
 }
+
+func TestInsertCrushType(t *testing.T) {
+	decompiled := `# types
+type 0 osd
+type 1 host
+type 2 region
+type 3 root
+
+# buckets
+root default {
+	id -1		# do not change unnecessarily
+	alg straw
+	hash 0	# rjenkins1
+}
+
+rule replicated_ruleset {
+	ruleset 0
+	type replicated
+	step chooseleaf firstn 0 type host
+}
+`
+	// the zone is inserted below the region and the types after it are renumbered
+	result := insertCrushType(decompiled, "zone", "region")
+	assert.Contains(t, result, "# types\ntype 0 osd\ntype 1 host\ntype 2 zone\ntype 3 region\ntype 4 root\n\n# buckets")
+	assert.Contains(t, result, "\ttype replicated\n\tstep chooseleaf firstn 0 type host\n")
+
+	// the type is added last if the next type is not found
+	result = insertCrushType(decompiled, "zone", "other")
+	assert.Contains(t, result, "type 3 root\ntype 4 zone\n\n# buckets")
+}
+
+func TestReplaceCrushRule(t *testing.T) {
+	decompiled := `# rules
+rule replicated_ruleset {
+	id 0
+	type replicated
+	min_size 1
+	max_size 10
+	step take default
+	step chooseleaf firstn 0 type host
+	step emit
+}
+rule two_dc {
+	id 3
+	type replicated
+	min_size 2
+	max_size 4
+	step take default
+	step emit
+}
+rule ec {
+	id 2
+	type erasure
+	min_size 3
+	max_size 5
+	step take default
+	step chooseleaf indep 0 type host
+	step emit
+}
+
+# end crush map
+`
+	// an existing rule keeps its id
+	steps := []string{"take dc1", "chooseleaf firstn 2 type host", "emit"}
+	result, err := replaceCrushRule(decompiled, "two_dc", "replicated", steps)
+	assert.Nil(t, err)
+	assert.Contains(t, result, "rule two_dc {\n\tid 3\n\ttype replicated\n\tmin_size 2\n\tmax_size 4\n\tstep take dc1\n\tstep chooseleaf firstn 2 type host\n\tstep emit\n}\n\n# end crush map")
+	assert.Equal(t, 1, strings.Count(result, "rule two_dc {"))
+	assert.Contains(t, result, "\tstep chooseleaf firstn 0 type host\n")
+
+	// a new rule gets the next id and is added at the end
+	result, err = replaceCrushRule(decompiled, "by_rack", "erasure", []string{"take default", "chooseleaf indep 0 type rack", "emit"})
+	assert.Nil(t, err)
+	assert.Contains(t, result, "}\n\nrule by_rack {\n\tid 4\n\ttype erasure\n")
+	assert.True(t, strings.HasSuffix(result, "\tstep emit\n}\n# end crush map\n"))
+
+	// a new rule gets the widest sizes of the rules of its type
+	assert.Contains(t, result, "\ttype erasure\n\tmin_size 3\n\tmax_size 5\n\tstep take default\n\tstep chooseleaf indep 0 type rack")
+	result, err = replaceCrushRule(decompiled, "by_host", "replicated", []string{"take default", "emit"})
+	assert.Nil(t, err)
+	assert.Contains(t, result, "rule by_host {\n\tid 4\n\ttype replicated\n\tmin_size 1\n\tmax_size 10\n")
+
+	// the sizes of the default rule are used if there is no rule of the type
+	result, err = replaceCrushRule("# rules\n# end crush map\n", "by_host", "replicated", []string{"take default", "emit"})
+	assert.Nil(t, err)
+	assert.Contains(t, result, "rule by_host {\n\tid 0\n\ttype replicated\n\tmin_size 1\n\tmax_size 10\n")
+}
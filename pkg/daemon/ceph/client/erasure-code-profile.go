@@ -107,10 +107,14 @@ func ModelPoolToCephPool(modelPool model.Pool) CephStoragePoolDetails {
 		Name:          modelPool.Name,
 		Number:        modelPool.Number,
 		FailureDomain: modelPool.FailureDomain,
+		PGCount:       modelPool.PGCount,
 	}
 
 	if modelPool.Type == model.Replicated {
 		pool.Size = modelPool.ReplicatedConfig.Size
+		pool.MinSize = modelPool.ReplicatedConfig.MinSize
+		pool.CrushRoot = modelPool.ReplicatedConfig.CrushRoot
+		pool.PrimaryZone = modelPool.ReplicatedConfig.PrimaryZone
 	} else if modelPool.Type == model.ErasureCoded {
 		pool.ErasureCodeProfile = GetErasureCodeProfileForPool(modelPool.Name)
 	}
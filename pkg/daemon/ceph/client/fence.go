@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// ImageWatcher is a client that watches the header of an image, such as a node where the image is mapped
+type ImageWatcher struct {
+	Address string `json:"address"`
+	Client  int64  `json:"client"`
+}
+
+type imageStatus struct {
+	Watchers []ImageWatcher `json:"watchers"`
+}
+
+// GetImageWatchers lists the clients that watch an RBD image
+func GetImageWatchers(context *clusterd.Context, imageName, poolName, clusterName, keyring, monitors string) ([]ImageWatcher, error) {
+	imageSpec := getImageSpec(imageName, poolName)
+	args := []string{
+		"status",
+		imageSpec,
+		"--id", "admin",
+		fmt.Sprintf("--cluster=%s", clusterName),
+		fmt.Sprintf("--keyring=%s", keyring),
+		"-m", monitors,
+		"--conf=/dev/null", // no config file needed because we are passing all required config as arguments
+		"--format", "json",
+	}
+
+	output, err := ExecuteRBDCommandWithTimeout(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the status of image %s: %+v. output: %s", imageSpec, err, output)
+	}
+
+	var status imageStatus
+	if err := json.Unmarshal([]byte(output), &status); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the status of image %s: %+v. output: %s", imageSpec, err, output)
+	}
+	return status.Watchers, nil
+}
+
+// BlacklistClient adds the address of a client to the OSD blacklist so that the OSDs reject all its requests. The
+// blacklist entry expires after the default blacklist interval of the cluster.
+func BlacklistClient(context *clusterd.Context, clusterName, address, keyring, monitors string) error {
+	args := []string{
+		"osd", "blacklist", "add", address,
+		"--id", "admin",
+		fmt.Sprintf("--cluster=%s", clusterName),
+		fmt.Sprintf("--keyring=%s", keyring),
+		"-m", monitors,
+		"--conf=/dev/null", // no config file needed because we are passing all required config as arguments
+	}
+
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", CephTool, args...)
+	if err != nil {
+		return fmt.Errorf("failed to blacklist client %s: %+v. output: %s", address, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFenceImageWatchers(t *testing.T) {
+	var blacklistArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" {
+				assert.Equal(t, "status", args[0])
+				assert.Equal(t, "pool1/image1", args[1])
+				return `{"watchers":[{"address":"10.0.0.1:0/3366853862","client":4167,"cookie":18446462598732840961}]}`, nil
+			}
+			assert.Equal(t, "ceph", command)
+			blacklistArgs = args
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	watchers, err := GetImageWatchers(context, "image1", "pool1", "mycluster", "/tmp/keyring", "10.0.0.10:6790")
+	assert.Nil(t, err)
+	assert.Equal(t, []ImageWatcher{{Address: "10.0.0.1:0/3366853862", Client: 4167}}, watchers)
+
+	err = BlacklistClient(context, "mycluster", watchers[0].Address, "/tmp/keyring", "10.0.0.10:6790")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd", "blacklist", "add", "10.0.0.1:0/3366853862"}, blacklistArgs[:4])
+}
@@ -22,6 +22,7 @@ import (
 	"strconv"
 
 	"regexp"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -36,6 +37,42 @@ type CephBlockImage struct {
 	Format int    `json:"format"`
 }
 
+// ImageOptions are the optional settings of a new image
+type ImageOptions struct {
+	// DataPool stores the data of the image, such as an erasure coded pool. The metadata stays in the image pool.
+	DataPool string
+	// Format of the image, 1 or 2
+	Format string
+	// Features of the image separated by commas, such as layering,exclusive-lock
+	Features string
+	// ObjectSize is the size of the objects of the image, such as 4M
+	ObjectSize string
+	// StripeUnit is the size of the stripes, such as 64K. It is set with the StripeCount.
+	StripeUnit string
+	// StripeCount is the number of objects a stripe is spread over
+	StripeCount string
+}
+
+func (o ImageOptions) args() []string {
+	var args []string
+	if o.DataPool != "" {
+		args = append(args, "--data-pool", o.DataPool)
+	}
+	if o.Format != "" {
+		args = append(args, "--image-format", o.Format)
+	}
+	if o.Features != "" {
+		args = append(args, "--image-feature", o.Features)
+	}
+	if o.ObjectSize != "" {
+		args = append(args, "--object-size", o.ObjectSize)
+	}
+	if o.StripeUnit != "" {
+		args = append(args, "--stripe-unit", o.StripeUnit, "--stripe-count", o.StripeCount)
+	}
+	return args
+}
+
 func ListImages(context *clusterd.Context, clusterName, poolName string) ([]CephBlockImage, error) {
 	args := []string{"ls", "-l", poolName}
 	buf, err := ExecuteRBDCommand(context, clusterName, args)
@@ -62,6 +99,12 @@ func ListImages(context *clusterd.Context, clusterName, poolName string) ([]Ceph
 }
 
 func CreateImage(context *clusterd.Context, clusterName, name, poolName string, size uint64) (*CephBlockImage, error) {
+	return CreateImageWithOptions(context, clusterName, name, poolName, ImageOptions{}, size)
+}
+
+// CreateImageWithOptions creates an image with the given options. The rbd defaults are used for the options that are
+// not set.
+func CreateImageWithOptions(context *clusterd.Context, clusterName, name, poolName string, opts ImageOptions, size uint64) (*CephBlockImage, error) {
 	if size > 0 && size < ImageMinSize {
 		// rbd tool uses MB as the smallest unit for size input.  0 is OK but anything else smaller
 		// than 1 MB should just be rounded up to 1 MB.
@@ -73,6 +116,7 @@ func CreateImage(context *clusterd.Context, clusterName, name, poolName string,
 	imageSpec := getImageSpec(name, poolName)
 
 	args := []string{"create", imageSpec, "--size", strconv.Itoa(sizeMB)}
+	args = append(args, opts.args()...)
 	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create image %s in pool %s of size %d: %+v. output: %s",
@@ -93,7 +137,21 @@ func CreateImage(context *clusterd.Context, clusterName, name, poolName string,
 	return nil, fmt.Errorf("failed to find image %s after creating it", name)
 }
 
+// DeleteImage deletes an image. An image with snapshots is not deleted since the snapshots must be deleted first.
 func DeleteImage(context *clusterd.Context, clusterName, name, poolName string) error {
+	snapshots, err := ListSnapshots(context, clusterName, poolName, name)
+	if err != nil {
+		return fmt.Errorf("failed to check snapshots before deleting image %s in pool %s: %+v", name, poolName, err)
+	}
+	if len(snapshots) > 0 {
+		names := make([]string, len(snapshots))
+		for i, snapshot := range snapshots {
+			names[i] = snapshot.Name
+		}
+		return fmt.Errorf("image %s in pool %s has snapshots %s. delete the volume snapshots of the image before deleting it",
+			name, poolName, strings.Join(names, ","))
+	}
+
 	imageSpec := getImageSpec(name, poolName)
 	args := []string{"rm", imageSpec}
 	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
@@ -105,7 +163,9 @@ func DeleteImage(context *clusterd.Context, clusterName, name, poolName string)
 	return nil
 }
 
-// MapImage maps an RBD image using admin cephfx and returns the device path
+// MapImage maps an RBD image using admin cephfx and returns the device path. Each image is mapped with its own client
+// instead of sharing the client of the other images mapped on the node, so that blacklisting the client of an image
+// only fences that image.
 func MapImage(context *clusterd.Context, imageName, poolName, clusterName, keyring, monitors string) error {
 	imageSpec := getImageSpec(imageName, poolName)
 	args := []string{
@@ -116,6 +176,7 @@ func MapImage(context *clusterd.Context, imageName, poolName, clusterName, keyri
 		fmt.Sprintf("--keyring=%s", keyring),
 		"-m", monitors,
 		"--conf=/dev/null", // no config file needed because we are passing all required config as arguments
+		"-o", "noshare",
 	}
 
 	output, err := ExecuteRBDCommandWithTimeout(context, clusterName, args)
@@ -151,6 +212,55 @@ func UnMapImage(context *clusterd.Context, imageName, poolName, clusterName, key
 	return nil
 }
 
+// MappedImage is an RBD image mapped to a device of the node by the rbd kernel module or by an rbd-nbd daemon
+type MappedImage struct {
+	// the id of the device in /sys/bus/rbd/devices of an image mapped by the rbd kernel module
+	ID string `json:"id"`
+	// the pid of the daemon of an image mapped by rbd-nbd
+	PID    string `json:"pid"`
+	Pool   string `json:"pool"`
+	Name   string `json:"name"`
+	Snap   string `json:"snap"`
+	Device string `json:"device"`
+}
+
+// ListMappedImages lists the RBD images mapped to devices of the node by the rbd kernel module
+func ListMappedImages(context *clusterd.Context) ([]MappedImage, error) {
+	args := []string{"showmapped", "--format", "json", "--conf=/dev/null"}
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", RBDTool, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mapped images: %+v. output: %s", err, output)
+	}
+	if strings.TrimSpace(output) == "" {
+		return []MappedImage{}, nil
+	}
+
+	// the mapped images are a list in newer releases, and a map keyed by the device id in luminous
+	var images []MappedImage
+	if err := json.Unmarshal([]byte(output), &images); err == nil {
+		return images, nil
+	}
+	imagesByID := map[string]MappedImage{}
+	if err := json.Unmarshal([]byte(output), &imagesByID); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal mapped images: %+v. output: %s", err, output)
+	}
+	images = []MappedImage{}
+	for id, image := range imagesByID {
+		image.ID = id
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// UnMapDevice unmaps the image mapped to a device by the rbd kernel module
+func UnMapDevice(context *clusterd.Context, devicePath string) error {
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", RBDTool, "unmap", devicePath, "--conf=/dev/null")
+	if err != nil {
+		return fmt.Errorf("failed to unmap device %s: %+v. output: %s", devicePath, err, output)
+	}
+	return nil
+}
+
 func getImageSpec(name, poolName string) string {
 	return fmt.Sprintf("%s/%s", poolName, name)
 }
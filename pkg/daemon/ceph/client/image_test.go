@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"strings"
+	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -92,6 +93,36 @@ func TestCreateImage(t *testing.T) {
 	createCalled = false
 }
 
+func TestCreateImageWithOptions(t *testing.T) {
+	var createArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case command == "rbd" && args[0] == "create":
+				createArgs = args
+				return "", nil
+			case command == "rbd" && args[0] == "ls" && args[1] == "-l":
+				return `[{"image":"image1","size":1048576,"format":2}]`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	opts := ImageOptions{DataPool: "ecpool", Features: "layering,exclusive-lock"}
+	image, err := CreateImageWithOptions(context, "foocluster", "image1", "pool1", opts, uint64(1048576))
+	assert.Nil(t, err)
+	assert.Equal(t, "image1", image.Name)
+	assert.Equal(t, []string{"create", "pool1/image1", "--size", "1", "--data-pool", "ecpool", "--image-feature", "layering,exclusive-lock"}, createArgs[:8])
+
+	// the image is striped over objects of the given size
+	opts = ImageOptions{Format: "2", ObjectSize: "8M", StripeUnit: "64K", StripeCount: "16"}
+	_, err = CreateImageWithOptions(context, "foocluster", "image1", "pool1", opts, uint64(1048576))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"create", "pool1/image1", "--size", "1", "--image-format", "2", "--object-size", "8M",
+		"--stripe-unit", "64K", "--stripe-count", "16"}, createArgs[:12])
+}
+
 func TestListImageLogLevelInfo(t *testing.T) {
 	executor := &exectest.MockExecutor{}
 	context := &clusterd.Context{Executor: executor}
@@ -192,3 +223,31 @@ func TestListImageLogLevelDebug(t *testing.T) {
 	assert.True(t, listCalled)
 	listCalled = false
 }
+
+func TestListMappedImages(t *testing.T) {
+	output := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "rbd", command)
+			assert.Equal(t, "showmapped", args[0])
+			return output, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// luminous lists the mapped images by device id
+	output = `{"0":{"pool":"replicapool","name":"pvc-1","snap":"-","device":"/dev/rbd0"}}`
+	images, err := ListMappedImages(context)
+	assert.Nil(t, err)
+	assert.Equal(t, []MappedImage{{ID: "0", Pool: "replicapool", Name: "pvc-1", Snap: "-", Device: "/dev/rbd0"}}, images)
+
+	output = `[{"id":"1","pool":"replicapool","namespace":"","name":"pvc-2","snap":"-","device":"/dev/rbd1"}]`
+	images, err = ListMappedImages(context)
+	assert.Nil(t, err)
+	assert.Equal(t, []MappedImage{{ID: "1", Pool: "replicapool", Name: "pvc-2", Snap: "-", Device: "/dev/rbd1"}}, images)
+
+	output = ""
+	images, err = ListMappedImages(context)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(images))
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -19,3 +20,42 @@ func MgrEnableModule(context *clusterd.Context, clusterName, name string, force
 
 	return nil
 }
+
+// MgrModuleAvailable checks whether the module is enabled or can be enabled in the mgr
+func MgrModuleAvailable(context *clusterd.Context, clusterName, name string) (bool, error) {
+	args := []string{"mgr", "module", "ls"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return false, fmt.Errorf("failed to list mgr modules: %+v", err)
+	}
+
+	var modules struct {
+		Enabled  []string          `json:"enabled_modules"`
+		Disabled []json.RawMessage `json:"disabled_modules"`
+	}
+	if err := json.Unmarshal(buf, &modules); err != nil {
+		return false, fmt.Errorf("failed to unmarshal mgr modules: %+v", err)
+	}
+
+	for _, module := range modules.Enabled {
+		if module == name {
+			return true, nil
+		}
+	}
+	for _, raw := range modules.Disabled {
+		// newer versions of ceph list the disabled modules as objects with their name
+		var module struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &module.Name); err != nil {
+			if err := json.Unmarshal(raw, &module); err != nil {
+				return false, fmt.Errorf("failed to unmarshal mgr module %s: %+v", string(raw), err)
+			}
+		}
+		if module.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
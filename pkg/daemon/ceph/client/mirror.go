@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const (
+	// MirroringModeDisabled is the mirroring mode of a pool that is not mirrored
+	MirroringModeDisabled = "disabled"
+)
+
+// PoolMirroringInfo is the mirroring mode and the peer clusters of a pool
+type PoolMirroringInfo struct {
+	Mode  string          `json:"mode"`
+	Peers []MirroringPeer `json:"peers"`
+}
+
+// MirroringPeer is a peer cluster the images of a pool are mirrored from
+type MirroringPeer struct {
+	UUID        string `json:"uuid"`
+	ClusterName string `json:"cluster_name"`
+	ClientName  string `json:"client_name"`
+}
+
+// PoolMirroringStatus is the mirroring status of a pool and its images as reported by the rbd-mirror daemons
+type PoolMirroringStatus struct {
+	Summary struct {
+		Health string         `json:"health"`
+		States map[string]int `json:"states"`
+	} `json:"summary"`
+	Images []struct {
+		Name        string `json:"name"`
+		GlobalID    string `json:"global_id"`
+		State       string `json:"state"`
+		Description string `json:"description"`
+		LastUpdate  string `json:"last_update"`
+	} `json:"images"`
+}
+
+// GetPoolMirroringInfo gets the mirroring mode and the peers of a pool
+func GetPoolMirroringInfo(context *clusterd.Context, clusterName, poolName string) (*PoolMirroringInfo, error) {
+	args := []string{"mirror", "pool", "info", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirroring info of pool %s. %+v", poolName, err)
+	}
+
+	var info PoolMirroringInfo
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return &info, nil
+}
+
+// EnablePoolMirroring enables the mirroring of the images of a pool in the "pool" or "image" mode
+func EnablePoolMirroring(context *clusterd.Context, clusterName, poolName, mode string) error {
+	args := []string{"mirror", "pool", "enable", poolName, mode}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to enable %s mirroring of pool %s. %+v. output: %s", mode, poolName, err, string(buf))
+	}
+
+	logger.Infof("enabled %s mirroring of pool %s", mode, poolName)
+	return nil
+}
+
+// DisablePoolMirroring disables the mirroring of the images of a pool
+func DisablePoolMirroring(context *clusterd.Context, clusterName, poolName string) error {
+	args := []string{"mirror", "pool", "disable", poolName}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to disable mirroring of pool %s. %+v. output: %s", poolName, err, string(buf))
+	}
+
+	logger.Infof("disabled mirroring of pool %s", poolName)
+	return nil
+}
+
+// AddPoolMirroringPeer registers a peer cluster that the rbd-mirror daemons mirror the images of the pool from. The
+// config and keyring of the peer cluster must be found by the daemons under the name of the peer cluster.
+func AddPoolMirroringPeer(context *clusterd.Context, clusterName, poolName, peerClientName, peerClusterName string) error {
+	peer := fmt.Sprintf("%s@%s", peerClientName, peerClusterName)
+	args := []string{"mirror", "pool", "peer", "add", poolName, peer}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to add mirroring peer %s to pool %s. %+v. output: %s", peer, poolName, err, string(buf))
+	}
+
+	logger.Infof("added mirroring peer %s to pool %s", peer, poolName)
+	return nil
+}
+
+// RemovePoolMirroringPeer removes a peer cluster from the mirroring of a pool
+func RemovePoolMirroringPeer(context *clusterd.Context, clusterName, poolName, peerUUID string) error {
+	args := []string{"mirror", "pool", "peer", "remove", poolName, peerUUID}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove mirroring peer %s from pool %s. %+v. output: %s", peerUUID, poolName, err, string(buf))
+	}
+
+	logger.Infof("removed mirroring peer %s from pool %s", peerUUID, poolName)
+	return nil
+}
+
+// GetPoolMirroringStatus gets the mirroring status of a pool and each of its mirrored images
+func GetPoolMirroringStatus(context *clusterd.Context, clusterName, poolName string) (*PoolMirroringStatus, error) {
+	args := []string{"mirror", "pool", "status", poolName, "--verbose"}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirroring status of pool %s. %+v", poolName, err)
+	}
+
+	var status PoolMirroringStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return &status, nil
+}
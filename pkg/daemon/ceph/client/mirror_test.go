@@ -0,0 +1,62 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolMirroring(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	peerAdded := ""
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		switch {
+		case command == "rbd" && args[2] == "info":
+			return `{"mode":"pool","peers":[{"uuid":"1234","cluster_name":"remote","client_name":"client.admin"}]}`, nil
+		case command == "rbd" && args[2] == "status":
+			return `{"summary":{"health":"WARNING","states":{"replaying":1,"syncing":1}},"images":[` +
+				`{"name":"image1","global_id":"abc","state":"up+replaying","description":"replaying","last_update":"2018-04-20 10:00:00"},` +
+				`{"name":"image2","global_id":"def","state":"up+syncing","description":"bootstrapping","last_update":"2018-04-20 10:00:00"}]}`, nil
+		case command == "rbd" && args[2] == "peer" && args[3] == "add":
+			peerAdded = args[5]
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected rbd command '%v'", args)
+	}
+
+	info, err := GetPoolMirroringInfo(context, "mycluster", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, "pool", info.Mode)
+	assert.Equal(t, []MirroringPeer{{UUID: "1234", ClusterName: "remote", ClientName: "client.admin"}}, info.Peers)
+
+	status, err := GetPoolMirroringStatus(context, "mycluster", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, "WARNING", status.Summary.Health)
+	assert.Equal(t, 2, len(status.Images))
+	assert.Equal(t, "image2", status.Images[1].Name)
+	assert.Equal(t, "up+syncing", status.Images[1].State)
+
+	// the peer is the client of the remote cluster
+	err = AddPoolMirroringPeer(context, "mycluster", "mypool", "client.mirror", "remote")
+	assert.Nil(t, err)
+	assert.Equal(t, "client.mirror@remote", peerAdded)
+}
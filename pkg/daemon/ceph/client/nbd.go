@@ -0,0 +1,174 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const (
+	NBDTool  = "rbd-nbd"
+	FuseTool = "ceph-fuse"
+)
+
+var (
+	systemdScopeOnce    sync.Once
+	systemdScopeEnabled bool
+)
+
+// systemdScopeAvailable returns whether the daemons can be started in a systemd scope of the host. It is detected once by
+// starting `true` in a scope, like the kubelet detects systemd before it mounts with systemd-run.
+var systemdScopeAvailable = func(context *clusterd.Context) bool {
+	systemdScopeOnce.Do(func() {
+		tool, args := systemdScopeCommand("true", nil)
+		_, err := context.Executor.ExecuteCommandWithOutput(false, "", tool, args...)
+		systemdScopeEnabled = err == nil
+		if !systemdScopeEnabled {
+			logger.Warningf("systemd-run is not available on the host, the %s and %s daemons stop when the agent is restarted. %+v", NBDTool, FuseTool, err)
+		}
+	})
+	return systemdScopeEnabled
+}
+
+// daemonCommand returns the command that starts a daemon in user space. The daemons keep the volumes of the node mapped
+// and mounted, so when systemd runs on the host they are started in a transient systemd scope of the host instead of
+// in the cgroup of the agent container, and keep running when the agent is restarted or updated.
+func daemonCommand(context *clusterd.Context, tool string, args []string) (string, []string) {
+	if !systemdScopeAvailable(context) {
+		return tool, args
+	}
+	return systemdScopeCommand(tool, args)
+}
+
+// systemdScopeCommand runs systemd-run in the mount namespace of the host, which starts the tool in a new scope. The
+// tool is started in the mount namespace of the agent where it is installed, which requires the pid namespace of the host.
+func systemdScopeCommand(tool string, args []string) (string, []string) {
+	scopeArgs := []string{
+		"--target", "1", "--mount", "--",
+		"systemd-run", fmt.Sprintf("--description=rook %s", tool), "--scope", "--",
+		"nsenter", "--target", strconv.Itoa(os.Getpid()), "--mount", "--",
+		tool,
+	}
+	return "nsenter", append(scopeArgs, args...)
+}
+
+// MapImageNBD maps an RBD image to an nbd device with an rbd-nbd daemon in user space, for the nodes where the rbd
+// kernel module is not available. The path of the nbd device is returned.
+func MapImageNBD(context *clusterd.Context, imageName, poolName, clusterName, keyring, monitors string) (string, error) {
+	imageSpec := getImageSpec(imageName, poolName)
+	args := []string{
+		"map",
+		imageSpec,
+		"--id", "admin",
+		fmt.Sprintf("--cluster=%s", clusterName),
+		fmt.Sprintf("--keyring=%s", keyring),
+		"-m", monitors,
+		"--conf=/dev/null", // no config file needed because we are passing all required config as arguments
+	}
+
+	tool, args := daemonCommand(context, NBDTool, args)
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", tool, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to map image %s with rbd-nbd: %+v. output: %s", imageSpec, err, output)
+	}
+
+	// rbd-nbd prints the device it mapped the image to
+	devicePath := strings.TrimSpace(output)
+	if !strings.HasPrefix(devicePath, "/dev/nbd") {
+		return "", fmt.Errorf("unexpected nbd device %s for image %s", devicePath, imageSpec)
+	}
+	return devicePath, nil
+}
+
+// UnMapImageNBD unmaps an nbd device, which stops its rbd-nbd daemon
+func UnMapImageNBD(context *clusterd.Context, devicePath string) error {
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", NBDTool, "unmap", devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to unmap nbd device %s: %+v. output: %s", devicePath, err, output)
+	}
+	return nil
+}
+
+// ListMappedImagesNBD lists the RBD images mapped to nbd devices of the node by rbd-nbd daemons
+func ListMappedImagesNBD(context *clusterd.Context) ([]MappedImage, error) {
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", NBDTool, "list-mapped")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images mapped with rbd-nbd: %+v. output: %s", err, output)
+	}
+
+	// the mapped images are listed in a table of their pid, pool, image, snap and device after a header line
+	images := []MappedImage{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] == "pid" {
+			continue
+		}
+		images = append(images, MappedImage{PID: fields[0], Pool: fields[1], Name: fields[2], Snap: fields[3], Device: fields[4]})
+	}
+	return images, nil
+}
+
+// MountFilesystemFuse mounts a path of a file system with a ceph-fuse daemon in user space, for the nodes where the
+// ceph kernel module is not available. The daemon runs until the mount point is unmounted.
+func MountFilesystemFuse(context *clusterd.Context, fsName, path, mountPoint, user, keyring, monitors string) error {
+	args := []string{
+		mountPoint,
+		"--id", user,
+		fmt.Sprintf("--keyring=%s", keyring),
+		"-m", monitors,
+		"--conf=/dev/null", // no config file needed because we are passing all required config as arguments
+		fmt.Sprintf("--client_mountpoint=%s", path),
+		fmt.Sprintf("--client_mds_namespace=%s", fsName),
+	}
+
+	tool, args := daemonCommand(context, FuseTool, args)
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", tool, args...)
+	if err != nil {
+		return fmt.Errorf("failed to mount path %s of filesystem %s to %s with ceph-fuse: %+v. output: %s", path, fsName, mountPoint, err, output)
+	}
+	return nil
+}
+
+// MountFilesystemRootFuse mounts the root of a file system with ceph-fuse as the admin of the cluster, so the directories
+// of the volumes provisioned from the file system can be managed. The daemon runs until it is unmounted.
+func MountFilesystemRootFuse(context *clusterd.Context, clusterName, fsName, mountPoint string) error {
+	args := []string{
+		mountPoint,
+		fmt.Sprintf("--client_mds_namespace=%s", fsName),
+	}
+	args = AppendAdminConnectionArgs(args, context.ConfigDir, clusterName)
+
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", FuseTool, args...)
+	if err != nil {
+		return fmt.Errorf("failed to mount the root of filesystem %s to %s with ceph-fuse: %+v. output: %s", fsName, mountPoint, err, output)
+	}
+	return nil
+}
+
+// UnmountFilesystemFuse unmounts a file system mounted with ceph-fuse, which stops its daemon
+func UnmountFilesystemFuse(context *clusterd.Context, mountPoint string) error {
+	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", "umount", mountPoint)
+	if err != nil {
+		return fmt.Errorf("failed to unmount %s: %+v. output: %s", mountPoint, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapImageNBD(t *testing.T) {
+	systemdScopeAvailable = func(context *clusterd.Context) bool { return false }
+	output := ""
+	var nbdArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "rbd-nbd", command)
+			nbdArgs = args
+			return output, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the device printed by rbd-nbd is returned
+	output = "/dev/nbd2\n"
+	devicePath, err := MapImageNBD(context, "image1", "pool1", "mycluster", "/tmp/keyring", "10.0.0.1:6790")
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/nbd2", devicePath)
+	assert.Equal(t, []string{"map", "pool1/image1", "--id", "admin", "--cluster=mycluster", "--keyring=/tmp/keyring", "-m", "10.0.0.1:6790"}, nbdArgs[:8])
+
+	// fail when rbd-nbd does not print a device
+	output = "some warning"
+	_, err = MapImageNBD(context, "image1", "pool1", "mycluster", "/tmp/keyring", "10.0.0.1:6790")
+	assert.NotNil(t, err)
+
+	err = UnMapImageNBD(context, "/dev/nbd2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"unmap", "/dev/nbd2"}, nbdArgs)
+}
+
+func TestListMappedImagesNBD(t *testing.T) {
+	output := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "rbd-nbd", command)
+			assert.Equal(t, []string{"list-mapped"}, args)
+			return output, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	output = "pid   pool        image  snap device    \n" +
+		"12345 replicapool pvc-1  -    /dev/nbd0 \n" +
+		"12346 replicapool pvc-2  -    /dev/nbd1 \n"
+	images, err := ListMappedImagesNBD(context)
+	assert.Nil(t, err)
+	assert.Equal(t, []MappedImage{
+		{PID: "12345", Pool: "replicapool", Name: "pvc-1", Snap: "-", Device: "/dev/nbd0"},
+		{PID: "12346", Pool: "replicapool", Name: "pvc-2", Snap: "-", Device: "/dev/nbd1"},
+	}, images)
+
+	output = ""
+	images, err = ListMappedImagesNBD(context)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(images))
+}
+
+func TestMountFilesystemRootFuse(t *testing.T) {
+	var commands [][]string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			commands = append(commands, append([]string{command}, args...))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, ConfigDir: "/var/lib/rook"}
+
+	// the root is mounted with the admin connection of the cluster
+	err := MountFilesystemRootFuse(context, "mycluster", "myfs", "/tmp/root")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ceph-fuse", "/tmp/root", "--client_mds_namespace=myfs", "--cluster=mycluster",
+		"--conf=/var/lib/rook/mycluster/mycluster.config", "--keyring=/var/lib/rook/mycluster/client.admin.keyring"}, commands[0])
+
+	err = UnmountFilesystemFuse(context, "/tmp/root")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"umount", "/tmp/root"}, commands[1])
+}
+
+func TestMountFilesystemFuseInSystemdScope(t *testing.T) {
+	systemdScopeAvailable = func(context *clusterd.Context) bool { return true }
+	var commands [][]string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			commands = append(commands, append([]string{command}, args...))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// ceph-fuse is started by systemd-run on the host in the mount namespace of the agent
+	err := MountFilesystemFuse(context, "myfs", "/vol1", "/tmp/mnt", "user1", "/tmp/keyring", "10.0.0.1:6790")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nsenter", "--target", "1", "--mount", "--", "systemd-run", "--description=rook ceph-fuse", "--scope", "--",
+		"nsenter", "--target", strconv.Itoa(os.Getpid()), "--mount", "--", "ceph-fuse", "/tmp/mnt", "--id", "user1"}, commands[0][:18])
+
+	// the unmount stops the daemon and does not need a scope
+	err = UnmountFilesystemFuse(context, "/tmp/mnt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"umount", "/tmp/mnt"}, commands[1])
+}
@@ -21,6 +21,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -135,3 +136,45 @@ func GetOSDDump(context *clusterd.Context, clusterName string) (*OSDDump, error)
 
 	return &osdDump, nil
 }
+
+// OSDOut marks the OSD out of the cluster so its data is moved to other OSDs
+func OSDOut(context *clusterd.Context, clusterName string, osdID int) error {
+	args := []string{"osd", "out", strconv.Itoa(osdID)}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to mark out osd.%d: %+v", osdID, err)
+	}
+
+	return nil
+}
+
+// OSDIn marks the OSD in the cluster so data is placed on it again
+func OSDIn(context *clusterd.Context, clusterName string, osdID int) error {
+	args := []string{"osd", "in", strconv.Itoa(osdID)}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to mark in osd.%d: %+v", osdID, err)
+	}
+
+	return nil
+}
+
+// OSDSafeToDestroy checks whether the OSD can be destroyed without reducing the durability of any data.
+// The check fails while the PGs stored on the OSD have not been moved to other OSDs.
+func OSDSafeToDestroy(context *clusterd.Context, clusterName string, osdID int) error {
+	args := []string{"osd", "safe-to-destroy", strconv.Itoa(osdID)}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("osd.%d is not safe to destroy: %+v", osdID, err)
+	}
+
+	return nil
+}
+
+// OSDDestroy removes the auth key of the OSD and marks it destroyed. The ID of the OSD is kept
+// in the osd map so it can be reused when the OSD is created again.
+func OSDDestroy(context *clusterd.Context, clusterName string, osdID int) error {
+	args := []string{"osd", "destroy", strconv.Itoa(osdID), "--yes-i-really-mean-it"}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to destroy osd.%d: %+v", osdID, err)
+	}
+
+	return nil
+}
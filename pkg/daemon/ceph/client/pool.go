@@ -21,6 +21,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -31,6 +32,11 @@ import (
 const (
 	confirmFlag       = "--yes-i-really-mean-it"
 	reallyConfirmFlag = "--yes-i-really-really-mean-it"
+
+	// TargetPGsPerOSD is the number of placement groups each osd should hold when all the pools are full
+	TargetPGsPerOSD = 100
+	// MinPGCount is the smallest number of placement groups computed for a pool
+	MinPGCount = 8
 )
 
 type CephStoragePoolSummary struct {
@@ -43,7 +49,13 @@ type CephStoragePoolDetails struct {
 	Number             int    `json:"pool_id"`
 	Size               uint   `json:"size"`
 	ErasureCodeProfile string `json:"erasure_code_profile"`
+	PGCount            int    `json:"pg_num"`
+	PGPCount           int    `json:"pgp_num"`
+	CrushRule          string `json:"crush_rule"`
+	MinSize            uint   `json:"min_size"`
 	FailureDomain      string
+	CrushRoot          string
+	PrimaryZone        string
 }
 
 type CephStoragePoolStats struct {
@@ -134,7 +146,11 @@ func CreatePoolWithProfile(context *clusterd.Context, clusterName string, newPoo
 		}
 	}
 
-	return CreatePoolForApp(context, clusterName, newPool, appName)
+	if err := CreatePoolForApp(context, clusterName, newPool, appName); err != nil {
+		return err
+	}
+
+	return SetPoolOptions(context, clusterName, newPoolReq)
 }
 
 func DeletePool(context *clusterd.Context, clusterName string, name string) error {
@@ -153,41 +169,54 @@ func DeletePool(context *clusterd.Context, clusterName string, name string) erro
 	}
 
 	// remove the crush rule for this pool and ignore the error in case the rule is still in use or not found
-	args = []string{"osd", "crush", "rule", "rm", name}
-	_, err = ExecuteCephCommand(context, clusterName, args)
-	if err != nil {
-		logger.Infof("did not delete crush rule %s. %+v", name, err)
+	deleteCrushRule(context, clusterName, name)
+	if pool.CrushRule != name && poolOwnsCrushRule(name, pool.CrushRule) {
+		// the pool was switched to a rule for another failure domain
+		deleteCrushRule(context, clusterName, pool.CrushRule)
 	}
 
 	logger.Infof("purge completed for pool %s", name)
 	return nil
 }
 
+func deleteCrushRule(context *clusterd.Context, clusterName, name string) {
+	args := []string{"osd", "crush", "rule", "rm", name}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		logger.Infof("did not delete crush rule %s. %+v", name, err)
+	}
+}
+
 func CreatePool(context *clusterd.Context, clusterName string, newPool CephStoragePoolDetails) error {
 	// for a generic/custom pool, just reuse the pool name for its app name
 	return CreatePoolForApp(context, clusterName, newPool, newPool.Name)
 }
 
 func CreatePoolForApp(context *clusterd.Context, clusterName string, newPool CephStoragePoolDetails, appName string) error {
-	// create a crush rule for a replicated pool, if a failure domain is specified
+	// create a crush rule for a replicated pool, if a failure domain, crush root, or primary zone is specified
 	replicated := newPool.ErasureCodeProfile == "" && newPool.Size > 0
-	ruleName := newPool.Name
-	if replicated && newPool.FailureDomain != "" {
-		args := []string{"osd", "crush", "rule", "create-simple", ruleName, "default", newPool.FailureDomain}
-		_, err := ExecuteCephCommand(context, clusterName, args)
-		if err != nil {
+	ruleName := ""
+	if replicated {
+		ruleName = PoolCrushRuleName(newPool)
+	}
+	if ruleName != "" {
+		if err := createReplicatedCrushRule(context, clusterName, newPool, ruleName); err != nil {
 			return fmt.Errorf("failed to crush rule %s. %+v", newPool.Name, err)
 		}
 	}
 
-	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.Number)}
+	pgCount := newPool.Number
+	if newPool.PGCount > 0 {
+		pgCount = newPool.PGCount
+	}
+	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(pgCount)}
 	if newPool.ErasureCodeProfile != "" {
 		args = append(args, "erasure", newPool.ErasureCodeProfile)
 	} else {
 		args = append(args, "replicated")
 
 		// Associate the crush rule created above with the new pool
-		if newPool.FailureDomain != "" {
+		if ruleName != "" {
 			args = append(args, ruleName)
 		}
 	}
@@ -202,6 +231,11 @@ func CreatePoolForApp(context *clusterd.Context, clusterName string, newPool Cep
 		if err = SetPoolProperty(context, clusterName, newPool.Name, "size", strconv.FormatUint(uint64(newPool.Size), 10)); err != nil {
 			return err
 		}
+		if newPool.MinSize > 0 {
+			if err = SetPoolProperty(context, clusterName, newPool.Name, "min_size", strconv.FormatUint(uint64(newPool.MinSize), 10)); err != nil {
+				return err
+			}
+		}
 	}
 
 	// ensure that the newly created pool gets an application tag
@@ -224,6 +258,317 @@ func SetPoolProperty(context *clusterd.Context, clusterName, name, propName stri
 	return nil
 }
 
+// GetPoolApplications gets the names of the applications enabled on a pool, such as rbd, cephfs, or rgw
+func GetPoolApplications(context *clusterd.Context, clusterName, name string) ([]string, error) {
+	args := []string{"osd", "pool", "application", "get", name}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the applications of pool %s. %+v", name, err)
+	}
+
+	var apps map[string]interface{}
+	if err := json.Unmarshal(buf, &apps); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+
+	var names []string
+	for app := range apps {
+		names = append(names, app)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetPoolFailureDomain gets the failure domain of a pool, which is the bucket type its crush rule chooses the osds from
+func GetPoolFailureDomain(context *clusterd.Context, clusterName string, pool CephStoragePoolDetails) (string, error) {
+	crush, err := GetCrushMap(context, clusterName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get crush map. %+v", err)
+	}
+
+	for _, rule := range crush.Rules {
+		if rule.Name != pool.CrushRule {
+			continue
+		}
+		for _, step := range rule.Steps {
+			if strings.HasPrefix(step.Operation, "choose") {
+				return step.Type, nil
+			}
+		}
+		return "", fmt.Errorf("crush rule %s of pool %s does not choose a failure domain", rule.Name, pool.Name)
+	}
+	return "", fmt.Errorf("crush rule %s of pool %s not found", pool.CrushRule, pool.Name)
+}
+
+// SetPoolFailureDomain creates a crush rule that spreads the data of the pool across the failure domain and switches
+// the pool to the new rule. Ceph then moves the data of the pool to match the rule. The number of data and coding
+// chunks of an erasure coded pool cannot be changed, but its chunks can be spread across another failure domain.
+func SetPoolFailureDomain(context *clusterd.Context, clusterName string, pool model.Pool) error {
+	cephPool := ModelPoolToCephPool(pool)
+	ruleName := placementCrushRuleName(cephPool)
+	if pool.Type == model.ErasureCoded {
+		// the rule of an erasure coded pool is created from a profile with the new failure domain
+		profileName := fmt.Sprintf("%s_%s", GetErasureCodeProfileForPool(pool.Name), pool.FailureDomain)
+		if err := CreateErasureCodeProfile(context, clusterName, pool.ErasureCodedConfig, profileName, pool.FailureDomain); err != nil {
+			return fmt.Errorf("failed to create erasure code profile %s. %+v", profileName, err)
+		}
+		args := []string{"osd", "crush", "rule", "create-erasure", ruleName, profileName}
+		if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to create crush rule %s. %+v", ruleName, err)
+		}
+	} else if err := createReplicatedCrushRule(context, clusterName, cephPool, ruleName); err != nil {
+		return fmt.Errorf("failed to create crush rule %s. %+v", ruleName, err)
+	}
+
+	return switchPoolCrushRule(context, clusterName, pool.Name, ruleName)
+}
+
+// PoolCrushRuleName gets the name of the crush rule of a replicated pool, or an empty string if the pool uses the default
+// rule. The crush root, failure domain, and primary zone of the pool are part of the name of its rule when they are
+// specified so that a change to them can be found from the name of the current rule of the pool.
+func PoolCrushRuleName(pool CephStoragePoolDetails) string {
+	if pool.CrushRoot == "" && pool.PrimaryZone == "" {
+		if pool.FailureDomain != "" {
+			return pool.Name
+		}
+		return ""
+	}
+	return placementCrushRuleName(pool)
+}
+
+// gets the name of the rule for the crush root, failure domain, and primary zone of the pool
+func placementCrushRuleName(pool CephStoragePoolDetails) string {
+	root, failureDomain := poolPlacement(pool)
+	name := fmt.Sprintf("%s_%s_%s", pool.Name, root, failureDomain)
+	if pool.PrimaryZone != "" {
+		name = fmt.Sprintf("%s_primary_%s", name, pool.PrimaryZone)
+	}
+	return name
+}
+
+// SetPoolCrushRule creates the crush rule for the crush root, failure domain, and primary zone of a replicated pool and
+// switches the pool to the new rule. Ceph then moves the data of the pool to match the rule.
+func SetPoolCrushRule(context *clusterd.Context, clusterName string, pool CephStoragePoolDetails) error {
+	ruleName := PoolCrushRuleName(pool)
+	if ruleName == "" {
+		return fmt.Errorf("pool %s does not need its own crush rule", pool.Name)
+	}
+	if err := createReplicatedCrushRule(context, clusterName, pool, ruleName); err != nil {
+		return fmt.Errorf("failed to create crush rule %s. %+v", ruleName, err)
+	}
+
+	return switchPoolCrushRule(context, clusterName, pool.Name, ruleName)
+}
+
+// switches the pool to the crush rule and removes the rule of the pool that is replaced if no other pool uses it
+func switchPoolCrushRule(context *clusterd.Context, clusterName, poolName, ruleName string) error {
+	details, err := GetPoolDetails(context, clusterName, poolName)
+	if err != nil {
+		return err
+	}
+	if err := SetPoolProperty(context, clusterName, poolName, "crush_rule", ruleName); err != nil {
+		return err
+	}
+
+	if details.CrushRule != ruleName && poolOwnsCrushRule(poolName, details.CrushRule) {
+		if err := deleteUnusedCrushRule(context, clusterName, details.CrushRule); err != nil {
+			logger.Warningf("failed to remove the replaced crush rule %s of pool %s. %+v", details.CrushRule, poolName, err)
+		}
+	}
+	return nil
+}
+
+// whether the rule was created for the pool, as opposed to the default rules or the rules of the crush map crd
+func poolOwnsCrushRule(poolName, ruleName string) bool {
+	return ruleName == poolName || strings.HasPrefix(ruleName, poolName+"_")
+}
+
+// removes the crush rule if no pool uses it
+func deleteUnusedCrushRule(context *clusterd.Context, clusterName, ruleName string) error {
+	pools, err := ListPoolSummaries(context, clusterName)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		details, err := GetPoolDetails(context, clusterName, p.Name)
+		if err != nil {
+			return err
+		}
+		if details.CrushRule == ruleName {
+			logger.Infof("not removing crush rule %s that is used by pool %s", ruleName, p.Name)
+			return nil
+		}
+	}
+
+	args := []string{"osd", "crush", "rule", "rm", ruleName}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove crush rule %s. %+v", ruleName, err)
+	}
+	logger.Infof("removed crush rule %s", ruleName)
+	return nil
+}
+
+// creates the crush rule that places the copies of a replicated pool. With a primary zone, the primary copy is chosen
+// from the primary zone and each of the other copies from one of the other zones under the root, so the reads are
+// served from the primary zone and the pool stays available if a zone is lost.
+func createReplicatedCrushRule(context *clusterd.Context, clusterName string, pool CephStoragePoolDetails, ruleName string) error {
+	root, failureDomain := poolPlacement(pool)
+	if pool.PrimaryZone == "" {
+		args := []string{"osd", "crush", "rule", "create-simple", ruleName, root, failureDomain}
+		_, err := ExecuteCephCommand(context, clusterName, args)
+		return err
+	}
+
+	crush, err := GetCrushMap(context, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to get crush map. %+v", err)
+	}
+	zones := crushBucketsUnder(crush, root, "zone")
+	if !contains(zones, pool.PrimaryZone) {
+		return fmt.Errorf("primary zone %s not found under crush root %s", pool.PrimaryZone, root)
+	}
+	if len(zones) < int(pool.Size) {
+		return fmt.Errorf("pool %s with size %d needs as many zones under crush root %s, found %d", pool.Name, pool.Size, root, len(zones))
+	}
+
+	chooseStep := fmt.Sprintf("chooseleaf firstn 1 type %s", failureDomain)
+	steps := []string{"take " + pool.PrimaryZone, chooseStep, "emit"}
+	for _, zone := range zones {
+		if zone != pool.PrimaryZone {
+			steps = append(steps, "take "+zone, chooseStep, "emit")
+		}
+	}
+	return SetCrushRule(context, clusterName, ruleName, "replicated", steps)
+}
+
+// gets the crush root and the failure domain of a replicated pool, with the defaults of ceph if they are not specified
+func poolPlacement(pool CephStoragePoolDetails) (string, string) {
+	root := pool.CrushRoot
+	if root == "" {
+		root = "default"
+	}
+	failureDomain := pool.FailureDomain
+	if failureDomain == "" {
+		failureDomain = "host"
+	}
+	return root, failureDomain
+}
+
+// gets the sorted names of the buckets of the given type under the named bucket of the crush map
+func crushBucketsUnder(crush CrushMap, parent, typeName string) []string {
+	bucketsByID := map[int]int{}
+	parentIndex := -1
+	for i, bucket := range crush.Buckets {
+		bucketsByID[bucket.ID] = i
+		if bucket.Name == parent {
+			parentIndex = i
+		}
+	}
+	if parentIndex == -1 {
+		return nil
+	}
+
+	var names []string
+	pending := []int{parentIndex}
+	for len(pending) > 0 {
+		bucket := crush.Buckets[pending[0]]
+		pending = pending[1:]
+		for _, item := range bucket.Items {
+			// the osds under the buckets have positive ids
+			child, ok := bucketsByID[item.ID]
+			if item.ID >= 0 || !ok {
+				continue
+			}
+			if crush.Buckets[child].TypeName == typeName {
+				names = append(names, crush.Buckets[child].Name)
+			} else {
+				pending = append(pending, child)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPoolQuota sets the max_bytes or max_objects quota of a pool. A value of 0 removes the quota.
+func SetPoolQuota(context *clusterd.Context, clusterName, name, quotaName string, value uint64) error {
+	args := []string{"osd", "pool", "set-quota", name, quotaName, strconv.FormatUint(value, 10)}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to set quota %s on pool %s. %+v", quotaName, name, err)
+	}
+	return nil
+}
+
+// SetPoolOptions applies the quotas, the compression settings, and the other parameters of the pool spec to the pool.
+// The quotas and the compression mode are always set so that removing them from the spec also removes them from the pool.
+func SetPoolOptions(context *clusterd.Context, clusterName string, pool model.Pool) error {
+	if err := SetPoolQuota(context, clusterName, pool.Name, "max_bytes", pool.Quotas.MaxBytes); err != nil {
+		return err
+	}
+	if err := SetPoolQuota(context, clusterName, pool.Name, "max_objects", pool.Quotas.MaxObjects); err != nil {
+		return err
+	}
+
+	props := map[string]string{"compression_mode": "none"}
+	if pool.Compression.Mode != "" {
+		props["compression_mode"] = pool.Compression.Mode
+	}
+	if pool.Compression.Algorithm != "" {
+		props["compression_algorithm"] = pool.Compression.Algorithm
+	}
+	if pool.Compression.RequiredRatio > 0 {
+		props["compression_required_ratio"] = strconv.FormatFloat(pool.Compression.RequiredRatio, 'f', -1, 64)
+	}
+	for name, value := range pool.Parameters {
+		props[name] = value
+	}
+
+	// set the properties in a consistent order
+	var names []string
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := SetPoolProperty(context, clusterName, pool.Name, name, props[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ComputePGCount computes the number of placement groups of a pool from the number of osds, the number of osds each
+// object is stored on, and the percentage of the cluster data expected in the pool. As in the ceph pg calculator, the
+// count is rounded down to a power of two unless that is more than 25% below the computed count.
+func ComputePGCount(osdCount int, width, dataPercent uint) int {
+	if width == 0 {
+		width = 1
+	}
+	pgs := float64(TargetPGsPerOSD*osdCount) * float64(dataPercent) / 100 / float64(width)
+
+	count := 1
+	for float64(count*2) <= pgs {
+		count *= 2
+	}
+	if pgs > float64(count)*1.25 {
+		count *= 2
+	}
+	if count < MinPGCount {
+		count = MinPGCount
+	}
+	return count
+}
+
 func GetPoolStats(context *clusterd.Context, clusterName string) (*CephStoragePoolStats, error) {
 	args := []string{"df", "detail"}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
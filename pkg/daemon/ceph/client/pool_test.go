@@ -19,13 +19,16 @@ which has the same license.
 package client
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/model"
 )
 
 func TestCreateECPool(t *testing.T) {
@@ -115,3 +118,124 @@ func testCreateReplicaPool(t *testing.T, failureDomain string) {
 		assert.True(t, crushRuleCreated)
 	}
 }
+
+func TestComputePGCount(t *testing.T) {
+	// 10 osds with all the data in a pool of 3 replicas is 333 pgs, which is rounded up to 512
+	assert.Equal(t, 512, ComputePGCount(10, 3, 100))
+
+	// 10 osds with 40% of the data is 133 pgs, which is rounded down to 128
+	assert.Equal(t, 128, ComputePGCount(10, 3, 40))
+
+	// an erasure coded pool is as wide as its data and coding chunks
+	assert.Equal(t, 256, ComputePGCount(10, 4, 100))
+
+	// the pools get a minimum number of pgs
+	assert.Equal(t, MinPGCount, ComputePGCount(1, 3, 5))
+	assert.Equal(t, MinPGCount, ComputePGCount(0, 0, 100))
+}
+
+func TestSetPoolOptions(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			logger.Infof("Command: %s %v", command, args)
+			commands = append(commands, strings.Join(args[0:6], " "))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the quotas and compression mode are always set so they are removed when they are not in the spec
+	p := model.Pool{Name: "mypool"}
+	err := SetPoolOptions(context, "myns", p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"osd pool set-quota mypool max_bytes 0",
+		"osd pool set-quota mypool max_objects 0",
+		"osd pool set mypool compression_mode none",
+	}, commands)
+
+	// the compression settings and parameters are set in order
+	commands = []string{}
+	p.Quotas = model.PoolQuotas{MaxBytes: 1073741824, MaxObjects: 1000}
+	p.Compression = model.PoolCompression{Mode: "aggressive", Algorithm: "snappy", RequiredRatio: 0.875}
+	p.Parameters = map[string]string{"nodeep-scrub": "1"}
+	err = SetPoolOptions(context, "myns", p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"osd pool set-quota mypool max_bytes 1073741824",
+		"osd pool set-quota mypool max_objects 1000",
+		"osd pool set mypool compression_algorithm snappy",
+		"osd pool set mypool compression_mode aggressive",
+		"osd pool set mypool compression_required_ratio 0.875",
+		"osd pool set mypool nodeep-scrub 1",
+	}, commands)
+}
+
+func TestCreateReplicaPoolPlacement(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			logger.Infof("Command: %s %v", command, args)
+			if args[1] == "crush" && args[2] == "dump" {
+				return zonesCrushMap, nil
+			}
+			commands = append(commands, strings.Join(args[0:7], " "))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the rule places the copies under the crush root and the min size is set after the size
+	p := CephStoragePoolDetails{Name: "mypool", Size: 3, MinSize: 2, CrushRoot: "ssd"}
+	err := CreatePoolForApp(context, "myns", p, "myapp")
+	assert.Nil(t, err)
+	assert.Equal(t, "osd crush rule create-simple mypool_ssd_host ssd host", commands[0])
+	assert.Equal(t, "osd pool create mypool 0 replicated mypool_ssd_host", commands[1])
+	assert.Equal(t, "osd pool set mypool min_size 2 --cluster=myns", commands[3])
+
+	// a pool with a primary zone needs a zone for each copy
+	commands = []string{}
+	p = CephStoragePoolDetails{Name: "mypool", Size: 4, PrimaryZone: "zone-a"}
+	err = CreatePoolForApp(context, "myns", p, "myapp")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(commands))
+	p.PrimaryZone = "zone-d"
+	p.Size = 3
+	err = CreatePoolForApp(context, "myns", p, "myapp")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(commands))
+}
+
+func TestPoolCrushRuleName(t *testing.T) {
+	// the pools without a custom placement keep the default rule or a rule named after the pool
+	assert.Equal(t, "", PoolCrushRuleName(CephStoragePoolDetails{Name: "mypool"}))
+	assert.Equal(t, "mypool", PoolCrushRuleName(CephStoragePoolDetails{Name: "mypool", FailureDomain: "rack"}))
+
+	assert.Equal(t, "mypool_ssd_host", PoolCrushRuleName(CephStoragePoolDetails{Name: "mypool", CrushRoot: "ssd"}))
+	assert.Equal(t, "mypool_default_rack_primary_zone-a",
+		PoolCrushRuleName(CephStoragePoolDetails{Name: "mypool", FailureDomain: "rack", PrimaryZone: "zone-a"}))
+}
+
+func TestCrushBucketsUnder(t *testing.T) {
+	var crush CrushMap
+	err := json.Unmarshal([]byte(zonesCrushMap), &crush)
+	assert.Nil(t, err)
+
+	// the zones are found under the regions of the root
+	assert.Equal(t, []string{"zone-a", "zone-b", "zone-c"}, crushBucketsUnder(crush, "default", "zone"))
+	assert.Equal(t, []string{"zone-c"}, crushBucketsUnder(crush, "region-2", "zone"))
+	assert.Equal(t, 0, len(crushBucketsUnder(crush, "ssd", "zone")))
+	assert.Equal(t, 0, len(crushBucketsUnder(crush, "doesntexist", "zone")))
+}
+
+// the default root has three zones in two regions and the ssd root has a host with an osd
+const zonesCrushMap = `{"buckets":[
+	{"id":-1,"name":"default","type_name":"root","items":[{"id":-2},{"id":-3}]},
+	{"id":-2,"name":"region-1","type_name":"region","items":[{"id":-4},{"id":-5}]},
+	{"id":-3,"name":"region-2","type_name":"region","items":[{"id":-6}]},
+	{"id":-4,"name":"zone-b","type_name":"zone","items":[]},
+	{"id":-5,"name":"zone-a","type_name":"zone","items":[]},
+	{"id":-6,"name":"zone-c","type_name":"zone","items":[]},
+	{"id":-7,"name":"ssd","type_name":"root","items":[{"id":-8}]},
+	{"id":-8,"name":"node1-ssd","type_name":"host","items":[{"id":0}]}]}`
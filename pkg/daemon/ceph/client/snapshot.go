@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// CephImageSnapshot is a snapshot of an rbd image
+type CephImageSnapshot struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+}
+
+// the info of an image snapshot. rbd reports the protection as a string.
+type snapshotInfo struct {
+	Size      uint64 `json:"size"`
+	Protected string `json:"protected"`
+}
+
+// ListSnapshots lists the snapshots of an image
+func ListSnapshots(context *clusterd.Context, clusterName, poolName, imageName string) ([]CephImageSnapshot, error) {
+	args := []string{"snap", "ls", getImageSpec(imageName, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of image %s in pool %s. %+v", imageName, poolName, err)
+	}
+
+	var snapshots []CephImageSnapshot
+	if err := json.Unmarshal(buf, &snapshots); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return snapshots, nil
+}
+
+// CreateSnapshot creates a snapshot of an image and protects it so it can be cloned. Creating a snapshot that
+// already exists only ensures it is protected.
+func CreateSnapshot(context *clusterd.Context, clusterName, poolName, imageName, snapName string) (*CephImageSnapshot, error) {
+	snapshot, err := getSnapshot(context, clusterName, poolName, imageName, snapName)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		args := []string{"snap", "create", getSnapSpec(imageName, poolName, snapName)}
+		if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+			return nil, fmt.Errorf("failed to create snapshot %s of image %s in pool %s. %+v. output: %s",
+				snapName, imageName, poolName, err, string(buf))
+		}
+		if snapshot, err = getSnapshot(context, clusterName, poolName, imageName, snapName); err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			return nil, fmt.Errorf("failed to find snapshot %s of image %s after creating it", snapName, imageName)
+		}
+	}
+
+	protected, err := snapshotProtected(context, clusterName, poolName, imageName, snapName)
+	if err != nil {
+		return nil, err
+	}
+	if !protected {
+		args := []string{"snap", "protect", getSnapSpec(imageName, poolName, snapName)}
+		if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+			return nil, fmt.Errorf("failed to protect snapshot %s of image %s in pool %s. %+v. output: %s",
+				snapName, imageName, poolName, err, string(buf))
+		}
+	}
+	return snapshot, nil
+}
+
+// DeleteSnapshot deletes the snapshot of an image. The images cloned from the snapshot are flattened first so they no
+// longer depend on it. Deleting a snapshot that does not exist is not an error.
+func DeleteSnapshot(context *clusterd.Context, clusterName, poolName, imageName, snapName string) error {
+	snapshot, err := getSnapshot(context, clusterName, poolName, imageName, snapName)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	protected, err := snapshotProtected(context, clusterName, poolName, imageName, snapName)
+	if err != nil {
+		return err
+	}
+	if protected {
+		children, err := listSnapshotChildren(context, clusterName, poolName, imageName, snapName)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			args := []string{"flatten", child}
+			if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+				return fmt.Errorf("failed to flatten image %s cloned from snapshot %s. %+v. output: %s", child, snapName, err, string(buf))
+			}
+		}
+
+		args := []string{"snap", "unprotect", getSnapSpec(imageName, poolName, snapName)}
+		if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to unprotect snapshot %s of image %s in pool %s. %+v. output: %s",
+				snapName, imageName, poolName, err, string(buf))
+		}
+	}
+
+	args := []string{"snap", "rm", getSnapSpec(imageName, poolName, snapName)}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s of image %s in pool %s. %+v. output: %s",
+			snapName, imageName, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// CloneSnapshot creates a new image from the protected snapshot of an image
+func CloneSnapshot(context *clusterd.Context, clusterName, poolName, imageName, snapName, clonePoolName, cloneName string) error {
+	args := []string{"clone", getSnapSpec(imageName, poolName, snapName), getImageSpec(cloneName, clonePoolName)}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to clone snapshot %s of image %s into image %s in pool %s. %+v. output: %s",
+			snapName, imageName, cloneName, clonePoolName, err, string(buf))
+	}
+	return nil
+}
+
+// ResizeImage changes the size of an image
+func ResizeImage(context *clusterd.Context, clusterName, name, poolName string, size uint64) error {
+	sizeMB := int(size / 1024 / 1024)
+	args := []string{"resize", getImageSpec(name, poolName), "--size", strconv.Itoa(sizeMB)}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to resize image %s in pool %s to size %d. %+v. output: %s", name, poolName, size, err, string(buf))
+	}
+	return nil
+}
+
+func getSnapshot(context *clusterd.Context, clusterName, poolName, imageName, snapName string) (*CephImageSnapshot, error) {
+	snapshots, err := ListSnapshots(context, clusterName, poolName, imageName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		if snapshots[i].Name == snapName {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func snapshotProtected(context *clusterd.Context, clusterName, poolName, imageName, snapName string) (bool, error) {
+	args := []string{"info", getSnapSpec(imageName, poolName, snapName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return false, fmt.Errorf("failed to get info of snapshot %s of image %s in pool %s. %+v", snapName, imageName, poolName, err)
+	}
+
+	var info snapshotInfo
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return false, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return info.Protected == "true", nil
+}
+
+// lists the images cloned from a snapshot as <pool>/<image>
+func listSnapshotChildren(context *clusterd.Context, clusterName, poolName, imageName, snapName string) ([]string, error) {
+	args := []string{"children", getSnapSpec(imageName, poolName, snapName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children of snapshot %s of image %s in pool %s. %+v", snapName, imageName, poolName, err)
+	}
+
+	var children []string
+	if err := json.Unmarshal(buf, &children); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return children, nil
+}
+
+func getSnapSpec(imageName, poolName, snapName string) string {
+	return fmt.Sprintf("%s@%s", getImageSpec(imageName, poolName), snapName)
+}
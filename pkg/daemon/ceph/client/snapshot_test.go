@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndDeleteSnapshot(t *testing.T) {
+	snapshots := `[]`
+	protected := "false"
+	commands := []string{}
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		switch {
+		case command == "rbd" && args[0] == "snap" && args[1] == "ls":
+			return snapshots, nil
+		case command == "rbd" && args[0] == "info":
+			return fmt.Sprintf(`{"name":"image1","size":1048576,"protected":"%s"}`, protected), nil
+		case command == "rbd" && args[0] == "children":
+			return `["pool2/clone1"]`, nil
+		case command == "rbd" && args[0] == "snap" && args[1] == "create":
+			snapshots = `[{"id":4,"name":"snap1","size":1048576,"timestamp":"Fri Apr 20 10:00:00 2018"}]`
+		}
+		commands = append(commands, fmt.Sprintf("%s %s", args[0], args[1]))
+		return "", nil
+	}
+
+	// the snapshot is created and protected so it can be cloned
+	snapshot, err := CreateSnapshot(context, "mycluster", "pool1", "image1", "snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, "snap1", snapshot.Name)
+	assert.Equal(t, uint64(1048576), snapshot.Size)
+	assert.Equal(t, []string{"snap create", "snap protect"}, commands)
+
+	// an existing protected snapshot is not changed
+	protected = "true"
+	commands = []string{}
+	_, err = CreateSnapshot(context, "mycluster", "pool1", "image1", "snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, commands)
+
+	// the clones are flattened before the snapshot is unprotected and removed
+	err = DeleteSnapshot(context, "mycluster", "pool1", "image1", "snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"flatten pool2/clone1", "snap unprotect", "snap rm"}, commands)
+
+	// deleting a missing snapshot does nothing
+	snapshots = `[]`
+	commands = []string{}
+	err = DeleteSnapshot(context, "mycluster", "pool1", "image1", "snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, commands)
+}
+
+func TestCloneSnapshot(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "clone" {
+			assert.Equal(t, "pool1/image1@snap1", args[1])
+			assert.Equal(t, "pool2/clone1", args[2])
+			return "", nil
+		}
+		if command == "rbd" && args[0] == "resize" {
+			assert.Equal(t, "pool2/clone1", args[1])
+			assert.Equal(t, "2", args[3])
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected rbd command '%v'", args)
+	}
+
+	err := CloneSnapshot(context, "mycluster", "pool1", "image1", "snap1", "pool2", "clone1")
+	assert.Nil(t, err)
+	err = ResizeImage(context, "mycluster", "clone1", "pool2", uint64(2097152))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rook/rook/pkg/clusterd"
+	cephclient "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/devicehealth"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeviceHealthCollector displays the SMART data of the OSD devices. The data is collected by the
+// OSD pods on each node and saved in a config map for each OSD.
+type DeviceHealthCollector struct {
+	// Context for executing commands against the Ceph cluster
+	context *clusterd.Context
+
+	// The name of the ceph cluster
+	clusterName string
+
+	// Healthy displays whether the device passed its overall SMART health self-assessment
+	// and no attribute is below its failure threshold
+	Healthy *prometheus.GaugeVec
+
+	// Temperature displays the temperature of the device in Celsius
+	Temperature *prometheus.GaugeVec
+
+	// PowerOnHours displays how long the device has been powered on
+	PowerOnHours *prometheus.GaugeVec
+
+	// ReallocatedSectors displays the number of sectors that were remapped after read or write errors
+	ReallocatedSectors *prometheus.GaugeVec
+
+	// PendingSectors displays the number of unstable sectors waiting to be remapped
+	PendingSectors *prometheus.GaugeVec
+}
+
+// NewDeviceHealthCollector creates an instance of the DeviceHealthCollector and instantiates
+// the individual metrics that show the health of the OSD devices.
+func NewDeviceHealthCollector(context *clusterd.Context, clusterName string) *DeviceHealthCollector {
+	labels := []string{"osd", "device"}
+	return &DeviceHealthCollector{
+		context:     context,
+		clusterName: clusterName,
+
+		Healthy: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: cephNamespace,
+				Name:      "osd_device_healthy",
+				Help:      "OSD Device SMART Health",
+			},
+			labels,
+		),
+
+		Temperature: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: cephNamespace,
+				Name:      "osd_device_temperature_celsius",
+				Help:      "OSD Device Temperature",
+			},
+			labels,
+		),
+
+		PowerOnHours: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: cephNamespace,
+				Name:      "osd_device_power_on_hours",
+				Help:      "OSD Device Power On Hours",
+			},
+			labels,
+		),
+
+		ReallocatedSectors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: cephNamespace,
+				Name:      "osd_device_reallocated_sectors",
+				Help:      "OSD Device Reallocated Sector Count",
+			},
+			labels,
+		),
+
+		PendingSectors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: cephNamespace,
+				Name:      "osd_device_pending_sectors",
+				Help:      "OSD Device Pending Sector Count",
+			},
+			labels,
+		),
+	}
+}
+
+func (d *DeviceHealthCollector) collectorList() []prometheus.Collector {
+	return []prometheus.Collector{
+		d.Healthy,
+		d.Temperature,
+		d.PowerOnHours,
+		d.ReallocatedSectors,
+		d.PendingSectors,
+	}
+}
+
+func (d *DeviceHealthCollector) collect() error {
+	osdDump, err := cephclient.GetOSDDump(d.context, d.clusterName)
+	if err != nil {
+		return err
+	}
+
+	// the devices that are no longer reported, or the osds that were removed, must not keep their last values
+	for _, metric := range []*prometheus.GaugeVec{d.Healthy, d.Temperature, d.PowerOnHours, d.ReallocatedSectors, d.PendingSectors} {
+		metric.Reset()
+	}
+
+	kv := k8sutil.NewConfigMapKVStore(d.clusterName, d.context.Clientset, metav1.OwnerReference{})
+	for _, dumpInfo := range osdDump.OSDs {
+		osdID, err := dumpInfo.OSD.Int64()
+		if err != nil {
+			return err
+		}
+		osdName := fmt.Sprintf("osd.%v", osdID)
+
+		devices, err := devicehealth.Load(kv, int(osdID))
+		if err != nil {
+			return err
+		}
+
+		for _, health := range devices {
+			healthy := 1.0
+			if health.PredictedFailure() {
+				healthy = 0
+			}
+			d.Healthy.WithLabelValues(osdName, health.Device).Set(healthy)
+			d.Temperature.WithLabelValues(osdName, health.Device).Set(float64(health.Temperature))
+			d.PowerOnHours.WithLabelValues(osdName, health.Device).Set(float64(health.PowerOnHours))
+			d.ReallocatedSectors.WithLabelValues(osdName, health.Device).Set(float64(health.ReallocatedSectors))
+			d.PendingSectors.WithLabelValues(osdName, health.Device).Set(float64(health.PendingSectors))
+		}
+	}
+
+	return nil
+}
+
+// Describe sends the descriptors of each DeviceHealthCollector related metrics we have defined
+// to the provided prometheus channel.
+func (d *DeviceHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range d.collectorList() {
+		metric.Describe(ch)
+	}
+}
+
+// Collect sends all the collected metrics to the provided prometheus channel.
+// It requires the caller to handle synchronization.
+func (d *DeviceHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := d.collect(); err != nil {
+		logger.Errorf("failed collecting osd device health metrics: %+v", err)
+	}
+
+	for _, metric := range d.collectorList() {
+		metric.Collect(ch)
+	}
+}
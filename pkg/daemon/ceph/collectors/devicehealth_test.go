@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package collectors
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeviceHealthCollector(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return `{"osds": [{"osd": 0, "up": 1, "in": 1}, {"osd": 1, "up": 1, "in": 1}]}`, nil
+		},
+	}
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, ConfigDir: configDir, Clientset: clientset}
+
+	// osd.0 has a healthy device and osd.1 has a failing device
+	kv := k8sutil.NewConfigMapKVStore("mycluster", clientset, metav1.OwnerReference{})
+	err := kv.SetValue("rook-ceph-osd-0-device-health", "sda",
+		`{"device":"sda","passed":true,"temperature":36,"powerOnHours":1200,"reallocatedSectors":0,"pendingSectors":0}`)
+	assert.Nil(t, err)
+	err = kv.SetValue("rook-ceph-osd-1-device-health", "sdb",
+		`{"device":"sdb","passed":true,"failingAttributes":["Reallocated_Sector_Ct"],"reallocatedSectors":2040,"pendingSectors":8}`)
+	assert.Nil(t, err)
+
+	collector := NewDeviceHealthCollector(context, "mycluster")
+	if err := prometheus.Register(collector); err != nil {
+		t.Fatalf("collector failed to register: %s", err)
+	}
+	defer prometheus.Unregister(collector)
+
+	server := httptest.NewServer(prometheus.Handler())
+	defer server.Close()
+
+	buf := scrapeMetrics(t, server.URL)
+	for _, re := range []*regexp.Regexp{
+		regexp.MustCompile(`ceph_osd_device_healthy{device="sda",osd="osd.0"} 1`),
+		regexp.MustCompile(`ceph_osd_device_temperature_celsius{device="sda",osd="osd.0"} 36`),
+		regexp.MustCompile(`ceph_osd_device_power_on_hours{device="sda",osd="osd.0"} 1200`),
+		regexp.MustCompile(`ceph_osd_device_healthy{device="sdb",osd="osd.1"} 0`),
+		regexp.MustCompile(`ceph_osd_device_reallocated_sectors{device="sdb",osd="osd.1"} 2040`),
+		regexp.MustCompile(`ceph_osd_device_pending_sectors{device="sdb",osd="osd.1"} 8`),
+	} {
+		assert.True(t, re.Match(buf), fmt.Sprintf("failed matching: %q", re))
+	}
+
+	// the metrics of the devices that are no longer reported are removed
+	err = clientset.CoreV1().ConfigMaps("mycluster").Delete("rook-ceph-osd-1-device-health", &metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	buf = scrapeMetrics(t, server.URL)
+	assert.True(t, regexp.MustCompile(`ceph_osd_device_healthy{device="sda",osd="osd.0"} 1`).Match(buf))
+	assert.False(t, regexp.MustCompile(`osd="osd.1"`).Match(buf))
+}
+
+func scrapeMetrics(t *testing.T, url string) []byte {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected failed response from prometheus: %s", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed reading server response: %s", err)
+	}
+	return buf
+}
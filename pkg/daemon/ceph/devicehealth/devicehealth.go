@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package devicehealth stores the SMART data of the OSD devices. The data is saved by the OSD pods and read by the
+// operator and the metrics collectors.
+package devicehealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const storeNameFmt = "rook-ceph-osd-%d-device-health"
+
+// Save saves the SMART data of a device of the given OSD
+func Save(kv *k8sutil.ConfigMapKVStore, id int, health *sys.DeviceHealth) error {
+	b, err := json.Marshal(health)
+	if err != nil {
+		return fmt.Errorf("failed to marshal health of device %s. %+v", health.Device, err)
+	}
+	return kv.SetValue(fmt.Sprintf(storeNameFmt, id), health.Device, string(b))
+}
+
+// Load loads the last SMART data that was collected for the devices of the given OSD
+func Load(kv *k8sutil.ConfigMapKVStore, id int) ([]sys.DeviceHealth, error) {
+	store, err := kv.GetStore(fmt.Sprintf(storeNameFmt, id))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the health of the devices has not been collected
+			return []sys.DeviceHealth{}, nil
+		}
+		return nil, err
+	}
+
+	var devices []string
+	for device := range store {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	result := []sys.DeviceHealth{}
+	for _, device := range devices {
+		var health sys.DeviceHealth
+		if err := json.Unmarshal([]byte(store[device]), &health); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal health of device %s for osd %d. %+v", device, id, err)
+		}
+		result = append(result, health)
+	}
+
+	return result, nil
+}
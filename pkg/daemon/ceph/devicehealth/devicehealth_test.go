@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package devicehealth
+
+import (
+	"testing"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	kv := k8sutil.NewConfigMapKVStore("ns", fake.NewSimpleClientset(), metav1.OwnerReference{})
+
+	// nothing has been collected yet
+	devices, err := Load(kv, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(devices))
+
+	// the devices are loaded in order
+	err = Save(kv, 1, &sys.DeviceHealth{Device: "sdb", Passed: true, ReallocatedSectors: 2040})
+	assert.Nil(t, err)
+	err = Save(kv, 1, &sys.DeviceHealth{Device: "sda", Passed: true, Temperature: 36})
+	assert.Nil(t, err)
+	devices, err = Load(kv, 1)
+	assert.Nil(t, err)
+	require.Equal(t, 2, len(devices))
+	assert.Equal(t, "sda", devices[0].Device)
+	assert.Equal(t, 36, devices[0].Temperature)
+	assert.Equal(t, "sdb", devices[1].Device)
+	assert.Equal(t, 2040, devices[1].ReallocatedSectors)
+
+	// the devices of other osds are stored separately
+	devices, err = Load(kv, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(devices))
+}
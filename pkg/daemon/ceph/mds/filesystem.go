@@ -65,7 +65,7 @@ func (f *Filesystem) CreateFilesystem(context *clusterd.Context, clusterName str
 	_, err := client.GetFilesystem(context, clusterName, f.Name)
 	if err == nil {
 		logger.Infof("file system %s already exists", f.Name)
-		return nil
+		return f.updatePoolOptions(context, clusterName)
 	}
 	if len(f.dataPools) == 0 {
 		return fmt.Errorf("at least one data pool must be specified")
@@ -100,6 +100,21 @@ func (f *Filesystem) CreateFilesystem(context *clusterd.Context, clusterName str
 	return nil
 }
 
+// applies the quotas, compression, and other properties to the pools of an existing file system
+func (f *Filesystem) updatePoolOptions(context *clusterd.Context, clusterName string) error {
+	for _, pool := range append([]*model.Pool{f.metadataPool}, f.dataPools...) {
+		if _, err := ceph.GetPoolDetails(context, clusterName, pool.Name); err != nil {
+			// data pools added to an existing file system are not created
+			logger.Warningf("skipping the options of pool %s. %+v", pool.Name, err)
+			continue
+		}
+		if err := ceph.SetPoolOptions(context, clusterName, *pool); err != nil {
+			return fmt.Errorf("failed to set the options of pool %s. %+v", pool.Name, err)
+		}
+	}
+	return nil
+}
+
 // Remove the file system in ceph
 func DeleteFilesystem(context *clusterd.Context, clusterName, filesystemName string) error {
 	logger.Infof("Removing file system %s", filesystemName)
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+)
+
+const quotaMaxBytesAttr = "ceph.quota.max_bytes"
+
+// sets the quota of a directory of a file system mounted with ceph-fuse
+var setQuota = func(dir string, bytes int64) error {
+	return syscall.Setxattr(dir, quotaMaxBytesAttr, []byte(strconv.FormatInt(bytes, 10)), 0)
+}
+
+// CreateVolumeDir creates the directory of a provisioned volume in the file system and sets its quota. The quota is
+// only enforced by the clients that support cephfs quotas.
+func CreateVolumeDir(context *clusterd.Context, cluster *mon.ClusterInfo, fsName, volumePath string, quota int64) error {
+	return withFilesystemRoot(context, cluster, fsName, func(rootDir string) error {
+		volumeDir := filepath.Join(rootDir, volumePath)
+		if err := os.MkdirAll(volumeDir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %+v", volumePath, err)
+		}
+		if err := setQuota(volumeDir, quota); err != nil {
+			return fmt.Errorf("failed to set the quota of %d bytes on directory %s: %+v", quota, volumePath, err)
+		}
+		logger.Infof("created directory %s in filesystem %s with a quota of %d bytes", volumePath, fsName, quota)
+		return nil
+	})
+}
+
+// DeleteVolumeDir removes the directory of a provisioned volume and its content from the file system
+func DeleteVolumeDir(context *clusterd.Context, cluster *mon.ClusterInfo, fsName, volumePath string) error {
+	return withFilesystemRoot(context, cluster, fsName, func(rootDir string) error {
+		if err := os.RemoveAll(filepath.Join(rootDir, volumePath)); err != nil {
+			return fmt.Errorf("failed to remove directory %s: %+v", volumePath, err)
+		}
+		logger.Infof("removed directory %s from filesystem %s", volumePath, fsName)
+		return nil
+	})
+}
+
+// withFilesystemRoot mounts the root of the file system as the admin with ceph-fuse while the directories of the
+// volumes are managed
+func withFilesystemRoot(context *clusterd.Context, cluster *mon.ClusterInfo, fsName string, f func(rootDir string) error) error {
+	if err := mon.GenerateAdminConnectionConfig(context, cluster); err != nil {
+		return fmt.Errorf("failed to write connection config. %+v", err)
+	}
+
+	rootDir, err := ioutil.TempDir("", "rook-cephfs-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary mount point for filesystem %s: %+v", fsName, err)
+	}
+	defer os.Remove(rootDir)
+
+	if err := client.MountFilesystemRootFuse(context, cluster.Name, fsName, rootDir); err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.UnmountFilesystemFuse(context, rootDir); err != nil {
+			logger.Warningf("failed to unmount the root of filesystem %s from %s. %+v", fsName, rootDir, err)
+		}
+	}()
+
+	return f(rootDir)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeDir(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(configDir)
+
+	mountPoints := []string{}
+	unmounted := 0
+	quotas := map[string]int64{}
+	setQuota = func(dir string, bytes int64) error {
+		quotas[dir] = bytes
+		return nil
+	}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithTimeout: func(debug bool, timeout time.Duration, actionName string, command string, args ...string) (string, error) {
+			if command == "ceph-fuse" {
+				assert.Equal(t, "--client_mds_namespace=myfs", args[1])
+				assert.Equal(t, "--cluster=mycluster", args[2])
+				mountPoints = append(mountPoints, args[0])
+				if len(mountPoints) > 1 {
+					// the file system already has the volume directory when it is mounted again
+					assert.Nil(t, os.MkdirAll(filepath.Join(args[0], "/volumes/pvc-1/data"), 0755))
+				}
+			}
+			if command == "umount" {
+				unmounted++
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, ConfigDir: configDir}
+	cluster := &mon.ClusterInfo{
+		Name:        "mycluster",
+		AdminSecret: "adminsecret",
+		Monitors:    map[string]*mon.CephMonitorConfig{"a": {Name: "a", Endpoint: "1.2.3.4:6790"}},
+	}
+
+	// the directory is created with a quota from the root of the file system mounted as the admin
+	err = CreateVolumeDir(context, cluster, "myfs", "/volumes/pvc-1", 1048576)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mountPoints))
+	assert.Equal(t, 1, unmounted)
+	volumeDir := filepath.Join(mountPoints[0], "/volumes/pvc-1")
+	defer os.RemoveAll(mountPoints[0])
+	_, err = os.Stat(volumeDir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1048576), quotas[volumeDir])
+	_, err = os.Stat(filepath.Join(configDir, "mycluster", "client.admin.keyring"))
+	assert.Nil(t, err)
+
+	// the directory is removed with its content
+	err = DeleteVolumeDir(context, cluster, "myfs", "/volumes/pvc-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mountPoints))
+	assert.Equal(t, 2, unmounted)
+	defer os.RemoveAll(mountPoints[1])
+	_, err = os.Stat(filepath.Join(mountPoints[1], "/volumes/pvc-1"))
+	assert.True(t, os.IsNotExist(err))
+}
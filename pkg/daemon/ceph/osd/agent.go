@@ -60,20 +60,28 @@ type OsdAgent struct {
 	usingDeviceFilter  bool
 	metadataDevice     string
 	directories        string
+	blockDevicePath    string
 	procMan            *proc.ProcManager
 	storeConfig        rookalpha.StoreConfig
 	kv                 *k8sutil.ConfigMapKVStore
 	configCounter      int32
 	osdsCompleted      chan struct{}
+	prepareOnly        bool
+	preparedOSDs       []OSDInfo
+	migratingDevices   map[string]int
+	healthInterval     time.Duration
+	stopHealthMonitors chan struct{}
 }
 
-func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, metadataDevice, directories string, forceFormat bool,
-	location string, storeConfig rookalpha.StoreConfig, cluster *mon.ClusterInfo, nodeName string, kv *k8sutil.ConfigMapKVStore) *OsdAgent {
+func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, metadataDevice, directories, blockDevicePath string,
+	forceFormat bool, location string, storeConfig rookalpha.StoreConfig, cluster *mon.ClusterInfo, nodeName string,
+	kv *k8sutil.ConfigMapKVStore) *OsdAgent {
 
 	return &OsdAgent{devices: devices, usingDeviceFilter: usingDeviceFilter, metadataDevice: metadataDevice,
-		directories: directories, forceFormat: forceFormat, location: location, storeConfig: storeConfig,
+		directories: directories, blockDevicePath: blockDevicePath, forceFormat: forceFormat, location: location, storeConfig: storeConfig,
 		cluster: cluster, nodeName: nodeName, kv: kv,
 		procMan: proc.New(context.Executor), osdProc: make(map[int]*proc.MonitoredProc),
+		stopHealthMonitors: make(chan struct{}),
 	}
 }
 
@@ -115,6 +123,11 @@ func (a *OsdAgent) configureDirs(context *clusterd.Context, dirs map[string]int)
 }
 
 func (a *OsdAgent) configureDevices(context *clusterd.Context, devices *DeviceOsdMapping) error {
+	if a.storeConfig.ProvisionScheme == LVMScheme {
+		// existing lvm osds are discovered from their volumes even if there are no available devices
+		return a.configureLVMDevices(context, devices)
+	}
+
 	if devices == nil || len(devices.Entries) == 0 {
 		return nil
 	}
@@ -201,8 +214,15 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 				continue
 			}
 
-			// register/create the OSD with ceph, which will assign it a cluster wide ID
-			osdID, osdUUID, err := registerOSD(context, a.cluster.Name)
+			// register/create the OSD with ceph, which will assign it a cluster wide ID. an OSD that is being
+			// migrated to another store type keeps its ID.
+			var osdID *int
+			var osdUUID *uuid.UUID
+			if id, ok := a.migratingDevices[name]; ok {
+				osdID, osdUUID, err = registerOSDWithID(context, a.cluster.Name, id)
+			} else {
+				osdID, osdUUID, err = registerOSD(context, a.cluster.Name)
+			}
 			if err != nil {
 				return nil, fmt.Errorf("failed to register OSD for device %s: %+v", name, err)
 			}
@@ -377,6 +397,12 @@ func (a *OsdAgent) startOSD(context *clusterd.Context, config *osdConfig) error
 		}
 	}
 
+	if a.prepareOnly {
+		// the OSD will be run in its own pod, only record the info needed to start it
+		a.preparedOSDs = append(a.preparedOSDs, newOSDInfo(a.cluster.Name, config))
+		return nil
+	}
+
 	// run the OSD in a child process now that it is fully initialized and ready to go
 	err := a.runOSD(context, a.cluster.Name, config)
 	if err != nil {
@@ -391,29 +417,15 @@ func (a *OsdAgent) runOSD(context *clusterd.Context, clusterName string, config
 	// start the OSD daemon in the foreground with the given config
 	logger.Infof("starting osd %d at %s", config.id, config.rootPath)
 
-	confFile := getOSDConfFilePath(config.rootPath, clusterName)
-	util.WriteFileToLog(logger, confFile)
+	util.WriteFileToLog(logger, getOSDConfFilePath(config.rootPath, clusterName))
 
 	osdUUIDArg := fmt.Sprintf("--osd-uuid=%s", config.uuid.String())
-	params := []string{"--foreground",
-		fmt.Sprintf("--id=%d", config.id),
-		fmt.Sprintf("--cluster=%s", clusterName),
-		fmt.Sprintf("--osd-data=%s", config.rootPath),
-		fmt.Sprintf("--conf=%s", confFile),
-		fmt.Sprintf("--keyring=%s", getOSDKeyringPath(config.rootPath)),
-		osdUUIDArg,
-	}
-
-	if isFilestore(config) {
-		params = append(params, fmt.Sprintf("--osd-journal=%s", getOSDJournalPath(config.rootPath)))
-	}
-
 	process, err := a.procMan.Start(
 		fmt.Sprintf("osd%d", config.id),
 		"ceph-osd",
 		regexp.QuoteMeta(osdUUIDArg),
 		proc.ReuseExisting,
-		params...)
+		getOSDArgs(clusterName, config)...)
 	if err != nil {
 		return fmt.Errorf("failed to start osd %d: %+v", config.id, err)
 	}
@@ -421,11 +433,30 @@ func (a *OsdAgent) runOSD(context *clusterd.Context, clusterName string, config
 	if process != nil {
 		// if the process was already running Start will return nil in which case we don't want to overwrite it
 		a.osdProc[config.id] = process
+		startDeviceHealthMonitor(context, config, a.healthInterval, a.stopHealthMonitors)
 	}
 
 	return nil
 }
 
+// the args to run the ceph-osd daemon in the foreground with the given config
+func getOSDArgs(clusterName string, config *osdConfig) []string {
+	args := []string{"--foreground",
+		fmt.Sprintf("--id=%d", config.id),
+		fmt.Sprintf("--cluster=%s", clusterName),
+		fmt.Sprintf("--osd-data=%s", config.rootPath),
+		fmt.Sprintf("--conf=%s", getOSDConfFilePath(config.rootPath, clusterName)),
+		fmt.Sprintf("--keyring=%s", getOSDKeyringPath(config.rootPath)),
+		fmt.Sprintf("--osd-uuid=%s", config.uuid.String()),
+	}
+
+	if isFilestore(config) {
+		args = append(args, fmt.Sprintf("--osd-journal=%s", getOSDJournalPath(config.rootPath)))
+	}
+
+	return args
+}
+
 func isOSDDataNotExist(osdDataPath string) bool {
 	_, err := os.Stat(filepath.Join(osdDataPath, "whoami"))
 	return os.IsNotExist(err)
@@ -464,6 +495,10 @@ func isBluestore(config *osdConfig) bool {
 }
 
 func isBluestoreDevice(config *osdConfig) bool {
+	if config.lvm != nil || config.blockDevice != nil {
+		// lvm and block devices are only supported with bluestore
+		return !config.dir
+	}
 	return !config.dir && config.partitionScheme != nil && config.partitionScheme.StoreType == Bluestore
 }
 
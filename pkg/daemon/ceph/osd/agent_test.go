@@ -263,6 +263,59 @@ func TestOSDAgentNoDevices(t *testing.T) {
 	assert.Equal(t, 1, len(agent.osdProc))
 }
 
+func TestOSDAgentPrepareOnly(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "TestOSDAgentPrepareOnly")
+	require.NoError(t, err)
+	defer os.RemoveAll(configDir)
+
+	agent, executor := createTestAgent(t, "", configDir, nil)
+	agent.prepareOnly = true
+
+	startCount := 0
+	executor.MockStartExecuteCommand = func(debug bool, name string, command string, args ...string) (*exec.Cmd, error) {
+		startCount++
+		return &exec.Cmd{Args: append([]string{command}, args...)}, nil
+	}
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		createTestKeyring(t, configDir, args)
+		return nil
+	}
+
+	context := &clusterd.Context{
+		Devices:   []*clusterd.LocalDisk{},
+		Executor:  executor,
+		ConfigDir: configDir,
+	}
+	dirs := map[string]int{filepath.Join(configDir, "sdx"): -1}
+	err = agent.configureDirs(context, dirs)
+	assert.Nil(t, err)
+
+	// the osd is initialized but not started
+	assert.Equal(t, 0, startCount)
+	assert.Equal(t, 0, len(agent.osdProc))
+	require.Equal(t, 1, len(agent.preparedOSDs))
+	info := agent.preparedOSDs[0]
+	assert.Equal(t, 3, info.ID)
+	assert.Equal(t, "myclust", info.Cluster)
+	assert.Equal(t, filepath.Join(configDir, "sdx", "osd3"), info.DataPath)
+	assert.Equal(t, Bluestore, info.StoreType)
+	assert.True(t, info.IsDirectory)
+
+	// the saved info is used to build the config when the osd is started in its own pod
+	err = saveOSDInfo(agent.kv, agent.nodeName, agent.preparedOSDs)
+	assert.Nil(t, err)
+	config, err := loadPreparedOSDConfig(context, agent.cluster, agent.kv, agent.nodeName, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, info.DataPath, config.rootPath)
+	assert.Equal(t, filepath.Join(configDir, "sdx"), config.configRoot)
+	assert.Equal(t, info.UUID, config.uuid.String())
+	assert.True(t, isBluestoreDir(config))
+
+	// an osd that was not prepared on the node is an error
+	_, err = loadPreparedOSDConfig(context, agent.cluster, agent.kv, agent.nodeName, 4)
+	assert.NotNil(t, err)
+}
+
 func createTestAgent(t *testing.T, devices, configDir string, storeConfig *rookalpha.StoreConfig) (*OsdAgent, *exectest.MockExecutor) {
 	location := "root=here"
 	forceFormat := false
@@ -278,7 +331,7 @@ func createTestAgent(t *testing.T, devices, configDir string, storeConfig *rooka
 	cluster := &mon.ClusterInfo{Name: "myclust"}
 	agent := NewAgent(
 		&clusterd.Context{Executor: executor, Clientset: testop.New(1)},
-		devices, false, "", "", forceFormat, location, *storeConfig, cluster, "myhost", mockKVStore())
+		devices, false, "", "", "", forceFormat, location, *storeConfig, cluster, "myhost", mockKVStore())
 
 	return agent, executor
 }
@@ -0,0 +1,109 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	blockDeviceKey = "block-device"
+)
+
+// blockDevice is the raw block device of a volume claim that is consumed whole by a bluestore OSD. The claim takes the
+// place of the node, so the OSD created on the device is saved in the config store of the claim and found again when
+// the OSD pod is rescheduled to another node with an empty data dir.
+type blockDevice struct {
+	// the path of the device in the OSD container
+	Path      string    `json:"-"`
+	ID        int       `json:"id"`
+	UUID      uuid.UUID `json:"uuid"`
+	FSCreated bool      `json:"fs-created"`
+}
+
+// configures and starts the OSD on the raw block device of a volume claim, registering the OSD the first time
+func (a *OsdAgent) configureBlockDevice(context *clusterd.Context) error {
+	if a.storeConfig.StoreType == Filestore {
+		return fmt.Errorf("osds on block devices are only supported with %s", Bluestore)
+	}
+
+	storeName := getConfigStoreName(a.nodeName)
+	device, err := loadBlockDevice(a.kv, storeName)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		osdID, osdUUID, err := registerOSD(context, a.cluster.Name)
+		if err != nil {
+			return fmt.Errorf("failed to register OSD for block device %s: %+v", a.blockDevicePath, err)
+		}
+		device = &blockDevice{ID: *osdID, UUID: *osdUUID}
+		if err := saveBlockDevice(a.kv, storeName, device); err != nil {
+			return err
+		}
+	}
+	device.Path = a.blockDevicePath
+
+	config := &osdConfig{id: device.ID, uuid: device.UUID, configRoot: context.ConfigDir, blockDevice: device,
+		storeConfig: a.storeConfig, kv: a.kv, storeName: storeName}
+	if err := a.startOSD(context, config); err != nil {
+		return fmt.Errorf("failed to config osd %d on block device %s. %+v", device.ID, device.Path, err)
+	}
+	return nil
+}
+
+// LoadBlockDeviceOSDID loads the id of the OSD on the block device of a volume claim. The id is nil until the OSD pod
+// of the claim has registered the OSD.
+func LoadBlockDeviceOSDID(kv *k8sutil.ConfigMapKVStore, claimName string) (*int, error) {
+	device, err := loadBlockDevice(kv, getConfigStoreName(claimName))
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return &device.ID, nil
+}
+
+func loadBlockDevice(kv *k8sutil.ConfigMapKVStore, storeName string) (*blockDevice, error) {
+	raw, err := kv.GetValue(storeName, blockDeviceKey)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// no osd was created on the device yet
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load the block device osd from %s. %+v", storeName, err)
+	}
+	var device blockDevice
+	if err := json.Unmarshal([]byte(raw), &device); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the block device osd %s. %+v", raw, err)
+	}
+	return &device, nil
+}
+
+func saveBlockDevice(kv *k8sutil.ConfigMapKVStore, storeName string, device *blockDevice) error {
+	raw, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the block device osd %d. %+v", device.ID, err)
+	}
+	if err := kv.SetValue(storeName, blockDeviceKey, string(raw)); err != nil {
+		return fmt.Errorf("failed to save the block device osd %d. %+v", device.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockDevice(t *testing.T) {
+	kv := mockKVStore()
+	storeName := getConfigStoreName("rook-ceph-osd-set1-0")
+
+	// no osd is found before one is saved
+	device, err := loadBlockDevice(kv, storeName)
+	assert.Nil(t, err)
+	assert.Nil(t, device)
+
+	osdUUID := uuid.Must(uuid.NewRandom())
+	device = &blockDevice{Path: "/dev/rook-osd-block", ID: 3, UUID: osdUUID}
+	config := &osdConfig{id: 3, uuid: osdUUID, blockDevice: device, kv: kv, storeName: storeName}
+	assert.Nil(t, saveBlockDevice(kv, storeName, device))
+	assert.True(t, isBluestoreDevice(config))
+	assert.False(t, isOSDFilesystemCreated(config))
+
+	// the wal and db are on the block device
+	walPath, dbPath, blockPath, err := getBluestorePartitionPaths(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "", walPath)
+	assert.Equal(t, "", dbPath)
+	assert.Equal(t, "/dev/rook-osd-block", blockPath)
+	dataPath, err := getBluestoreDataPath(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/rook-osd-block", dataPath)
+
+	// the created filesystem is recorded with the osd, but not the path of the device
+	assert.Nil(t, markOSDFileSystemCreated(nil, config))
+	device, err = loadBlockDevice(kv, storeName)
+	assert.Nil(t, err)
+	assert.Equal(t, &blockDevice{ID: 3, UUID: osdUUID, FSCreated: true}, device)
+}
@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/operator/k8sutil"
@@ -35,11 +36,63 @@ import (
 
 const (
 	osdDirsKeyName = "osd-dirs"
+	osdInfoKeyName = "osd-info"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "cephosd")
 
-func Run(context *clusterd.Context, agent *OsdAgent) error {
+// OSDInfo is the info about an OSD that was prepared on a node that is needed to run the OSD in its own pod
+type OSDInfo struct {
+	ID          int    `json:"id"`
+	UUID        string `json:"uuid"`
+	Cluster     string `json:"cluster"`
+	DataPath    string `json:"data-path"`
+	StoreType   string `json:"store-type"`
+	IsDirectory bool   `json:"is-directory"`
+	IsLVM       bool   `json:"is-lvm"`
+}
+
+// Run configures the OSDs on the node and runs all of them as child processes. If the health interval is set, the
+// SMART data of the OSD devices is collected in the background. The OSDs that are down are recovered according to
+// the recovery policy.
+func Run(context *clusterd.Context, agent *OsdAgent, healthInterval time.Duration, recoveryPolicy rookalpha.OSDRecoveryPolicy) error {
+	agent.healthInterval = healthInterval
+	if err := configureOSDs(context, agent); err != nil {
+		return err
+	}
+
+	// OSD processes monitoring
+	mon := NewMonitor(context, agent, recoveryPolicy)
+	go mon.Run()
+
+	// FIX
+	log.Printf("sleeping a while to let the osds run...")
+	<-time.After(1000000 * time.Second)
+
+	return nil
+}
+
+// Provision configures the OSDs on the node without running them. The info about each OSD is saved in the
+// config store of the node so that the operator can start a pod for each OSD.
+func Provision(context *clusterd.Context, agent *OsdAgent) error {
+	agent.prepareOnly = true
+	if err := configureOSDs(context, agent); err != nil {
+		return err
+	}
+
+	logger.Infof("saving info for %d prepared osds", len(agent.preparedOSDs))
+	if err := saveOSDInfo(agent.kv, agent.nodeName, agent.preparedOSDs); err != nil {
+		return fmt.Errorf("failed to save osd info. %+v", err)
+	}
+
+	if err := completeMigration(agent); err != nil {
+		return fmt.Errorf("failed to complete osd migration. %+v", err)
+	}
+
+	return nil
+}
+
+func configureOSDs(context *clusterd.Context, agent *OsdAgent) error {
 	// set the crush location in the osd config file
 	cephConfig := mon.CreateDefaultCephConfig(context, agent.cluster, path.Join(context.ConfigDir, agent.cluster.Name))
 	cephConfig.GlobalConfig.CrushLocation = agent.location
@@ -49,6 +102,11 @@ func Run(context *clusterd.Context, agent *OsdAgent) error {
 		return fmt.Errorf("failed to write connection config. %+v", err)
 	}
 
+	if agent.blockDevicePath != "" {
+		// the osd of a volume claim consumes the whole block device of the claim and there are no other devices or dirs
+		return agent.configureBlockDevice(context)
+	}
+
 	logger.Infof("discovering hardware")
 	rawDevices, err := clusterd.DiscoverDevices(context.Executor)
 	if err != nil {
@@ -86,14 +144,6 @@ func Run(context *clusterd.Context, agent *OsdAgent) error {
 		return fmt.Errorf("failed to save osd dir map. %+v", err)
 	}
 
-	// OSD processes monitoring
-	mon := NewMonitor(context, agent)
-	go mon.Run()
-
-	// FIX
-	log.Printf("sleeping a while to let the osds run...")
-	<-time.After(1000000 * time.Second)
-
 	return nil
 }
 
@@ -234,3 +284,45 @@ func saveOSDDirMap(kv *k8sutil.ConfigMapKVStore, nodeName string, dirMap map[str
 
 	return nil
 }
+
+func newOSDInfo(clusterName string, config *osdConfig) OSDInfo {
+	storeType := config.storeConfig.StoreType
+	if config.partitionScheme != nil {
+		storeType = config.partitionScheme.StoreType
+	}
+
+	return OSDInfo{
+		ID:          config.id,
+		UUID:        config.uuid.String(),
+		Cluster:     clusterName,
+		DataPath:    config.rootPath,
+		StoreType:   storeType,
+		IsDirectory: config.dir,
+		IsLVM:       config.lvm != nil,
+	}
+}
+
+// LoadOSDInfo loads the info about the OSDs that were prepared on the given node
+func LoadOSDInfo(kv *k8sutil.ConfigMapKVStore, nodeName string) ([]OSDInfo, error) {
+	osdInfoRaw, err := kv.GetValue(getConfigStoreName(nodeName), osdInfoKeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	var osds []OSDInfo
+	err = json.Unmarshal([]byte(osdInfoRaw), &osds)
+	if err != nil {
+		return nil, err
+	}
+
+	return osds, nil
+}
+
+func saveOSDInfo(kv *k8sutil.ConfigMapKVStore, nodeName string, osds []OSDInfo) error {
+	b, err := json.Marshal(osds)
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(getConfigStoreName(nodeName), osdInfoKeyName, string(b))
+}
@@ -57,6 +57,8 @@ type osdConfig struct {
 	dir             bool
 	storeConfig     rookalpha.StoreConfig
 	partitionScheme *PerfSchemeEntry
+	lvm             *lvmVolumes
+	blockDevice     *blockDevice
 	kv              *k8sutil.ConfigMapKVStore
 	storeName       string
 }
@@ -332,6 +334,21 @@ func getDataPartitionDetails(config *osdConfig) (*PerfSchemePartitionDetails, er
 	return dataDetails, nil
 }
 
+// gets the path of the partition, logical volume or device that holds the data of a bluestore osd
+func getBluestoreDataPath(config *osdConfig) (string, error) {
+	if config.blockDevice != nil {
+		return config.blockDevice.Path, nil
+	}
+	if config.lvm != nil {
+		return config.lvm.BlockPath, nil
+	}
+	dataPartDetails, err := getDataPartitionDetails(config)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(diskByPartUUID, dataPartDetails.PartitionUUID), nil
+}
+
 func getMetadataPartitionDetails(config *osdConfig) (*PerfSchemePartitionDetails, error) {
 	if config.partitionScheme == nil {
 		return nil, fmt.Errorf("partition scheme missing from %+v", config)
@@ -397,6 +414,29 @@ func registerOSD(context *clusterd.Context, clusterName string) (*int, *uuid.UUI
 	return &osdID, &osdUUID, nil
 }
 
+// registers an OSD that reuses the ID of a destroyed OSD
+func registerOSDWithID(context *clusterd.Context, clusterName string, id int) (*int, *uuid.UUID, error) {
+	osdUUID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate UUID for osd: %+v", err)
+	}
+
+	args := []string{"osd", "new", osdUUID.String(), strconv.Itoa(id)}
+	buf, err := client.ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create osd %s with id %d: %+v", osdUUID, id, err)
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal response: %+v.  raw response: '%s'", err, string(buf[:]))
+	}
+	osdID := int(resp["osdid"].(float64))
+
+	logger.Infof("successfully created OSD %s with existing ID %d", osdUUID.String(), osdID)
+	return &osdID, &osdUUID, nil
+}
+
 func getStoreSettings(config *osdConfig) (map[string]string, error) {
 	settings := map[string]string{}
 	if isFilestore(config) {
@@ -454,7 +494,7 @@ func getStoreSettings(config *osdConfig) (map[string]string, error) {
 		settings["bluestore block size"] = strconv.Itoa(int(float64(totalBytes) * bluestoreDirBlockSizeRatio))
 	} else {
 		// devices are being used for bluestore, all we need is their paths
-		if config.partitionScheme == nil || config.partitionScheme.Partitions == nil {
+		if config.lvm == nil && config.blockDevice == nil && (config.partitionScheme == nil || config.partitionScheme.Partitions == nil) {
 			return nil, fmt.Errorf("failed to find partitions from config for osd %d", config.id)
 		}
 
@@ -464,8 +504,13 @@ func getStoreSettings(config *osdConfig) (map[string]string, error) {
 		}
 	}
 
-	settings["bluestore block wal path"] = walPath
-	settings["bluestore block db path"] = dbPath
+	// the wal and db are collocated on the block device when there is no separate path for them
+	if walPath != "" {
+		settings["bluestore block wal path"] = walPath
+	}
+	if dbPath != "" {
+		settings["bluestore block db path"] = dbPath
+	}
 	settings["bluestore block path"] = blockPath
 
 	return settings, nil
@@ -592,11 +637,10 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 	} else {
 		// for bluestore devices, the data partition will be raw, so we can't use Statfs.  Get the
 		// full device properties of the data partition and then get the size from that.
-		dataPartDetails, err := getDataPartitionDetails(config)
+		dataPartPath, err := getBluestoreDataPath(config)
 		if err != nil {
 			return fmt.Errorf("failed to get data partition details for osd %d (%s): %+v", osdID, osdDataPath, err)
 		}
-		dataPartPath := filepath.Join(diskByPartUUID, dataPartDetails.PartitionUUID)
 		devProps, err := sys.GetDevicePropertiesFromPath(dataPartPath, context.Executor)
 		if err != nil {
 			return fmt.Errorf("failed to get device properties for %s: %+v", dataPartPath, err)
@@ -662,6 +706,14 @@ func getBluestorePartitionPaths(config *osdConfig) (string, string, string, erro
 	if !isBluestoreDevice(config) {
 		return "", "", "", fmt.Errorf("must be bluestore device to get bluestore partition paths: %+v", config)
 	}
+	if config.lvm != nil {
+		// the logical volumes have stable paths
+		return config.lvm.WalPath, config.lvm.DBPath, config.lvm.BlockPath, nil
+	}
+	if config.blockDevice != nil {
+		// the wal and db are collocated on the block device
+		return "", "", config.blockDevice.Path, nil
+	}
 	parts := config.partitionScheme.Partitions
 	walPartition, ok := parts[WalPartitionType]
 	if !ok {
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/devicehealth"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+// startDeviceHealthMonitor collects the SMART data of the osd devices in the background if the interval is set. It is
+// called by every path that runs an osd daemon, whether the osd runs in its own pod or with the other osds of its node.
+func startDeviceHealthMonitor(context *clusterd.Context, config *osdConfig, interval time.Duration, stopCh chan struct{}) {
+	if interval <= 0 || config.dir {
+		return
+	}
+	go runDeviceHealthMonitor(context, config, interval, stopCh)
+}
+
+// runs in the background of the osd pod and saves the SMART data of the osd devices at each interval
+func runDeviceHealthMonitor(context *clusterd.Context, config *osdConfig, interval time.Duration, stopCh chan struct{}) {
+	devices := getOSDDevices(config)
+	if len(devices) == 0 {
+		logger.Infof("osd %d has no devices to monitor for health", config.id)
+		return
+	}
+
+	logger.Infof("monitoring the health of devices %v for osd %d every %v", devices, config.id, interval)
+	for {
+		collectDeviceHealth(context, config.kv, config.id, devices)
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// collects the SMART data for each device of the osd and saves it in the osd's device health store
+func collectDeviceHealth(context *clusterd.Context, kv *k8sutil.ConfigMapKVStore, id int, devices []string) {
+	for _, device := range devices {
+		health, err := sys.GetDeviceHealth(device, context.Executor)
+		if err != nil {
+			logger.Warningf("failed to get health of device %s for osd %d. %+v", device, id, err)
+			continue
+		}
+		if health.PredictedFailure() {
+			logger.Warningf("device %s of osd %d is predicted to fail: %+v", device, id, health)
+		}
+
+		if err := devicehealth.Save(kv, id, health); err != nil {
+			logger.Warningf("failed to save health of device %s for osd %d. %+v", device, id, err)
+		}
+	}
+}
+
+// gets the names of the devices that hold the data and metadata of the osd
+func getOSDDevices(config *osdConfig) []string {
+	devices := map[string]bool{}
+	if config.lvm != nil {
+		for _, device := range config.lvm.Devices {
+			devices[device] = true
+		}
+	} else if config.partitionScheme != nil {
+		for _, p := range config.partitionScheme.Partitions {
+			if p.Device != "" {
+				devices[p.Device] = true
+			}
+		}
+	}
+
+	result := []string{}
+	for device := range devices {
+		result = append(result, device)
+	}
+	sort.Strings(result)
+	return result
+}
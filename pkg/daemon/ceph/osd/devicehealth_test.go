@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/devicehealth"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOSDDevices(t *testing.T) {
+	// a bluestore osd with its metadata on another device
+	entry := NewPerfSchemeEntry(Bluestore)
+	entry.Partitions[BlockPartitionType] = &PerfSchemePartitionDetails{Device: "sdb"}
+	entry.Partitions[DatabasePartitionType] = &PerfSchemePartitionDetails{Device: "nvme0n1"}
+	entry.Partitions[WalPartitionType] = &PerfSchemePartitionDetails{Device: "nvme0n1"}
+	assert.Equal(t, []string{"nvme0n1", "sdb"}, getOSDDevices(&osdConfig{partitionScheme: entry}))
+
+	// lvm osds report the devices backing their volumes
+	assert.Equal(t, []string{"sdc"}, getOSDDevices(&osdConfig{lvm: &lvmVolumes{Devices: []string{"sdc", "sdc"}}}))
+
+	// directories have no devices
+	assert.Equal(t, 0, len(getOSDDevices(&osdConfig{dir: true})))
+}
+
+func TestCollectDeviceHealth(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch args[len(args)-1] {
+			case "/dev/sda":
+				return "SMART overall-health self-assessment test result: PASSED", nil
+			case "/dev/sdb":
+				return "SMART overall-health self-assessment test result: FAILED!", errors.New("exit status 8")
+			}
+			return "", errors.New("no SMART support")
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	kv := mockKVStore()
+
+	// nothing has been collected yet
+	devices, err := devicehealth.Load(kv, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(devices))
+
+	// the device without SMART support is skipped
+	collectDeviceHealth(context, kv, 1, []string{"sda", "sdb", "vda"})
+	devices, err = devicehealth.Load(kv, 1)
+	assert.Nil(t, err)
+	require.Equal(t, 2, len(devices))
+	assert.Equal(t, "sda", devices[0].Device)
+	assert.False(t, devices[0].PredictedFailure())
+	assert.Equal(t, "sdb", devices[1].Device)
+	assert.True(t, devices[1].PredictedFailure())
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/util"
+	"github.com/rook/rook/pkg/util/sys"
 )
 
 const (
@@ -83,7 +84,7 @@ func createOSDFileSystem(context *clusterd.Context, clusterName string, config *
 	}
 
 	// update the scheme to indicate the OSD's filesystem has been created and backed up.
-	if err := markOSDFileSystemCreated(config); err != nil {
+	if err := markOSDFileSystemCreated(context, config); err != nil {
 		return err
 	}
 
@@ -94,6 +95,12 @@ func createOSDFileSystem(context *clusterd.Context, clusterName string, config *
 // successfully.  It may not exist on disk anymore and therefore needs to be repaired, but this
 // determines if it was ever created and backed up in the past.
 func isOSDFilesystemCreated(config *osdConfig) bool {
+	if config.lvm != nil {
+		return config.lvm.FSCreated
+	}
+	if config.blockDevice != nil {
+		return config.blockDevice.FSCreated
+	}
 	if config.partitionScheme == nil {
 		return false
 	}
@@ -102,7 +109,22 @@ func isOSDFilesystemCreated(config *osdConfig) bool {
 }
 
 // marks the given OSD's filesystem as created and backed up.
-func markOSDFileSystemCreated(config *osdConfig) error {
+func markOSDFileSystemCreated(context *clusterd.Context, config *osdConfig) error {
+	if config.lvm != nil {
+		// the state is kept in a tag on the block volume
+		if err := sys.AddLogicalVolumeTag(config.lvm.BlockPath, lvmFSCreatedTag, "true", context.Executor); err != nil {
+			return err
+		}
+		config.lvm.FSCreated = true
+		return nil
+	}
+
+	if config.blockDevice != nil {
+		// the state is kept with the osd of the block device in the config store
+		config.blockDevice.FSCreated = true
+		return saveBlockDevice(config.kv, config.storeName, config.blockDevice)
+	}
+
 	if config.partitionScheme == nil {
 		return nil
 	}
@@ -216,11 +238,16 @@ func repairOSDFileSystem(config *osdConfig) error {
 		return err
 	}
 
-	if err := createBluestoreSymlink(config, walPath, bluestoreWalSymlinkName); err != nil {
-		return err
+	// lvm osds without a metadata device have their wal and db on the block volume
+	if walPath != "" {
+		if err := createBluestoreSymlink(config, walPath, bluestoreWalSymlinkName); err != nil {
+			return err
+		}
 	}
-	if err := createBluestoreSymlink(config, dbPath, bluestoreDBSymlinkName); err != nil {
-		return err
+	if dbPath != "" {
+		if err := createBluestoreSymlink(config, dbPath, bluestoreDBSymlinkName); err != nil {
+			return err
+		}
 	}
 	if err := createBluestoreSymlink(config, blockPath, bluestoreBlockSymlinkName); err != nil {
 		return err
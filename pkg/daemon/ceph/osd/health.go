@@ -18,31 +18,50 @@ package osd
 import (
 	"time"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/util/proc"
 )
 
-const upStatus = 1
+const (
+	upStatus = 1
+	inStatus = 1
+)
 
 var (
 	healthCheckInterval = 60 * time.Second
-	osdGracePeriod      = 600 * time.Second
 )
 
-// Monitor defines OSD process monitoring
+// Monitor defines OSD process monitoring. The processes of the OSDs that are down are restarted and the OSDs
+// are marked out according to the recovery policy of the cluster.
 type Monitor struct {
-	context *clusterd.Context
-	agent   *OsdAgent
+	context        *clusterd.Context
+	agent          *OsdAgent
+	recoveryPolicy rookalpha.OSDRecoveryPolicy
+
+	// lastStatus keeps track of the OSDs that are down
+	// key - OSD id; value: the recovery state of the OSD
+	lastStatus map[int]*downStatus
+}
 
-	// lastStatus keeps track of OSDs status
-	// key - OSD id; value: time of the status change.
-	lastStatus map[int]time.Time
+// the recovery state of an osd that is down
+type downStatus struct {
+	// when the osd was first seen down
+	since time.Time
+	// how many times the process of the osd was restarted
+	restarts int
+	// when the process was last restarted
+	lastRestart time.Time
+	// whether the monitor marked out the osd
+	markedOut bool
+	// whether the restart attempts are exhausted
+	gaveUp bool
 }
 
 // NewMonitor instantiates OSD monitoring
-func NewMonitor(context *clusterd.Context, agent *OsdAgent) *Monitor {
-	return &Monitor{context, agent, make(map[int]time.Time)}
+func NewMonitor(context *clusterd.Context, agent *OsdAgent, recoveryPolicy rookalpha.OSDRecoveryPolicy) *Monitor {
+	return &Monitor{context: context, agent: agent, recoveryPolicy: recoveryPolicy, lastStatus: make(map[int]*downStatus)}
 }
 
 // Run runs monitoring logic for osds status at set intervals
@@ -65,48 +84,100 @@ func (m *Monitor) osdStatus() error {
 		return err
 	}
 
-	evalDownStatus := func(id int, proc *proc.MonitoredProc) {
-		if now := time.Now(); now.Sub(m.lastStatus[id]) > osdGracePeriod {
-			logger.Infof("stopping osd.%d, it has been down for longer than the grace period (down since %+v)", id, m.lastStatus[id])
-			// Stopping the process, continuing monitoring so that ProcMan would replace it with a new proc
-			err = proc.Stop(true)
-			if err != nil {
-				// Logging the error and continuing with the next osd.id status check.
-				logger.Warningf("failed to stop osd.%d: %+v", id, err)
-			} else {
-				logger.Infof("stopped osd.%d", id)
-				delete(m.lastStatus, id)
-			}
-		} else {
-			logger.Warningf("waiting for the osd.%d to exceed the grace period", id)
-		}
-	}
-
 	for id, proc := range m.agent.osdProc {
 		logger.Debugf("validating status of osd.%d", id)
-		_, tracked := m.lastStatus[id]
 
-		// No action on in/out cluster state is taken at this time.
-		status, _, err := osdDump.StatusByID(int64(id))
+		status, in, err := osdDump.StatusByID(int64(id))
 		if err != nil {
 			return err
 		}
 
-		if status != upStatus {
-			logger.Infof("osd.%d is marked 'DOWN'", id)
-			if tracked {
-				evalDownStatus(id, proc)
-			} else {
-				m.lastStatus[id] = time.Now()
-			}
+		if status == upStatus {
+			m.osdUp(id, in)
 		} else {
-			logger.Debugf("osd.%d is healthy.", id)
-			if tracked {
-				logger.Debugf("osd.%d recovered, stopping tracking.", id)
-				delete(m.lastStatus, id)
-			}
+			m.osdDown(id, in, proc)
 		}
 	}
 
 	return nil
 }
+
+// stops tracking an osd that is up again and marks it back in if the monitor marked it out
+func (m *Monitor) osdUp(id int, in int64) {
+	logger.Debugf("osd.%d is healthy.", id)
+	down, tracked := m.lastStatus[id]
+	if !tracked {
+		return
+	}
+
+	logger.Infof("osd.%d recovered after %d restarts, stopping tracking.", id, down.restarts)
+	delete(m.lastStatus, id)
+
+	if down.markedOut && in != inStatus {
+		if err := client.OSDIn(m.context, m.agent.cluster.Name, id); err != nil {
+			logger.Warningf("failed to mark in osd.%d. %+v", id, err)
+			return
+		}
+		logger.Infof("marked in osd.%d", id)
+	}
+}
+
+// applies the recovery policy to an osd that is down
+func (m *Monitor) osdDown(id int, in int64, proc *proc.MonitoredProc) {
+	logger.Infof("osd.%d is marked 'DOWN'", id)
+	down, tracked := m.lastStatus[id]
+	if !tracked {
+		m.lastStatus[id] = &downStatus{since: time.Now()}
+		return
+	}
+	if down.gaveUp {
+		logger.Debugf("osd.%d is still down after %d restarts", id, down.restarts)
+		return
+	}
+
+	markOutAfter := m.recoveryPolicy.GetMarkOutAfter()
+	if markOutAfter > 0 && in == inStatus && time.Since(down.since) > markOutAfter {
+		logger.Infof("marking out osd.%d, it has been down for longer than %v", id, markOutAfter)
+		m.markOut(id, down)
+	}
+
+	if down.restarts > 0 && time.Since(down.lastRestart) <= m.recoveryPolicy.GetRestartBackoff(down.restarts) {
+		logger.Infof("waiting for the backoff of osd.%d after %d restarts", id, down.restarts)
+		return
+	}
+
+	if down.restarts >= m.recoveryPolicy.GetMaxRestartAttempts() {
+		// mark out the osd so its data is recovered on other osds
+		logger.Warningf("giving up on osd.%d after %d restarts", id, down.restarts)
+		if in == inStatus {
+			m.markOut(id, down)
+		}
+		down.gaveUp = true
+		return
+	}
+
+	if time.Since(down.since) <= m.recoveryPolicy.GetRestartGracePeriod() {
+		logger.Warningf("waiting for the osd.%d to exceed the grace period", id)
+		return
+	}
+
+	logger.Infof("stopping osd.%d, it has been down for longer than the grace period (down since %+v)", id, down.since)
+	// Stopping the process, continuing monitoring so that ProcMan would replace it with a new proc
+	if err := proc.Stop(true); err != nil {
+		// Logging the error and continuing with the next osd.id status check.
+		logger.Warningf("failed to stop osd.%d: %+v", id, err)
+		return
+	}
+	down.restarts++
+	down.lastRestart = time.Now()
+	logger.Infof("stopped osd.%d (attempt %d of %d)", id, down.restarts, m.recoveryPolicy.GetMaxRestartAttempts())
+}
+
+func (m *Monitor) markOut(id int, down *downStatus) {
+	if err := client.OSDOut(m.context, m.agent.cluster.Name, id); err != nil {
+		logger.Warningf("failed to mark out osd.%d. %+v", id, err)
+		return
+	}
+	down.markedOut = true
+	logger.Infof("marked out osd.%d", id)
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package osd
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -28,9 +29,6 @@ import (
 )
 
 func TestOSDStatus(t *testing.T) {
-	// Overwriting default grace period to speed up testing
-	osdGracePeriod = 1 * time.Microsecond
-
 	configDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("failed to create temp config dir: %+v", err)
@@ -42,15 +40,19 @@ func TestOSDStatus(t *testing.T) {
 	agent, executor := createTestAgent(t, "sdx", configDir, storeConfig)
 
 	var execCount = 0
+	up, in := 0, 1
+	var inOutArgs []string
 	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
 		logger.Infof("ExecuteCommandWithOutputFile: %s %v", command, args)
 		execCount++
 		if args[1] == "dump" {
-			// Mock executor for OSD Dump command, returning an osd in Down state
-			return `{"OSDs": [{"OSD": 1, "Up": 0, "In": 1}]}`, nil
+			// Mock executor for OSD Dump command, returning the state of the osd
+			return fmt.Sprintf(`{"OSDs": [{"OSD": 1, "Up": %d, "In": %d}]}`, up, in), nil
 		} else if args[1] == "create" {
 			// Mock executor for osd creation
 			return `{"osdid": 1.0}`, nil
+		} else if args[1] == "out" || args[1] == "in" {
+			inOutArgs = args
 		}
 		return "", nil
 	}
@@ -76,8 +78,8 @@ func TestOSDStatus(t *testing.T) {
 	err = agent.configureDevices(context, devices)
 	assert.Nil(t, err)
 
-	// Initializing an OSD monitoring
-	osdMon := NewMonitor(context, agent)
+	// Initializing an OSD monitoring that gives up after one restart
+	osdMon := NewMonitor(context, agent, rookalpha.OSDRecoveryPolicy{MaxRestartAttempts: 1})
 	// Run OSD monitoring routine
 	err = osdMon.osdStatus()
 	assert.Nil(t, err)
@@ -88,10 +90,31 @@ func TestOSDStatus(t *testing.T) {
 	// OSD monitoring should start tracking an osd with Down status
 	assert.Equal(t, 1, len(osdMon.lastStatus))
 
-	// Run OSD monitoring routine again to trigger an action on tracked proc
+	// nothing is done during the grace period
 	err = osdMon.osdStatus()
 	assert.Nil(t, err)
 	assert.Equal(t, 5, execCount)
-	// OSD monitor should stop tracking that process once the action is triggered
+	assert.Equal(t, 0, osdMon.lastStatus[1].restarts)
+
+	// the process is restarted after the grace period
+	osdMon.lastStatus[1].since = time.Now().Add(-time.Hour)
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 6, execCount)
+	assert.Equal(t, 1, osdMon.lastStatus[1].restarts)
+
+	// the osd is still down after the backoff, the monitor gives up and marks out the osd
+	osdMon.lastStatus[1].lastRestart = time.Now().Add(-time.Hour)
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd", "out", "1"}, inOutArgs[:3])
+	assert.True(t, osdMon.lastStatus[1].gaveUp)
+	assert.Equal(t, 1, osdMon.lastStatus[1].restarts)
+
+	// the osd is marked in and not tracked anymore when it is up again
+	up, in = 1, 0
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd", "in", "1"}, inOutArgs[:3])
 	assert.Equal(t, 0, len(osdMon.lastStatus))
 }
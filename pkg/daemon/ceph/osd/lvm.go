@@ -0,0 +1,298 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/util/exec"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+const (
+	// LVMScheme provisions the OSD devices with LVM volume groups and logical volumes
+	LVMScheme = "lvm"
+	// PartitionScheme provisions the OSD devices with GPT partitions. This is the default.
+	PartitionScheme = "partition"
+
+	// the tags on the logical volumes hold all the metadata needed to rediscover the OSDs on a node
+	lvmClusterFSIDTag = "ceph.cluster_fsid"
+	lvmOSDIDTag       = "ceph.osd_id"
+	lvmOSDFSIDTag     = "ceph.osd_fsid"
+	lvmTypeTag        = "ceph.type"
+	lvmFSCreatedTag   = "rook.fs_created"
+	// the tag on the volume group that holds the db and wal logical volumes of the OSDs. Its value is the cluster fsid.
+	lvmMetadataTag = "rook.metadata"
+
+	lvmBlockType = "block"
+	lvmDBType    = "db"
+	lvmWalType   = "wal"
+
+	lvmBlockVGNameFmt    = "rook-block-%s"
+	lvmMetadataVGNameFmt = "rook-metadata-%s"
+	lvmLVNameFmt         = "osd-%s-%s"
+)
+
+// lvmVolumes are the logical volumes of a bluestore OSD provisioned with LVM
+type lvmVolumes struct {
+	ID        int
+	UUID      uuid.UUID
+	BlockPath string
+	DBPath    string
+	WalPath   string
+	FSCreated bool
+	// Devices are the names of the devices backing the volumes
+	Devices []string
+}
+
+// find all the OSDs of the cluster on the node from the tags of their logical volumes. The volumes of the
+// OSDs of other clusters on the same host are ignored.
+func discoverLVMOSDs(executor exec.Executor, clusterFSID string) (map[int]*lvmVolumes, error) {
+	lvs, err := sys.GetLogicalVolumes(executor)
+	if err != nil {
+		return nil, err
+	}
+
+	osds := map[int]*lvmVolumes{}
+	for _, lv := range lvs {
+		idTag, ok := lv.Tags[lvmOSDIDTag]
+		if !ok {
+			// not an osd volume
+			continue
+		}
+		if lv.Tags[lvmClusterFSIDTag] != clusterFSID {
+			logger.Debugf("skipping logical volume %s of another cluster", lv.Path)
+			continue
+		}
+		id, err := strconv.Atoi(idTag)
+		if err != nil {
+			logger.Warningf("skipping logical volume %s with invalid osd id %s. %+v", lv.Path, idTag, err)
+			continue
+		}
+		osdUUID, err := uuid.Parse(lv.Tags[lvmOSDFSIDTag])
+		if err != nil {
+			logger.Warningf("skipping logical volume %s with invalid osd fsid. %+v", lv.Path, err)
+			continue
+		}
+
+		volumes, ok := osds[id]
+		if !ok {
+			volumes = &lvmVolumes{ID: id, UUID: osdUUID}
+			osds[id] = volumes
+		}
+
+		volumes.Devices = append(volumes.Devices, lv.Devices...)
+		switch lv.Tags[lvmTypeTag] {
+		case lvmBlockType:
+			volumes.BlockPath = lv.Path
+			volumes.FSCreated = lv.Tags[lvmFSCreatedTag] == "true"
+		case lvmDBType:
+			volumes.DBPath = lv.Path
+		case lvmWalType:
+			volumes.WalPath = lv.Path
+		}
+	}
+
+	// an osd is only usable if its block volume was created
+	for id, volumes := range osds {
+		if volumes.BlockPath == "" {
+			logger.Warningf("skipping osd %d without a block logical volume", id)
+			delete(osds, id)
+		}
+	}
+
+	return osds, nil
+}
+
+// configure the OSDs on the devices with LVM. Volume groups are created on new data devices and on the
+// metadata device, and each OSD gets its own logical volumes for block, db, and wal.
+func (a *OsdAgent) configureLVMDevices(context *clusterd.Context, devices *DeviceOsdMapping) error {
+	if a.storeConfig.StoreType == Filestore {
+		return fmt.Errorf("the %s provisioning scheme is only supported with %s", LVMScheme, Bluestore)
+	}
+
+	clusterFSID, err := getClusterFSID(context, a.cluster)
+	if err != nil {
+		return err
+	}
+	osds, err := discoverLVMOSDs(context.Executor, clusterFSID)
+	if err != nil {
+		return fmt.Errorf("failed to discover lvm osds. %+v", err)
+	}
+	logger.Infof("found %d existing lvm osds on this node", len(osds))
+
+	if devices != nil && len(devices.Entries) > 0 {
+		metadataVG, err := a.getLVMMetadataVolumeGroup(context, devices, clusterFSID)
+		if err != nil {
+			return err
+		}
+
+		// sort the devices so the osds are created in a predictable order
+		var names []string
+		for name, mapping := range devices.Entries {
+			if isDeviceDesiredForData(mapping) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			volumes, err := a.createLVMOSD(context, name, metadataVG, clusterFSID)
+			if err != nil {
+				return fmt.Errorf("failed to create lvm osd on device %s. %+v", name, err)
+			}
+			devices.Entries[name].Data = volumes.ID
+			osds[volumes.ID] = volumes
+		}
+	}
+
+	// start all the existing and new osds
+	var ids []int
+	for id := range osds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	succeeded := 0
+	for _, id := range ids {
+		volumes := osds[id]
+		config := &osdConfig{id: volumes.ID, uuid: volumes.UUID, configRoot: context.ConfigDir, lvm: volumes,
+			storeConfig: a.storeConfig, kv: a.kv, storeName: getConfigStoreName(a.nodeName)}
+		if err := a.startOSD(context, config); err != nil {
+			return fmt.Errorf("failed to config osd %d. %+v", id, err)
+		}
+		succeeded++
+	}
+
+	logger.Infof("%d/%d lvm osds succeeded on this node", succeeded, len(osds))
+	return nil
+}
+
+// gets the volume group of the cluster that holds the db and wal volumes, creating it on the metadata device if needed
+func (a *OsdAgent) getLVMMetadataVolumeGroup(context *clusterd.Context, devices *DeviceOsdMapping, clusterFSID string) (string, error) {
+	vgs, err := sys.GetVolumeGroups(context.Executor)
+	if err != nil {
+		return "", err
+	}
+	for _, vg := range vgs {
+		if vg.Tags[lvmMetadataTag] == clusterFSID {
+			// the metadata device was already initialized
+			return vg.Name, nil
+		}
+	}
+
+	for name, mapping := range devices.Entries {
+		if !isDeviceDesiredForMetadata(mapping, nil) {
+			continue
+		}
+
+		vgName := fmt.Sprintf(lvmMetadataVGNameFmt, name)
+		logger.Infof("creating metadata volume group %s on device %s", vgName, name)
+		if err := sys.CreatePhysicalVolume(name, context.Executor); err != nil {
+			return "", err
+		}
+		if err := sys.CreateVolumeGroup(vgName, name, map[string]string{lvmMetadataTag: clusterFSID}, context.Executor); err != nil {
+			return "", err
+		}
+		return vgName, nil
+	}
+
+	// there is no metadata device, the db and wal will be collocated on the block volume
+	return "", nil
+}
+
+// registers a new osd and creates its logical volumes on the data device and the metadata volume group
+func (a *OsdAgent) createLVMOSD(context *clusterd.Context, device, metadataVG, clusterFSID string) (*lvmVolumes, error) {
+	osdID, osdUUID, err := registerOSD(context, a.cluster.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register OSD for device %s: %+v", device, err)
+	}
+
+	volumes := &lvmVolumes{ID: *osdID, UUID: *osdUUID}
+	tags := func(lvType string) map[string]string {
+		return map[string]string{
+			lvmClusterFSIDTag: clusterFSID,
+			lvmOSDIDTag:       strconv.Itoa(*osdID),
+			lvmOSDFSIDTag:     osdUUID.String(),
+			lvmTypeTag:        lvType,
+		}
+	}
+
+	if metadataVG != "" {
+		// create the metadata volumes first so the osd is not discovered until all its volumes exist
+		walSizeMB := WalDefaultSizeMB
+		if a.storeConfig.WalSizeMB > 0 {
+			walSizeMB = a.storeConfig.WalSizeMB
+		}
+		dbSizeMB := DBDefaultSizeMB
+		if a.storeConfig.DatabaseSizeMB > 0 {
+			dbSizeMB = a.storeConfig.DatabaseSizeMB
+		}
+
+		walName := fmt.Sprintf(lvmLVNameFmt, lvmWalType, osdUUID.String())
+		if err := sys.CreateLogicalVolume(walName, metadataVG, walSizeMB, tags(lvmWalType), context.Executor); err != nil {
+			return nil, err
+		}
+		dbName := fmt.Sprintf(lvmLVNameFmt, lvmDBType, osdUUID.String())
+		if err := sys.CreateLogicalVolume(dbName, metadataVG, dbSizeMB, tags(lvmDBType), context.Executor); err != nil {
+			return nil, err
+		}
+		volumes.WalPath = lvmPath(metadataVG, walName)
+		volumes.DBPath = lvmPath(metadataVG, dbName)
+	}
+
+	blockVG := fmt.Sprintf(lvmBlockVGNameFmt, osdUUID.String())
+	blockName := fmt.Sprintf(lvmLVNameFmt, lvmBlockType, osdUUID.String())
+	logger.Infof("creating volume group %s on device %s for osd %d", blockVG, device, *osdID)
+	if err := sys.CreatePhysicalVolume(device, context.Executor); err != nil {
+		return nil, err
+	}
+	if err := sys.CreateVolumeGroup(blockVG, device, nil, context.Executor); err != nil {
+		return nil, err
+	}
+	if err := sys.CreateLogicalVolume(blockName, blockVG, sys.UseAllFreeExtents, tags(lvmBlockType), context.Executor); err != nil {
+		return nil, err
+	}
+	volumes.BlockPath = lvmPath(blockVG, blockName)
+
+	return volumes, nil
+}
+
+// get the fsid of the cluster, which is queried from the mons when it was not passed to the daemon
+func getClusterFSID(context *clusterd.Context, cluster *mon.ClusterInfo) (string, error) {
+	if cluster.FSID != "" {
+		return cluster.FSID, nil
+	}
+	status, err := client.Status(context, cluster.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the fsid of cluster %s. %+v", cluster.Name, err)
+	}
+	if status.FSID == "" {
+		return "", fmt.Errorf("empty fsid for cluster %s", cluster.Name)
+	}
+	cluster.FSID = status.FSID
+	return cluster.FSID, nil
+}
+
+func lvmPath(vg, lv string) string {
+	return fmt.Sprintf("/dev/%s/%s", vg, lv)
+}
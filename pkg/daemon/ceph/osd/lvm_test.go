@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverLVMOSDs(t *testing.T) {
+	osdUUID := uuid.Must(uuid.NewRandom()).String()
+	lvs := fmt.Sprintf(`{"report": [{"lv": [
+		{"lv_name":"osd-block-a", "vg_name":"rook-block-a", "lv_path":"/dev/rook-block-a/osd-block-a", "lv_tags":"ceph.cluster_fsid=myfsid,ceph.osd_fsid=%[1]s,ceph.osd_id=3,ceph.type=block,rook.fs_created=true"},
+		{"lv_name":"osd-db-a", "vg_name":"rook-metadata-sdc", "lv_path":"/dev/rook-metadata-sdc/osd-db-a", "lv_tags":"ceph.cluster_fsid=myfsid,ceph.osd_fsid=%[1]s,ceph.osd_id=3,ceph.type=db"},
+		{"lv_name":"osd-wal-a", "vg_name":"rook-metadata-sdc", "lv_path":"/dev/rook-metadata-sdc/osd-wal-a", "lv_tags":"ceph.cluster_fsid=myfsid,ceph.osd_fsid=%[1]s,ceph.osd_id=3,ceph.type=wal"},
+		{"lv_name":"osd-db-b", "vg_name":"rook-metadata-sdc", "lv_path":"/dev/rook-metadata-sdc/osd-db-b", "lv_tags":"ceph.cluster_fsid=myfsid,ceph.osd_fsid=%[1]s,ceph.osd_id=4,ceph.type=db"},
+		{"lv_name":"osd-block-c", "vg_name":"rook-block-c", "lv_path":"/dev/rook-block-c/osd-block-c", "lv_tags":"ceph.cluster_fsid=otherfsid,ceph.osd_fsid=%[1]s,ceph.osd_id=5,ceph.type=block"},
+		{"lv_name":"root", "vg_name":"system", "lv_path":"/dev/system/root", "lv_tags":""}
+	]}]}`, osdUUID)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "lvs", command)
+			return lvs, nil
+		},
+	}
+
+	osds, err := discoverLVMOSDs(executor, "myfsid")
+	assert.Nil(t, err)
+	// osd 4 is skipped since its block volume was never created, and osd 5 belongs to another cluster
+	require.Equal(t, 1, len(osds))
+	volumes := osds[3]
+	require.NotNil(t, volumes)
+	assert.Equal(t, osdUUID, volumes.UUID.String())
+	assert.Equal(t, "/dev/rook-block-a/osd-block-a", volumes.BlockPath)
+	assert.Equal(t, "/dev/rook-metadata-sdc/osd-db-a", volumes.DBPath)
+	assert.Equal(t, "/dev/rook-metadata-sdc/osd-wal-a", volumes.WalPath)
+	assert.True(t, volumes.FSCreated)
+
+	// the lvm paths are used for the bluestore settings
+	config := &osdConfig{id: 3, lvm: volumes, storeConfig: rookalpha.StoreConfig{StoreType: Bluestore}}
+	assert.True(t, isBluestoreDevice(config))
+	assert.True(t, isOSDFilesystemCreated(config))
+	settings, err := getStoreSettings(config)
+	assert.Nil(t, err)
+	assert.Equal(t, volumes.BlockPath, settings["bluestore block path"])
+	assert.Equal(t, volumes.DBPath, settings["bluestore block db path"])
+	assert.Equal(t, volumes.WalPath, settings["bluestore block wal path"])
+
+	// the db and wal settings are omitted when they are collocated on the block volume
+	config.lvm = &lvmVolumes{ID: 3, BlockPath: volumes.BlockPath}
+	settings, err = getStoreSettings(config)
+	assert.Nil(t, err)
+	assert.Equal(t, volumes.BlockPath, settings["bluestore block path"])
+	_, ok := settings["bluestore block db path"]
+	assert.False(t, ok)
+}
+
+func TestCreateLVMOSD(t *testing.T) {
+	var commands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return "{\"osdid\":3.0}", nil
+		},
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			commands = append(commands, command)
+			if command == "lvcreate" {
+				// the volumes are tagged with the cluster they belong to
+				assert.Contains(t, args, "ceph.cluster_fsid=myfsid")
+			}
+			return nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	agent := &OsdAgent{cluster: &mon.ClusterInfo{Name: "myclust"}, storeConfig: rookalpha.StoreConfig{StoreType: Bluestore}}
+
+	// with a metadata volume group the db and wal get their own volumes
+	volumes, err := agent.createLVMOSD(context, "sdb", "rook-metadata-sdc", "myfsid")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, volumes.ID)
+	assert.Equal(t, []string{"lvcreate", "lvcreate", "pvcreate", "vgcreate", "lvcreate"}, commands)
+	id := volumes.UUID.String()
+	assert.Equal(t, fmt.Sprintf("/dev/rook-block-%s/osd-block-%s", id, id), volumes.BlockPath)
+	assert.Equal(t, fmt.Sprintf("/dev/rook-metadata-sdc/osd-db-%s", id), volumes.DBPath)
+	assert.Equal(t, fmt.Sprintf("/dev/rook-metadata-sdc/osd-wal-%s", id), volumes.WalPath)
+	assert.False(t, volumes.FSCreated)
+
+	// without a metadata volume group only the block volume is created
+	commands = nil
+	volumes, err = agent.createLVMOSD(context, "sdb", "", "myfsid")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pvcreate", "vgcreate", "lvcreate"}, commands)
+	assert.Equal(t, "", volumes.DBPath)
+	assert.Equal(t, "", volumes.WalPath)
+
+	// lvm requires bluestore
+	agent.storeConfig.StoreType = Filestore
+	err = agent.configureLVMDevices(context, nil)
+	assert.NotNil(t, err)
+}
+
+func TestGetClusterFSID(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			assert.Equal(t, "status", args[0])
+			return `{"fsid":"myfsid"}`, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the fsid is queried from the mons and cached in the cluster info
+	cluster := &mon.ClusterInfo{Name: "myclust"}
+	fsid, err := getClusterFSID(context, cluster)
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", fsid)
+	assert.Equal(t, "myfsid", cluster.FSID)
+
+	// the fsid passed to the daemon is used as is
+	cluster.FSID = "passedfsid"
+	fsid, err = getClusterFSID(context, cluster)
+	assert.Nil(t, err)
+	assert.Equal(t, "passedfsid", fsid)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// the devices of the osds being migrated and the id each osd will keep
+	osdMigrationKeyName = "osd-migration"
+)
+
+// PrepareMigration releases the device of a filestore OSD so that the OSD will be created again as bluestore
+// with the same ID when the devices on the node are configured. The OSD must already be destroyed in the cluster.
+func PrepareMigration(context *clusterd.Context, agent *OsdAgent, id int) error {
+	if agent.storeConfig.StoreType != Bluestore {
+		return fmt.Errorf("osd %d can only be migrated to %s, not %s", id, Bluestore, agent.storeConfig.StoreType)
+	}
+	if agent.storeConfig.ProvisionScheme == LVMScheme {
+		return fmt.Errorf("osd %d cannot be migrated with the %s provisioning scheme", id, LVMScheme)
+	}
+
+	storeName := getConfigStoreName(agent.nodeName)
+	migrating, err := loadMigratingDevices(agent.kv, agent.nodeName)
+	if err != nil {
+		return fmt.Errorf("failed to load the migrating devices. %+v", err)
+	}
+
+	scheme, err := LoadScheme(agent.kv, storeName)
+	if err != nil {
+		return fmt.Errorf("failed to load partition scheme: %+v", err)
+	}
+
+	index := -1
+	for i, entry := range scheme.Entries {
+		if entry.ID == id {
+			index = i
+			break
+		}
+	}
+
+	if index == -1 {
+		for device, migratingID := range migrating {
+			if migratingID == id {
+				// a previous attempt already released the device, the osd will be created on it again
+				logger.Infof("device %s of osd %d was already released for migration", device, id)
+				agent.migratingDevices = migrating
+				return nil
+			}
+		}
+		return fmt.Errorf("osd %d was not found in the partition scheme of node %s", id, agent.nodeName)
+	}
+
+	entry := scheme.Entries[index]
+	if entry.StoreType != Filestore {
+		return fmt.Errorf("osd %d is already %s", id, entry.StoreType)
+	}
+	if !entry.IsCollocated() {
+		return fmt.Errorf("osd %d has partitions on more than one device and cannot be migrated", id)
+	}
+
+	dataDetails := entry.Partitions[FilestoreDataPartitionType]
+	if dataDetails == nil {
+		return fmt.Errorf("data partition missing from osd %d", id)
+	}
+
+	// remember the device and id before releasing it so the id is not lost if the preparation is interrupted
+	migrating[dataDetails.Device] = id
+	if err := saveMigratingDevices(agent.kv, agent.nodeName, migrating); err != nil {
+		return fmt.Errorf("failed to save the migrating devices. %+v", err)
+	}
+
+	// the filestore data is mounted at the osd root, unmount it and remove the old osd config
+	rootPath := path.Join(context.ConfigDir, fmt.Sprintf("osd%d", id))
+	dataPartPath := filepath.Join(diskByPartUUID, dataDetails.PartitionUUID)
+	if err := sys.UnmountDevice(dataPartPath, context.Executor); err != nil {
+		return fmt.Errorf("failed to unmount osd %d. %+v", id, err)
+	}
+	if err := os.RemoveAll(rootPath); err != nil {
+		return fmt.Errorf("failed to remove the config of osd %d at %s. %+v", id, rootPath, err)
+	}
+
+	// remove the osd from the scheme so its device is partitioned again as a new data device
+	scheme.Entries = append(scheme.Entries[:index], scheme.Entries[index+1:]...)
+	if err := scheme.SaveScheme(agent.kv, storeName); err != nil {
+		return fmt.Errorf("failed to save partition scheme: %+v", err)
+	}
+
+	logger.Infof("released device %s of osd %d for migration to %s", dataDetails.Device, id, Bluestore)
+	agent.migratingDevices = migrating
+	return nil
+}
+
+// clears the migrating devices after their osds were created again
+func completeMigration(agent *OsdAgent) error {
+	if len(agent.migratingDevices) == 0 {
+		return nil
+	}
+
+	agent.migratingDevices = map[string]int{}
+	return saveMigratingDevices(agent.kv, agent.nodeName, agent.migratingDevices)
+}
+
+func loadMigratingDevices(kv *k8sutil.ConfigMapKVStore, nodeName string) (map[string]int, error) {
+	raw, err := kv.GetValue(getConfigStoreName(nodeName), osdMigrationKeyName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return map[string]int{}, nil
+		}
+		return nil, err
+	}
+
+	migrating := map[string]int{}
+	if err := json.Unmarshal([]byte(raw), &migrating); err != nil {
+		return nil, err
+	}
+
+	return migrating, nil
+}
+
+func saveMigratingDevices(kv *k8sutil.ConfigMapKVStore, nodeName string, migrating map[string]int) error {
+	b, err := json.Marshal(migrating)
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(getConfigStoreName(nodeName), osdMigrationKeyName, string(b))
+}
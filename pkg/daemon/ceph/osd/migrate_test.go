@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareMigration(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	unmounted := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			if command == "umount" {
+				unmounted = args[0]
+			}
+			return nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, ConfigDir: configDir}
+	kv := mockKVStore()
+	agent := &OsdAgent{nodeName: "node1", kv: kv, storeConfig: rookalpha.StoreConfig{StoreType: Filestore}}
+
+	// osd.1 is a filestore osd on sdb and osd.2 is a bluestore osd on sdc
+	scheme := NewPerfScheme()
+	filestoreEntry := NewPerfSchemeEntry(Filestore)
+	filestoreEntry.ID = 1
+	assert.Nil(t, PopulateCollocatedPerfSchemeEntry(filestoreEntry, "sdb", rookalpha.StoreConfig{StoreType: Filestore}))
+	bluestoreEntry := NewPerfSchemeEntry(Bluestore)
+	bluestoreEntry.ID = 2
+	assert.Nil(t, PopulateCollocatedPerfSchemeEntry(bluestoreEntry, "sdc", rookalpha.StoreConfig{StoreType: Bluestore}))
+	scheme.Entries = []*PerfSchemeEntry{filestoreEntry, bluestoreEntry}
+	assert.Nil(t, scheme.SaveScheme(kv, getConfigStoreName("node1")))
+	assert.Nil(t, os.MkdirAll(filepath.Join(configDir, "osd1"), 0744))
+
+	// the osds can only be migrated to bluestore
+	assert.NotNil(t, PrepareMigration(context, agent, 1))
+	agent.storeConfig.StoreType = Bluestore
+
+	// osd.2 is already bluestore and osd.3 does not exist
+	assert.NotNil(t, PrepareMigration(context, agent, 2))
+	assert.NotNil(t, PrepareMigration(context, agent, 3))
+
+	// the device of osd.1 is released
+	err := PrepareMigration(context, agent, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(diskByPartUUID, filestoreEntry.Partitions[FilestoreDataPartitionType].PartitionUUID), unmounted)
+	assert.Equal(t, map[string]int{"sdb": 1}, agent.migratingDevices)
+	_, err = os.Stat(filepath.Join(configDir, "osd1"))
+	assert.True(t, os.IsNotExist(err))
+	saved, err := LoadScheme(kv, getConfigStoreName("node1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(saved.Entries))
+	assert.Equal(t, 2, saved.Entries[0].ID)
+
+	// preparing the migration again after an interruption finds the released device
+	agent.migratingDevices = nil
+	err = PrepareMigration(context, agent, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"sdb": 1}, agent.migratingDevices)
+
+	// the migrating devices are cleared after the osd is created again
+	assert.Nil(t, completeMigration(agent))
+	migrating, err := loadMigratingDevices(kv, "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(migrating))
+}
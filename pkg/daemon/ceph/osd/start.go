@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util"
+)
+
+// StartOSD runs the ceph-osd daemon in the foreground for an OSD that was previously prepared on the node.
+// If the health interval is set, the SMART data of the OSD devices is collected in the background.
+// The call does not return until the daemon exits.
+func StartOSD(context *clusterd.Context, cluster *mon.ClusterInfo, kv *k8sutil.ConfigMapKVStore, nodeName, location string, id int,
+	healthInterval time.Duration) error {
+	config, err := loadPreparedOSDConfig(context, cluster, kv, nodeName, id)
+	if err != nil {
+		return err
+	}
+
+	// the device of a filestore OSD must be mounted again in this pod
+	if err := remountFilestoreDeviceIfNeeded(context, config); err != nil {
+		return fmt.Errorf("failed to remount osd %d. %+v", id, err)
+	}
+
+	// refresh the config file in case the mons have changed since the OSD was prepared
+	if err := writeConfigFile(config, context, cluster, location); err != nil {
+		return fmt.Errorf("failed to update config file for osd %d. %+v", id, err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	startDeviceHealthMonitor(context, config, healthInterval, stopCh)
+
+	logger.Infof("starting osd %d at %s", config.id, config.rootPath)
+	util.WriteFileToLog(logger, getOSDConfFilePath(config.rootPath, cluster.Name))
+
+	if err := context.Executor.ExecuteCommand(false, fmt.Sprintf("osd%d", config.id), "ceph-osd", getOSDArgs(cluster.Name, config)...); err != nil {
+		return fmt.Errorf("failed to run osd %d. %+v", config.id, err)
+	}
+
+	return nil
+}
+
+// build the config of a prepared OSD from the info and the partition scheme saved in the node's config store.
+// The logical volumes of an lvm OSD are rediscovered from their tags instead.
+func loadPreparedOSDConfig(context *clusterd.Context, cluster *mon.ClusterInfo, kv *k8sutil.ConfigMapKVStore, nodeName string,
+	id int) (*osdConfig, error) {
+	osds, err := LoadOSDInfo(kv, nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load osd info for node %s. %+v", nodeName, err)
+	}
+
+	var info *OSDInfo
+	for i := range osds {
+		if osds[i].ID == id {
+			info = &osds[i]
+			break
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("osd %d was not prepared on node %s", id, nodeName)
+	}
+
+	osdUUID, err := uuid.Parse(info.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse uuid %s of osd %d. %+v", info.UUID, id, err)
+	}
+
+	config := &osdConfig{
+		id:          info.ID,
+		uuid:        osdUUID,
+		rootPath:    info.DataPath,
+		configRoot:  filepath.Dir(info.DataPath),
+		dir:         info.IsDirectory,
+		storeConfig: rookalpha.StoreConfig{StoreType: info.StoreType},
+		kv:          kv,
+		storeName:   getConfigStoreName(nodeName),
+	}
+
+	if info.IsLVM {
+		clusterFSID, err := getClusterFSID(context, cluster)
+		if err != nil {
+			return nil, err
+		}
+		osds, err := discoverLVMOSDs(context.Executor, clusterFSID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover lvm osds. %+v", err)
+		}
+		volumes, ok := osds[id]
+		if !ok {
+			return nil, fmt.Errorf("logical volumes for osd %d not found on node %s", id, nodeName)
+		}
+		config.lvm = volumes
+	} else if !config.dir {
+		// the partitions of the device are needed to run the OSD
+		scheme, err := LoadScheme(kv, config.storeName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load partition scheme for node %s. %+v", nodeName, err)
+		}
+		for _, entry := range scheme.Entries {
+			if entry.ID == id {
+				config.partitionScheme = entry
+				break
+			}
+		}
+		if config.partitionScheme == nil {
+			return nil, fmt.Errorf("partition scheme for osd %d not found on node %s", id, nodeName)
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbd for the Ceph rbd-mirror daemon.
+package rbd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/util"
+)
+
+var (
+	logger          = capnslog.NewPackageLogger("github.com/rook/rook", "cephrbd")
+	keyringTemplate = `
+[client.%s]
+	key = %s
+	caps mon = "profile rbd"
+	caps osd = "profile rbd"
+`
+)
+
+const (
+	rbdMirror = "rbd-mirror"
+)
+
+// MirrorConfig is the config of an rbd-mirror daemon
+type MirrorConfig struct {
+	ClusterInfo *mon.ClusterInfo
+	Name        string
+	Keyring     string
+}
+
+// RunMirror generates the config of the rbd-mirror daemon and runs it in the foreground. The config and keyrings of
+// the peer clusters are expected in /etc/ceph, where rbd-mirror looks for the clusters by their names.
+func RunMirror(context *clusterd.Context, config *MirrorConfig) error {
+	logger.Infof("Starting rbd-mirror %s", config.Name)
+	if err := generateConfigFiles(context, config); err != nil {
+		return fmt.Errorf("failed to generate rbd-mirror config files. %+v", err)
+	}
+
+	if err := startMirror(context, config); err != nil {
+		return fmt.Errorf("failed to run rbd-mirror. %+v", err)
+	}
+
+	return nil
+}
+
+func generateConfigFiles(context *clusterd.Context, config *MirrorConfig) error {
+	keyringPath := getMirrorKeyringPath(context.ConfigDir, config.Name)
+	confDir := getMirrorConfDir(context.ConfigDir, config.Name)
+	username := fmt.Sprintf("client.%s", config.Name)
+	logger.Infof("Conf files: dir=%s keyring=%s", confDir, keyringPath)
+	_, err := mon.GenerateConfigFile(context, config.ClusterInfo, confDir, username, keyringPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create config file. %+v", err)
+	}
+
+	keyringEval := func(key string) string {
+		return fmt.Sprintf(keyringTemplate, config.Name, key)
+	}
+
+	err = mon.WriteKeyring(keyringPath, config.Keyring, keyringEval)
+	if err != nil {
+		return fmt.Errorf("failed to create rbd-mirror keyring. %+v", err)
+	}
+
+	return nil
+}
+
+func startMirror(context *clusterd.Context, config *MirrorConfig) error {
+	confFile := getMirrorConfFilePath(context.ConfigDir, config.Name, config.ClusterInfo.Name)
+	util.WriteFileToLog(logger, confFile)
+
+	keyringPath := getMirrorKeyringPath(context.ConfigDir, config.Name)
+	args := []string{
+		"--foreground",
+		fmt.Sprintf("--cluster=%s", config.ClusterInfo.Name),
+		fmt.Sprintf("--conf=%s", confFile),
+		fmt.Sprintf("--keyring=%s", keyringPath),
+		"--id", config.Name,
+	}
+
+	if err := context.Executor.ExecuteCommand(false, rbdMirror, rbdMirror, args...); err != nil {
+		return fmt.Errorf("failed to start rbd-mirror: %+v", err)
+	}
+	return nil
+}
+
+func getMirrorConfDir(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func getMirrorConfFilePath(dir, name, clusterName string) string {
+	return path.Join(getMirrorConfDir(dir, name), fmt.Sprintf("%s.config", clusterName))
+}
+
+func getMirrorKeyringPath(dir, name string) string {
+	return path.Join(getMirrorConfDir(dir, name), "keyring")
+}
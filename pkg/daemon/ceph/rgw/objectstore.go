@@ -270,6 +270,12 @@ func createSimilarPools(context *Context, pools []string, poolSpec model.Pool) e
 				return fmt.Errorf("failed to create pool %s for object store %s", name, context.Name)
 			}
 		}
+
+		// apply the quotas, compression, and other properties to new and existing pools
+		poolSpec.Name = name
+		if err := ceph.SetPoolOptions(context.context, context.ClusterName, poolSpec); err != nil {
+			return fmt.Errorf("failed to set the options of pool %s for object store %s. %+v", name, context.Name, err)
+		}
 	}
 	return nil
 }
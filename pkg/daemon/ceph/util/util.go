@@ -28,6 +28,11 @@ const (
 	RBDSysBusPathDefault = "/sys/bus/rbd"
 	RBDDevicesDir        = "devices"
 	RBDDevicePathPrefix  = "/dev/rbd"
+
+	SysBlockPathDefault = "/sys/block"
+	ProcPathDefault     = "/proc"
+	NBDDevicePrefix     = "nbd"
+	DevicePathPrefix    = "/dev/"
 )
 
 // FindRBDMappedFile search for the mapped RBD volume and returns its device path
@@ -57,3 +62,41 @@ func FindRBDMappedFile(imageName, poolName, sysBusDir string) (string, error) {
 	}
 	return "", nil
 }
+
+// FindNBDMappedDevice searches for the nbd device that an rbd-nbd process maps the image to and returns its name. The
+// pid of the process serving an nbd device is found in sysfs, and its command line has the spec of the mapped image.
+func FindNBDMappedDevice(imageName, poolName, sysBlockDir, procDir string) (string, error) {
+	devices, err := ioutil.ReadDir(sysBlockDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read block device dir: %+v", err)
+	}
+
+	imageSpec := fmt.Sprintf("%s/%s", poolName, imageName)
+	for _, device := range devices {
+		if !strings.HasPrefix(device.Name(), NBDDevicePrefix) {
+			continue
+		}
+		// the pid is only found while the device is connected
+		pid, err := ioutil.ReadFile(filepath.Join(sysBlockDir, device.Name(), "pid"))
+		if err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(filepath.Join(procDir, strings.TrimSpace(string(pid)), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		if len(args) == 0 || filepath.Base(args[0]) != "rbd-nbd" {
+			continue
+		}
+		for _, arg := range args[1:] {
+			if arg == imageSpec {
+				return device.Name(), nil
+			}
+		}
+	}
+	return "", nil
+}
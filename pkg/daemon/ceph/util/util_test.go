@@ -38,3 +38,40 @@ func TestFindDevicePath(t *testing.T) {
 	mappedImageFile, _ := FindRBDMappedFile("myimage1", "mypool1", mockRBDSysBusPath)
 	assert.Equal(t, "3", mappedImageFile)
 }
+
+func TestFindNBDMappedDevice(t *testing.T) {
+	// set up a mock sys block and proc file system
+	root, err := ioutil.TempDir("", "TestFindNBDMappedDevice")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %+v", err)
+	}
+	defer os.RemoveAll(root)
+	sysBlockPath := filepath.Join(root, "sys")
+	procPath := filepath.Join(root, "proc")
+
+	// no device is found when the sys block dir does not exist
+	device, err := FindNBDMappedDevice("myimage1", "mypool1", sysBlockPath, procPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "", device)
+
+	addDevice := func(name, pid, cmdline string) {
+		os.MkdirAll(filepath.Join(sysBlockPath, name), 0777)
+		if pid != "" {
+			ioutil.WriteFile(filepath.Join(sysBlockPath, name, "pid"), []byte(pid+"\n"), 0777)
+			os.MkdirAll(filepath.Join(procPath, pid), 0777)
+			ioutil.WriteFile(filepath.Join(procPath, pid, "cmdline"), []byte(cmdline), 0777)
+		}
+	}
+	addDevice("sda", "", "")
+	addDevice("nbd0", "", "")
+	addDevice("nbd1", "100", "rbd-nbd\x00map\x00mypool1/otherimage\x00")
+	addDevice("nbd2", "200", "/usr/bin/rbd-nbd\x00map\x00mypool1/myimage1\x00--id\x00admin\x00")
+
+	device, err = FindNBDMappedDevice("myimage1", "mypool1", sysBlockPath, procPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "nbd2", device)
+
+	device, err = FindNBDMappedDevice("myimage2", "mypool1", sysBlockPath, procPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "", device)
+}
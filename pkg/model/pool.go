@@ -24,7 +24,10 @@ const (
 )
 
 type ReplicatedPoolConfig struct {
-	Size uint `json:"size"`
+	Size        uint   `json:"size"`
+	MinSize     uint   `json:"minSize,omitempty"`
+	CrushRoot   string `json:"crushRoot,omitempty"`
+	PrimaryZone string `json:"primaryZone,omitempty"`
 }
 
 type ErasureCodedPoolConfig struct {
@@ -33,13 +36,28 @@ type ErasureCodedPoolConfig struct {
 	Algorithm        string `json:"algorithm"`
 }
 
+type PoolQuotas struct {
+	MaxBytes   uint64 `json:"maxBytes"`
+	MaxObjects uint64 `json:"maxObjects"`
+}
+
+type PoolCompression struct {
+	Mode          string  `json:"mode"`
+	Algorithm     string  `json:"algorithm"`
+	RequiredRatio float64 `json:"requiredRatio"`
+}
+
 type Pool struct {
 	Name               string                 `json:"poolName"`
 	Number             int                    `json:"poolNum"`
 	Type               PoolType               `json:"type"`
 	FailureDomain      string                 `json:"failureDomain"`
+	PGCount            int                    `json:"pgCount,omitempty"`
 	ReplicatedConfig   ReplicatedPoolConfig   `json:"replicatedConfig"`
 	ErasureCodedConfig ErasureCodedPoolConfig `json:"erasureCodedConfig"`
+	Quotas             PoolQuotas             `json:"quotas"`
+	Compression        PoolCompression        `json:"compression"`
+	Parameters         map[string]string      `json:"parameters,omitempty"`
 }
 
 func PoolTypeToString(poolType PoolType) string {
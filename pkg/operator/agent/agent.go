@@ -49,7 +49,7 @@ var clusterAccessRules = []v1beta1.PolicyRule{
 	{
 		APIGroups: []string{""},
 		Resources: []string{"pods", "secrets", "configmaps", "persistentvolumes", "nodes", "nodes/proxy"},
-		Verbs:     []string{"get", "list"},
+		Verbs:     []string{"get", "list", "watch"},
 	},
 	{
 		APIGroups: []string{rookalpha.CustomResourceGroup},
@@ -78,24 +78,44 @@ func New(clientset kubernetes.Interface) *Agent {
 // Start the agent
 func (a *Agent) Start(namespace, agentImage string) error {
 
-	err := k8sutil.MakeClusterRole(a.clientset, namespace, agentDaemonsetName, clusterAccessRules, nil)
+	csiEnabled, err := isCSISupported(a.clientset)
+	if err != nil {
+		logger.Warningf("failed to detect whether the CSI driver is supported. %+v", err)
+	}
+
+	rules := clusterAccessRules
+	if csiEnabled {
+		rules = append(append([]v1beta1.PolicyRule{}, clusterAccessRules...), csiAgentAccessRules...)
+	}
+	err = k8sutil.MakeClusterRole(a.clientset, namespace, agentDaemonsetName, rules, nil)
 	if err != nil {
 		return fmt.Errorf("failed to init RBAC for rook-agents. %+v", err)
 	}
 
-	err = a.createAgentDaemonSet(namespace, agentImage)
+	err = a.createAgentDaemonSet(namespace, agentImage, csiEnabled)
 	if err != nil {
 		return fmt.Errorf("Error starting agent daemonset: %v", err)
 	}
+
+	if csiEnabled {
+		if err = a.createCSIController(namespace, agentImage); err != nil {
+			return fmt.Errorf("Error starting CSI controller: %v", err)
+		}
+	}
 	return nil
 }
 
-func (a *Agent) createAgentDaemonSet(namespace, agentImage string) error {
+func (a *Agent) createAgentDaemonSet(namespace, agentImage string, csiEnabled bool) error {
 
 	flexvolumeDirPath, source := a.discoverFlexvolumeDir()
 	logger.Infof("discovered flexvolume dir path from source %s. value: %s", source, flexvolumeDirPath)
+	kubeletRootDir := k8sutil.KubeletRootDir()
+	logger.Infof("kubelet root dir: %s", kubeletRootDir)
 
 	privileged := true
+	// the mounts of the ceph-fuse daemons in the agent are propagated to the kubelet, which requires the
+	// MountPropagation feature gate on Kubernetes 1.8 and 1.9
+	mountPropagation := v1.MountPropagationBidirectional
 	ds := &extensions.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: agentDaemonsetName,
@@ -134,10 +154,16 @@ func (a *Agent) createAgentDaemonSet(namespace, agentImage string) error {
 									Name:      "libmodules",
 									MountPath: "/lib/modules",
 								},
+								{
+									Name:             "kubelet",
+									MountPath:        kubeletRootDir,
+									MountPropagation: &mountPropagation,
+								},
 							},
 							Env: []v1.EnvVar{
 								k8sutil.NamespaceEnvVar(),
 								k8sutil.NodeEnvVar(),
+								{Name: k8sutil.KubeletRootDirEnvVar, Value: kubeletRootDir},
 							},
 						},
 					},
@@ -174,13 +200,27 @@ func (a *Agent) createAgentDaemonSet(namespace, agentImage string) error {
 								},
 							},
 						},
+						{
+							Name: "kubelet",
+							VolumeSource: v1.VolumeSource{
+								HostPath: &v1.HostPathVolumeSource{
+									Path: kubeletRootDir,
+								},
+							},
+						},
 					},
 					HostNetwork: true,
+					// the filesystems of the volumes are grown in the mount namespace of the host
+					HostPID: true,
 				},
 			},
 		},
 	}
 
+	if csiEnabled {
+		addCSINodeService(&ds.Spec.Template.Spec, kubeletRootDir)
+	}
+
 	// Add toleration if any
 	tolerationValue := os.Getenv(agentDaemonsetTolerationEnv)
 	if tolerationValue != "" {
@@ -227,7 +267,7 @@ func (a *Agent) discoverFlexvolumeDir() (flexvolumeDirPath, source string) {
 	}
 
 	// unmarshal to a NodeConfigKubelet
-	configKubelet := NodeConfigKubelet{}
+	configKubelet := k8sutil.NodeConfigKubelet{}
 	if err := json.Unmarshal(nodeConfig, &configKubelet); err != nil {
 		logger.Warningf("unable to parse node config from Kubelet: %+v", err)
 	} else {
@@ -239,7 +279,7 @@ func (a *Agent) discoverFlexvolumeDir() (flexvolumeDirPath, source string) {
 	}
 
 	// unmarshal to a NodeConfigControllerManager
-	configControllerManager := NodeConfigControllerManager{}
+	configControllerManager := k8sutil.NodeConfigControllerManager{}
 	if err := json.Unmarshal(nodeConfig, &configControllerManager); err != nil {
 		logger.Warningf("unable to parse node config from controller manager: %+v", err)
 	} else {
@@ -251,7 +291,7 @@ func (a *Agent) discoverFlexvolumeDir() (flexvolumeDirPath, source string) {
 	}
 
 	// unmarshal to a KubeletConfiguration
-	kubeletConfiguration := KubeletConfiguration{}
+	kubeletConfiguration := k8sutil.KubeletConfiguration{}
 	if err := json.Unmarshal(nodeConfig, &kubeletConfiguration); err != nil {
 		logger.Warningf("unable to parse node config as kubelet configuration: %+v", err)
 	} else {
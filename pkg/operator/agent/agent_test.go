@@ -27,6 +27,7 @@ import (
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 func TestStartAgentDaemonset(t *testing.T) {
@@ -81,11 +82,13 @@ func TestStartAgentDaemonset(t *testing.T) {
 	assert.Equal(t, "rook-agent", agentDS.Name)
 	assert.True(t, *agentDS.Spec.Template.Spec.Containers[0].SecurityContext.Privileged)
 	volumes := agentDS.Spec.Template.Spec.Volumes
-	assert.Equal(t, 4, len(volumes))
+	assert.Equal(t, 5, len(volumes))
 	volumeMounts := agentDS.Spec.Template.Spec.Containers[0].VolumeMounts
-	assert.Equal(t, 4, len(volumeMounts))
+	assert.Equal(t, 5, len(volumeMounts))
+	assert.Equal(t, "/var/lib/kubelet", volumeMounts[4].MountPath)
+	assert.Equal(t, "/var/lib/kubelet", volumes[4].HostPath.Path)
 	envs := agentDS.Spec.Template.Spec.Containers[0].Env
-	assert.Equal(t, 2, len(envs))
+	assert.Equal(t, 3, len(envs))
 	image := agentDS.Spec.Template.Spec.Containers[0].Image
 	assert.Equal(t, "rook/rook:myversion", image)
 	assert.Nil(t, agentDS.Spec.Template.Spec.Tolerations)
@@ -203,3 +206,50 @@ func TestStartAgentDaemonsetWithToleration(t *testing.T) {
 	assert.Equal(t, "example", string(agentDS.Spec.Template.Spec.Tolerations[0].Key))
 	assert.Equal(t, "Exists", string(agentDS.Spec.Template.Spec.Tolerations[0].Operator))
 }
+
+func TestStartAgentDaemonsetWithCSI(t *testing.T) {
+	clientset := test.New(3)
+	isCSISupported = func(clientset kubernetes.Interface) (bool, error) { return true, nil }
+	defer func() { isCSISupported = csiSupported }()
+	os.Setenv(k8sutil.KubeletRootDirEnvVar, "/var/lib/k8s")
+	defer os.Unsetenv(k8sutil.KubeletRootDirEnvVar)
+
+	namespace := "ns"
+	a := New(clientset)
+	err := a.Start(namespace, "rook/rook:myversion")
+	assert.Nil(t, err)
+
+	// the agent can record the node id of the driver
+	role, err := clientset.RbacV1beta1().ClusterRoles().Get("rook-agent", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(role.Rules))
+
+	// the node service is served in the agent and registered with the kubelet
+	agentDS, err := clientset.Extensions().DaemonSets(namespace).Get("rook-agent", metav1.GetOptions{})
+	assert.Nil(t, err)
+	containers := agentDS.Spec.Template.Spec.Containers
+	assert.Equal(t, 2, len(containers))
+	assert.Equal(t, "csi-driver-registrar", containers[1].Name)
+	assert.Equal(t, 6, len(containers[0].VolumeMounts))
+	assert.Equal(t, v1.EnvVar{Name: "ROOK_CSI_ENDPOINT", Value: "unix:///csi/csi.sock"}, containers[0].Env[3])
+	volumes := agentDS.Spec.Template.Spec.Volumes
+	assert.Equal(t, 6, len(volumes))
+	assert.Equal(t, "/var/lib/k8s/plugins/rbd.csi.rook.io", volumes[5].HostPath.Path)
+
+	// the kubelet root dir of the nodes is propagated to the agent
+	assert.Equal(t, "/var/lib/k8s", containers[0].VolumeMounts[4].MountPath)
+	assert.Equal(t, v1.EnvVar{Name: "KUBELET_ROOT_DIR_PATH", Value: "/var/lib/k8s"}, containers[0].Env[2])
+	assert.Equal(t, "/var/lib/k8s", volumes[4].HostPath.Path)
+
+	// the controller service is served next to the external provisioner and attacher
+	_, err = clientset.RbacV1beta1().ClusterRoles().Get("rook-csi-controller", metav1.GetOptions{})
+	assert.Nil(t, err)
+	controller, err := clientset.ExtensionsV1beta1().Deployments(namespace).Get("rook-csi-controller", metav1.GetOptions{})
+	assert.Nil(t, err)
+	containers = controller.Spec.Template.Spec.Containers
+	assert.Equal(t, 3, len(containers))
+	assert.Equal(t, []string{"csi"}, containers[0].Args)
+	assert.Equal(t, "rook/rook:myversion", containers[0].Image)
+	assert.Equal(t, "--provisioner=rbd.csi.rook.io", containers[1].Args[1])
+	assert.Equal(t, "csi-attacher", containers[2].Name)
+}
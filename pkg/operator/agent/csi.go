@@ -0,0 +1,215 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package agent
+
+import (
+	"fmt"
+	"path"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/daemon/agent/csi"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/api/rbac/v1beta1"
+	kserrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/util/version"
+)
+
+const (
+	csiControllerName = "rook-csi-controller"
+	// the CSI beta APIs that the sidecars use are available from Kubernetes 1.10
+	csiMinVersion       = "v1.10.0"
+	csiSocketVolume     = "csi-socket"
+	csiSocketDir        = "/csi"
+	csiEndpointEnv      = "ROOK_CSI_ENDPOINT"
+	csiProvisionerImage = "quay.io/k8scsi/csi-provisioner:v0.2.1"
+	csiAttacherImage    = "quay.io/k8scsi/csi-attacher:v0.2.0"
+	csiRegistrarImage   = "quay.io/k8scsi/driver-registrar:v0.2.0"
+)
+
+var csiSocketPath = path.Join(csiSocketDir, csi.SocketFile)
+
+// the driver registrar records the node id of the driver in an annotation of the node
+var csiAgentAccessRules = []v1beta1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes"},
+		Verbs:     []string{"update", "patch"},
+	},
+}
+
+var csiControllerAccessRules = []v1beta1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"persistentvolumes"},
+		Verbs:     []string{"get", "list", "watch", "create", "delete", "update"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"persistentvolumeclaims"},
+		Verbs:     []string{"get", "list", "watch", "update"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"list", "watch", "create", "update", "patch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes", "configmaps"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+		Verbs:     []string{"get", "create", "update", "delete"},
+	},
+	{
+		APIGroups: []string{"storage.k8s.io"},
+		Resources: []string{"storageclasses"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"storage.k8s.io"},
+		Resources: []string{"volumeattachments"},
+		Verbs:     []string{"get", "list", "watch", "update"},
+	},
+	{
+		APIGroups: []string{rookalpha.CustomResourceGroup},
+		Resources: []string{attachment.CustomResourceNamePlural},
+		Verbs:     []string{"get", "list", "create", "delete", "update"},
+	},
+}
+
+var isCSISupported = csiSupported
+
+// csiSupported returns whether the Kubernetes version supports the rook CSI driver
+func csiSupported(clientset kubernetes.Interface) (bool, error) {
+	kubeVersion, err := k8sutil.GetK8SVersion(clientset)
+	if err != nil {
+		return false, err
+	}
+	return kubeVersion.AtLeast(version.MustParseSemantic(csiMinVersion)), nil
+}
+
+// addCSINodeService serves the node service of the CSI driver in the agent, and registers the driver with the kubelet
+// with a driver registrar sidecar. The socket of the driver is in the plugin dir of the kubelet.
+func addCSINodeService(podSpec *v1.PodSpec, kubeletRootDir string) {
+	socketMount := v1.VolumeMount{Name: csiSocketVolume, MountPath: csiSocketDir}
+	agent := &podSpec.Containers[0]
+	agent.VolumeMounts = append(agent.VolumeMounts, socketMount)
+	agent.Env = append(agent.Env, v1.EnvVar{Name: csiEndpointEnv, Value: "unix://" + csiSocketPath})
+
+	podSpec.Containers = append(podSpec.Containers, v1.Container{
+		Name:         "csi-driver-registrar",
+		Image:        csiRegistrarImage,
+		Args:         []string{"--v=5", "--csi-address=" + csiSocketPath},
+		VolumeMounts: []v1.VolumeMount{socketMount},
+		Env: []v1.EnvVar{
+			{
+				Name:      "KUBE_NODE_NAME",
+				ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+			},
+		},
+	})
+
+	hostPathType := v1.HostPathDirectoryOrCreate
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: csiSocketVolume,
+		VolumeSource: v1.VolumeSource{
+			HostPath: &v1.HostPathVolumeSource{
+				Path: path.Join(kubeletRootDir, "plugins", csi.DriverName),
+				Type: &hostPathType,
+			},
+		},
+	})
+}
+
+// createCSIController creates the deployment that serves the controller service of the CSI driver next to the
+// external provisioner and attacher, which provision and attach the volumes of the storage classes of the driver
+func (a *Agent) createCSIController(namespace, image string) error {
+	err := k8sutil.MakeClusterRole(a.clientset, namespace, csiControllerName, csiControllerAccessRules, nil)
+	if err != nil {
+		return fmt.Errorf("failed to init RBAC for the CSI controller. %+v", err)
+	}
+
+	socketMount := v1.VolumeMount{Name: csiSocketVolume, MountPath: csiSocketDir}
+	replicas := int32(1)
+	deployment := &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: csiControllerName,
+		},
+		Spec: extensions.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": csiControllerName,
+					},
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: csiControllerName,
+					Containers: []v1.Container{
+						{
+							Name:  csiControllerName,
+							Image: image,
+							Args:  []string{"csi"},
+							VolumeMounts: []v1.VolumeMount{
+								socketMount,
+								{Name: "config", MountPath: k8sutil.DataDir},
+							},
+							Env: []v1.EnvVar{
+								k8sutil.NamespaceEnvVar(),
+								{Name: csiEndpointEnv, Value: "unix://" + csiSocketPath},
+							},
+						},
+						{
+							Name:         "csi-provisioner",
+							Image:        csiProvisionerImage,
+							Args:         []string{"--v=5", "--provisioner=" + csi.DriverName, "--csi-address=" + csiSocketPath},
+							VolumeMounts: []v1.VolumeMount{socketMount},
+						},
+						{
+							Name:         "csi-attacher",
+							Image:        csiAttacherImage,
+							Args:         []string{"--v=5", "--csi-address=" + csiSocketPath},
+							VolumeMounts: []v1.VolumeMount{socketMount},
+						},
+					},
+					Volumes: []v1.Volume{
+						{Name: csiSocketVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+						{Name: "config", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+					},
+				},
+			},
+		},
+	}
+
+	_, err = a.clientset.ExtensionsV1beta1().Deployments(namespace).Create(deployment)
+	if err != nil {
+		if !kserrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create the CSI controller deployment. %+v", err)
+		}
+		logger.Infof("CSI controller deployment already exists")
+	} else {
+		logger.Infof("CSI controller deployment started")
+	}
+	return nil
+}
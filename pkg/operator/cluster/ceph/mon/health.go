@@ -186,13 +186,13 @@ func (c *Cluster) checkMonsOnSameNode() (bool, error) {
 
 func (c *Cluster) checkMonsOnValidNodes() (bool, error) {
 	for mon, nInfo := range c.mapping.Node {
-		// get node to use for validNode() func
+		// get node to use for ValidNode() func
 		node, err := c.context.Clientset.CoreV1().Nodes().Get(nInfo.Name, metav1.GetOptions{})
 		if err != nil {
 			return true, err
 		}
 		// check if node the mon is on is still valid
-		if !validNode(*node, c.placement) {
+		if !ValidNode(*node, c.placement) {
 			logger.Warningf("node %s isn't valid anymore, failover mon %s", nInfo.Name, mon)
 			c.failoverMon(mon)
 			return true, nil
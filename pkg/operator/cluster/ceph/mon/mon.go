@@ -429,7 +429,7 @@ func (c *Cluster) getMonNodes() ([]v1.Node, error) {
 	if len(availableNodes) == 0 {
 		logger.Infof("All nodes are running mons. Adding all %d nodes to the availability.", len(nodes.Items))
 		for _, node := range nodes.Items {
-			if validNode(node, c.placement) {
+			if ValidNode(node, c.placement) {
 				availableNodes = append(availableNodes, node)
 			}
 		}
@@ -460,7 +460,7 @@ func (c *Cluster) getAvailableMonNodes() ([]v1.Node, *v1.NodeList, error) {
 	// choose nodes for the new mons that don't have mons currently
 	availableNodes := []v1.Node{}
 	for _, node := range nodes.Items {
-		if !nodesInUse.Contains(node.Name) && validNode(node, c.placement) {
+		if !nodesInUse.Contains(node.Name) && ValidNode(node, c.placement) {
 			availableNodes = append(availableNodes, node)
 		}
 	}
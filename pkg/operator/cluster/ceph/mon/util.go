@@ -204,7 +204,8 @@ func monInQuorum(monitor client.MonMapEntry, quorum []int) bool {
 	return false
 }
 
-func validNode(node v1.Node, placement rookalpha.Placement) bool {
+// ValidNode returns whether the node is schedulable for pods with the given placement
+func ValidNode(node v1.Node, placement rookalpha.Placement) bool {
 	// a node cannot be disabled
 	if node.Spec.Unschedulable {
 		return false
@@ -0,0 +1,360 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/devicehealth"
+	cephosd "github.com/rook/rook/pkg/daemon/ceph/osd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	upStatus = 1
+	inStatus = 1
+
+	// the annotation on the deployment of an osd whose device was flagged as failed by the monitor
+	deviceFailedAnnotation = "rook.io/osd-device-failed"
+
+	eventSource        = "rook-ceph-operator"
+	eventOSDDown       = "OSDDown"
+	eventOSDRestarted  = "OSDRestarted"
+	eventOSDMarkedOut  = "OSDMarkedOut"
+	eventOSDRecovered  = "OSDRecovered"
+	eventDeviceFailed  = "OSDDeviceFailed"
+	eventOSDMarkedIn   = "OSDMarkedIn"
+	eventDeviceFailing = "OSDDevicePredictedFailure"
+)
+
+var (
+	healthCheckInterval = 60 * time.Second
+)
+
+// Monitor recovers the OSDs that are down according to the recovery policy. The pod of a down OSD is
+// restarted with a backoff between the attempts, the OSD is marked out after it has been down long enough,
+// and the device of the OSD is flagged as failed when the restart attempts are exhausted. If configured,
+// it also marks out the OSDs whose devices are predicted to fail. Each decision is reported as an event
+// on the deployment of the OSD.
+type Monitor struct {
+	context        *clusterd.Context
+	namespace      string
+	deviceHealth   rookalpha.DeviceHealthSpec
+	recoveryPolicy rookalpha.OSDRecoveryPolicy
+	kv             *k8sutil.ConfigMapKVStore
+	// guards the settings that are updated with the cluster
+	lock sync.Mutex
+
+	// lastStatus keeps track of the OSDs that are down
+	// key - OSD id; value: the recovery state of the OSD
+	lastStatus map[int]*downStatus
+}
+
+// the recovery state of an osd that is down
+type downStatus struct {
+	// when the osd was first seen down
+	since time.Time
+	// how many times the pod of the osd was restarted
+	restarts int
+	// when the pod was last restarted
+	lastRestart time.Time
+	// whether the monitor marked out the osd
+	markedOut bool
+}
+
+// NewMonitor instantiates OSD monitoring
+func NewMonitor(context *clusterd.Context, namespace string, storage rookalpha.StorageSpec) *Monitor {
+	return &Monitor{
+		context:        context,
+		namespace:      namespace,
+		deviceHealth:   storage.DeviceHealth,
+		recoveryPolicy: storage.RecoveryPolicy,
+		kv:             k8sutil.NewConfigMapKVStore(namespace, context.Clientset, metav1.OwnerReference{}),
+		lastStatus:     make(map[int]*downStatus),
+	}
+}
+
+// Update applies the device health settings and the recovery policy of an updated cluster to the next checks
+func (m *Monitor) Update(storage rookalpha.StorageSpec) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.deviceHealth = storage.DeviceHealth
+	m.recoveryPolicy = storage.RecoveryPolicy
+}
+
+// Run runs monitoring logic for osds status at set intervals
+func (m *Monitor) Run(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("Stopping monitoring of osds in namespace %s", m.namespace)
+			return
+
+		case <-time.After(healthCheckInterval):
+			logger.Debug("Checking osd processes status.")
+			err := m.osdStatus()
+			if err != nil {
+				logger.Warningf("Failed OSD status check: %+v", err)
+			}
+		}
+	}
+}
+
+// osdStatus validates osd dump output for each osd that runs in its own deployment
+func (m *Monitor) osdStatus() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	logger.Debugf("OSDs with previously detected Down status: %+v", m.lastStatus)
+	osdDump, err := client.GetOSDDump(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+
+	selector := fmt.Sprintf("%s=%s", k8sutil.AppAttr, appName)
+	deployments, err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list osd deployments. %+v", err)
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		osdID, err := m.getOSDID(d)
+		if err != nil {
+			logger.Warningf("failed to get the osd id of deployment %s. %+v", d.Name, err)
+			continue
+		}
+		if osdID == nil {
+			logger.Debugf("the osd of deployment %s is not created yet", d.Name)
+			continue
+		}
+		id := *osdID
+		logger.Debugf("validating status of osd.%d", id)
+
+		status, in, err := osdDump.StatusByID(int64(id))
+		if err != nil {
+			return err
+		}
+
+		if in == inStatus && m.deviceHealth.Enabled && m.deviceHealth.MarkOutOnPredictedFailure {
+			if err := m.markOutIfDeviceFailing(d, id); err != nil {
+				logger.Warningf("failed to check device health of osd.%d: %+v", id, err)
+			}
+		}
+
+		if _, ok := d.Annotations[deviceFailedAnnotation]; ok {
+			// the monitor gave up on the osd. the admin must replace the device or remove the annotation.
+			logger.Debugf("skipping osd.%d with a failed device", id)
+			delete(m.lastStatus, id)
+			continue
+		}
+
+		if status == upStatus {
+			m.osdUp(d, id, in)
+		} else {
+			m.osdDown(d, id, in)
+		}
+	}
+
+	return nil
+}
+
+// gets the id of the osd that runs in a deployment. The deployments of the osds on volume claims are created before
+// their osd is registered, so their id is loaded from the config store of the claim instead of a label.
+func (m *Monitor) getOSDID(d *extensions.Deployment) (*int, error) {
+	if claimName, ok := d.Labels[volumeClaimAttr]; ok {
+		return cephosd.LoadBlockDeviceOSDID(m.kv, claimName)
+	}
+	id, err := strconv.Atoi(d.Labels[osdIDAttr])
+	if err != nil {
+		return nil, fmt.Errorf("invalid osd id label. %+v", err)
+	}
+	return &id, nil
+}
+
+// stops tracking an osd that is up again and marks it back in if the monitor marked it out
+func (m *Monitor) osdUp(d *extensions.Deployment, id int, in int64) {
+	logger.Debugf("osd.%d is healthy.", id)
+	down, tracked := m.lastStatus[id]
+	if !tracked {
+		return
+	}
+
+	logger.Infof("osd.%d recovered, stopping tracking.", id)
+	delete(m.lastStatus, id)
+	m.recordEvent(d, v1.EventTypeNormal, eventOSDRecovered, fmt.Sprintf("osd.%d is up after %d restarts", id, down.restarts))
+
+	if down.markedOut && in != inStatus {
+		if err := client.OSDIn(m.context, m.namespace, id); err != nil {
+			logger.Warningf("failed to mark in osd.%d. %+v", id, err)
+			return
+		}
+		m.recordEvent(d, v1.EventTypeNormal, eventOSDMarkedIn, fmt.Sprintf("osd.%d was marked in", id))
+	}
+}
+
+// applies the recovery policy to an osd that is down
+func (m *Monitor) osdDown(d *extensions.Deployment, id int, in int64) {
+	logger.Infof("osd.%d is marked 'DOWN'", id)
+	down, tracked := m.lastStatus[id]
+	if !tracked {
+		m.lastStatus[id] = &downStatus{since: time.Now()}
+		m.recordEvent(d, v1.EventTypeWarning, eventOSDDown, fmt.Sprintf("osd.%d is down", id))
+		return
+	}
+
+	markOutAfter := m.recoveryPolicy.GetMarkOutAfter()
+	if markOutAfter > 0 && in == inStatus && time.Since(down.since) > markOutAfter {
+		logger.Infof("marking out osd.%d, it has been down for longer than %v", id, markOutAfter)
+		m.markOut(d, id, down, fmt.Sprintf("osd.%d was marked out after being down for %v", id, markOutAfter))
+	}
+
+	if down.restarts > 0 && time.Since(down.lastRestart) <= m.recoveryPolicy.GetRestartBackoff(down.restarts) {
+		logger.Infof("waiting for the backoff of osd.%d after %d restarts", id, down.restarts)
+		return
+	}
+
+	if down.restarts >= m.recoveryPolicy.GetMaxRestartAttempts() {
+		m.flagDeviceFailed(d, id, in, down)
+		return
+	}
+
+	if time.Since(down.since) <= m.recoveryPolicy.GetRestartGracePeriod() {
+		logger.Warningf("waiting for the osd.%d to exceed the grace period", id)
+		return
+	}
+
+	logger.Infof("restarting osd.%d, it has been down for longer than the grace period (down since %+v)", id, down.since)
+	if err := m.restartOSD(id); err != nil {
+		// Logging the error and continuing with the next osd.id status check.
+		logger.Warningf("failed to restart osd.%d: %+v", id, err)
+		return
+	}
+	down.restarts++
+	down.lastRestart = time.Now()
+	logger.Infof("restarted osd.%d", id)
+	m.recordEvent(d, v1.EventTypeNormal, eventOSDRestarted, fmt.Sprintf("osd.%d was restarted (attempt %d of %d)",
+		id, down.restarts, m.recoveryPolicy.GetMaxRestartAttempts()))
+}
+
+// gives up on an osd that is still down after all the restart attempts. the osd is marked out so its data is
+// recovered on other osds and its deployment is annotated so the monitor takes no further action.
+func (m *Monitor) flagDeviceFailed(d *extensions.Deployment, id int, in int64, down *downStatus) {
+	logger.Warningf("giving up on osd.%d after %d restarts, flagging its device as failed", id, down.restarts)
+	if in == inStatus {
+		m.markOut(d, id, down, fmt.Sprintf("osd.%d was marked out since it is still down after %d restarts", id, down.restarts))
+	}
+
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	d.Annotations[deviceFailedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	if _, err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.namespace).Update(d); err != nil {
+		logger.Warningf("failed to flag the device of osd.%d as failed. %+v", id, err)
+		return
+	}
+
+	delete(m.lastStatus, id)
+	m.recordEvent(d, v1.EventTypeWarning, eventDeviceFailed, fmt.Sprintf("the device of osd.%d is flagged as failed after %d restarts. "+
+		"replace the device or remove the %s annotation to resume the recovery", id, down.restarts, deviceFailedAnnotation))
+}
+
+func (m *Monitor) markOut(d *extensions.Deployment, id int, down *downStatus, message string) {
+	if err := client.OSDOut(m.context, m.namespace, id); err != nil {
+		logger.Warningf("failed to mark out osd.%d. %+v", id, err)
+		return
+	}
+	down.markedOut = true
+	m.recordEvent(d, v1.EventTypeWarning, eventOSDMarkedOut, message)
+}
+
+// records an event on the deployment of the osd
+func (m *Monitor) recordEvent(d *extensions.Deployment, eventType, reason, message string) {
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", d.Name, now.UnixNano()),
+			Namespace: m.namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:       "Deployment",
+			APIVersion: "extensions/v1beta1",
+			Name:       d.Name,
+			Namespace:  m.namespace,
+			UID:        d.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := m.context.Clientset.CoreV1().Events(m.namespace).Create(event); err != nil {
+		logger.Warningf("failed to record event %s for %s. %+v", reason, d.Name, err)
+	}
+}
+
+// mark out the osd if the SMART data of one of its devices predicts a failure so its data is moved
+// to other osds before the device fails
+func (m *Monitor) markOutIfDeviceFailing(d *extensions.Deployment, id int) error {
+	devices, err := devicehealth.Load(m.kv, id)
+	if err != nil {
+		return err
+	}
+
+	for _, health := range devices {
+		if !health.PredictedFailure() {
+			continue
+		}
+
+		logger.Warningf("marking out osd.%d since device %s is predicted to fail: %+v", id, health.Device, health)
+		if err := client.OSDOut(m.context, m.namespace, id); err != nil {
+			return fmt.Errorf("failed to mark out osd.%d. %+v", id, err)
+		}
+		m.recordEvent(d, v1.EventTypeWarning, eventDeviceFailing, fmt.Sprintf("osd.%d was marked out since device %s is predicted to fail", id, health.Device))
+		return nil
+	}
+
+	return nil
+}
+
+// delete the pods of the osd so the deployment will start a new one
+func (m *Monitor) restartOSD(id int) error {
+	selector := fmt.Sprintf("%s=%s,%s=%d", k8sutil.AppAttr, appName, osdIDAttr, id)
+	pods, err := m.context.Clientset.CoreV1().Pods(m.namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods. %+v", err)
+	}
+
+	for _, pod := range pods.Items {
+		if err := m.context.Clientset.CoreV1().Pods(m.namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("failed to delete pod %s. %+v", pod.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	cephosd "github.com/rook/rook/pkg/daemon/ceph/osd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOSDStatus(t *testing.T) {
+	execCount := 0
+	var outArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[1] == "dump" {
+				execCount++
+				// osd.1 is down and osd.2 is up
+				return `{"OSDs": [{"OSD": 1, "Up": 0, "In": 1}, {"OSD": 2, "Up": 1, "In": 1}]}`, nil
+			}
+			if args[1] == "out" {
+				outArgs = args
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	// create the deployments and pods for two osds
+	c := New(context, "ns", "myversion", rookalpha.StorageSpec{}, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	for _, id := range []int{1, 2} {
+		d := c.makeDeployment("node1", v1.ResourceRequirements{}, rookalpha.Config{}, cephosd.OSDInfo{ID: id, Cluster: "ns", DataPath: "/var/lib/rook/osd1"})
+		_, err := clientset.ExtensionsV1beta1().Deployments("ns").Create(d)
+		assert.Nil(t, err)
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: d.Name + "-pod", Namespace: "ns", Labels: d.Spec.Template.Labels}}
+		_, err = clientset.CoreV1().Pods("ns").Create(pod)
+		assert.Nil(t, err)
+	}
+
+	// the first check starts tracking the down osd
+	storage := rookalpha.StorageSpec{RecoveryPolicy: rookalpha.OSDRecoveryPolicy{MaxRestartAttempts: 1}}
+	osdMon := NewMonitor(context, "ns", storage)
+	err := osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, execCount)
+	assert.Equal(t, 1, len(osdMon.lastStatus))
+	pods, _ := clientset.CoreV1().Pods("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 2, len(pods.Items))
+	assertEvents(t, clientset, eventOSDDown)
+
+	// the second check restarts the osd that has been down longer than the grace period
+	osdMon.lastStatus[1].since = time.Now().Add(-time.Hour)
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, execCount)
+	assert.Equal(t, 1, osdMon.lastStatus[1].restarts)
+	pods, _ = clientset.CoreV1().Pods("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 1, len(pods.Items))
+	assert.Equal(t, "rook-ceph-osd-id-2-pod", pods.Items[0].Name)
+	assertEvents(t, clientset, eventOSDDown, eventOSDRestarted)
+
+	// nothing is done during the backoff after the restart
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, osdMon.lastStatus[1].restarts)
+	assert.Nil(t, outArgs)
+
+	// the osd is still down after the last attempt, the device is flagged as failed and the osd is marked out
+	osdMon.lastStatus[1].lastRestart = time.Now().Add(-time.Hour)
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(osdMon.lastStatus))
+	assert.Equal(t, []string{"osd", "out", "1"}, outArgs[:3])
+	d, _ := clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-osd-id-1", metav1.GetOptions{})
+	assert.NotEqual(t, "", d.Annotations[deviceFailedAnnotation])
+	assertEvents(t, clientset, eventOSDDown, eventOSDRestarted, eventOSDMarkedOut, eventDeviceFailed)
+
+	// the osd with the failed device is not tracked anymore
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(osdMon.lastStatus))
+}
+
+func TestOSDStatusVolumeClaim(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return `{"OSDs": [{"OSD": 3, "Up": 0, "In": 1}]}`, nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	c := New(context, "ns", "myversion", rookalpha.StorageSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	d := c.makeVolumeClaimDeployment("rook-ceph-osd-set1-0", "set1", v1.ResourceRequirements{}, rookalpha.Config{})
+	_, err := clientset.ExtensionsV1beta1().Deployments("ns").Create(d)
+	assert.Nil(t, err)
+
+	// the deployment is skipped until its osd is registered on the claim
+	osdMon := NewMonitor(context, "ns", rookalpha.StorageSpec{})
+	assert.Nil(t, osdMon.osdStatus())
+	assert.Equal(t, 0, len(osdMon.lastStatus))
+
+	// the id of the osd is loaded from the config store of the claim
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	err = kv.SetValue("rook-ceph-osd-rook-ceph-osd-set1-0-config", "block-device", `{"id":3}`)
+	assert.Nil(t, err)
+	assert.Nil(t, osdMon.osdStatus())
+	assert.Equal(t, 1, len(osdMon.lastStatus))
+	assert.NotNil(t, osdMon.lastStatus[3])
+}
+
+func TestMarkOutDownOSD(t *testing.T) {
+	up := 0
+	var inOutArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[1] == "dump" {
+				in := 1
+				if inOutArgs != nil && inOutArgs[1] == "out" {
+					in = 0
+				}
+				return fmt.Sprintf(`{"OSDs": [{"OSD": 1, "Up": %d, "In": %d}]}`, up, in), nil
+			}
+			if args[1] == "out" || args[1] == "in" {
+				inOutArgs = args
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	c := New(context, "ns", "myversion", rookalpha.StorageSpec{}, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	d := c.makeDeployment("node1", v1.ResourceRequirements{}, rookalpha.Config{}, cephosd.OSDInfo{ID: 1, Cluster: "ns", DataPath: "/var/lib/rook/osd1"})
+	_, err := clientset.ExtensionsV1beta1().Deployments("ns").Create(d)
+	assert.Nil(t, err)
+
+	// the osd is marked out when it is down longer than the policy allows, before the grace period for restarts
+	storage := rookalpha.StorageSpec{RecoveryPolicy: rookalpha.OSDRecoveryPolicy{MarkOutAfterSeconds: 60, RestartGracePeriodSeconds: 3600}}
+	osdMon := NewMonitor(context, "ns", storage)
+	assert.Nil(t, osdMon.osdStatus())
+	assert.Nil(t, inOutArgs)
+	osdMon.lastStatus[1].since = time.Now().Add(-2 * time.Minute)
+	assert.Nil(t, osdMon.osdStatus())
+	assert.Equal(t, []string{"osd", "out", "1"}, inOutArgs[:3])
+	assert.Equal(t, 0, osdMon.lastStatus[1].restarts)
+	assert.True(t, osdMon.lastStatus[1].markedOut)
+
+	// the osd is marked in when it is up again
+	up = 1
+	assert.Nil(t, osdMon.osdStatus())
+	assert.Equal(t, []string{"osd", "in", "1"}, inOutArgs[:3])
+	assert.Equal(t, 0, len(osdMon.lastStatus))
+	assertEvents(t, clientset, eventOSDDown, eventOSDMarkedOut, eventOSDRecovered, eventOSDMarkedIn)
+}
+
+// asserts the reasons of the events recorded on the osd deployments
+func assertEvents(t *testing.T, clientset *fake.Clientset, reasons ...string) {
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	actual := []string{}
+	for _, e := range events.Items {
+		assert.Equal(t, "Deployment", e.InvolvedObject.Kind)
+		actual = append(actual, e.Reason)
+	}
+	sort.Strings(actual)
+	sort.Strings(reasons)
+	assert.Equal(t, reasons, actual)
+}
+
+func TestMarkOutFailingDevice(t *testing.T) {
+	var outArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[1] == "dump" {
+				// both osds are up and in
+				return `{"OSDs": [{"OSD": 1, "Up": 1, "In": 1}, {"OSD": 2, "Up": 1, "In": 1}]}`, nil
+			}
+			if args[1] == "out" {
+				outArgs = args
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	c := New(context, "ns", "myversion", rookalpha.StorageSpec{}, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	for _, id := range []int{1, 2} {
+		d := c.makeDeployment("node1", v1.ResourceRequirements{}, rookalpha.Config{}, cephosd.OSDInfo{ID: id, Cluster: "ns", DataPath: "/var/lib/rook/osd1"})
+		_, err := clientset.ExtensionsV1beta1().Deployments("ns").Create(d)
+		assert.Nil(t, err)
+	}
+
+	// the device of osd.2 is failing
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	err := kv.SetValue("rook-ceph-osd-1-device-health", "sda", `{"device":"sda","passed":true}`)
+	assert.Nil(t, err)
+	err = kv.SetValue("rook-ceph-osd-2-device-health", "sdb", `{"device":"sdb","passed":false}`)
+	assert.Nil(t, err)
+
+	// nothing is marked out unless enabled
+	osdMon := NewMonitor(context, "ns", rookalpha.StorageSpec{DeviceHealth: rookalpha.DeviceHealthSpec{Enabled: true}})
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Nil(t, outArgs)
+
+	// nothing is marked out when the device health is not collected
+	osdMon.Update(rookalpha.StorageSpec{DeviceHealth: rookalpha.DeviceHealthSpec{MarkOutOnPredictedFailure: true}})
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Nil(t, outArgs)
+
+	// the running monitor marks out the osd after the cluster is updated
+	osdMon.Update(rookalpha.StorageSpec{DeviceHealth: rookalpha.DeviceHealthSpec{Enabled: true, MarkOutOnPredictedFailure: true}})
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd", "out", "2"}, outArgs[:3])
+	assertEvents(t, clientset, eventDeviceFailing)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	cephosd "github.com/rook/rook/pkg/daemon/ceph/osd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	migrateOSDIDEnvVarName = "ROOK_MIGRATE_OSD_ID"
+
+	// the steps to migrate an osd, in the order they are run
+	migrationPhaseMarkOut      = "MarkOut"
+	migrationPhaseWaitForClean = "WaitForClean"
+	migrationPhaseStop         = "Stop"
+	migrationPhaseDestroy      = "Destroy"
+	migrationPhasePrepare      = "Prepare"
+	migrationPhaseMarkIn       = "MarkIn"
+)
+
+var (
+	migrationCheckInterval = 10 * time.Second
+	migrationCleanTimeout  = 2 * time.Hour
+)
+
+// MigrationStatusFunc is called with the progress of a store migration so it can be reported in the cluster status
+type MigrationStatusFunc func(status *rookalpha.StoreMigrationStatus) error
+
+// the osd being migrated and the node where it was prepared
+type migratingOSD struct {
+	node rookalpha.Node
+	info cephosd.OSDInfo
+}
+
+// MigrateToBluestore migrates the filestore OSDs on the storage nodes to bluestore one OSD at a time. Each OSD is
+// marked out and destroyed after its data is safely on other OSDs, then its device is prepared again as bluestore
+// with the same OSD ID. If the status shows an OSD was in the middle of its migration, the migration resumes
+// from the step where it stopped.
+func (c *Cluster) MigrateToBluestore(status *rookalpha.StoreMigrationStatus, updateStatus MigrationStatusFunc) error {
+	osds, err := c.getMigrationCandidates(status)
+	if err != nil {
+		return c.failMigration(status, updateStatus, fmt.Errorf("failed to find the osds to migrate. %+v", err))
+	}
+
+	status.TargetStoreType = cephosd.Bluestore
+	status.State = rookalpha.StoreMigrationInProgress
+	status.Pending = []int{}
+	for id := range osds {
+		if id != status.CurrentOSD {
+			status.Pending = append(status.Pending, id)
+		}
+	}
+	sort.Ints(status.Pending)
+	if status.CurrentOSD == -1 && len(status.Pending) > 0 {
+		status.CurrentOSD = status.Pending[0]
+		status.Pending = status.Pending[1:]
+		status.Phase = migrationPhaseMarkOut
+	}
+
+	for status.CurrentOSD != -1 {
+		osd, ok := osds[status.CurrentOSD]
+		if !ok {
+			return c.failMigration(status, updateStatus, fmt.Errorf("osd %d was not found on the storage nodes", status.CurrentOSD))
+		}
+
+		if err := c.migrateOSD(osd, status, updateStatus); err != nil {
+			return c.failMigration(status, updateStatus, err)
+		}
+
+		logger.Infof("osd %d was migrated to %s", status.CurrentOSD, cephosd.Bluestore)
+		status.Completed = append(status.Completed, status.CurrentOSD)
+		status.CurrentOSD = -1
+		status.Phase = ""
+		if len(status.Pending) > 0 {
+			status.CurrentOSD = status.Pending[0]
+			status.Pending = status.Pending[1:]
+			status.Phase = migrationPhaseMarkOut
+		}
+		status.Message = ""
+		if err := updateStatus(status); err != nil {
+			logger.Warningf("failed to update the migration status. %+v", err)
+		}
+	}
+
+	status.State = rookalpha.StoreMigrationCompleted
+	status.Message = fmt.Sprintf("%d osds were migrated to %s", len(status.Completed), cephosd.Bluestore)
+	logger.Info(status.Message)
+	return updateStatus(status)
+}
+
+// runs the migration steps for a single osd, starting at the current phase of the status
+func (c *Cluster) migrateOSD(osd migratingOSD, status *rookalpha.StoreMigrationStatus, updateStatus MigrationStatusFunc) error {
+	id := osd.info.ID
+	steps := []struct {
+		phase string
+		run   func() error
+	}{
+		{migrationPhaseMarkOut, func() error { return client.OSDOut(c.context, c.Namespace, id) }},
+		{migrationPhaseWaitForClean, func() error { return c.waitForMigrationStep(id, client.OSDSafeToDestroy) }},
+		{migrationPhaseStop, func() error {
+			return k8sutil.DeleteDeployment(c.context.Clientset, c.Namespace, fmt.Sprintf(osdAppNameFmt, id))
+		}},
+		{migrationPhaseDestroy, func() error { return c.waitForMigrationStep(id, client.OSDDestroy) }},
+		{migrationPhasePrepare, func() error { return c.prepareMigratedOSD(osd.node, id) }},
+		{migrationPhaseMarkIn, func() error { return client.OSDIn(c.context, c.Namespace, id) }},
+	}
+
+	started := false
+	for _, step := range steps {
+		if !started && step.phase != status.Phase {
+			// the step was completed before the migration was interrupted
+			continue
+		}
+		started = true
+
+		logger.Infof("migrating osd %d: %s", id, step.phase)
+		status.Phase = step.phase
+		status.Message = fmt.Sprintf("osd %d on node %s", id, osd.node.Name)
+		if err := updateStatus(status); err != nil {
+			logger.Warningf("failed to update the migration status. %+v", err)
+		}
+
+		if err := step.run(); err != nil {
+			return fmt.Errorf("failed to migrate osd %d in phase %s. %+v", id, step.phase, err)
+		}
+	}
+
+	if !started {
+		return fmt.Errorf("unknown migration phase %s for osd %d", status.Phase, id)
+	}
+	return nil
+}
+
+// retries the ceph command on the osd until it succeeds. the osd must be drained and down for some commands.
+func (c *Cluster) waitForMigrationStep(id int, command func(*clusterd.Context, string, int) error) error {
+	var err error
+	for start := time.Now(); time.Since(start) < migrationCleanTimeout; time.Sleep(migrationCheckInterval) {
+		if err = command(c.context, c.Namespace, id); err == nil {
+			return nil
+		}
+		logger.Infof("waiting on osd %d. %+v", id, err)
+	}
+
+	return fmt.Errorf("timed out waiting on osd %d. %+v", id, err)
+}
+
+// runs the prepare job on the node of the osd to create it again as bluestore and starts its deployment
+func (c *Cluster) prepareMigratedOSD(n rookalpha.Node, id int) error {
+	job := c.makeJob(n.Name, n.Devices, n.Selection, n.Resources, n.Config)
+	job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env,
+		v1.EnvVar{Name: migrateOSDIDEnvVarName, Value: strconv.Itoa(id)})
+	if err := k8sutil.RunReplaceableJob(c.context.Clientset, job); err != nil {
+		return fmt.Errorf("failed to run osd prepare job on node %s. %+v", n.Name, err)
+	}
+	if err := k8sutil.WaitForJobCompletion(c.context.Clientset, c.Namespace, job.Name, prepareJobInterval, prepareJobTimeout); err != nil {
+		return fmt.Errorf("failed to prepare osd %d on node %s. %+v", id, n.Name, err)
+	}
+
+	kv := k8sutil.NewConfigMapKVStore(c.Namespace, c.context.Clientset, c.ownerRef)
+	osds, err := cephosd.LoadOSDInfo(kv, n.Name)
+	if err != nil {
+		return fmt.Errorf("failed to load the osds prepared on node %s. %+v", n.Name, err)
+	}
+	for _, osd := range osds {
+		if osd.ID != id {
+			continue
+		}
+		if osd.StoreType != cephosd.Bluestore {
+			return fmt.Errorf("osd %d was prepared as %s", id, osd.StoreType)
+		}
+		return c.startOSDDeployment(n.Name, n.Resources, n.Config, osd)
+	}
+
+	return fmt.Errorf("osd %d was not prepared on node %s", id, n.Name)
+}
+
+// gets the filestore osds on the devices of the nodes that are configured for bluestore. the osd currently
+// being migrated is included even if it was already prepared as bluestore.
+func (c *Cluster) getMigrationCandidates(status *rookalpha.StoreMigrationStatus) (map[int]migratingOSD, error) {
+	nodes, err := c.getStorageNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage nodes. %+v", err)
+	}
+
+	kv := k8sutil.NewConfigMapKVStore(c.Namespace, c.context.Clientset, c.ownerRef)
+	candidates := map[int]migratingOSD{}
+	for _, n := range nodes {
+		storeType := n.Config.StoreConfig.StoreType
+		if storeType == "" {
+			storeType = cephosd.DefaultStore
+		}
+		if storeType != cephosd.Bluestore {
+			logger.Infof("skipping migration of the osds on node %s with store type %s", n.Name, storeType)
+			continue
+		}
+
+		osds, err := cephosd.LoadOSDInfo(kv, n.Name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to load the osds prepared on node %s. %+v", n.Name, err)
+		}
+
+		for _, osd := range osds {
+			if osd.ID == status.CurrentOSD || (osd.StoreType == cephosd.Filestore && !osd.IsDirectory) {
+				candidates[osd.ID] = migratingOSD{node: n, info: osd}
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+func (c *Cluster) failMigration(status *rookalpha.StoreMigrationStatus, updateStatus MigrationStatusFunc, err error) error {
+	status.State = rookalpha.StoreMigrationFailed
+	status.Message = err.Error()
+	if updateErr := updateStatus(status); updateErr != nil {
+		logger.Warningf("failed to update the migration status. %+v", updateErr)
+	}
+	return err
+}
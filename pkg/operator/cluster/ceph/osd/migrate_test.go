@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"strings"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigrationCandidates(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	storageSpec := rookalpha.StorageSpec{Nodes: []rookalpha.Node{{Name: "node1"}, {Name: "node2"}}}
+	storageSpec.Nodes[1].StoreConfig.StoreType = "filestore"
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// node1 has a filestore device, a bluestore device and a filestore dir. node2 stays on filestore.
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	err := kv.SetValue("rook-ceph-osd-node1-config", "osd-info", `[{"id":1,"store-type":"filestore"},`+
+		`{"id":2,"store-type":"bluestore"},{"id":3,"store-type":"filestore","is-directory":true}]`)
+	assert.Nil(t, err)
+	err = kv.SetValue("rook-ceph-osd-node2-config", "osd-info", `[{"id":4,"store-type":"filestore"}]`)
+	assert.Nil(t, err)
+
+	osds, err := c.getMigrationCandidates(&rookalpha.StoreMigrationStatus{CurrentOSD: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(osds))
+	assert.Equal(t, "node1", osds[1].node.Name)
+
+	// the osd being migrated is a candidate even after it was prepared as bluestore
+	osds, err = c.getMigrationCandidates(&rookalpha.StoreMigrationStatus{CurrentOSD: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(osds))
+}
+
+func TestResumeMigration(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			commands = append(commands, strings.Join(args[0:3], " "))
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	storageSpec := rookalpha.StorageSpec{Nodes: []rookalpha.Node{{Name: "node1"}}}
+	c := New(&clusterd.Context{Clientset: clientset, Executor: executor}, "ns", "myversion", storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// osd.1 was already prepared as bluestore when the migration was interrupted
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	err := kv.SetValue("rook-ceph-osd-node1-config", "osd-info", `[{"id":1,"store-type":"bluestore"}]`)
+	assert.Nil(t, err)
+
+	updates := 0
+	status := &rookalpha.StoreMigrationStatus{CurrentOSD: 1, Phase: migrationPhaseMarkIn, State: rookalpha.StoreMigrationInProgress}
+	err = c.MigrateToBluestore(status, func(s *rookalpha.StoreMigrationStatus) error {
+		updates++
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// only the remaining step was run
+	assert.Equal(t, []string{"osd in 1"}, commands)
+	assert.Equal(t, rookalpha.StoreMigrationCompleted, status.State)
+	assert.Equal(t, []int{1}, status.Completed)
+	assert.Equal(t, 0, len(status.Pending))
+	assert.Equal(t, -1, status.CurrentOSD)
+	assert.Equal(t, 3, updates)
+}
+
+func TestMigrationFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", rookalpha.StorageSpec{}, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// the osd in the status is not found on any node
+	status := &rookalpha.StoreMigrationStatus{CurrentOSD: 5, Phase: migrationPhaseDestroy}
+	err := c.MigrateToBluestore(status, func(s *rookalpha.StoreMigrationStatus) error { return nil })
+	assert.NotNil(t, err)
+	assert.Equal(t, rookalpha.StoreMigrationFailed, status.State)
+	assert.Equal(t, 5, status.CurrentOSD)
+	assert.Equal(t, migrationPhaseDestroy, status.Phase)
+}
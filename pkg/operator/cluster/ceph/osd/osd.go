@@ -52,6 +52,15 @@ var clusterAccessRules = []v1beta1.PolicyRule{
 	},
 }
 
+// the osds read the topology labels of their node
+var nodeAccessRules = []v1beta1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes"},
+		Verbs:     []string{"get"},
+	},
+}
+
 // Cluster keeps track of the OSDs
 type Cluster struct {
 	context         *clusterd.Context
@@ -91,11 +100,44 @@ func (c *Cluster) Start() error {
 	if err != nil {
 		logger.Warningf("failed to init RBAC for OSDs. %+v", err)
 	}
+	if c.Storage.Topology.Enabled {
+		// nodes are not namespaced, so the role to read them is cluster scoped
+		err := k8sutil.BindClusterRole(c.context.Clientset, c.Namespace, fmt.Sprintf(appNameFmt, c.Namespace), appName, nodeAccessRules, nil)
+		if err != nil {
+			logger.Warningf("failed to init RBAC for the OSD topology. %+v", err)
+		}
+	}
+
+	if c.Storage.UseAllNodes == false && len(c.Storage.Nodes) == 0 && len(c.Storage.VolumeClaimSets) == 0 {
+		logger.Warningf("useAllNodes is set to false and no nodes or volume claim sets are specified, no OSD pods are going to be created")
+	}
 
-	if c.Storage.UseAllNodes == false && len(c.Storage.Nodes) == 0 {
-		logger.Warningf("useAllNodes is set to false and no nodes are specified, no OSD pods are going to be created")
+	if c.dataDirHostPath != "" {
+		// each osd runs in its own pod after a job prepares the devices and dirs on the node
+		if err := c.startNodes(); err != nil {
+			return err
+		}
+	} else {
+		// without a data dir on the host the osd pods would not find the osds prepared by the job
+		logger.Warningf("dataDirHostPath is not set, all the osds on a node will be run in a single pod")
+		if err := c.startLegacyNodes(); err != nil {
+			return err
+		}
 	}
 
+	for i := range c.Storage.VolumeClaimSets {
+		// fully resolve the storage config for this set of claims
+		set := c.Storage.ResolveVolumeClaimSet(c.Storage.VolumeClaimSets[i].Name)
+		if err := c.startVolumeClaimSet(set); err != nil {
+			return fmt.Errorf("failed to start osds for volume claim set %s. %+v", c.Storage.VolumeClaimSets[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// start a single pod on each node that prepares and runs all the osds on the node
+func (c *Cluster) startLegacyNodes() error {
 	if c.Storage.UseAllNodes {
 		// make a daemonset for all nodes in the cluster
 		ds := c.makeDaemonSet(c.Storage.Selection, c.Storage.Config)
@@ -283,6 +325,10 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 		envVars = append(envVars, osdStoreEnvVar(config.StoreConfig.StoreType))
 	}
 
+	if config.StoreConfig.ProvisionScheme != "" {
+		envVars = append(envVars, osdProvisionSchemeEnvVar(config.StoreConfig.ProvisionScheme))
+	}
+
 	if config.StoreConfig.DatabaseSizeMB != 0 {
 		envVars = append(envVars, osdDatabaseSizeEnvVar(config.StoreConfig.DatabaseSizeMB))
 	}
@@ -299,6 +345,18 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 		envVars = append(envVars, locationEnvVar(config.Location))
 	}
 
+	if c.Storage.Topology.Enabled {
+		envVars = append(envVars, topologyLabelsEnvVar(c.Storage.Topology.GetLabels()))
+	}
+
+	if c.Storage.DeviceHealth.Enabled && devMountNeeded {
+		// the osds collect the SMART data of their devices
+		envVars = append(envVars, v1.EnvVar{Name: deviceHealthIntervalEnvVarName, Value: c.Storage.DeviceHealth.GetInterval().String()})
+	}
+
+	// the pod restarts and marks out its own osds that are down
+	envVars = append(envVars, recoveryPolicyEnvVars(c.Storage.RecoveryPolicy)...)
+
 	privileged := false
 	// elevate to be privileged if it is going to mount devices
 	if devMountNeeded {
@@ -329,7 +387,27 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 }
 
 func nodeNameEnvVar() v1.EnvVar {
-	return v1.EnvVar{Name: "ROOK_NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}}
+	return v1.EnvVar{Name: nodeNameEnvVarName, ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}}
+}
+
+func recoveryPolicyEnvVars(policy rookalpha.OSDRecoveryPolicy) []v1.EnvVar {
+	envVars := []v1.EnvVar{}
+	settings := []struct {
+		name  string
+		value int
+	}{
+		{"ROOK_RESTART_GRACE_PERIOD_SECONDS", policy.RestartGracePeriodSeconds},
+		{"ROOK_MAX_RESTART_ATTEMPTS", policy.MaxRestartAttempts},
+		{"ROOK_RESTART_BACKOFF_SECONDS", policy.RestartBackoffSeconds},
+		{"ROOK_MARK_OUT_AFTER_SECONDS", policy.MarkOutAfterSeconds},
+	}
+	for _, setting := range settings {
+		// the osd falls back to the default of the settings that are not set
+		if setting.value > 0 {
+			envVars = append(envVars, v1.EnvVar{Name: setting.name, Value: strconv.Itoa(setting.value)})
+		}
+	}
+	return envVars
 }
 
 func dataDevicesEnvVar(dataDevices string) v1.EnvVar {
@@ -352,6 +430,10 @@ func osdStoreEnvVar(osdStore string) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_OSD_STORE", Value: osdStore}
 }
 
+func osdProvisionSchemeEnvVar(scheme string) v1.EnvVar {
+	return v1.EnvVar{Name: "ROOK_OSD_PROVISION_SCHEME", Value: scheme}
+}
+
 func osdDatabaseSizeEnvVar(databaseSize int) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_OSD_DATABASE_SIZE", Value: strconv.Itoa(databaseSize)}
 }
@@ -367,3 +449,7 @@ func osdJournalSizeEnvVar(journalSize int) v1.EnvVar {
 func locationEnvVar(location string) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_LOCATION", Value: location}
 }
+
+func topologyLabelsEnvVar(labels map[string]string) v1.EnvVar {
+	return v1.EnvVar{Name: k8sutil.TopologyLabelsEnvVar, Value: k8sutil.FormatTopologyLabels(labels)}
+}
@@ -16,17 +16,25 @@ limitations under the License.
 package osd
 
 import (
+	"encoding/json"
 	"strconv"
 	"testing"
 
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	cephosd "github.com/rook/rook/pkg/daemon/ceph/osd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/kubernetes/pkg/kubelet/apis"
 )
 
@@ -51,6 +59,20 @@ func TestPodContainer(t *testing.T) {
 	assert.Equal(t, 1, len(c.Spec.Containers))
 	container := c.Spec.Containers[0]
 	assert.Equal(t, "osd", container.Args[0])
+	verifyEnvVar(t, container.Env, "ROOK_DEVICE_HEALTH_INTERVAL", "", false)
+
+	// the osds that run with the other osds of their node also collect the health of their devices
+	cluster.Storage.DeviceHealth = rookalpha.DeviceHealthSpec{Enabled: true, IntervalMinutes: 30}
+	c = cluster.podTemplateSpec([]rookalpha.Device{{Name: "sda"}}, rookalpha.Selection{}, v1.ResourceRequirements{}, config)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_DEVICE_HEALTH_INTERVAL", "30m0s", true)
+
+	// the osds that run with the other osds of their node are recovered with the policy of the cluster
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_MAX_RESTART_ATTEMPTS", "", false)
+	cluster.Storage.RecoveryPolicy = rookalpha.OSDRecoveryPolicy{MaxRestartAttempts: 5, MarkOutAfterSeconds: 900}
+	c = cluster.podTemplateSpec([]rookalpha.Device{{Name: "sda"}}, rookalpha.Selection{}, v1.ResourceRequirements{}, config)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_MAX_RESTART_ATTEMPTS", "5", true)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_MARK_OUT_AFTER_SECONDS", "900", true)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_RESTART_GRACE_PERIOD_SECONDS", "", false)
 }
 
 func TestDaemonset(t *testing.T) {
@@ -255,3 +277,254 @@ func TestHostNetwork(t *testing.T) {
 	assert.Equal(t, true, r.Spec.Template.Spec.HostNetwork)
 	assert.Equal(t, v1.DNSClusterFirstWithHostNet, r.Spec.Template.Spec.DNSPolicy)
 }
+
+func TestStartVolumeClaimSet(t *testing.T) {
+	storageSpec := rookalpha.StorageSpec{
+		Config: rookalpha.Config{Location: "rack=foo"},
+		VolumeClaimSets: []rookalpha.VolumeClaimSet{
+			{
+				Name:  "set1",
+				Count: 2,
+				VolumeClaimTemplate: v1.PersistentVolumeClaim{
+					Spec: v1.PersistentVolumeClaimSpec{
+						Resources: v1.ResourceRequirements{
+							Requests: v1.ResourceList{v1.ResourceStorage: *resource.NewQuantity(10737418240, resource.BinarySI)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// the raw objects are created with the fields of the 1.8 API types in the fake clientset
+	rawObjects := map[string][]byte{}
+	defer func(create func(rest.Interface, string, string, []byte) error) { createRawObject = create }(createRawObject)
+	createRawObject = func(client rest.Interface, namespace, resource string, raw []byte) error {
+		var err error
+		switch resource {
+		case "persistentvolumeclaims":
+			claim := &v1.PersistentVolumeClaim{}
+			assert.Nil(t, json.Unmarshal(raw, claim))
+			_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(claim)
+			rawObjects["claim/"+claim.Name] = raw
+		case "deployments":
+			d := &extensions.Deployment{}
+			assert.Nil(t, json.Unmarshal(raw, d))
+			_, err = clientset.ExtensionsV1beta1().Deployments(namespace).Create(d)
+			rawObjects["deployment/"+d.Name] = raw
+		default:
+			assert.Fail(t, "unexpected resource "+resource)
+		}
+		return err
+	}
+
+	// start the first time
+	err := c.Start()
+	assert.Nil(t, err)
+
+	// a claim and a deployment should be created for each OSD in the set
+	for _, name := range []string{"rook-ceph-osd-set1-0", "rook-ceph-osd-set1-1"} {
+		claim, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "set1", claim.Labels[volumeClaimSetAttr])
+		size := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		assert.Equal(t, "10Gi", size.String())
+
+		// the claim is a raw block volume
+		var rawClaim struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				VolumeMode string `json:"volumeMode"`
+			} `json:"spec"`
+		}
+		assert.Nil(t, json.Unmarshal(rawObjects["claim/"+name], &rawClaim))
+		assert.Equal(t, "PersistentVolumeClaim", rawClaim.Kind)
+		assert.Equal(t, "Block", rawClaim.Spec.VolumeMode)
+
+		d, err := clientset.ExtensionsV1beta1().Deployments("ns").Get(name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), *d.Spec.Replicas)
+		assert.Equal(t, appName, d.Labels[k8sutil.AppAttr])
+		assert.Equal(t, name, d.Labels[volumeClaimAttr])
+
+		// the data dir is not on the host, and the claim is a volume of the pod
+		podSpec := d.Spec.Template.Spec
+		assert.Equal(t, k8sutil.DataDirVolume, podSpec.Volumes[0].Name)
+		assert.NotNil(t, podSpec.Volumes[0].VolumeSource.EmptyDir)
+		claimVolume := podSpec.Volumes[len(podSpec.Volumes)-1]
+		assert.Equal(t, "osd-block", claimVolume.Name)
+		assert.Equal(t, name, claimVolume.VolumeSource.PersistentVolumeClaim.ClaimName)
+
+		// the claim is a device of the container
+		var rawDeployment struct {
+			Spec struct {
+				Template struct {
+					Spec struct {
+						Containers []struct {
+							VolumeDevices []map[string]string `json:"volumeDevices"`
+						} `json:"containers"`
+					} `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		}
+		assert.Nil(t, json.Unmarshal(rawObjects["deployment/"+name], &rawDeployment))
+		assert.Equal(t, []map[string]string{{"name": "osd-block", "devicePath": "/dev/rook-osd-block"}},
+			rawDeployment.Spec.Template.Spec.Containers[0].VolumeDevices)
+
+		// the claim name is the identity of the OSD rather than the node
+		container := podSpec.Containers[0]
+		verifyEnvVar(t, container.Env, "ROOK_NODE_NAME", name, true)
+		verifyEnvVar(t, container.Env, "ROOK_LOCATION", "rack=foo", true)
+		verifyEnvVar(t, container.Env, "ROOK_BLOCK_DEVICE_PATH", "/dev/rook-osd-block", true)
+		assert.True(t, *container.SecurityContext.Privileged)
+	}
+
+	// starting again should be idempotent
+	err = c.Start()
+	assert.Nil(t, err)
+}
+
+func TestPrepareJob(t *testing.T) {
+	storageSpec := rookalpha.StorageSpec{
+		Nodes: []rookalpha.Node{{Name: "node1", Devices: []rookalpha.Device{{Name: "sda"}}}},
+	}
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "rook/rook:myversion", storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	n := c.Storage.ResolveNode("node1")
+	job := c.makeJob(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, n.Config)
+	assert.Equal(t, "rook-ceph-osd-prepare-node1", job.Name)
+	assert.Equal(t, "node1", job.Spec.Template.Spec.NodeSelector[apis.LabelHostname])
+	assert.Equal(t, v1.RestartPolicyOnFailure, job.Spec.Template.Spec.RestartPolicy)
+	assert.Equal(t, prepareAppName, job.Spec.Template.Labels[k8sutil.AppAttr])
+
+	cont := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{"osd", "prepare"}, cont.Args)
+	verifyEnvVar(t, cont.Env, "ROOK_DATA_DEVICES", "sda", true)
+	assert.True(t, *cont.SecurityContext.Privileged)
+}
+
+func TestOSDDeployment(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "rook/rook:myversion", rookalpha.StorageSpec{}, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceCPU: *resource.NewQuantity(100.0, resource.BinarySI)}}
+	config := rookalpha.Config{Location: "rack=foo"}
+
+	// an osd on a device
+	osd := cephosd.OSDInfo{ID: 3, Cluster: "ns", DataPath: "/var/lib/rook/osd3", StoreType: cephosd.Bluestore}
+	d := c.makeDeployment("node1", resources, config, osd)
+	assert.Equal(t, "rook-ceph-osd-id-3", d.Name)
+	assert.Equal(t, "3", d.Labels[osdIDAttr])
+	assert.Equal(t, "3", d.Spec.Template.Labels[osdIDAttr])
+	assert.Equal(t, int32(1), *d.Spec.Replicas)
+	podSpec := d.Spec.Template.Spec
+	assert.Equal(t, "node1", podSpec.NodeSelector[apis.LabelHostname])
+	assert.Equal(t, 3, len(podSpec.Volumes))
+	assert.Equal(t, "/var/lib/rook", podSpec.Volumes[0].HostPath.Path)
+	assert.Equal(t, "devices", podSpec.Volumes[2].Name)
+
+	cont := podSpec.Containers[0]
+	assert.Equal(t, []string{"osd", "start"}, cont.Args)
+	assert.True(t, *cont.SecurityContext.Privileged)
+	assert.Equal(t, "100", cont.Resources.Limits.Cpu().String())
+	verifyEnvVar(t, cont.Env, "ROOK_OSD_ID", "3", true)
+	verifyEnvVar(t, cont.Env, "ROOK_LOCATION", "rack=foo", true)
+	verifyEnvVar(t, cont.Env, "ROOK_DEVICE_HEALTH_INTERVAL", "", false)
+	assert.Equal(t, []string{"ceph", "--admin-daemon", "/var/lib/rook/osd3/ns-osd.3.asok", "status"}, cont.LivenessProbe.Exec.Command)
+
+	// the osd collects the health of its devices when enabled
+	c.Storage.DeviceHealth = rookalpha.DeviceHealthSpec{Enabled: true, IntervalMinutes: 30}
+	d = c.makeDeployment("node1", resources, config, osd)
+	verifyEnvVar(t, d.Spec.Template.Spec.Containers[0].Env, "ROOK_DEVICE_HEALTH_INTERVAL", "30m0s", true)
+	c.Storage.DeviceHealth = rookalpha.DeviceHealthSpec{}
+
+	// an osd in a directory outside the data dir
+	osd = cephosd.OSDInfo{ID: 4, Cluster: "ns", DataPath: "/rook/dir1/osd4", IsDirectory: true}
+	d = c.makeDeployment("node1", resources, config, osd)
+	podSpec = d.Spec.Template.Spec
+	assert.Equal(t, 3, len(podSpec.Volumes))
+	assert.Equal(t, "/rook/dir1", podSpec.Volumes[2].HostPath.Path)
+	assert.Equal(t, "/rook/dir1", podSpec.Containers[0].VolumeMounts[2].MountPath)
+	assert.False(t, *podSpec.Containers[0].SecurityContext.Privileged)
+
+	// the deployment is updated if it already exists
+	err := c.startOSDDeployment("node1", resources, config, osd)
+	assert.Nil(t, err)
+	err = c.startOSDDeployment("node1", v1.ResourceRequirements{}, config, osd)
+	assert.Nil(t, err)
+	d, err = clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-osd-id-4", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(d.Spec.Template.Spec.Containers[0].Resources.Limits))
+}
+
+func TestStartNodesReplacesLegacyOSDs(t *testing.T) {
+	legacyLabels := map[string]string{k8sutil.AppAttr: appName}
+	clientset := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{apis.LabelHostname: "host1"}}},
+		&extensions.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd", Namespace: "ns"}},
+		&extensions.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-host1", Namespace: "ns"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "legacy-host1", Namespace: "ns", Labels: legacyLabels}, Spec: v1.PodSpec{NodeName: "node1"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "legacy-host2", Namespace: "ns", Labels: legacyLabels}, Spec: v1.PodSpec{NodeName: "node2"}},
+	)
+	// the prepare jobs complete as soon as they are created
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*batch.Job).Status.Succeeded = 1
+		return false, nil, nil
+	})
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	err := kv.SetValue("rook-ceph-osd-node1-config", "osd-info", `[{"id":1,"store-type":"bluestore"}]`)
+	assert.Nil(t, err)
+
+	storageSpec := rookalpha.StorageSpec{Nodes: []rookalpha.Node{{Name: "host1"}, {Name: "host2"}}}
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	err = c.startNodes()
+	assert.Nil(t, err)
+
+	// the prepare job and the osd are keyed by the k8s node name and select the node by its hostname
+	job, err := clientset.BatchV1().Jobs("ns").Get("rook-ceph-osd-prepare-node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "host1", job.Spec.Template.Spec.NodeSelector[apis.LabelHostname])
+
+	// the osd is started in its own deployment after the legacy pods on its node are removed
+	d, err := clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-osd-id-1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "host1", d.Spec.Template.Spec.NodeSelector[apis.LabelHostname])
+	_, err = clientset.ExtensionsV1beta1().DaemonSets("ns").Get("rook-ceph-osd", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	_, err = clientset.ExtensionsV1beta1().ReplicaSets("ns").Get("rook-ceph-osd-host1", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	_, err = clientset.CoreV1().Pods("ns").Get("legacy-host1", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the legacy pod keeps running on the node where no osds were prepared
+	_, err = clientset.CoreV1().Pods("ns").Get("legacy-host2", metav1.GetOptions{})
+	assert.Nil(t, err)
+}
+
+func TestGetStorageNodes(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{apis.LabelHostname: "host1"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{Unschedulable: true}},
+	)
+	storageSpec := rookalpha.StorageSpec{UseAllNodes: true, Config: rookalpha.Config{Location: "rack=foo"}}
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// all the schedulable nodes are used with the cluster storage settings
+	nodes, err := c.getStorageNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nodes))
+	assert.Equal(t, "node1", nodes[0].Name)
+	assert.Equal(t, "rack=foo", nodes[0].Config.Location)
+
+	// only the specified nodes are used, resolved from their hostname to the k8s node name
+	c.Storage = rookalpha.StorageSpec{Nodes: []rookalpha.Node{{Name: "host1"}, {Name: "node3"}}}
+	nodes, err = c.getStorageNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, "node1", nodes[0].Name)
+	assert.Equal(t, "node3", nodes[1].Name)
+	assert.Equal(t, cephosd.Bluestore, nodes[0].Config.StoreConfig.StoreType)
+}
@@ -0,0 +1,430 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	cephosd "github.com/rook/rook/pkg/daemon/ceph/osd"
+	opmon "github.com/rook/rook/pkg/operator/cluster/ceph/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	prepareAppName                 = "rook-ceph-osd-prepare"
+	prepareAppNameFmt              = "rook-ceph-osd-prepare-%s"
+	osdAppNameFmt                  = "rook-ceph-osd-id-%d"
+	osdIDAttr                      = "ceph-osd-id"
+	deviceHealthIntervalEnvVarName = "ROOK_DEVICE_HEALTH_INTERVAL"
+	osdIDEnvVarName                = "ROOK_OSD_ID"
+	livenessInitialDelay           = 45
+)
+
+var (
+	prepareJobInterval = 5 * time.Second
+	prepareJobTimeout  = 20 * time.Minute
+)
+
+// start the OSDs on the storage nodes. A job on each node prepares the devices and directories for the OSDs,
+// then a deployment is started for each OSD that was prepared so that each OSD runs in its own pod.
+func (c *Cluster) startNodes() error {
+	nodes, err := c.getStorageNodes()
+	if err != nil {
+		return fmt.Errorf("failed to get storage nodes. %+v", err)
+	}
+
+	// the pods of the legacy daemon set keep running until the osds on their node are started in their own deployments
+	if err := c.orphanLegacyDaemonSet(); err != nil {
+		return err
+	}
+
+	// start the jobs on all the nodes first so they are prepared in parallel
+	pending := map[string]rookalpha.Node{}
+	for _, n := range nodes {
+		job := c.makeJob(n.Name, n.Devices, n.Selection, n.Resources, n.Config)
+		if err := k8sutil.RunReplaceableJob(c.context.Clientset, job); err != nil {
+			return fmt.Errorf("failed to run osd prepare job on node %s. %+v", n.Name, err)
+		}
+		logger.Infof("osd prepare job started on node %s", n.Name)
+		pending[n.Name] = n
+	}
+
+	// wait for all the jobs together, starting the osds of each node as soon as its job completes
+	for start := time.Now(); ; time.Sleep(prepareJobInterval) {
+		for name, n := range pending {
+			job, err := c.context.Clientset.BatchV1().Jobs(c.Namespace).Get(fmt.Sprintf(prepareAppNameFmt, name), metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get osd prepare job for node %s. %+v", name, err)
+			}
+			if job.Status.Succeeded == 0 {
+				continue
+			}
+
+			delete(pending, name)
+			if err := c.startNodeOSDs(n); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Since(start) >= prepareJobTimeout {
+			// the osds on these nodes will be started when the cluster is orchestrated again
+			for name := range pending {
+				logger.Errorf("gave up waiting for the osds on node %s to be prepared after %s", name, prepareJobTimeout)
+			}
+			return nil
+		}
+	}
+}
+
+// start a deployment for each osd prepared on a node, after the legacy pod that ran all the osds on the node is stopped
+func (c *Cluster) startNodeOSDs(n rookalpha.Node) error {
+	kv := k8sutil.NewConfigMapKVStore(c.Namespace, c.context.Clientset, c.ownerRef)
+	osds, err := cephosd.LoadOSDInfo(kv, n.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Infof("no osds were prepared on node %s", n.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to load the osds prepared on node %s. %+v", n.Name, err)
+	}
+
+	if err := c.removeLegacyOSDs(n.Name); err != nil {
+		return fmt.Errorf("failed to remove the legacy osd pods on node %s. %+v", n.Name, err)
+	}
+
+	for _, osd := range osds {
+		if err := c.startOSDDeployment(n.Name, n.Resources, n.Config, osd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete the legacy daemon set that ran all the osds on each node without deleting its pods, which are removed one
+// node at a time when the osds of the node are started in their own deployments
+func (c *Cluster) orphanLegacyDaemonSet() error {
+	_, err := c.context.Clientset.ExtensionsV1beta1().DaemonSets(c.Namespace).Get(appName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get legacy osd daemon set. %+v", err)
+	}
+
+	propagation := metav1.DeletePropagationOrphan
+	err = c.context.Clientset.ExtensionsV1beta1().DaemonSets(c.Namespace).Delete(appName, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete legacy osd daemon set. %+v", err)
+	}
+	logger.Infof("removed legacy osd daemon set. its pods will be replaced by the osd deployments")
+	return nil
+}
+
+// remove the legacy replica set or daemon set pod that ran all the osds on a node, waiting for the pods to be
+// terminated so that an osd never runs in two pods with the same data
+func (c *Cluster) removeLegacyOSDs(nodeName string) error {
+	// the legacy replica sets were named after the hostname of their node
+	hostname, err := c.getNodeHostname(nodeName)
+	if err != nil {
+		return err
+	}
+	replicaSetName := fmt.Sprintf(appNameFmt, hostname)
+	_, err = c.context.Clientset.ExtensionsV1beta1().ReplicaSets(c.Namespace).Get(replicaSetName, metav1.GetOptions{})
+	if err == nil {
+		if err := k8sutil.DeleteReplicaSet(c.context.Clientset, c.Namespace, replicaSetName); err != nil {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get legacy osd replica set %s. %+v", replicaSetName, err)
+	}
+
+	// the pods that run all the osds of a node are the osd pods without an osd id or a volume claim
+	selector := fmt.Sprintf("%s=%s,!%s,!%s", k8sutil.AppAttr, appName, osdIDAttr, volumeClaimSetAttr)
+	pods, err := c.context.Clientset.CoreV1().Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list legacy osd pods. %+v", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != nodeName && pod.Spec.NodeSelector[apis.LabelHostname] != hostname {
+			continue
+		}
+		if err := k8sutil.DeletePod(c.context.Clientset, c.Namespace, pod.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get the name of the k8s node with the hostname of a storage node
+func (c *Cluster) getK8sNodeName(nodeName string) (string, error) {
+	selector := fmt.Sprintf("%s=%s", apis.LabelHostname, nodeName)
+	k8sNodes, err := c.context.Clientset.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s. %+v", nodeName, err)
+	}
+	if len(k8sNodes.Items) == 0 {
+		return nodeName, nil
+	}
+	return k8sNodes.Items[0].Name, nil
+}
+
+// get the hostname label of a k8s node, which the osd pods of the node select
+func (c *Cluster) getNodeHostname(nodeName string) (string, error) {
+	node, err := c.context.Clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nodeName, nil
+		}
+		return "", fmt.Errorf("failed to get node %s. %+v", nodeName, err)
+	}
+	if hostname, ok := node.Labels[apis.LabelHostname]; ok {
+		return hostname, nil
+	}
+	return nodeName, nil
+}
+
+// get the node selector for the osd pods of a k8s node
+func (c *Cluster) nodeSelector(nodeName string) map[string]string {
+	hostname, err := c.getNodeHostname(nodeName)
+	if err != nil {
+		logger.Warningf("failed to get the hostname of node %s, selecting it by name. %+v", nodeName, err)
+		hostname = nodeName
+	}
+	return map[string]string{apis.LabelHostname: hostname}
+}
+
+func (c *Cluster) startOSDDeployment(nodeName string, resources v1.ResourceRequirements, config rookalpha.Config, osd cephosd.OSDInfo) error {
+	deployment := c.makeDeployment(nodeName, resources, config, osd)
+	_, err := c.context.Clientset.ExtensionsV1beta1().Deployments(c.Namespace).Create(deployment)
+	if err == nil {
+		logger.Infof("deployment for osd %d started on node %s", osd.ID, nodeName)
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create deployment for osd %d. %+v", osd.ID, err)
+	}
+
+	// update the existing deployment in case its settings have changed. only the pod for this osd will be restarted.
+	_, err = c.context.Clientset.ExtensionsV1beta1().Deployments(c.Namespace).Update(deployment)
+	if err != nil {
+		return fmt.Errorf("failed to update deployment for osd %d. %+v", osd.ID, err)
+	}
+	logger.Infof("deployment for osd %d updated on node %s", osd.ID, nodeName)
+	return nil
+}
+
+// get the fully resolved nodes that will be prepared for OSDs. The nodes are named after their k8s node, which is
+// the node name the osd pods read from the downward api and save the osd info under.
+func (c *Cluster) getStorageNodes() ([]rookalpha.Node, error) {
+	if !c.Storage.UseAllNodes {
+		nodes := []rookalpha.Node{}
+		for i := range c.Storage.Nodes {
+			n := *c.Storage.ResolveNode(c.Storage.Nodes[i].Name)
+			n.Resources = k8sutil.MergeResourceRequirements(n.Resources, c.resources)
+
+			// the nodes in the storage spec are named by their hostname label
+			name, err := c.getK8sNodeName(n.Name)
+			if err != nil {
+				return nil, err
+			}
+			n.Name = name
+			nodes = append(nodes, n)
+		}
+		return nodes, nil
+	}
+
+	// all the nodes where the osd pods can be scheduled will use the cluster wide storage settings
+	k8sNodes, err := c.context.Clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := []rookalpha.Node{}
+	for _, k8sNode := range k8sNodes.Items {
+		if !opmon.ValidNode(k8sNode, c.placement) {
+			logger.Infof("skipping node %s that is not valid for osds", k8sNode.Name)
+			continue
+		}
+
+		nodes = append(nodes, rookalpha.Node{
+			Name:      k8sNode.Name,
+			Selection: c.Storage.Selection,
+			Config:    c.Storage.Config,
+			Resources: c.resources,
+		})
+	}
+
+	return nodes, nil
+}
+
+func (c *Cluster) makeJob(nodeName string, devices []rookalpha.Device, selection rookalpha.Selection,
+	resources v1.ResourceRequirements, config rookalpha.Config) *batch.Job {
+
+	podSpec := c.podTemplateSpec(devices, selection, resources, config)
+	podSpec.Name = prepareAppName
+	podSpec.Labels[k8sutil.AppAttr] = prepareAppName
+	podSpec.Spec.NodeSelector = c.nodeSelector(nodeName)
+	podSpec.Spec.RestartPolicy = v1.RestartPolicyOnFailure
+	podSpec.Spec.Containers[0].Args = []string{"osd", "prepare"}
+
+	return &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf(prepareAppNameFmt, nodeName),
+			Namespace:       c.Namespace,
+			OwnerReferences: []metav1.OwnerReference{c.ownerRef},
+			Labels: map[string]string{
+				k8sutil.AppAttr:     prepareAppName,
+				k8sutil.ClusterAttr: c.Namespace,
+			},
+		},
+		Spec: batch.JobSpec{Template: podSpec},
+	}
+}
+
+func (c *Cluster) makeDeployment(nodeName string, resources v1.ResourceRequirements, config rookalpha.Config,
+	osd cephosd.OSDInfo) *extensions.Deployment {
+
+	volumes := []v1.Volume{
+		{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: c.dataDirHostPath}}},
+		k8sutil.ConfigOverrideVolume(),
+	}
+	volumeMounts := []v1.VolumeMount{
+		{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+		k8sutil.ConfigOverrideMount(),
+	}
+
+	if osd.IsDirectory {
+		// a directory outside the data dir is mounted from the host at the same path
+		dirPath := filepath.Dir(osd.DataPath)
+		if !strings.HasPrefix(dirPath, k8sutil.DataDir) {
+			volumeName := k8sutil.PathToVolumeName(dirPath)
+			volumes = append(volumes, v1.Volume{Name: volumeName, VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: dirPath}}})
+			volumeMounts = append(volumeMounts, v1.VolumeMount{Name: volumeName, MountPath: dirPath})
+		}
+	} else {
+		// the osd needs access to the partitions on its devices
+		volumes = append(volumes, v1.Volume{Name: "devices", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev"}}})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: "devices", MountPath: "/dev"})
+	}
+
+	envVars := []v1.EnvVar{
+		nodeNameEnvVar(),
+		{Name: osdIDEnvVarName, Value: strconv.Itoa(osd.ID)},
+		{Name: "ROOK_CLUSTER_ID", Value: string(c.ownerRef.UID)},
+		k8sutil.PodIPEnvVar(k8sutil.PrivateIPEnvVar),
+		k8sutil.PodIPEnvVar(k8sutil.PublicIPEnvVar),
+		opmon.ClusterNameEnvVar(c.Namespace),
+		opmon.EndpointEnvVar(),
+		opmon.SecretEnvVar(),
+		opmon.AdminSecretEnvVar(),
+		k8sutil.ConfigDirEnvVar(),
+		k8sutil.ConfigOverrideEnvVar(),
+	}
+	if config.Location != "" {
+		envVars = append(envVars, locationEnvVar(config.Location))
+	}
+	if c.Storage.Topology.Enabled {
+		envVars = append(envVars, topologyLabelsEnvVar(c.Storage.Topology.GetLabels()))
+	}
+	if c.Storage.DeviceHealth.Enabled && !osd.IsDirectory {
+		// the osd pod collects the SMART data of its devices
+		envVars = append(envVars, v1.EnvVar{Name: deviceHealthIntervalEnvVarName, Value: c.Storage.DeviceHealth.GetInterval().String()})
+	}
+
+	// the osd is alive as long as it responds on its admin socket, which is in its run dir
+	adminSocket := filepath.Join(osd.DataPath, fmt.Sprintf("%s-osd.%d.asok", osd.Cluster, osd.ID))
+	livenessProbe := &v1.Probe{
+		Handler: v1.Handler{
+			Exec: &v1.ExecAction{Command: []string{"ceph", "--admin-daemon", adminSocket, "status"}},
+		},
+		InitialDelaySeconds: livenessInitialDelay,
+	}
+
+	privileged := !osd.IsDirectory
+	runAsUser := int64(0)
+	readOnlyRootFilesystem := false
+	container := v1.Container{
+		Args:          []string{"osd", "start"},
+		Name:          appName,
+		Image:         k8sutil.MakeRookImage(c.Version),
+		VolumeMounts:  volumeMounts,
+		Env:           envVars,
+		LivenessProbe: livenessProbe,
+		SecurityContext: &v1.SecurityContext{
+			Privileged:             &privileged,
+			RunAsUser:              &runAsUser,
+			ReadOnlyRootFilesystem: &readOnlyRootFilesystem,
+		},
+		Resources: resources,
+	}
+
+	podSpec := v1.PodSpec{
+		ServiceAccountName: appName,
+		Containers:         []v1.Container{container},
+		RestartPolicy:      v1.RestartPolicyAlways,
+		Volumes:            volumes,
+		HostNetwork:        c.HostNetwork,
+		NodeSelector:       c.nodeSelector(nodeName),
+	}
+	if c.HostNetwork {
+		podSpec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+	c.placement.ApplyToPodSpec(&podSpec)
+
+	replicaCount := int32(1)
+	return &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf(osdAppNameFmt, osd.ID),
+			Namespace:       c.Namespace,
+			OwnerReferences: []metav1.OwnerReference{c.ownerRef},
+			Labels: map[string]string{
+				k8sutil.AppAttr:     appName,
+				k8sutil.ClusterAttr: c.Namespace,
+				osdIDAttr:           strconv.Itoa(osd.ID),
+			},
+		},
+		Spec: extensions.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: appName,
+					Labels: map[string]string{
+						k8sutil.AppAttr:     appName,
+						k8sutil.ClusterAttr: c.Namespace,
+						osdIDAttr:           strconv.Itoa(osd.ID),
+					},
+					Annotations: map[string]string{},
+				},
+				Spec: podSpec,
+			},
+			Replicas: &replicaCount,
+			// the old osd process must be stopped before a new one can use the same data
+			Strategy: extensions.DeploymentStrategy{Type: extensions.RecreateDeploymentStrategyType},
+		},
+	}
+}
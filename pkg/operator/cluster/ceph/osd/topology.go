@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strings"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// the type each new bucket type is inserted before in the crush map
+var crushTypeParents = map[string]string{"zone": "region"}
+
+// TopologyController keeps the CRUSH location of the osd hosts up to date with the topology labels of their nodes
+type TopologyController struct {
+	context   *clusterd.Context
+	namespace string
+	storage   rookalpha.StorageSpec
+	labels    map[string]string
+}
+
+// NewTopologyController creates a controller that moves the osd hosts in the crush map when their node labels change
+func NewTopologyController(context *clusterd.Context, namespace string, storage rookalpha.StorageSpec) *TopologyController {
+	return &TopologyController{
+		context:   context,
+		namespace: namespace,
+		storage:   storage,
+		labels:    storage.Topology.GetLabels(),
+	}
+}
+
+// Run adds the bucket types of the topology to the crush map and watches the nodes until the stop channel is closed
+func (t *TopologyController) Run(stopCh chan struct{}) {
+	logger.Infof("watching the topology labels of the nodes in namespace %s: %s", t.namespace, k8sutil.FormatTopologyLabels(t.labels))
+	if err := t.addCrushTypes(); err != nil {
+		logger.Warningf("failed to add the topology types to the crush map. %+v", err)
+	}
+
+	source := cache.NewListWatchFromClient(t.context.Clientset.CoreV1().RESTClient(), "nodes", v1.NamespaceAll, fields.Everything())
+	_, controller := cache.NewInformer(source, &v1.Node{}, 0, cache.ResourceEventHandlerFuncs{
+		UpdateFunc: t.onNodeUpdate,
+	})
+	controller.Run(stopCh)
+}
+
+// adds the bucket types of the topology that are not in the crush map, such as the zone type in older clusters
+func (t *TopologyController) addCrushTypes() error {
+	for bucketType := range t.labels {
+		nextType, ok := crushTypeParents[bucketType]
+		if !ok {
+			nextType = "root"
+		}
+		if err := client.AddCrushType(t.context, t.namespace, bucketType, nextType); err != nil {
+			return fmt.Errorf("failed to add crush type %s. %+v", bucketType, err)
+		}
+	}
+	return nil
+}
+
+func (t *TopologyController) onNodeUpdate(oldObj, newObj interface{}) {
+	oldNode := oldObj.(*v1.Node)
+	newNode := newObj.(*v1.Node)
+
+	oldTopology := k8sutil.NodeTopologyLocation(oldNode, t.labels)
+	newTopology := k8sutil.NodeTopologyLocation(newNode, t.labels)
+	if oldTopology == newTopology {
+		return
+	}
+
+	logger.Infof("topology of node %s changed from '%s' to '%s'", newNode.Name, oldTopology, newTopology)
+	if err := t.moveHost(newNode, newTopology); err != nil {
+		logger.Errorf("failed to update the crush location of node %s. %+v", newNode.Name, err)
+	}
+}
+
+// moves the host bucket of the node to its new location. The location configured for the node or the cluster
+// takes precedence over the topology labels.
+func (t *TopologyController) moveHost(node *v1.Node, topology string) error {
+	location := t.storage.Config.Location
+	if n := t.storage.ResolveNode(node.Name); n != nil {
+		location = n.Config.Location
+	}
+
+	pairs, err := client.FormatLocation(k8sutil.MergeLocation(location, topology), node.Name)
+	if err != nil {
+		return fmt.Errorf("invalid location. %+v", err)
+	}
+
+	host := ""
+	args := []string{}
+	for _, pair := range pairs {
+		if strings.HasPrefix(pair, "host=") {
+			host = strings.TrimPrefix(pair, "host=")
+			continue
+		}
+		args = append(args, pair)
+	}
+
+	// only the hosts with osds are in the crush map
+	crushMap, err := client.GetCrushMap(t.context, t.namespace)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, bucket := range crushMap.Buckets {
+		if bucket.Name == host && bucket.TypeName == "host" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		logger.Infof("host %s is not in the crush map", host)
+		return nil
+	}
+
+	logger.Infof("moving host %s to %v", host, args)
+	return client.CrushMoveBucket(t.context, t.namespace, host, args)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"strings"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTopologyNodeUpdate(t *testing.T) {
+	moves := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[1] == "crush" && args[2] == "dump" {
+				return `{"buckets":[{"id":-2,"name":"node1","type_name":"host"},{"id":-3,"name":"node2","type_name":"host"}]}`, nil
+			}
+			if args[1] == "crush" && args[2] == "move" {
+				moves = append(moves, strings.Join(args[3:6], " "))
+			}
+			return "", nil
+		},
+	}
+	storage := rookalpha.StorageSpec{
+		Nodes:    []rookalpha.Node{{Name: "node2", Config: rookalpha.Config{Location: "zone=z9"}}},
+		Topology: rookalpha.TopologySpec{Enabled: true},
+	}
+	controller := NewTopologyController(&clusterd.Context{Executor: executor}, "ns", storage)
+
+	node := func(name, zone string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			"failure-domain.beta.kubernetes.io/region": "r1",
+			"failure-domain.beta.kubernetes.io/zone":   zone,
+		}}}
+	}
+
+	// the host is not moved if the topology labels did not change
+	controller.onNodeUpdate(node("node1", "z1"), node("node1", "z1"))
+	assert.Equal(t, 0, len(moves))
+
+	// the host is moved to the new zone
+	controller.onNodeUpdate(node("node1", "z1"), node("node1", "z2"))
+	assert.Equal(t, []string{"node1 region=r1 zone=z2"}, moves)
+
+	// the zone configured for the node takes precedence over its labels
+	controller.onNodeUpdate(node("node2", "z1"), node("node2", "z2"))
+	assert.Equal(t, []string{"node1 region=r1 zone=z2", "node2 zone=z9 region=r1"}, moves)
+
+	// hosts without osds are not in the crush map
+	controller.onNodeUpdate(node("node3", "z1"), node("node3", "z2"))
+	assert.Equal(t, 2, len(moves))
+}
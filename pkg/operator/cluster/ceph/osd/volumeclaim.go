@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	volumeClaimSetAttr = "volume_claim_set"
+	volumeClaimAttr    = "volume_claim"
+	nodeNameEnvVarName = "ROOK_NODE_NAME"
+
+	// the claims are consumed as raw block devices at this path in the OSD container
+	blockDeviceVolume = "osd-block"
+	blockDevicePath   = "/dev/rook-osd-block"
+	volumeModeBlock   = "Block"
+)
+
+// createRawObject creates an object from its raw json. The volume mode of claims and the volume devices of containers
+// are not in the 1.8 API types, so the claims and the OSD deployments are created as raw objects.
+var createRawObject = func(client rest.Interface, namespace, resource string, raw []byte) error {
+	return client.Post().Namespace(namespace).Resource(resource).Body(raw).Do().Error()
+}
+
+// start an OSD deployment for each of the claims in the volume claim set. The claims are created from the
+// template if they do not exist yet.
+func (c *Cluster) startVolumeClaimSet(set *rookalpha.VolumeClaimSet) error {
+	if set.Name == "" {
+		return fmt.Errorf("volume claim set name is required")
+	}
+	if set.Count <= 0 {
+		logger.Warningf("volume claim set %s has a count of %d, no OSDs will be created for it", set.Name, set.Count)
+		return nil
+	}
+
+	resources := k8sutil.MergeResourceRequirements(set.Resources, c.resources)
+	for i := 0; i < set.Count; i++ {
+		claimName := volumeClaimName(set.Name, i)
+
+		claim, err := rawBlockVolumeClaim(c.makeVolumeClaim(claimName, set))
+		if err != nil {
+			return fmt.Errorf("failed to make osd volume claim %s. %+v", claimName, err)
+		}
+		err = createRawObject(c.context.Clientset.CoreV1().RESTClient(), c.Namespace, "persistentvolumeclaims", claim)
+		if err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create osd volume claim %s. %+v", claimName, err)
+			}
+			logger.Infof("osd volume claim %s already exists", claimName)
+		} else {
+			logger.Infof("osd volume claim %s created", claimName)
+		}
+
+		deployment, err := rawVolumeClaimDeployment(c.makeVolumeClaimDeployment(claimName, set.Name, resources, set.Config))
+		if err != nil {
+			return fmt.Errorf("failed to make osd deployment for volume claim %s. %+v", claimName, err)
+		}
+		err = createRawObject(c.context.Clientset.ExtensionsV1beta1().RESTClient(), c.Namespace, "deployments", deployment)
+		if err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create osd deployment for volume claim %s. %+v", claimName, err)
+			}
+			logger.Infof("osd deployment already exists for volume claim %s", claimName)
+		} else {
+			logger.Infof("osd deployment started for volume claim %s", claimName)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) makeVolumeClaim(claimName string, set *rookalpha.VolumeClaimSet) *v1.PersistentVolumeClaim {
+	claim := set.VolumeClaimTemplate.DeepCopy()
+	claim.ObjectMeta = metav1.ObjectMeta{
+		Name:            claimName,
+		Namespace:       c.Namespace,
+		Labels:          claim.Labels,
+		Annotations:     claim.Annotations,
+		OwnerReferences: []metav1.OwnerReference{c.ownerRef},
+	}
+	if claim.Labels == nil {
+		claim.Labels = map[string]string{}
+	}
+	claim.Labels[k8sutil.AppAttr] = appName
+	claim.Labels[k8sutil.ClusterAttr] = c.Namespace
+	claim.Labels[volumeClaimSetAttr] = set.Name
+	return claim
+}
+
+func (c *Cluster) makeVolumeClaimDeployment(claimName, setName string, resources v1.ResourceRequirements,
+	config rookalpha.Config) *extensions.Deployment {
+
+	podSpec := c.podTemplateSpec(nil, rookalpha.Selection{}, resources, config)
+	podSpec.Labels[volumeClaimSetAttr] = setName
+	podSpec.Labels[volumeClaimAttr] = claimName
+
+	// the OSD consumes the claim as a raw block device. The data dir is not kept on the host since the OSD follows
+	// its volume to other nodes. The OSD dir is restored from the config store of the claim when the pod moves.
+	for i := range podSpec.Spec.Volumes {
+		if podSpec.Spec.Volumes[i].Name == k8sutil.DataDirVolume {
+			podSpec.Spec.Volumes[i].VolumeSource = v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+		}
+	}
+	podSpec.Spec.Volumes = append(podSpec.Spec.Volumes, v1.Volume{
+		Name:         blockDeviceVolume,
+		VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName}},
+	})
+
+	// the OSD is not tied to a node. The claim name takes the place of the node name so the crush host
+	// and the OSD config store keep the same identity when the volume moves to another node.
+	// The topology labels are not read since the OSD has no node of its own.
+	container := &podSpec.Spec.Containers[0]
+	envVars := []v1.EnvVar{}
+	for _, env := range container.Env {
+		if env.Name == nodeNameEnvVarName {
+			env = v1.EnvVar{Name: nodeNameEnvVarName, Value: claimName}
+		} else if env.Name == k8sutil.TopologyLabelsEnvVar {
+			continue
+		}
+		envVars = append(envVars, env)
+	}
+	envVars = append(envVars, v1.EnvVar{Name: "ROOK_BLOCK_DEVICE_PATH", Value: blockDevicePath})
+	container.Env = envVars
+	privileged := true
+	container.SecurityContext.Privileged = &privileged
+
+	replicaCount := int32(1)
+	return &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            claimName,
+			Namespace:       c.Namespace,
+			OwnerReferences: []metav1.OwnerReference{c.ownerRef},
+			Labels: map[string]string{
+				k8sutil.AppAttr:     appName,
+				k8sutil.ClusterAttr: c.Namespace,
+				volumeClaimSetAttr:  setName,
+				volumeClaimAttr:     claimName,
+			},
+		},
+		Spec: extensions.DeploymentSpec{
+			Template: podSpec,
+			Replicas: &replicaCount,
+			// the claim can only be attached to one pod at a time, so the old pod must be gone before the new one starts
+			Strategy: extensions.DeploymentStrategy{Type: extensions.RecreateDeploymentStrategyType},
+		},
+	}
+}
+
+// rawBlockVolumeClaim returns the raw json of a claim in the block volume mode
+func rawBlockVolumeClaim(claim *v1.PersistentVolumeClaim) ([]byte, error) {
+	obj, err := toRawObject(claim, "v1", "PersistentVolumeClaim")
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("claim %s has no spec", claim.Name)
+	}
+	spec["volumeMode"] = volumeModeBlock
+	return json.Marshal(obj)
+}
+
+// rawVolumeClaimDeployment returns the raw json of an OSD deployment whose container has the block device of its claim
+func rawVolumeClaimDeployment(deployment *extensions.Deployment) ([]byte, error) {
+	obj, err := toRawObject(deployment, "extensions/v1beta1", "Deployment")
+	if err != nil {
+		return nil, err
+	}
+	spec, _ := obj["spec"].(map[string]interface{})
+	template, _ := spec["template"].(map[string]interface{})
+	podSpec, _ := template["spec"].(map[string]interface{})
+	containers, _ := podSpec["containers"].([]interface{})
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("deployment %s has no container", deployment.Name)
+	}
+	container := containers[0].(map[string]interface{})
+	container["volumeDevices"] = []map[string]string{{"name": blockDeviceVolume, "devicePath": blockDevicePath}}
+	return json.Marshal(obj)
+}
+
+func toRawObject(obj interface{}, apiVersion, kind string) (map[string]interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	result["apiVersion"] = apiVersion
+	result["kind"] = kind
+	return result, nil
+}
+
+func volumeClaimName(setName string, index int) string {
+	return fmt.Sprintf(appNameFmt, fmt.Sprintf("%s-%d", setName, index))
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbd for the Ceph rbd-mirror daemons.
+package rbd
+
+import (
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	opmon "github.com/rook/rook/pkg/operator/cluster/ceph/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-rbd-mirror")
+
+const (
+	appName     = "rook-ceph-rbd-mirror"
+	keyringName = "keyring"
+
+	// PeersSecretName is the secret with the config and keyrings of the peer clusters of the mirrored pools. The
+	// secret is mounted in the rbd-mirror pods where the daemons find the peer clusters by their names.
+	PeersSecretName = "rook-ceph-rbd-mirror-peers"
+	peersConfigDir  = "/etc/ceph"
+	peersVolumeName = "rook-ceph-rbd-mirror-peers"
+)
+
+// Mirroring is the manager of the rbd-mirror daemons
+type Mirroring struct {
+	Namespace   string
+	Version     string
+	Workers     int
+	placement   rookalpha.Placement
+	context     *clusterd.Context
+	HostNetwork bool
+	resources   v1.ResourceRequirements
+	ownerRef    metav1.OwnerReference
+}
+
+// New creates an instance of the rbd-mirror daemons
+func New(context *clusterd.Context, namespace, version string, spec rookalpha.RBDMirroringSpec, placement rookalpha.Placement,
+	hostNetwork bool, resources v1.ResourceRequirements, ownerRef metav1.OwnerReference) *Mirroring {
+	return &Mirroring{
+		context:     context,
+		Namespace:   namespace,
+		Version:     version,
+		Workers:     spec.Workers,
+		placement:   placement,
+		HostNetwork: hostNetwork,
+		resources:   resources,
+		ownerRef:    ownerRef,
+	}
+}
+
+// Start the rbd-mirror daemons and remove the daemons beyond the number of workers
+func (m *Mirroring) Start() error {
+	if m.Workers > 0 {
+		logger.Infof("start running %d rbd-mirror daemons", m.Workers)
+		if err := m.createPeersSecret(); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < m.Workers; i++ {
+		name := fmt.Sprintf("%s%d", appName, i)
+		if err := m.createKeyring(name); err != nil {
+			return fmt.Errorf("failed to create rbd-mirror keyring. %+v", err)
+		}
+
+		deployment := m.makeDeployment(name)
+		if _, err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.Namespace).Create(deployment); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create rbd-mirror deployment %s. %+v", name, err)
+			}
+			logger.Infof("%s deployment already exists", name)
+		} else {
+			logger.Infof("%s deployment started", name)
+		}
+	}
+
+	return m.removeExtraMirrors()
+}
+
+// removes the deployments of the rbd-mirror daemons beyond the number of workers
+func (m *Mirroring) removeExtraMirrors() error {
+	opts := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, appName)}
+	deployments, err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.Namespace).List(opts)
+	if err != nil {
+		return fmt.Errorf("failed to list rbd-mirror deployments. %+v", err)
+	}
+
+	wanted := map[string]bool{}
+	for i := 0; i < m.Workers; i++ {
+		wanted[fmt.Sprintf("%s%d", appName, i)] = true
+	}
+	for _, d := range deployments.Items {
+		if wanted[d.Name] {
+			continue
+		}
+		logger.Infof("removing rbd-mirror %s", d.Name)
+		if err := k8sutil.DeleteDeployment(m.context.Clientset, m.Namespace, d.Name); err != nil {
+			return fmt.Errorf("failed to remove rbd-mirror deployment %s. %+v", d.Name, err)
+		}
+	}
+	return nil
+}
+
+func (m *Mirroring) makeDeployment(name string) *extensions.Deployment {
+	optional := true
+	podSpec := v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      m.getLabels(),
+			Annotations: map[string]string{},
+		},
+		Spec: v1.PodSpec{
+			Containers:    []v1.Container{m.mirrorContainer(name)},
+			RestartPolicy: v1.RestartPolicyAlways,
+			Volumes: []v1.Volume{
+				{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: peersVolumeName, VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: PeersSecretName, Optional: &optional}}},
+				k8sutil.ConfigOverrideVolume(),
+			},
+			HostNetwork: m.HostNetwork,
+		},
+	}
+	if m.HostNetwork {
+		podSpec.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+	m.placement.ApplyToPodSpec(&podSpec.Spec)
+
+	replicas := int32(1)
+	return &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       m.Namespace,
+			Labels:          m.getLabels(),
+			OwnerReferences: []metav1.OwnerReference{m.ownerRef},
+		},
+		Spec: extensions.DeploymentSpec{Template: podSpec, Replicas: &replicas},
+	}
+}
+
+func (m *Mirroring) mirrorContainer(name string) v1.Container {
+	return v1.Container{
+		Args: []string{
+			"rbd-mirror",
+			fmt.Sprintf("--config-dir=%s", k8sutil.DataDir),
+		},
+		Name:  name,
+		Image: k8sutil.MakeRookImage(m.Version),
+		VolumeMounts: []v1.VolumeMount{
+			{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+			{Name: peersVolumeName, MountPath: peersConfigDir, ReadOnly: true},
+			k8sutil.ConfigOverrideMount(),
+		},
+		Env: []v1.EnvVar{
+			{Name: "ROOK_RBD_MIRROR_NAME", Value: name},
+			{Name: "ROOK_RBD_MIRROR_KEYRING", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: keyringName}}},
+			k8sutil.PodIPEnvVar(k8sutil.PrivateIPEnvVar),
+			k8sutil.PodIPEnvVar(k8sutil.PublicIPEnvVar),
+			opmon.ClusterNameEnvVar(m.Namespace),
+			opmon.EndpointEnvVar(),
+			opmon.SecretEnvVar(),
+			opmon.AdminSecretEnvVar(),
+			k8sutil.ConfigOverrideEnvVar(),
+		},
+		Resources: m.resources,
+	}
+}
+
+func (m *Mirroring) getLabels() map[string]string {
+	return map[string]string{
+		k8sutil.AppAttr:     appName,
+		k8sutil.ClusterAttr: m.Namespace,
+	}
+}
+
+// creates the secret for the config of the peer clusters, which the pool controller fills in as peers are added
+func (m *Mirroring) createPeersSecret() error {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            PeersSecretName,
+			Namespace:       m.Namespace,
+			OwnerReferences: []metav1.OwnerReference{m.ownerRef},
+		},
+		Type: k8sutil.RookType,
+	}
+	if _, err := m.context.Clientset.CoreV1().Secrets(m.Namespace).Create(secret); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create rbd-mirror peers secret. %+v", err)
+	}
+	return nil
+}
+
+func (m *Mirroring) createKeyring(name string) error {
+	_, err := m.context.Clientset.CoreV1().Secrets(m.Namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		logger.Infof("the rbd-mirror keyring %s was already generated", name)
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get rbd-mirror secrets. %+v", err)
+	}
+
+	// get-or-create-key for the user account
+	username, access := getKeyringProperties(name)
+	keyring, err := client.AuthGetOrCreateKey(m.context, m.Namespace, username, access)
+	if err != nil {
+		return fmt.Errorf("failed to get or create auth key for %s. %+v", username, err)
+	}
+
+	// Store the keyring in a secret
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       m.Namespace,
+			OwnerReferences: []metav1.OwnerReference{m.ownerRef},
+		},
+		StringData: map[string]string{keyringName: keyring},
+		Type:       k8sutil.RookType,
+	}
+	_, err = m.context.Clientset.CoreV1().Secrets(m.Namespace).Create(secret)
+	if err != nil {
+		return fmt.Errorf("failed to save rbd-mirror secrets. %+v", err)
+	}
+
+	return nil
+}
+
+func getKeyringProperties(name string) (string, []string) {
+	username := fmt.Sprintf("client.%s", name)
+	access := []string{"mon", "profile rbd", "osd", "profile rbd"}
+	return username, access
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rbd
+
+import (
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStartMirrors(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return `{"key":"mysecurekey"}`, nil
+		},
+	}
+	clientset := testop.New(3)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	// no daemons are started without workers
+	m := New(context, "ns", "myversion", rookalpha.RBDMirroringSpec{}, rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	err := m.Start()
+	assert.Nil(t, err)
+	deployments, _ := clientset.ExtensionsV1beta1().Deployments("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 0, len(deployments.Items))
+
+	// a deployment is started for each worker with the peers secret mounted
+	m.Workers = 2
+	err = m.Start()
+	assert.Nil(t, err)
+	deployments, _ = clientset.ExtensionsV1beta1().Deployments("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 2, len(deployments.Items))
+	d, err := clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-rbd-mirror1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "rbd-mirror", d.Spec.Template.Spec.Containers[0].Args[0])
+	assert.Equal(t, PeersSecretName, d.Spec.Template.Spec.Volumes[1].Secret.SecretName)
+	assert.Equal(t, "/etc/ceph", d.Spec.Template.Spec.Containers[0].VolumeMounts[1].MountPath)
+	_, err = clientset.CoreV1().Secrets("ns").Get(PeersSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	_, err = clientset.CoreV1().Secrets("ns").Get("rook-ceph-rbd-mirror1", metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// the daemons beyond the workers are removed
+	m.Workers = 1
+	err = m.Start()
+	assert.Nil(t, err)
+	deployments, _ = clientset.ExtensionsV1beta1().Deployments("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 1, len(deployments.Items))
+	assert.Equal(t, "rook-ceph-rbd-mirror0", deployments.Items[0].Name)
+}
@@ -33,6 +33,8 @@ import (
 	"github.com/rook/rook/pkg/operator/cluster/ceph/mgr"
 	"github.com/rook/rook/pkg/operator/cluster/ceph/mon"
 	"github.com/rook/rook/pkg/operator/cluster/ceph/osd"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/rbd"
+	"github.com/rook/rook/pkg/operator/crush"
 	"github.com/rook/rook/pkg/operator/file"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/operator/object"
@@ -59,8 +61,6 @@ const (
 )
 
 const (
-	// DefaultClusterName states the default name of the rook-cluster if not provided.
-	DefaultClusterName         = "rook"
 	clusterDeleteRetryInterval = 2 //seconds
 	clusterDeleteMaxRetries    = 15
 )
@@ -85,18 +85,21 @@ type ClusterController struct {
 	volumeAttachment attachment.Attachment
 	devicesInUse     bool
 	rookImage        string
+	clusterMap       map[string]*cluster
 }
 
 type cluster struct {
-	context   *clusterd.Context
-	Namespace string
-	Spec      rookalpha.ClusterSpec
-	mons      *mon.Cluster
-	mgrs      *mgr.Cluster
-	osds      *osd.Cluster
-	apis      *api.Cluster
-	stopCh    chan struct{}
-	ownerRef  metav1.OwnerReference
+	context    *clusterd.Context
+	Namespace  string
+	Spec       rookalpha.ClusterSpec
+	mons       *mon.Cluster
+	mgrs       *mgr.Cluster
+	osds       *osd.Cluster
+	apis       *api.Cluster
+	mirrors    *rbd.Mirroring
+	osdMonitor *osd.Monitor
+	stopCh     chan struct{}
+	ownerRef   metav1.OwnerReference
 }
 
 // NewClusterController create controller for watching cluster custom resources created
@@ -105,6 +108,7 @@ func NewClusterController(context *clusterd.Context, rookImage string, volumeAtt
 		context:          context,
 		volumeAttachment: volumeAttachment,
 		rookImage:        rookImage,
+		clusterMap:       make(map[string]*cluster),
 	}
 }
 
@@ -176,10 +180,30 @@ func (c *ClusterController) onAdd(obj interface{}) {
 	fileController := file.NewFilesystemController(c.context, c.rookImage, cluster.Spec.HostNetwork, cluster.ownerRef)
 	fileController.StartWatch(cluster.Namespace, cluster.stopCh)
 
+	// Start crush map CRD watcher
+	crushMapController := crush.NewCrushMapController(c.context)
+	crushMapController.StartWatch(cluster.Namespace, cluster.stopCh)
+
 	// Start mon health checker
 	healthChecker := mon.NewHealthChecker(cluster.mons)
 	go healthChecker.Check(cluster.stopCh)
 
+	// Start the osd health monitor
+	cluster.osdMonitor = osd.NewMonitor(c.context, cluster.Namespace, cluster.Spec.Storage)
+	go cluster.osdMonitor.Run(cluster.stopCh)
+	c.clusterMap[cluster.Namespace] = cluster
+
+	if cluster.Spec.Storage.Topology.Enabled {
+		// Start the watcher of the node topology labels
+		topologyController := osd.NewTopologyController(c.context, cluster.Namespace, cluster.Spec.Storage)
+		go topologyController.Run(cluster.stopCh)
+	}
+
+	if storeMigrationInProgress(clust) {
+		// resume the migration of the osds that was interrupted
+		go c.migrateStore(clust)
+	}
+
 	// add the finalizer to the crd
 	err = c.addFinalizer(clust)
 	if err != nil {
@@ -204,6 +228,20 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 		}
 		// remove the finalizer from the crd, which indicates to k8s that the resource can safely be deleted
 		c.removeFinalizer(newClust)
+		delete(c.clusterMap, newClust.Namespace)
+		return
+	}
+
+	if cluster, ok := c.clusterMap[newClust.Namespace]; ok && osdHealthChanged(oldClust.Spec.Storage, newClust.Spec.Storage) {
+		// the osd monitor keeps running with the settings of the updated cluster
+		logger.Infof("updating the osd health settings of cluster %s", newClust.Namespace)
+		cluster.Spec.Storage = newClust.Spec.Storage
+		cluster.osdMonitor.Update(newClust.Spec.Storage)
+	}
+
+	if storeMigrationRequested(oldClust.Spec, newClust.Spec) && !storeMigrationInProgress(newClust) {
+		logger.Infof("store type of cluster %s changed to %s", newClust.Namespace, bluestore)
+		go c.migrateStore(newClust)
 		return
 	}
 
@@ -212,9 +250,16 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	logger.Infof("updating cluster %s", newClust.Namespace)
-	cluster := newCluster(newClust, c.context)
-	if err := cluster.createInstance(c.rookImage); err != nil {
+	cluster, ok := c.clusterMap[newClust.Namespace]
+	if !ok {
+		logger.Warningf("cluster %s is not running, not updating it", newClust.Namespace)
+		return
+	}
+
+	// only the rbd-mirror daemons are updated, the other daemons of the running cluster are left as they are
+	logger.Infof("updating the rbd-mirror daemons of cluster %s", newClust.Namespace)
+	cluster.Spec.RBDMirroring = newClust.Spec.RBDMirroring
+	if err := cluster.startMirrors(c.rookImage); err != nil {
 		logger.Errorf("failed to update cluster in namespace %s. %+v", newClust.Namespace, err)
 	}
 }
@@ -225,6 +270,7 @@ func (c *ClusterController) onDelete(obj interface{}) {
 	if err != nil {
 		logger.Errorf("failed to delete cluster. %+v", err)
 	}
+	delete(c.clusterMap, clust.Namespace)
 }
 
 func (c *ClusterController) addFinalizer(clust *rookalpha.Cluster) error {
@@ -402,10 +448,25 @@ func (c *cluster) createInstance(rookImage string) error {
 		return fmt.Errorf("failed to start the osds. %+v", err)
 	}
 
+	// Start the rbd-mirror daemons
+	err = c.startMirrors(rookImage)
+	if err != nil {
+		return err
+	}
+
 	logger.Infof("Done creating rook instance in namespace %s", c.Namespace)
 	return nil
 }
 
+// starts the rbd-mirror daemons for the mirroring settings of the cluster and removes the extra daemons
+func (c *cluster) startMirrors(rookImage string) error {
+	c.mirrors = rbd.New(c.context, c.Namespace, rookImage, c.Spec.RBDMirroring, c.Spec.Placement.GetRBDMirror(), c.Spec.HostNetwork, c.Spec.Resources.RBDMirror, c.ownerRef)
+	if err := c.mirrors.Start(); err != nil {
+		return fmt.Errorf("failed to start the rbd-mirror daemons. %+v", err)
+	}
+	return nil
+}
+
 func (c *cluster) createInitialCrushMap() error {
 	configMapExists := false
 	createCrushMap := false
@@ -465,7 +526,16 @@ func (c *cluster) createInitialCrushMap() error {
 	return nil
 }
 
+// whether the settings of the osd monitor changed
+func osdHealthChanged(oldStorage, newStorage rookalpha.StorageSpec) bool {
+	return oldStorage.DeviceHealth != newStorage.DeviceHealth || oldStorage.RecoveryPolicy != newStorage.RecoveryPolicy
+}
+
 func clusterChanged(oldCluster, newCluster rookalpha.ClusterSpec) bool {
-	// no updates to the cluster supported yet
+	// only the number of rbd-mirror daemons can be updated
+	if oldCluster.RBDMirroring != newCluster.RBDMirroring {
+		logger.Infof("rbd mirroring workers changed from %d to %d", oldCluster.RBDMirroring.Workers, newCluster.RBDMirroring.Workers)
+		return true
+	}
 	return false
 }
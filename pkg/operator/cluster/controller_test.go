@@ -58,8 +58,75 @@ func TestClusterChanged(t *testing.T) {
 	old := rookalpha.ClusterSpec{MonCount: 1, HostNetwork: false}
 	new := rookalpha.ClusterSpec{MonCount: 3, HostNetwork: true}
 
-	// no changes supported yet
+	// the mons and the network cannot be changed
 	assert.False(t, clusterChanged(old, new))
+
+	// the number of rbd-mirror daemons can be changed
+	new.RBDMirroring.Workers = 2
+	assert.True(t, clusterChanged(old, new))
+}
+
+func TestOSDHealthChanged(t *testing.T) {
+	old := rookalpha.StorageSpec{}
+	new := rookalpha.StorageSpec{}
+	assert.False(t, osdHealthChanged(old, new))
+
+	// the osd monitor is updated with the recovery policy and the device health settings
+	new.RecoveryPolicy.MaxRestartAttempts = 5
+	assert.True(t, osdHealthChanged(old, new))
+	new = rookalpha.StorageSpec{DeviceHealth: rookalpha.DeviceHealthSpec{MarkOutOnPredictedFailure: true}}
+	assert.True(t, osdHealthChanged(old, new))
+}
+
+func TestUpdateRBDMirroring(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return `{"key":"mysecurekey"}`, nil
+		},
+	}
+	clientset := testop.New(3)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	c := NewClusterController(context, "myversion", &attachment.MockAttachment{})
+
+	old := &rookalpha.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "ns"}, Spec: rookalpha.ClusterSpec{MonCount: 3}}
+	new := old.DeepCopy()
+	new.Spec.RBDMirroring.Workers = 2
+
+	// a cluster that is not running is not updated
+	c.onUpdate(old, new)
+	deployments, _ := clientset.ExtensionsV1beta1().Deployments("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 0, len(deployments.Items))
+
+	// only the rbd-mirror daemons of the running cluster are started
+	c.clusterMap["ns"] = newCluster(old, context)
+	c.onUpdate(old, new)
+	deployments, _ = clientset.ExtensionsV1beta1().Deployments("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 2, len(deployments.Items))
+	for _, d := range deployments.Items {
+		assert.Equal(t, "rbd-mirror", d.Spec.Template.Spec.Containers[0].Args[0])
+	}
+	assert.Equal(t, 2, c.clusterMap["ns"].Spec.RBDMirroring.Workers)
+	assert.Equal(t, 3, c.clusterMap["ns"].Spec.MonCount)
+}
+
+func TestStoreMigrationRequested(t *testing.T) {
+	old := rookalpha.ClusterSpec{}
+	new := rookalpha.ClusterSpec{}
+	old.Storage.StoreConfig.StoreType = "filestore"
+	assert.False(t, storeMigrationRequested(old, new))
+
+	// only a change from filestore to bluestore starts a migration
+	new.Storage.StoreConfig.StoreType = "bluestore"
+	assert.True(t, storeMigrationRequested(old, new))
+	assert.False(t, storeMigrationRequested(new, old))
+
+	// a migration that is in progress is resumed
+	clust := &rookalpha.Cluster{Spec: new}
+	assert.False(t, storeMigrationInProgress(clust))
+	clust.Status.StoreMigration = &rookalpha.StoreMigrationStatus{State: rookalpha.StoreMigrationInProgress}
+	assert.True(t, storeMigrationInProgress(clust))
+	clust.Status.StoreMigration.State = rookalpha.StoreMigrationCompleted
+	assert.False(t, storeMigrationInProgress(clust))
 }
 
 func TestClusterDelete(t *testing.T) {
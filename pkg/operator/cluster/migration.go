@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/osd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	filestore = "filestore"
+	bluestore = "bluestore"
+)
+
+// determines if the store type of the cluster was changed from filestore to bluestore
+func storeMigrationRequested(oldCluster, newCluster rookalpha.ClusterSpec) bool {
+	return oldCluster.Storage.Config.StoreConfig.StoreType == filestore &&
+		newCluster.Storage.Config.StoreConfig.StoreType == bluestore
+}
+
+// determines if a migration was interrupted, for example by a restart of the operator
+func storeMigrationInProgress(clust *rookalpha.Cluster) bool {
+	return clust.Status.StoreMigration != nil && clust.Status.StoreMigration.State == rookalpha.StoreMigrationInProgress
+}
+
+// migrates the osds of the cluster to bluestore one at a time, reporting the progress in the cluster status
+func (c *ClusterController) migrateStore(clust *rookalpha.Cluster) {
+	status := clust.Status.StoreMigration.DeepCopy()
+	if status == nil || status.State != rookalpha.StoreMigrationInProgress {
+		// start a new migration
+		status = &rookalpha.StoreMigrationStatus{CurrentOSD: -1}
+	}
+
+	updateStatus := func(status *rookalpha.StoreMigrationStatus) error {
+		return c.updateStoreMigrationStatus(clust.Namespace, clust.Name, status)
+	}
+
+	if clust.Spec.DataDirHostPath == "" {
+		status.State = rookalpha.StoreMigrationFailed
+		status.Message = "dataDirHostPath must be set to migrate the osds"
+		logger.Errorf("cannot migrate the osds in namespace %s. %s", clust.Namespace, status.Message)
+		if err := updateStatus(status); err != nil {
+			logger.Warningf("failed to update the migration status. %+v", err)
+		}
+		return
+	}
+
+	logger.Infof("migrating the osds in namespace %s to %s", clust.Namespace, bluestore)
+	osds := osd.New(c.context, clust.Namespace, c.rookImage, clust.Spec.Storage, clust.Spec.DataDirHostPath,
+		clust.Spec.Placement.GetOSD(), clust.Spec.HostNetwork, clust.Spec.Resources.OSD, ClusterOwnerRef(clust.Namespace, string(clust.UID)))
+	if err := osds.MigrateToBluestore(status, updateStatus); err != nil {
+		logger.Errorf("failed to migrate the osds in namespace %s. %+v", clust.Namespace, err)
+	}
+}
+
+// saves the migration status in the cluster crd. the latest crd is retrieved so the update does not conflict
+// with other changes to the crd.
+func (c *ClusterController) updateStoreMigrationStatus(namespace, name string, status *rookalpha.StoreMigrationStatus) error {
+	clust, err := c.context.RookClientset.RookV1alpha1().Clusters(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get cluster %s. %+v", name, err)
+	}
+
+	clust.Status.StoreMigration = status.DeepCopy()
+	if _, err := c.context.RookClientset.RookV1alpha1().Clusters(namespace).Update(clust); err != nil {
+		return fmt.Errorf("failed to update the status of cluster %s. %+v", name, err)
+	}
+
+	return nil
+}
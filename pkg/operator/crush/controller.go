@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crush to manage the crush map of a rook cluster.
+package crush
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/coreos/pkg/capnslog"
+	opkit "github.com/rook/operator-kit"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	customResourceName       = "crushmap"
+	customResourceNamePlural = "crushmaps"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-crush")
+
+// CrushMapResource represents the CrushMap custom resource object
+var CrushMapResource = opkit.CustomResource{
+	Name:    customResourceName,
+	Plural:  customResourceNamePlural,
+	Group:   rookalpha.CustomResourceGroup,
+	Version: rookalpha.Version,
+	Scope:   apiextensionsv1beta1.NamespaceScoped,
+	Kind:    reflect.TypeOf(rookalpha.CrushMap{}).Name(),
+}
+
+// CrushMapController represents a controller object for crush map custom resources
+type CrushMapController struct {
+	context *clusterd.Context
+}
+
+// NewCrushMapController create controller for watching crush map custom resources created
+func NewCrushMapController(context *clusterd.Context) *CrushMapController {
+	return &CrushMapController{
+		context: context,
+	}
+}
+
+// StartWatch watches for instances of CrushMap custom resources and acts on them
+func (c *CrushMapController) StartWatch(namespace string, stopCh chan struct{}) error {
+
+	resourceHandlerFuncs := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+		DeleteFunc: c.onDelete,
+	}
+
+	logger.Infof("start watching crush map resources in namespace %s", namespace)
+	watcher := opkit.NewWatcher(CrushMapResource, namespace, resourceHandlerFuncs, c.context.RookClientset.Rook().RESTClient())
+	go watcher.Watch(&rookalpha.CrushMap{}, stopCh)
+	return nil
+}
+
+func (c *CrushMapController) onAdd(obj interface{}) {
+	crushMap := obj.(*rookalpha.CrushMap).DeepCopy()
+	c.reconcile(crushMap)
+}
+
+func (c *CrushMapController) onUpdate(oldObj, newObj interface{}) {
+	oldCrushMap := oldObj.(*rookalpha.CrushMap)
+	crushMap := newObj.(*rookalpha.CrushMap).DeepCopy()
+
+	// the status updates of the operator do not change the spec
+	if reflect.DeepEqual(oldCrushMap.Spec, crushMap.Spec) {
+		logger.Debugf("crush map %s not changed", crushMap.Name)
+		return
+	}
+
+	logger.Infof("updating crush map %s", crushMap.Name)
+	c.reconcile(crushMap)
+}
+
+func (c *CrushMapController) onDelete(obj interface{}) {
+	crushMap := obj.(*rookalpha.CrushMap)
+	logger.Infof("crush map %s deleted. the buckets, rules, and weights of the cluster are not changed.", crushMap.Name)
+}
+
+// computes the changes to the crush map of the cluster and applies them unless only a preview is requested.
+// the result is reported in the status of the crush map resource.
+func (c *CrushMapController) reconcile(crushMap *rookalpha.CrushMap) {
+	status := Reconcile(c.context, crushMap.Namespace, &crushMap.Spec)
+	if status.State == rookalpha.CrushMapFailed {
+		logger.Errorf("failed to reconcile crush map %s. %s", crushMap.Name, status.Message)
+	}
+
+	if err := c.updateStatus(crushMap.Namespace, crushMap.Name, status); err != nil {
+		logger.Errorf("failed to update the status of crush map %s. %+v", crushMap.Name, err)
+	}
+}
+
+// Reconcile validates the crush map spec and computes the changes to the crush map of the cluster. The changes are
+// applied in order unless the spec only requests a preview.
+func Reconcile(context *clusterd.Context, namespace string, spec *rookalpha.CrushMapSpec) *rookalpha.CrushMapStatus {
+	status := &rookalpha.CrushMapStatus{Changes: []string{}}
+	changes, err := planChanges(context, namespace, spec)
+	if err != nil {
+		status.State = rookalpha.CrushMapFailed
+		status.Message = fmt.Sprintf("invalid crush map. %+v", err)
+		return status
+	}
+
+	for _, change := range changes {
+		status.Changes = append(status.Changes, change.description)
+	}
+	if spec.Preview {
+		status.State = rookalpha.CrushMapPreview
+		status.Message = fmt.Sprintf("%d changes to apply", len(changes))
+		return status
+	}
+
+	for _, change := range changes {
+		logger.Infof("crush map change: %s", change.description)
+		if err := change.apply(); err != nil {
+			status.State = rookalpha.CrushMapFailed
+			status.Message = fmt.Sprintf("failed to %s. %+v", change.description, err)
+			return status
+		}
+	}
+
+	status.State = rookalpha.CrushMapApplied
+	status.Message = fmt.Sprintf("%d changes applied", len(changes))
+	return status
+}
+
+// saves the status in the crush map resource. the latest resource is retrieved so the update does not conflict.
+func (c *CrushMapController) updateStatus(namespace, name string, status *rookalpha.CrushMapStatus) error {
+	crushMap, err := c.context.RookClientset.RookV1alpha1().CrushMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get crush map %s. %+v", name, err)
+	}
+
+	crushMap.Status = *status
+	if _, err := c.context.RookClientset.RookV1alpha1().CrushMaps(namespace).Update(crushMap); err != nil {
+		return fmt.Errorf("failed to update crush map %s. %+v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crush
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// a root with one host that holds osd.0 with a weight of 1
+const testCrushDump = `{
+	"devices": [{"id": 0, "name": "osd.0"}],
+	"types": [{"type_id": 0, "name": "osd"}, {"type_id": 1, "name": "host"}, {"type_id": 8, "name": "datacenter"}, {"type_id": 11, "name": "root"}],
+	"buckets": [
+		{"id": -1, "name": "default", "type_id": 11, "type_name": "root", "items": [{"id": -2, "weight": 65536}]},
+		{"id": -2, "name": "node1", "type_id": 1, "type_name": "host", "items": [{"id": 0, "weight": 65536}]}
+	],
+	"rules": [
+		{"rule_id": 0, "rule_name": "replicated_ruleset", "type": 1, "steps": [
+			{"op": "take", "item": -1, "item_name": "default"},
+			{"op": "chooseleaf_firstn", "num": 0, "type": "host"},
+			{"op": "emit"}
+		]}
+	]
+}`
+
+func newTestContext(commands *[]string) *clusterd.Context {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[1] == "crush" && args[2] == "dump" {
+				return testCrushDump, nil
+			}
+			if args[1] == "crush" && args[2] == "show-tunables" {
+				return `{"profile": "firefly"}`, nil
+			}
+			// record the command without the connection args
+			for i, arg := range args {
+				if strings.HasPrefix(arg, "--") {
+					args = args[:i]
+					break
+				}
+			}
+			*commands = append(*commands, strings.Join(args, " "))
+			return "", nil
+		},
+	}
+	return &clusterd.Context{Executor: executor}
+}
+
+func TestCrushMapPreview(t *testing.T) {
+	commands := []string{}
+	context := newTestContext(&commands)
+
+	spec := &rookalpha.CrushMapSpec{
+		Tunables: "hammer",
+		Buckets:  []rookalpha.CrushBucketSpec{{Name: "dc1", Type: "datacenter"}, {Name: "node1", Type: "host", Parent: "dc1"}},
+		Rules: []rookalpha.CrushRuleSpec{
+			{Name: "replicated_ruleset", Steps: []rookalpha.CrushRuleStep{{Op: "take", Item: "default"}, {Op: "chooseleaf", Type: "host"}, {Op: "emit"}}},
+			{Name: "two_dc", Steps: []rookalpha.CrushRuleStep{
+				{Op: "take", Item: "dc1"}, {Op: "chooseleaf", Count: 2, Type: "host"}, {Op: "emit"},
+			}},
+		},
+		OSDWeights: []rookalpha.OSDWeightSpec{{ID: 0, Weight: 0.5}},
+		Preview:    true,
+	}
+
+	// the changes are reported without running any commands
+	status := Reconcile(context, "ns", spec)
+	assert.Equal(t, rookalpha.CrushMapPreview, status.State, status.Message)
+	assert.Equal(t, []string{
+		"set tunables from firefly to hammer",
+		"add bucket dc1 of type datacenter under default",
+		"move bucket node1 from default to dc1",
+		"add rule two_dc: take dc1, chooseleaf firstn 2 type host, emit",
+		"set the weight of osd.0 from 1.00000 to 0.50000",
+	}, status.Changes)
+	assert.Equal(t, 0, len(commands))
+}
+
+func TestCrushMapApply(t *testing.T) {
+	commands := []string{}
+	context := newTestContext(&commands)
+
+	spec := &rookalpha.CrushMapSpec{
+		Buckets:    []rookalpha.CrushBucketSpec{{Name: "dc1", Type: "datacenter"}},
+		OSDWeights: []rookalpha.OSDWeightSpec{{ID: 0, Weight: 1}},
+	}
+	status := Reconcile(context, "ns", spec)
+	assert.Equal(t, rookalpha.CrushMapApplied, status.State, status.Message)
+	assert.Equal(t, 1, len(status.Changes))
+	assert.Equal(t, []string{"osd crush add-bucket dc1 datacenter", "osd crush move dc1 root=default"}, commands)
+}
+
+func TestCrushMapValidation(t *testing.T) {
+	commands := []string{}
+	context := newTestContext(&commands)
+
+	invalid := []rookalpha.CrushMapSpec{
+		{Tunables: "newest"},
+		{Buckets: []rookalpha.CrushBucketSpec{{Name: "dc1", Type: "zone"}}},
+		{Buckets: []rookalpha.CrushBucketSpec{{Name: "node1", Type: "datacenter"}}},
+		{Buckets: []rookalpha.CrushBucketSpec{{Name: "dc1", Type: "datacenter", Parent: "node1"}}},
+		{Buckets: []rookalpha.CrushBucketSpec{{Name: "dc1", Type: "datacenter", Parent: "dc0"}}},
+		{Rules: []rookalpha.CrushRuleSpec{{Name: "r1", Steps: []rookalpha.CrushRuleStep{{Op: "chooseleaf", Type: "host"}, {Op: "emit"}}}}},
+		{Rules: []rookalpha.CrushRuleSpec{{Name: "r1", Steps: []rookalpha.CrushRuleStep{{Op: "take", Item: "dc1"}, {Op: "emit"}}}}},
+		{Rules: []rookalpha.CrushRuleSpec{{Name: "r1", Type: "other", Steps: []rookalpha.CrushRuleStep{{Op: "take", Item: "default"}, {Op: "emit"}}}}},
+		{OSDWeights: []rookalpha.OSDWeightSpec{{ID: 5, Weight: 1}}},
+	}
+	for i, spec := range invalid {
+		status := Reconcile(context, "ns", &spec)
+		assert.Equal(t, rookalpha.CrushMapFailed, status.State, fmt.Sprintf("spec %d", i))
+		assert.Equal(t, 0, len(status.Changes))
+	}
+	assert.Equal(t, 0, len(commands))
+}
@@ -0,0 +1,353 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crush
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+const (
+	defaultRoot     = "default"
+	replicatedRule  = "replicated"
+	erasureRule     = "erasure"
+	crushWeightUnit = 0x10000
+)
+
+var (
+	tunablesProfiles = []string{"legacy", "argonaut", "bobtail", "firefly", "hammer", "jewel", "optimal", "default"}
+	ruleTypes        = map[string]int{replicatedRule: 1, erasureRule: 3}
+)
+
+// a change to the crush map and how to apply it
+type crushChange struct {
+	description string
+	apply       func() error
+}
+
+// validates the spec against the current crush map of the cluster and returns the changes needed for the crush map
+// to match the spec. Buckets, rules, and osds that are not in the spec are not changed.
+func planChanges(context *clusterd.Context, namespace string, spec *rookalpha.CrushMapSpec) ([]crushChange, error) {
+	crushMap, err := client.GetCrushMap(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	current := newCrushState(crushMap)
+
+	changes := []crushChange{}
+	if spec.Tunables != "" {
+		change, err := planTunables(context, namespace, spec.Tunables)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	bucketChanges, err := planBuckets(context, namespace, current, spec.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, bucketChanges...)
+
+	ruleChanges, err := planRules(context, namespace, current, spec.Rules)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, ruleChanges...)
+
+	weightChanges, err := planOSDWeights(context, namespace, current, spec.OSDWeights)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, weightChanges...)
+
+	return changes, nil
+}
+
+func planTunables(context *clusterd.Context, namespace, profile string) (*crushChange, error) {
+	valid := false
+	for _, p := range tunablesProfiles {
+		if p == profile {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("unknown tunables profile %s", profile)
+	}
+
+	currentProfile, err := client.GetCrushTunablesProfile(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if currentProfile == profile {
+		return nil, nil
+	}
+
+	return &crushChange{
+		description: fmt.Sprintf("set tunables from %s to %s", currentProfile, profile),
+		apply: func() error {
+			_, err := client.SetCrushTunables(context, namespace, profile)
+			return err
+		},
+	}, nil
+}
+
+func planBuckets(context *clusterd.Context, namespace string, current *crushState, buckets []rookalpha.CrushBucketSpec) ([]crushChange, error) {
+	changes := []crushChange{}
+	for _, b := range buckets {
+		if b.Name == "" {
+			return nil, fmt.Errorf("missing bucket name")
+		}
+		typeID, ok := current.types[b.Type]
+		if !ok || typeID == 0 {
+			return nil, fmt.Errorf("bucket %s has an invalid type %s", b.Name, b.Type)
+		}
+		if existingType, ok := current.bucketTypes[b.Name]; ok && existingType != b.Type {
+			return nil, fmt.Errorf("bucket %s already exists with type %s", b.Name, existingType)
+		}
+
+		parent := b.Parent
+		if parent == "" {
+			parent = defaultRoot
+		}
+		// the parent must already exist or be declared before the bucket
+		parentType, ok := current.bucketTypes[parent]
+		if !ok {
+			return nil, fmt.Errorf("parent %s of bucket %s not found", parent, b.Name)
+		}
+		if current.types[parentType] <= typeID {
+			return nil, fmt.Errorf("bucket %s of type %s cannot be placed under %s of type %s", b.Name, b.Type, parent, parentType)
+		}
+
+		name := b.Name
+		bucketType := b.Type
+		location := []string{fmt.Sprintf("%s=%s", parentType, parent)}
+		currentParent, exists := current.bucketParents[name]
+		if !exists {
+			changes = append(changes, crushChange{
+				description: fmt.Sprintf("add bucket %s of type %s under %s", name, bucketType, parent),
+				apply: func() error {
+					if err := client.CrushAddBucket(context, namespace, name, bucketType); err != nil {
+						return err
+					}
+					return client.CrushMoveBucket(context, namespace, name, location)
+				},
+			})
+		} else if currentParent != parent {
+			changes = append(changes, crushChange{
+				description: fmt.Sprintf("move bucket %s from %s to %s", name, currentParent, parent),
+				apply: func() error {
+					return client.CrushMoveBucket(context, namespace, name, location)
+				},
+			})
+		}
+
+		// the following buckets can be placed under this bucket
+		current.bucketTypes[name] = bucketType
+		current.bucketParents[name] = parent
+	}
+
+	return changes, nil
+}
+
+func planRules(context *clusterd.Context, namespace string, current *crushState, rules []rookalpha.CrushRuleSpec) ([]crushChange, error) {
+	changes := []crushChange{}
+	names := map[string]bool{}
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("missing rule name")
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %s is declared more than once", r.Name)
+		}
+		names[r.Name] = true
+
+		ruleType := r.Type
+		if ruleType == "" {
+			ruleType = replicatedRule
+		}
+		if _, ok := ruleTypes[ruleType]; !ok {
+			return nil, fmt.Errorf("rule %s has an invalid type %s", r.Name, ruleType)
+		}
+
+		steps, err := formatRuleSteps(current, r.Name, ruleType, r.Steps)
+		if err != nil {
+			return nil, err
+		}
+
+		name := r.Name
+		existing, exists := current.rules[name]
+		if exists && existing.ruleType == ruleTypes[ruleType] && reflect.DeepEqual(existing.steps, steps) {
+			continue
+		}
+
+		description := fmt.Sprintf("add rule %s: %s", name, strings.Join(steps, ", "))
+		if exists {
+			description = fmt.Sprintf("update rule %s from %s to %s", name, strings.Join(existing.steps, ", "), strings.Join(steps, ", "))
+		}
+		changes = append(changes, crushChange{
+			description: description,
+			apply: func() error {
+				return client.SetCrushRule(context, namespace, name, ruleType, steps)
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+// validates the steps of the rule and formats them as they are written in the decompiled crush map
+func formatRuleSteps(current *crushState, name, ruleType string, steps []rookalpha.CrushRuleStep) ([]string, error) {
+	if len(steps) == 0 || steps[0].Op != "take" || steps[len(steps)-1].Op != "emit" {
+		return nil, fmt.Errorf("rule %s must start with a take step and end with an emit step", name)
+	}
+
+	// erasure coded pools need the chunks at the same position in the chosen buckets
+	mode := "firstn"
+	if ruleType == erasureRule {
+		mode = "indep"
+	}
+
+	result := []string{}
+	for i, step := range steps {
+		switch step.Op {
+		case "take":
+			if _, ok := current.bucketTypes[step.Item]; !ok {
+				return nil, fmt.Errorf("step %d of rule %s takes an unknown bucket %s", i, name, step.Item)
+			}
+			result = append(result, fmt.Sprintf("take %s", step.Item))
+		case "choose", "chooseleaf":
+			if _, ok := current.types[step.Type]; !ok {
+				return nil, fmt.Errorf("step %d of rule %s chooses an unknown type %s", i, name, step.Type)
+			}
+			result = append(result, fmt.Sprintf("%s %s %d type %s", step.Op, mode, step.Count, step.Type))
+		case "emit":
+			result = append(result, "emit")
+		default:
+			return nil, fmt.Errorf("step %d of rule %s has an unknown op %s", i, name, step.Op)
+		}
+	}
+	return result, nil
+}
+
+func planOSDWeights(context *clusterd.Context, namespace string, current *crushState, weights []rookalpha.OSDWeightSpec) ([]crushChange, error) {
+	changes := []crushChange{}
+	for _, w := range weights {
+		currentWeight, ok := current.osdWeights[w.ID]
+		if !ok {
+			return nil, fmt.Errorf("osd %d is not in the crush map", w.ID)
+		}
+		if w.Weight < 0 {
+			return nil, fmt.Errorf("osd %d has a negative weight", w.ID)
+		}
+
+		// the weights are stored as fixed point numbers in the crush map
+		if math.Abs(currentWeight-w.Weight) < 1.0/crushWeightUnit {
+			continue
+		}
+
+		id := w.ID
+		weight := w.Weight
+		changes = append(changes, crushChange{
+			description: fmt.Sprintf("set the weight of osd.%d from %.5f to %.5f", id, currentWeight, weight),
+			apply: func() error {
+				return client.CrushReweightOSD(context, namespace, id, weight)
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+// the parts of the current crush map the spec is compared with
+type crushState struct {
+	types         map[string]int
+	bucketTypes   map[string]string
+	bucketParents map[string]string
+	rules         map[string]crushRule
+	osdWeights    map[int]float64
+}
+
+type crushRule struct {
+	ruleType int
+	steps    []string
+}
+
+func newCrushState(crushMap client.CrushMap) *crushState {
+	state := &crushState{
+		types:         map[string]int{},
+		bucketTypes:   map[string]string{},
+		bucketParents: map[string]string{},
+		rules:         map[string]crushRule{},
+		osdWeights:    map[int]float64{},
+	}
+	for _, t := range crushMap.Types {
+		state.types[t.Name] = t.ID
+	}
+
+	bucketNames := map[int]string{}
+	for _, b := range crushMap.Buckets {
+		bucketNames[b.ID] = b.Name
+		state.bucketTypes[b.Name] = b.TypeName
+		state.bucketParents[b.Name] = ""
+	}
+	for _, b := range crushMap.Buckets {
+		for _, item := range b.Items {
+			if item.ID >= 0 {
+				// the items with positive ids are osds
+				state.osdWeights[item.ID] = float64(item.Weight) / crushWeightUnit
+			} else if child, ok := bucketNames[item.ID]; ok {
+				state.bucketParents[child] = b.Name
+			}
+		}
+	}
+
+	for _, r := range crushMap.Rules {
+		rule := crushRule{ruleType: r.Type, steps: []string{}}
+		for _, step := range r.Steps {
+			rule.steps = append(rule.steps, formatDumpedStep(step.Operation, step.ItemName, step.Type, step.Number))
+		}
+		state.rules[r.Name] = rule
+	}
+
+	return state
+}
+
+// formats a step of a rule in the crush map dump the same way as in the decompiled crush map, for example the
+// chooseleaf_firstn op is written as "chooseleaf firstn <count> type <type>"
+func formatDumpedStep(op, item, bucketType string, count int) string {
+	switch op {
+	case "take":
+		return fmt.Sprintf("take %s", item)
+	case "emit":
+		return "emit"
+	}
+
+	parts := strings.SplitN(op, "_", 2)
+	if len(parts) == 2 {
+		return fmt.Sprintf("%s %s %d type %s", parts[0], parts[1], count, bucketType)
+	}
+	return op
+}
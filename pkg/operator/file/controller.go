@@ -25,6 +25,7 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	mds "github.com/rook/rook/pkg/operator/file/ceph"
+	"github.com/rook/rook/pkg/operator/pool"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
@@ -122,6 +123,14 @@ func filesystemChanged(oldFS, newFS rookalpha.FilesystemSpec) bool {
 		logger.Infof("number of data pools changed from %d to %d", len(oldFS.DataPools), len(newFS.DataPools))
 		return true
 	}
+	if pool.PoolOptionsChanged(oldFS.MetadataPool, newFS.MetadataPool) {
+		return true
+	}
+	for i := range newFS.DataPools {
+		if pool.PoolOptionsChanged(oldFS.DataPools[i], newFS.DataPools[i]) {
+			return true
+		}
+	}
 	if oldFS.MetadataServer.ActiveCount != newFS.MetadataServer.ActiveCount {
 		logger.Infof("number of mds active changed from %d to %d", oldFS.MetadataServer.ActiveCount, newFS.MetadataServer.ActiveCount)
 		return true
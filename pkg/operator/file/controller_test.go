@@ -37,4 +37,8 @@ func TestFilesystemChanged(t *testing.T) {
 
 	new = rookalpha.FilesystemSpec{MetadataServer: rookalpha.MetadataServerSpec{ActiveCount: 1, ActiveStandby: false}}
 	assert.True(t, filesystemChanged(old, new))
+
+	new = rookalpha.FilesystemSpec{MetadataServer: rookalpha.MetadataServerSpec{ActiveCount: 1, ActiveStandby: true}}
+	new.MetadataPool.Quotas.MaxBytes = 1024
+	assert.True(t, filesystemChanged(old, new))
 }
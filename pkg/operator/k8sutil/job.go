@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"fmt"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RunReplaceableJob runs a job. If a job with the same name already exists from a previous run, it is deleted
+// with its pods before the job is created again.
+func RunReplaceableJob(clientset kubernetes.Interface, job *batch.Job) error {
+	_, err := clientset.BatchV1().Jobs(job.Namespace).Get(job.Name, metav1.GetOptions{})
+	if err == nil {
+		logger.Infof("removing previous job %s to start a new one", job.Name)
+		if err := DeleteBatchJob(clientset, job.Namespace, job.Name); err != nil {
+			return fmt.Errorf("failed to remove job %s. %+v", job.Name, err)
+		}
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get job %s. %+v", job.Name, err)
+	}
+
+	_, err = clientset.BatchV1().Jobs(job.Namespace).Create(job)
+	return err
+}
+
+// WaitForJobCompletion waits for a job to succeed, returning an error if it does not succeed before the timeout
+func WaitForJobCompletion(clientset kubernetes.Interface, namespace, name string, interval, timeout time.Duration) error {
+	logger.Infof("waiting for job %s to complete", name)
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(interval) {
+		job, err := clientset.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get job %s. %+v", name, err)
+		}
+
+		if job.Status.Succeeded > 0 {
+			logger.Infof("job %s completed", name)
+			return nil
+		}
+		logger.Debugf("job %s is not complete yet. active=%d, failed=%d", name, job.Status.Active, job.Status.Failed)
+	}
+
+	return fmt.Errorf("gave up waiting for job %s to complete after %s", name, timeout)
+}
+
+// DeleteBatchJob makes a best effort at deleting a job and its pods, then waits for them to be deleted
+func DeleteBatchJob(clientset kubernetes.Interface, namespace, name string) error {
+	deleteAction := func(options *metav1.DeleteOptions) error {
+		return clientset.BatchV1().Jobs(namespace).Delete(name, options)
+	}
+	getAction := func() error {
+		_, err := clientset.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+		return err
+	}
+	return deletePodsAndWait(namespace, name, deleteAction, getAction)
+}
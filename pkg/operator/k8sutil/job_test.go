@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunReplaceableJob(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	job := &batch.Job{ObjectMeta: metav1.ObjectMeta{Name: "myjob", Namespace: "ns"}}
+
+	// the job is created the first time
+	err := RunReplaceableJob(clientset, job)
+	assert.Nil(t, err)
+
+	// simulate the completion of the first run
+	existing, err := clientset.BatchV1().Jobs("ns").Get("myjob", metav1.GetOptions{})
+	assert.Nil(t, err)
+	existing.Status.Succeeded = 1
+	_, err = clientset.BatchV1().Jobs("ns").Update(existing)
+	assert.Nil(t, err)
+
+	// the previous run is replaced with a new job
+	err = RunReplaceableJob(clientset, job)
+	assert.Nil(t, err)
+	replaced, err := clientset.BatchV1().Jobs("ns").Get("myjob", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), replaced.Status.Succeeded)
+}
+
+func TestWaitForJobCompletion(t *testing.T) {
+	job := &batch.Job{ObjectMeta: metav1.ObjectMeta{Name: "myjob", Namespace: "ns"}}
+	clientset := fake.NewSimpleClientset(job)
+
+	// the job never completes
+	err := WaitForJobCompletion(clientset, "ns", "myjob", time.Millisecond, 5*time.Millisecond)
+	assert.NotNil(t, err)
+
+	// the job has completed
+	job.Status.Succeeded = 1
+	_, err = clientset.BatchV1().Jobs("ns").Update(job)
+	assert.Nil(t, err)
+	err = WaitForJobCompletion(clientset, "ns", "myjob", time.Millisecond, 5*time.Millisecond)
+	assert.Nil(t, err)
+
+	// the job does not exist
+	err = WaitForJobCompletion(clientset, "ns", "otherjob", time.Millisecond, 5*time.Millisecond)
+	assert.NotNil(t, err)
+}
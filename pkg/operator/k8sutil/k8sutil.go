@@ -33,6 +33,8 @@ const (
 	Namespace = "rook"
 	// DefaultNamespace for the cluster
 	DefaultNamespace = "default"
+	// DefaultClusterName states the default name of the rook-cluster if not provided.
+	DefaultClusterName = "rook"
 	// DataDirVolume data dir volume
 	DataDirVolume = "rook-data"
 	// DataDir folder
@@ -151,6 +151,32 @@ func DeleteDaemonset(clientset kubernetes.Interface, namespace, name string) err
 	return deletePodsAndWait(namespace, name, deleteAction, getAction)
 }
 
+// DeleteReplicaSet makes a best effort at deleting a replica set and its pods, then waits for them to be deleted
+func DeleteReplicaSet(clientset kubernetes.Interface, namespace, name string) error {
+	logger.Infof("removing %s replica set if it exists", name)
+	deleteAction := func(options *metav1.DeleteOptions) error {
+		return clientset.ExtensionsV1beta1().ReplicaSets(namespace).Delete(name, options)
+	}
+	getAction := func() error {
+		_, err := clientset.ExtensionsV1beta1().ReplicaSets(namespace).Get(name, metav1.GetOptions{})
+		return err
+	}
+	return deletePodsAndWait(namespace, name, deleteAction, getAction)
+}
+
+// DeletePod makes a best effort at deleting a pod, then waits for it to be deleted
+func DeletePod(clientset kubernetes.Interface, namespace, name string) error {
+	logger.Infof("removing %s pod if it exists", name)
+	deleteAction := func(options *metav1.DeleteOptions) error {
+		return clientset.CoreV1().Pods(namespace).Delete(name, options)
+	}
+	getAction := func() error {
+		_, err := clientset.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		return err
+	}
+	return deletePodsAndWait(namespace, name, deleteAction, getAction)
+}
+
 // deletePodsAndWait will delete a resource, then wait for it to be purged from the system
 func deletePodsAndWait(namespace, name string,
 	deleteAction func(*metav1.DeleteOptions) error,
@@ -93,6 +93,11 @@ func MakeClusterRole(clientset kubernetes.Interface, namespace, name string, rul
 		return err
 	}
 
+	return BindClusterRole(clientset, namespace, name, name, rules, ownerRef)
+}
+
+// BindClusterRole creates or updates a cluster scoped role with the rules and binds it to an existing service account
+func BindClusterRole(clientset kubernetes.Interface, namespace, name, serviceAccount string, rules []v1beta1.PolicyRule, ownerRef *metav1.OwnerReference) error {
 	if !isRBACEnabled() {
 		return nil
 	}
@@ -110,7 +115,7 @@ func MakeClusterRole(clientset kubernetes.Interface, namespace, name string, rul
 		role.OwnerReferences = []metav1.OwnerReference{*ownerRef}
 	}
 
-	_, err = clientset.RbacV1beta1().ClusterRoles().Get(role.Name, metav1.GetOptions{})
+	_, err := clientset.RbacV1beta1().ClusterRoles().Get(role.Name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		logger.Infof("creating cluster role %s", name)
 		_, err = clientset.RbacV1beta1().ClusterRoles().Create(role)
@@ -132,7 +137,7 @@ func MakeClusterRole(clientset kubernetes.Interface, namespace, name string, rul
 			APIGroup: "rbac.authorization.k8s.io",
 		},
 		Subjects: []v1beta1.Subject{
-			{Kind: "ServiceAccount", Name: name, Namespace: namespace},
+			{Kind: "ServiceAccount", Name: serviceAccount, Namespace: namespace},
 		},
 	}
 	if ownerRef != nil {
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// TopologyLabelsEnvVar is the env var with the node label for each CRUSH bucket type
+	TopologyLabelsEnvVar = "ROOK_TOPOLOGY_LABELS"
+)
+
+// characters that are not allowed in the name of a CRUSH bucket
+var invalidCrushNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// FormatTopologyLabels formats the node label for each CRUSH bucket type as "rack=label1,zone=label2"
+func FormatTopologyLabels(labels map[string]string) string {
+	pairs := []string{}
+	for bucketType, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", bucketType, label))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseTopologyLabels parses the node label for each CRUSH bucket type formatted by FormatTopologyLabels
+func ParseTopologyLabels(value string) (map[string]string, error) {
+	labels := map[string]string{}
+	if value == "" {
+		return labels, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("topology label '%s' is not in the format <bucket type>=<node label>", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// TopologyLocation returns the CRUSH location of a node from its labels, such as "region=us-east,zone=us-east-1a".
+// The bucket types whose labels are not set on the node are skipped.
+func TopologyLocation(nodeLabels, topologyLabels map[string]string) string {
+	pairs := []string{}
+	for bucketType, label := range topologyLabels {
+		value, ok := nodeLabels[label]
+		if !ok || value == "" {
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", bucketType, invalidCrushNameChars.ReplaceAllString(value, "-")))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// GetNodeTopologyLocation gets the CRUSH location of the node with the given name from its labels
+func GetNodeTopologyLocation(clientset kubernetes.Interface, nodeName string, topologyLabels map[string]string) (string, error) {
+	node, err := clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s. %+v", nodeName, err)
+	}
+	return NodeTopologyLocation(node, topologyLabels), nil
+}
+
+// NodeTopologyLocation returns the CRUSH location of the node from its labels
+func NodeTopologyLocation(node *v1.Node, topologyLabels map[string]string) string {
+	return TopologyLocation(node.Labels, topologyLabels)
+}
+
+// MergeLocation adds the pairs of the topology location to the location, except for the bucket types that are
+// already set in the location. The location that is explicitly configured always takes precedence.
+func MergeLocation(location, topology string) string {
+	if topology == "" {
+		return location
+	}
+	if location == "" {
+		return topology
+	}
+
+	set := map[string]bool{}
+	for _, pair := range strings.Split(location, ",") {
+		set[strings.SplitN(pair, "=", 2)[0]] = true
+	}
+
+	pairs := []string{location}
+	for _, pair := range strings.Split(topology, ",") {
+		if !set[strings.SplitN(pair, "=", 2)[0]] {
+			pairs = append(pairs, pair)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTopologyLabelsFormat(t *testing.T) {
+	labels := map[string]string{"zone": "failure-domain.beta.kubernetes.io/zone", "rack": "example.com/rack"}
+	value := FormatTopologyLabels(labels)
+	assert.Equal(t, "rack=example.com/rack,zone=failure-domain.beta.kubernetes.io/zone", value)
+
+	parsed, err := ParseTopologyLabels(value)
+	assert.Nil(t, err)
+	assert.Equal(t, labels, parsed)
+
+	parsed, err = ParseTopologyLabels("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(parsed))
+
+	_, err = ParseTopologyLabels("zone")
+	assert.NotNil(t, err)
+	_, err = ParseTopologyLabels("zone=")
+	assert.NotNil(t, err)
+}
+
+func TestTopologyLocation(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{
+		"failure-domain.beta.kubernetes.io/zone": "us-east-1a",
+		"example.com/rack":                       "rack 1",
+	}}}
+	_, err := clientset.CoreV1().Nodes().Create(node)
+	assert.Nil(t, err)
+
+	// the labels missing on the node are skipped and invalid characters are replaced
+	labels := map[string]string{"region": "failure-domain.beta.kubernetes.io/region", "zone": "failure-domain.beta.kubernetes.io/zone", "rack": "example.com/rack"}
+	location, err := GetNodeTopologyLocation(clientset, "node1", labels)
+	assert.Nil(t, err)
+	assert.Equal(t, "rack=rack-1,zone=us-east-1a", location)
+
+	_, err = GetNodeTopologyLocation(clientset, "node2", labels)
+	assert.NotNil(t, err)
+}
+
+func TestMergeLocation(t *testing.T) {
+	assert.Equal(t, "", MergeLocation("", ""))
+	assert.Equal(t, "rack=r1", MergeLocation("rack=r1", ""))
+	assert.Equal(t, "zone=z1", MergeLocation("", "zone=z1"))
+
+	// the explicit location takes precedence
+	assert.Equal(t, "zone=z9,rack=r1", MergeLocation("zone=z9", "rack=r1,zone=z1"))
+}
@@ -22,8 +22,43 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"k8s.io/kubernetes/pkg/apis/componentconfig"
+	kubeletconfig "k8s.io/kubernetes/pkg/kubelet/apis/kubeletconfig/v1alpha1"
+)
+
+const (
+	// KubeletRootDirEnvVar is the env var that sets the root dir of the kubelet on the nodes, since the root dir is a
+	// flag of the kubelet that is not in the node configuration
+	KubeletRootDirEnvVar  = "KUBELET_ROOT_DIR_PATH"
+	kubeletDefaultRootDir = "/var/lib/kubelet"
 )
 
+// KubeletRootDir returns the root dir of the kubelet from the env var, or the default /var/lib/kubelet
+func KubeletRootDir() string {
+	if rootDir := os.Getenv(KubeletRootDirEnvVar); rootDir != "" {
+		return rootDir
+	}
+	return kubeletDefaultRootDir
+}
+
+// NodeConfigControllerManager is a reference of all the configuration for the K8S node from the controllermanager
+type NodeConfigControllerManager struct {
+	ComponentConfig componentconfig.KubeControllerManagerConfiguration `json:"componentconfig"`
+}
+
+// NodeConfigKubelet is a reference of all the configuration for the K8S node from kubelet
+type NodeConfigKubelet struct {
+	ComponentConfig kubeletconfig.KubeletConfiguration `json:"componentconfig"`
+}
+
+// KubeletConfiguration represents the response from the node config URI (configz) in Kubernetes 1.8+
+type KubeletConfiguration struct {
+	KubeletConfig struct {
+		VolumePluginDir string `json:"volumePluginDir"`
+	} `json:"kubeletconfig"`
+}
+
 // PathToVolumeName converts a path to a valid volume name
 func PathToVolumeName(path string) string {
 	// kubernetes volume names must match this regex: [a-z0-9]([-a-z0-9]*[a-z0-9])?
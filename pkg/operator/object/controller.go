@@ -25,6 +25,7 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	rgw "github.com/rook/rook/pkg/operator/object/ceph"
+	"github.com/rook/rook/pkg/operator/pool"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
@@ -125,6 +126,9 @@ func storeChanged(oldStore, newStore rookalpha.ObjectStoreSpec) bool {
 		logger.Infof("metadata pool replication changed from %d to %d", oldStore.MetadataPool.Replicated.Size, newStore.MetadataPool.Replicated.Size)
 		return true
 	}
+	if pool.PoolOptionsChanged(oldStore.DataPool, newStore.DataPool) || pool.PoolOptionsChanged(oldStore.MetadataPool, newStore.MetadataPool) {
+		return true
+	}
 	if oldStore.Gateway.Instances != newStore.Gateway.Instances {
 		logger.Infof("RGW instances changed from %d to %d", oldStore.Gateway.Instances, newStore.Gateway.Instances)
 		return true
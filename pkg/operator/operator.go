@@ -30,12 +30,14 @@ import (
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume/attachment"
 	"github.com/rook/rook/pkg/operator/agent"
 	"github.com/rook/rook/pkg/operator/cluster"
+	"github.com/rook/rook/pkg/operator/crush"
 	"github.com/rook/rook/pkg/operator/file"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/operator/object"
 	"github.com/rook/rook/pkg/operator/pool"
 	"github.com/rook/rook/pkg/operator/provisioner"
 	"github.com/rook/rook/pkg/operator/provisioner/controller"
+	"github.com/rook/rook/pkg/operator/snapshot"
 	"k8s.io/api/core/v1"
 )
 
@@ -45,7 +47,8 @@ const (
 
 // volume provisioner constant
 const (
-	provisionerName = "rook.io/block"
+	provisionerName     = "rook.io/block"
+	fileProvisionerName = "rook.io/file"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "operator")
@@ -59,20 +62,23 @@ type Operator struct {
 	// The cluster is global because you create multiple clusters in k8s
 	clusterController *cluster.ClusterController
 	volumeProvisioner controller.Provisioner
+	fileProvisioner   controller.Provisioner
 }
 
 // New creates an operator instance
 func New(context *clusterd.Context, volumeAttachmentWrapper attachment.Attachment, rookImage string) *Operator {
 	clusterController := cluster.NewClusterController(context, rookImage, volumeAttachmentWrapper)
 	volumeProvisioner := provisioner.New(context)
+	fileProvisioner := provisioner.NewFileProvisioner(context, rookImage)
 
 	schemes := []opkit.CustomResource{cluster.ClusterResource, pool.PoolResource, object.ObjectStoreResource,
-		file.FilesystemResource, attachment.VolumeAttachmentResource}
+		file.FilesystemResource, crush.CrushMapResource, attachment.VolumeAttachmentResource, snapshot.VolumeSnapshotResource}
 	return &Operator{
 		context:           context,
 		clusterController: clusterController,
 		resources:         schemes,
 		volumeProvisioner: volumeProvisioner,
+		fileProvisioner:   fileProvisioner,
 		rookImage:         rookImage,
 	}
 }
@@ -111,6 +117,11 @@ func (o *Operator) Run() error {
 	if err != nil {
 		return fmt.Errorf("Error getting server version: %v", err)
 	}
+	// record the cluster on the volumes that were provisioned before it was stored in their options
+	if err := provisioner.MigrateVolumes(o.context); err != nil {
+		logger.Warningf("failed to migrate the rook volumes. %+v", err)
+	}
+
 	pc := controller.NewProvisionController(
 		o.context.Clientset,
 		provisionerName,
@@ -120,6 +131,24 @@ func (o *Operator) Run() error {
 	go pc.Run(stopChan)
 	logger.Infof("rook-provisioner started")
 
+	// provision the volumes of the shared file systems
+	fpc := controller.NewProvisionController(
+		o.context.Clientset,
+		fileProvisionerName,
+		o.fileProvisioner,
+		serverVersion.GitVersion,
+	)
+	go fpc.Run(stopChan)
+	logger.Infof("rook file provisioner started")
+
+	// expand the rook block volumes when their claims request more storage
+	resizeController := provisioner.NewResizeController(o.context)
+	go resizeController.Run(stopChan)
+
+	// watch for the snapshots of the rook volumes in all namespaces
+	snapshotController := snapshot.NewVolumeSnapshotController(o.context)
+	snapshotController.StartWatch(v1.NamespaceAll, stopChan)
+
 	// watch for changes to the rook clusters
 	o.clusterController.StartWatch(v1.NamespaceAll, stopChan)
 
@@ -20,6 +20,7 @@ package pool
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 
 	"github.com/coreos/pkg/capnslog"
 	opkit "github.com/rook/operator-kit"
@@ -28,6 +29,7 @@ import (
 	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/model"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -40,6 +42,14 @@ const (
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-pool")
 
+var (
+	compressionModes      = []string{"none", "passive", "aggressive", "force"}
+	compressionAlgorithms = []string{"snappy", "zlib", "zstd", "lz4"}
+	// the pool properties that the operator manages from the other settings of the pool spec
+	reservedParameters = []string{"size", "min_size", "pg_num", "pgp_num", "crush_rule", "crush_ruleset", "compression_mode",
+		"compression_algorithm", "compression_required_ratio", "pg_autoscale_mode", "target_size_ratio"}
+)
+
 // PoolResource represents the Pool custom resource object
 var PoolResource = opkit.CustomResource{
 	Name:    customResourceName,
@@ -74,28 +84,48 @@ func (c *PoolController) StartWatch(namespace string, stopCh chan struct{}) erro
 	logger.Infof("start watching pool resources in namespace %s", namespace)
 	watcher := opkit.NewWatcher(PoolResource, namespace, resourceHandlerFuncs, c.context.RookClientset.Rook().RESTClient())
 	go watcher.Watch(&rookalpha.Pool{}, stopCh)
+
+	// grow the placement groups of the pools as osds are added
+	go c.watchPGCounts(namespace, stopCh)
+
+	// report the mirroring status of the images of the mirrored pools
+	go c.watchMirroringStatus(namespace, stopCh)
 	return nil
 }
 
 func (c *PoolController) onAdd(obj interface{}) {
 	pool := obj.(*rookalpha.Pool).DeepCopy()
+	if pool.DeletionTimestamp != nil {
+		// the deletion was blocked before the operator restarted
+		c.handleDelete(pool)
+		return
+	}
 
 	err := createPool(c.context, pool)
 	if err != nil {
 		logger.Errorf("failed to create pool %s. %+v", pool.ObjectMeta.Name, err)
 	}
+	c.updateStatus(pool, err)
+
+	// add the finalizer so the pool is only deleted when it is not in use
+	if err := c.addFinalizer(pool); err != nil {
+		logger.Errorf("failed to add finalizer to pool %s. %+v", pool.Name, err)
+	}
 }
 
 func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 	oldPool := oldObj.(*rookalpha.Pool)
-	pool := newObj.(*rookalpha.Pool)
+	pool := newObj.(*rookalpha.Pool).DeepCopy()
 
-	if oldPool.Name != pool.Name {
-		logger.Errorf("failed to update pool %s. name update not allowed", pool.Name)
+	// K8s only sets the deletion timestamp when the pool has finalizers. The pool crd is removed when the
+	// finalizers are removed.
+	if pool.DeletionTimestamp != nil {
+		c.handleDelete(pool)
 		return
 	}
-	if pool.Spec.ErasureCoded.CodingChunks != 0 && pool.Spec.ErasureCoded.DataChunks != 0 {
-		logger.Errorf("failed to update pool %s. erasurecoded update not allowed", pool.Name)
+
+	if oldPool.Name != pool.Name {
+		logger.Errorf("failed to update pool %s. name update not allowed", pool.Name)
 		return
 	}
 	if !poolChanged(oldPool.Spec, pool.Spec) {
@@ -105,14 +135,81 @@ func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 
 	// if the pool is modified, allow the pool to be created if it wasn't already
 	logger.Infof("updating pool %s", pool.Name)
-	if err := createPool(c.context, pool); err != nil {
+	err := createPool(c.context, pool)
+	if err == nil && oldPool.Spec.Mirroring.Mode != "" && pool.Spec.Mirroring.Mode == "" {
+		err = disableMirroring(c.context, pool)
+	}
+	if err != nil {
 		logger.Errorf("failed to create (modify) pool %s. %+v", pool.ObjectMeta.Name, err)
 	}
+	c.updateStatus(pool, err)
+}
+
+// saves the result of applying the spec in the pool status. the latest pool is retrieved so the update does not
+// conflict with other changes to the pool.
+func (c *PoolController) updateStatus(p *rookalpha.Pool, err error) {
+	status := rookalpha.PoolStatus{State: rookalpha.PoolCreated}
+	if err != nil {
+		status = rookalpha.PoolStatus{State: rookalpha.PoolFailed, Message: err.Error()}
+	} else if p.Spec.Mirroring.Mode != "" {
+		if status.Mirroring, err = mirroringStatus(c.context, p); err != nil {
+			logger.Warningf("failed to get the mirroring status of pool %s. %+v", p.Name, err)
+		}
+	}
+	c.saveStatus(p, status)
+}
+
+func (c *PoolController) saveStatus(p *rookalpha.Pool, status rookalpha.PoolStatus) {
+	pool, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get pool %s to update its status. %+v", p.Name, err)
+		return
+	}
+	if reflect.DeepEqual(pool.Status, status) {
+		return
+	}
+	pool.Status = status
+	if _, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Update(pool); err != nil {
+		logger.Warningf("failed to update the status of pool %s. %+v", p.Name, err)
+	}
 }
 
 func poolChanged(old, new rookalpha.PoolSpec) bool {
-	if old.Replicated.Size != new.Replicated.Size {
-		logger.Infof("pool replication changed from %d to %d", old.Replicated.Size, new.Replicated.Size)
+	if old.Replicated != new.Replicated {
+		logger.Infof("pool replication changed from %+v to %+v", old.Replicated, new.Replicated)
+		return true
+	}
+	if old.FailureDomain != new.FailureDomain {
+		logger.Infof("pool failure domain changed from %s to %s", old.FailureDomain, new.FailureDomain)
+		return true
+	}
+	if old.ErasureCoded != new.ErasureCoded {
+		logger.Infof("pool erasure code settings changed from %+v to %+v", old.ErasureCoded, new.ErasureCoded)
+		return true
+	}
+	if !reflect.DeepEqual(old.Mirroring, new.Mirroring) {
+		logger.Infof("pool mirroring changed from %+v to %+v", old.Mirroring, new.Mirroring)
+		return true
+	}
+	if old.ExpectedDataPercent != new.ExpectedDataPercent {
+		logger.Infof("pool expected data percent changed from %d to %d", old.ExpectedDataPercent, new.ExpectedDataPercent)
+		return true
+	}
+	return PoolOptionsChanged(old, new)
+}
+
+// PoolOptionsChanged determines if the quotas, compression, or other properties of a pool changed
+func PoolOptionsChanged(old, new rookalpha.PoolSpec) bool {
+	if old.Quotas != new.Quotas {
+		logger.Infof("pool quotas changed from %+v to %+v", old.Quotas, new.Quotas)
+		return true
+	}
+	if old.Compression != new.Compression {
+		logger.Infof("pool compression changed from %+v to %+v", old.Compression, new.Compression)
+		return true
+	}
+	if !reflect.DeepEqual(old.Parameters, new.Parameters) {
+		logger.Infof("pool parameters changed from %v to %v", old.Parameters, new.Parameters)
 		return true
 	}
 	return false
@@ -120,9 +217,24 @@ func poolChanged(old, new rookalpha.PoolSpec) bool {
 
 func (c *PoolController) onDelete(obj interface{}) {
 	pool := obj.(*rookalpha.Pool)
-	if err := deletePool(c.context, pool); err != nil {
-		logger.Errorf("failed to delete pool %s. %+v", pool.ObjectMeta.Name, err)
+	if pool.DeletionTimestamp != nil {
+		// the pool was already deleted by the finalizer
+		logger.Debugf("pool %s was deleted", pool.Name)
+		return
 	}
+
+	// the pool crd did not have the finalizer, so it is already gone. if the pool is in use or could not be deleted,
+	// the crd is created again so the pool is not left behind without a crd.
+	reason, err := c.deleteUnusedPool(pool)
+	if err == nil && reason == "" {
+		return
+	}
+	if err != nil {
+		logger.Errorf("failed to delete pool %s. %+v", pool.Name, err)
+	} else {
+		logger.Warningf("not deleting pool %s. %s", pool.Name, reason)
+	}
+	c.restorePoolCRD(pool)
 }
 
 // Create the pool
@@ -132,16 +244,122 @@ func createPool(context *clusterd.Context, p *rookalpha.Pool) error {
 		return fmt.Errorf("invalid pool %s arguments. %+v", p.Name, err)
 	}
 
-	// create the pool
-	logger.Infof("creating pool %s in namespace %s", p.Name, p.Namespace)
-	if err := ceph.CreatePoolWithProfile(context, p.Namespace, *p.Spec.ToModel(p.Name), p.Name); err != nil {
-		return fmt.Errorf("failed to create pool %s. %+v", p.Name, err)
+	// size the placement groups for the expected data unless the mgr will size them
+	poolModel := p.Spec.ToModel(p.Name)
+	autoscale := false
+	if p.Spec.ExpectedDataPercent > 0 {
+		var err error
+		autoscale, err = ceph.MgrModuleAvailable(context, p.Namespace, pgAutoscalerModule)
+		if err != nil {
+			logger.Warningf("failed to check if the pg autoscaler is available. %+v", err)
+		}
+		if !autoscale {
+			if poolModel.PGCount, err = targetPGCount(context, p.Namespace, &p.Spec); err != nil {
+				return fmt.Errorf("failed to compute the pg count of pool %s. %+v", p.Name, err)
+			}
+		}
+	}
+
+	if details, err := ceph.GetPoolDetails(context, p.Namespace, p.Name); err == nil {
+		// the pool already exists
+		if err := updatePool(context, p, poolModel, details); err != nil {
+			return fmt.Errorf("failed to update pool %s. %+v", p.Name, err)
+		}
+	} else {
+		// create the pool
+		logger.Infof("creating pool %s in namespace %s", p.Name, p.Namespace)
+		if err := ceph.CreatePoolWithProfile(context, p.Namespace, *poolModel, p.Name); err != nil {
+			return fmt.Errorf("failed to create pool %s. %+v", p.Name, err)
+		}
+	}
+
+	if p.Spec.Mirroring.Mode != "" {
+		if err := configureMirroring(context, p); err != nil {
+			return fmt.Errorf("failed to configure the mirroring of pool %s. %+v", p.Name, err)
+		}
+	}
+
+	if autoscale {
+		if err := enablePGAutoscale(context, p); err != nil {
+			return fmt.Errorf("failed to enable the pg autoscaler for pool %s. %+v", p.Name, err)
+		}
 	}
 
 	logger.Infof("created pool %s", p.Name)
 	return nil
 }
 
+// applies the spec to an existing pool. the replica counts, placement, and options of a pool can be changed, but
+// a pool cannot be changed between replicated and erasure coded and the chunks of an erasure coded pool are fixed.
+func updatePool(context *clusterd.Context, p *rookalpha.Pool, poolModel *model.Pool, details ceph.CephStoragePoolDetails) error {
+	if err := validatePoolTypeUnchanged(context, p, details); err != nil {
+		return err
+	}
+
+	r := p.Spec.Replication()
+	if r != nil && r.Size != details.Size {
+		logger.Infof("changing the size of pool %s from %d to %d", p.Name, details.Size, r.Size)
+		if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "size", strconv.FormatUint(uint64(r.Size), 10)); err != nil {
+			return err
+		}
+	}
+	if r != nil && r.MinSize > 0 && r.MinSize != details.MinSize {
+		logger.Infof("changing the min size of pool %s from %d to %d", p.Name, details.MinSize, r.MinSize)
+		if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "min_size", strconv.FormatUint(uint64(r.MinSize), 10)); err != nil {
+			return err
+		}
+	}
+
+	if r != nil && (r.CrushRoot != "" || r.PrimaryZone != "") {
+		// the crush root, failure domain, and primary zone are part of the name of the rule
+		cephPool := ceph.ModelPoolToCephPool(*poolModel)
+		ruleName := ceph.PoolCrushRuleName(cephPool)
+		if ruleName != details.CrushRule {
+			logger.Infof("changing the crush rule of pool %s from %s to %s", p.Name, details.CrushRule, ruleName)
+			if err := ceph.SetPoolCrushRule(context, p.Namespace, cephPool); err != nil {
+				return fmt.Errorf("failed to change the crush rule of pool %s. %+v", p.Name, err)
+			}
+		}
+	} else if p.Spec.FailureDomain != "" {
+		failureDomain, err := ceph.GetPoolFailureDomain(context, p.Namespace, details)
+		if err != nil {
+			return fmt.Errorf("failed to get the failure domain of pool %s. %+v", p.Name, err)
+		}
+		if failureDomain != p.Spec.FailureDomain {
+			logger.Infof("changing the failure domain of pool %s from %s to %s", p.Name, failureDomain, p.Spec.FailureDomain)
+			if err := ceph.SetPoolFailureDomain(context, p.Namespace, *poolModel); err != nil {
+				return fmt.Errorf("failed to change the failure domain of pool %s. %+v", p.Name, err)
+			}
+		}
+	}
+
+	return ceph.SetPoolOptions(context, p.Namespace, *poolModel)
+}
+
+// the data of a pool would need to be copied to a new pool to change its type or its erasure code profile
+func validatePoolTypeUnchanged(context *clusterd.Context, p *rookalpha.Pool, details ceph.CephStoragePoolDetails) error {
+	ec := p.Spec.ErasureCode()
+	if details.ErasureCodeProfile == "" {
+		if ec != nil {
+			return fmt.Errorf("replicated pool %s cannot be changed to erasure coded. create a new pool and copy the data", p.Name)
+		}
+		return nil
+	}
+	if ec == nil {
+		return fmt.Errorf("erasure coded pool %s cannot be changed to replicated. create a new pool and copy the data", p.Name)
+	}
+
+	profile, err := ceph.GetErasureCodeProfileDetails(context, p.Namespace, details.ErasureCodeProfile)
+	if err != nil {
+		return fmt.Errorf("failed to get the erasure code profile of pool %s. %+v", p.Name, err)
+	}
+	if profile.DataChunkCount != ec.DataChunks || profile.CodingChunkCount != ec.CodingChunks {
+		return fmt.Errorf("the erasure code profile of pool %s cannot be changed from %d data and %d coding chunks to %d and %d. "+
+			"create a new pool and copy the data", p.Name, profile.DataChunkCount, profile.CodingChunkCount, ec.DataChunks, ec.CodingChunks)
+	}
+	return nil
+}
+
 // Delete the pool
 func deletePool(context *clusterd.Context, p *rookalpha.Pool) error {
 
@@ -170,8 +388,20 @@ func ModelToSpec(pool model.Pool) rookalpha.PoolSpec {
 	ec := pool.ErasureCodedConfig
 	return rookalpha.PoolSpec{
 		FailureDomain: pool.FailureDomain,
-		Replicated:    rookalpha.ReplicatedSpec{Size: pool.ReplicatedConfig.Size},
-		ErasureCoded:  rookalpha.ErasureCodedSpec{CodingChunks: ec.CodingChunkCount, DataChunks: ec.DataChunkCount, Algorithm: ec.Algorithm},
+		Replicated: rookalpha.ReplicatedSpec{
+			Size:        pool.ReplicatedConfig.Size,
+			MinSize:     pool.ReplicatedConfig.MinSize,
+			CrushRoot:   pool.ReplicatedConfig.CrushRoot,
+			PrimaryZone: pool.ReplicatedConfig.PrimaryZone,
+		},
+		ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: ec.CodingChunkCount, DataChunks: ec.DataChunkCount, Algorithm: ec.Algorithm},
+		Quotas:       rookalpha.QuotaSpec{MaxBytes: pool.Quotas.MaxBytes, MaxObjects: pool.Quotas.MaxObjects},
+		Compression: rookalpha.CompressionSpec{
+			Mode:          pool.Compression.Mode,
+			Algorithm:     pool.Compression.Algorithm,
+			RequiredRatio: pool.Compression.RequiredRatio,
+		},
+		Parameters: pool.Parameters,
 	}
 }
 
@@ -196,13 +426,36 @@ func ValidatePoolSpec(context *clusterd.Context, namespace string, p *rookalpha.
 	if p.Replication() == nil && p.ErasureCode() == nil {
 		return fmt.Errorf("neither replication nor erasure code settings were specified")
 	}
+	if err := validateCompression(p.Compression); err != nil {
+		return err
+	}
+	for name := range p.Parameters {
+		if contains(reservedParameters, name) {
+			return fmt.Errorf("pool parameter %s is managed by the operator and cannot be set", name)
+		}
+	}
+	if err := validateMirroring(p.Mirroring); err != nil {
+		return err
+	}
+	// zero is unset. a share above the whole cluster would size the pool with more pgs than the osds can hold.
+	if p.ExpectedDataPercent > 100 {
+		return fmt.Errorf("expected data percent %d must be between 1 and 100", p.ExpectedDataPercent)
+	}
+
+	r := p.Replication()
+	if r != nil && r.MinSize > r.Size {
+		return fmt.Errorf("min size %d cannot be greater than the size %d", r.MinSize, r.Size)
+	}
+	if p.FailureDomain == "" && (r == nil || (r.CrushRoot == "" && r.PrimaryZone == "")) {
+		return nil
+	}
 
-	// validate the failure domain if specified
+	// validate the failure domain, crush root, and primary zone if specified
+	crush, err := ceph.GetCrushMap(context, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get crush map. %+v", err)
+	}
 	if p.FailureDomain != "" {
-		crush, err := ceph.GetCrushMap(context, namespace)
-		if err != nil {
-			return fmt.Errorf("failed to get crush map. %+v", err)
-		}
 		found := false
 		for _, t := range crush.Types {
 			if t.Name == p.FailureDomain {
@@ -214,6 +467,43 @@ func ValidatePoolSpec(context *clusterd.Context, namespace string, p *rookalpha.
 			return fmt.Errorf("unrecognized failure domain %s", p.FailureDomain)
 		}
 	}
+	if r != nil && r.CrushRoot != "" && !crushBucketExists(crush, r.CrushRoot, "root") {
+		return fmt.Errorf("unrecognized crush root %s", r.CrushRoot)
+	}
+	if r != nil && r.PrimaryZone != "" && !crushBucketExists(crush, r.PrimaryZone, "zone") {
+		return fmt.Errorf("unrecognized primary zone %s", r.PrimaryZone)
+	}
 
 	return nil
 }
+
+func crushBucketExists(crush ceph.CrushMap, name, typeName string) bool {
+	for _, b := range crush.Buckets {
+		if b.Name == name && b.TypeName == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCompression(c rookalpha.CompressionSpec) error {
+	if c.Mode != "" && !contains(compressionModes, c.Mode) {
+		return fmt.Errorf("unrecognized compression mode %s", c.Mode)
+	}
+	if c.Algorithm != "" && !contains(compressionAlgorithms, c.Algorithm) {
+		return fmt.Errorf("unrecognized compression algorithm %s", c.Algorithm)
+	}
+	if c.RequiredRatio < 0 || c.RequiredRatio > 1 {
+		return fmt.Errorf("compression required ratio %v must be between 0 and 1", c.RequiredRatio)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -17,13 +17,20 @@ package pool
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestValidatePool(t *testing.T) {
@@ -64,6 +71,40 @@ func TestValidatePool(t *testing.T) {
 	p.Spec.ErasureCoded.DataChunks = 2
 	err = ValidatePool(context, &p)
 	assert.Nil(t, err)
+
+	// the compression settings must be recognized
+	p.Spec.Compression = rookalpha.CompressionSpec{Mode: "aggressive", Algorithm: "snappy", RequiredRatio: 0.875}
+	err = ValidatePool(context, &p)
+	assert.Nil(t, err)
+	p.Spec.Compression.Mode = "always"
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+	p.Spec.Compression = rookalpha.CompressionSpec{Algorithm: "gzip"}
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+	p.Spec.Compression = rookalpha.CompressionSpec{RequiredRatio: 1.5}
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+
+	// the parameters cannot override the properties managed by the operator
+	p.Spec.Parameters = map[string]string{"nodeep-scrub": "1"}
+	err = ValidatePool(context, &p)
+	assert.Nil(t, err)
+	for _, name := range []string{"size", "pg_num", "pgp_num", "crush_rule"} {
+		p.Spec.Parameters = map[string]string{name: "1"}
+		err = ValidatePool(context, &p)
+		assert.NotNil(t, err)
+	}
+	p.Spec.Parameters = nil
+
+	// the expected data percent is at most the whole cluster
+	p.Spec.Compression = rookalpha.CompressionSpec{}
+	p.Spec.ExpectedDataPercent = 100
+	err = ValidatePool(context, &p)
+	assert.Nil(t, err)
+	p.Spec.ExpectedDataPercent = 101
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
 }
 
 func TestValidateFailureDomain(t *testing.T) {
@@ -90,12 +131,47 @@ func TestValidateFailureDomain(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestValidatePlacement(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+		if args[1] == "crush" && args[2] == "dump" {
+			return `{"buckets":[{"id":-1,"name":"default","type_name":"root"},{"id":-2,"name":"zone-a","type_name":"zone"}]}`, nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+
+	// succeed with a root and a zone that exist
+	p := rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated = rookalpha.ReplicatedSpec{Size: 3, MinSize: 2, CrushRoot: "default", PrimaryZone: "zone-a"}
+	err := ValidatePool(context, &p)
+	assert.Nil(t, err)
+
+	// fail with a min size greater than the size
+	p.Spec.Replicated.MinSize = 4
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+	p.Spec.Replicated.MinSize = 2
+
+	// fail with a root or a zone that doesn't exist
+	p.Spec.Replicated.CrushRoot = "zone-a"
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+	p.Spec.Replicated.CrushRoot = "default"
+	p.Spec.Replicated.PrimaryZone = "zone-b"
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+}
+
 func TestCreatePool(t *testing.T) {
 	executor := &exectest.MockExecutor{
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
 			if command == "ceph" && args[1] == "erasure-code-profile" {
 				return `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van"}`, nil
 			}
+			if args[1] == "pool" && args[2] == "get" {
+				return "", fmt.Errorf("pool not found")
+			}
 			return "", nil
 		},
 	}
@@ -122,17 +198,152 @@ func TestCreatePool(t *testing.T) {
 }
 
 func TestUpdatePool(t *testing.T) {
-	// the pool did not change for properties that are updatable
+	// the pool did not change
 	old := rookalpha.PoolSpec{FailureDomain: "osd", ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: 2, DataChunks: 2}}
-	new := rookalpha.PoolSpec{FailureDomain: "host", ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: 3, DataChunks: 3}}
+	new := rookalpha.PoolSpec{FailureDomain: "osd", ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: 2, DataChunks: 2}}
 	changed := poolChanged(old, new)
 	assert.False(t, changed)
 
+	// the failure domain and erasure code changes are applied or reported in the status
+	new = rookalpha.PoolSpec{FailureDomain: "host", ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: 2, DataChunks: 2}}
+	assert.True(t, poolChanged(old, new))
+	new = rookalpha.PoolSpec{FailureDomain: "osd", ErasureCoded: rookalpha.ErasureCodedSpec{CodingChunks: 3, DataChunks: 3}}
+	assert.True(t, poolChanged(old, new))
+
 	// the pool changed for properties that are updatable
 	old = rookalpha.PoolSpec{FailureDomain: "osd", Replicated: rookalpha.ReplicatedSpec{Size: 1}}
 	new = rookalpha.PoolSpec{FailureDomain: "osd", Replicated: rookalpha.ReplicatedSpec{Size: 2}}
 	changed = poolChanged(old, new)
 	assert.True(t, changed)
+
+	// the quotas, compression, and parameters are updatable
+	new = rookalpha.PoolSpec{FailureDomain: "osd", Replicated: rookalpha.ReplicatedSpec{Size: 1}, Quotas: rookalpha.QuotaSpec{MaxObjects: 10}}
+	assert.True(t, poolChanged(old, new))
+	new = rookalpha.PoolSpec{FailureDomain: "osd", Replicated: rookalpha.ReplicatedSpec{Size: 1}, Compression: rookalpha.CompressionSpec{Mode: "force"}}
+	assert.True(t, poolChanged(old, new))
+	new = rookalpha.PoolSpec{FailureDomain: "osd", Replicated: rookalpha.ReplicatedSpec{Size: 1}, Parameters: map[string]string{"nodeep-scrub": "1"}}
+	assert.True(t, poolChanged(old, new))
+}
+
+func TestUpdateExistingPool(t *testing.T) {
+	profile, rule := "", "mypool"
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "pool" && args[2] == "get" {
+				return fmt.Sprintf(`{"pool":"mypool","pool_id":1,"size":3}{"pool":"mypool","crush_rule":"%s"}`, rule) +
+					fmt.Sprintf(`{"pool":"mypool","erasure_code_profile":"%s"}`, profile), nil
+			}
+			if args[1] == "lspools" {
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			}
+			if args[1] == "pool" && args[2] == "set" && args[4] == "crush_rule" {
+				rule = args[5]
+			}
+			if args[1] == "crush" && args[2] == "dump" {
+				return `{"types":[{"type_id":0,"name":"osd"},{"type_id":1,"name":"host"},{"type_id":3,"name":"rack"}],` +
+					`"rules":[{"rule_id":1,"rule_name":"mypool","steps":[{"op":"take","item":-1,"item_name":"default"},` +
+					`{"op":"chooseleaf_firstn","num":0,"type":"host"},{"op":"emit"}]}]}`, nil
+			}
+			if args[1] == "erasure-code-profile" && args[2] == "get" {
+				return `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van"}`, nil
+			}
+			if args[2] != "set-quota" && !(args[2] == "set" && args[4] == "compression_mode") {
+				commands = append(commands, cephCommand(args))
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+	p.Spec.FailureDomain = "host"
+
+	// nothing changes when the pool matches the spec
+	err := createPool(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the pool is switched to a new rule for the failure domain and the replaced rule is removed
+	p.Spec.FailureDomain = "rack"
+	err = createPool(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"osd crush rule create-simple mypool_default_rack default rack",
+		"osd pool set mypool crush_rule mypool_default_rack",
+		"osd crush rule rm mypool",
+	}, commands)
+
+	// a replicated pool cannot be changed to erasure coded
+	p.Spec.Replicated.Size = 0
+	p.Spec.ErasureCoded = rookalpha.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}
+	err = createPool(context, p)
+	assert.NotNil(t, err)
+
+	// the chunks of an erasure coded pool cannot be changed, but the failure domain can
+	profile, rule = "mypool_ecprofile", "mypool"
+	commands = []string{}
+	err = createPool(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "osd crush rule create-erasure mypool_default_rack mypool_ecprofile_rack", commands[1])
+	p.Spec.ErasureCoded.DataChunks = 4
+	err = createPool(context, p)
+	assert.NotNil(t, err)
+}
+
+func TestUpdatePoolPlacement(t *testing.T) {
+	rule := "mypool_ssd_host"
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "pool" && args[2] == "get" {
+				return fmt.Sprintf(`{"pool":"mypool","pool_id":1,"size":3,"min_size":2,"crush_rule":"%s"}`, rule), nil
+			}
+			if args[1] == "lspools" {
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			}
+			if args[1] == "pool" && args[2] == "set" && args[4] == "crush_rule" {
+				rule = args[5]
+			}
+			if args[1] == "crush" && args[2] == "dump" {
+				return `{"buckets":[{"id":-1,"name":"ssd","type_name":"root"},{"id":-2,"name":"hdd","type_name":"root"}]}`, nil
+			}
+			if args[2] != "set-quota" && !(args[2] == "set" && args[4] == "compression_mode") {
+				commands = append(commands, cephCommand(args))
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated = rookalpha.ReplicatedSpec{Size: 3, MinSize: 2, CrushRoot: "ssd"}
+
+	// nothing changes when the pool matches the spec
+	err := createPool(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the min size and the crush root are changed
+	p.Spec.Replicated.MinSize = 1
+	p.Spec.Replicated.CrushRoot = "hdd"
+	err = createPool(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"osd pool set mypool min_size 1",
+		"osd crush rule create-simple mypool_hdd_host hdd host",
+		"osd pool set mypool crush_rule mypool_hdd_host",
+		"osd crush rule rm mypool_ssd_host",
+	}, commands)
+}
+
+// the ceph command without the connection and format args
+func cephCommand(args []string) string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			return strings.Join(args[:i], " ")
+		}
+	}
+	return strings.Join(args, " ")
 }
 
 func TestDeletePool(t *testing.T) {
@@ -164,3 +375,277 @@ func TestDeletePool(t *testing.T) {
 	err = deletePool(context, p)
 	assert.Nil(t, err)
 }
+
+func TestGrowPGCount(t *testing.T) {
+	pgNum, pgpNum := 64, 64
+	sets := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "pool" && args[2] == "get" {
+				return fmt.Sprintf(`{"pool":"mypool","pool_id":1,"size":3}{"pool":"mypool","pg_num":%d}{"pool":"mypool","pgp_num":%d}`, pgNum, pgpNum), nil
+			}
+			if args[1] == "pool" && args[2] == "set" {
+				sets = append(sets, fmt.Sprintf("%s=%s", args[4], args[5]))
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+	p.Spec.ExpectedDataPercent = 100
+
+	status := ceph.CephStatus{}
+	status.OsdMap.OsdMap.NumOsd = 10
+	status.PgMap.PgsByState = []ceph.PgStateEntry{{StateName: "active+clean", Count: 64}}
+
+	// the pg count doubles toward the target of 512 pgs
+	changed, err := growPGCount(context, p, status)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"pg_num=128"}, sets)
+
+	// the pgp count follows once the pgs are created
+	pgNum = 128
+	changed, err = growPGCount(context, p, status)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "pgp_num=128", sets[1])
+
+	// nothing changes while the pgs are not clean
+	pgpNum = 128
+	status.PgMap.PgsByState = []ceph.PgStateEntry{{StateName: "active+clean", Count: 100}, {StateName: "active+remapped+backfilling", Count: 28}}
+	changed, err = growPGCount(context, p, status)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 2, len(sets))
+
+	// the pgs being scrubbed are clean
+	status.PgMap.PgsByState = []ceph.PgStateEntry{{StateName: "active+clean", Count: 100}, {StateName: "active+clean+scrubbing+deep", Count: 28}}
+	changed, err = growPGCount(context, p, status)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "pg_num=256", sets[2])
+
+	// the pg count is not decreased when it is above the target
+	pgNum, pgpNum = 1024, 1024
+	status.PgMap.PgsByState = []ceph.PgStateEntry{{StateName: "active+clean", Count: 1024}}
+	changed, err = growPGCount(context, p, status)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 3, len(sets))
+}
+
+func TestPGStateClean(t *testing.T) {
+	assert.True(t, pgStateClean("active+clean"))
+	assert.True(t, pgStateClean("active+clean+scrubbing"))
+	assert.True(t, pgStateClean("active+clean+scrubbing+deep"))
+	assert.False(t, pgStateClean("active"))
+	assert.False(t, pgStateClean("peering"))
+	assert.False(t, pgStateClean("active+undersized+degraded"))
+	assert.False(t, pgStateClean("active+recovering+degraded"))
+	assert.False(t, pgStateClean("active+remapped+backfilling"))
+	assert.False(t, pgStateClean("active+clean+remapped"))
+}
+
+func TestPoolUsage(t *testing.T) {
+	images, filesystems, apps := "[]", "[]", "{}"
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			switch cephCommand(args) {
+			case "osd lspools":
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			case "fs ls":
+				return filesystems, nil
+			case "osd pool application get mypool":
+				return apps, nil
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == "rbd" {
+				return images, nil
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+
+	// a volume in a pool with the same name in another cluster
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "block"}, Parameters: map[string]string{"pool": "mypool", "clusterName": "othercluster"}}
+	_, err := clientset.StorageV1().StorageClasses().Create(sc)
+	assert.Nil(t, err)
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+			Driver:  "rook.io/rook",
+			Options: map[string]string{"pool": "mypool", "storageClass": "block", "image": "pvc-1"},
+		}}},
+	}
+	_, err = clientset.CoreV1().PersistentVolumes().Create(pv)
+	assert.Nil(t, err)
+	reason, err := poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+
+	// the volume is in the pool of this cluster
+	sc.Parameters["clusterName"] = "myns"
+	_, err = clientset.StorageV1().StorageClasses().Update(sc)
+	assert.Nil(t, err)
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "it is used by the persistent volumes pvc-1", reason)
+
+	// the cluster recorded in the options of the volume has precedence over its storage class
+	pv.Spec.FlexVolume.Options["clusterName"] = "othercluster"
+	_, err = clientset.CoreV1().PersistentVolumes().Update(pv)
+	assert.Nil(t, err)
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+	assert.Nil(t, clientset.CoreV1().PersistentVolumes().Delete("pvc-1", &metav1.DeleteOptions{}))
+
+	// the pool has images
+	images = `[{"image":"img1","size":1048576,"format":2}]`
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "it has 1 rbd images", reason)
+
+	// the pool is used by a file system
+	images = "[]"
+	filesystems = `[{"name":"myfs","metadata_pool":"myfs-metadata","data_pools":["mypool"]}]`
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "it is used by file system myfs", reason)
+
+	// the pool is used by an object store
+	filesystems = "[]"
+	apps = `{"rgw":{}}`
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "it is used by an object store", reason)
+
+	// the rbd pool without images is not in use even though it keeps its rbd_directory and rbd_info objects
+	apps = `{"rbd":{}}`
+	reason, err = poolUsage(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestDeletePoolInUse(t *testing.T) {
+	deleteRetryInterval = 0
+	deleted := false
+	lspoolsErr := error(nil)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			switch cephCommand(args) {
+			case "osd lspools":
+				if deleted {
+					return "[]", nil
+				}
+				return `[{"poolnum":1,"poolname":"mypool"}]`, lspoolsErr
+			case "fs ls":
+				return "[]", nil
+			case "osd pool application get mypool":
+				return "{}", nil
+			case "osd pool delete mypool mypool":
+				deleted = true
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == "rbd" {
+				return `[{"image":"img1","size":1048576,"format":2}]`, nil
+			}
+			return "", nil
+		},
+	}
+	rookClientset := rookfake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: fake.NewSimpleClientset(), RookClientset: rookClientset}
+	c := NewPoolController(context)
+
+	now := metav1.Now()
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns", Finalizers: []string{finalizerName}, DeletionTimestamp: &now}}
+	_, err := rookClientset.RookV1alpha1().Pools("myns").Create(p)
+	assert.Nil(t, err)
+
+	// the finalizer is kept when the usage of the pool cannot be checked
+	lspoolsErr = fmt.Errorf("mock failure")
+	c.handleDelete(p)
+	assert.False(t, deleted)
+	p, err = rookClientset.RookV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, rookalpha.PoolFailed, p.Status.State)
+	assert.Equal(t, []string{finalizerName}, p.Finalizers)
+	lspoolsErr = nil
+
+	// the pool is not deleted while it has images
+	c.handleDelete(p)
+	assert.False(t, deleted)
+	p, err = rookClientset.RookV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, rookalpha.PoolFailed, p.Status.State)
+	assert.Contains(t, p.Status.Message, "it has 1 rbd images")
+	assert.Equal(t, []string{finalizerName}, p.Finalizers)
+
+	// the pool is deleted with the force annotation and the finalizer is removed
+	p.Annotations = map[string]string{ForceDeleteAnnotation: "true"}
+	c.handleDelete(p)
+	assert.True(t, deleted)
+	p, err = rookClientset.RookV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(p.Finalizers))
+}
+
+func TestDeletePoolWithoutFinalizer(t *testing.T) {
+	deleteRetryInterval = 0
+	images := `[{"image":"img1","size":1048576,"format":2}]`
+	deleted := false
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			switch cephCommand(args) {
+			case "osd lspools":
+				if deleted {
+					return "[]", nil
+				}
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			case "fs ls":
+				return "[]", nil
+			case "osd pool application get mypool":
+				return "{}", nil
+			case "osd pool delete mypool mypool":
+				deleted = true
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == "rbd" {
+				return images, nil
+			}
+			return "", nil
+		},
+	}
+	rookClientset := rookfake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: fake.NewSimpleClientset(), RookClientset: rookClientset}
+	c := NewPoolController(context)
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+
+	// the crd of a pool in use is created again with the finalizer
+	c.onDelete(p)
+	assert.False(t, deleted)
+	restored, err := rookClientset.RookV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{finalizerName}, restored.Finalizers)
+	assert.Equal(t, uint(3), restored.Spec.Replicated.Size)
+	assert.Nil(t, rookClientset.RookV1alpha1().Pools("myns").Delete("mypool", &metav1.DeleteOptions{}))
+
+	// the unused pool is deleted with its crd
+	images = "[]"
+	c.onDelete(p)
+	assert.True(t, deleted)
+	_, err = rookClientset.RookV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
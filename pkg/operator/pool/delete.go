@@ -0,0 +1,260 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ForceDeleteAnnotation on a pool crd allows the pool to be deleted even if it is still in use
+	ForceDeleteAnnotation = "rook.io/force-delete"
+)
+
+var (
+	finalizerName  = fmt.Sprintf("%s.%s", customResourceName, rookalpha.CustomResourceGroup)
+	flexDriverName = fmt.Sprintf("%s/%s", flexvolume.FlexvolumeVendor, flexvolume.FlexvolumeDriver)
+
+	deleteRetryInterval = 5 * time.Second
+	deleteMaxRetries    = 5
+)
+
+// deletes the pool when its crd is deleted, unless the pool is still in use. The finalizer keeps the crd until the
+// pool is confirmed to be deleted so the reason the pool was not deleted can be reported in the status. If the pool
+// could not be deleted, the deletion is attempted again when the crd is updated or the operator restarts.
+func (c *PoolController) handleDelete(p *rookalpha.Pool) {
+	if !hasFinalizer(p) {
+		return
+	}
+
+	reason, err := c.deleteUnusedPool(p)
+	if err != nil {
+		logger.Errorf("failed to delete pool %s. %+v", p.Name, err)
+		c.updateStatus(p, err)
+		return
+	}
+	if reason != "" {
+		logger.Warningf("not deleting pool %s. %s", p.Name, reason)
+		c.saveStatus(p, rookalpha.PoolStatus{
+			State:   rookalpha.PoolFailed,
+			Message: fmt.Sprintf("the pool was not deleted since %s. set the annotation %s to \"true\" to delete it anyway", reason, ForceDeleteAnnotation),
+		})
+		return
+	}
+
+	if err := c.removeFinalizer(p); err != nil {
+		logger.Errorf("failed to remove finalizer from pool %s. %+v", p.Name, err)
+	}
+}
+
+// deletes the pool unless it is in use, retrying when the usage or the deletion of the pool cannot be confirmed.
+// The reason is returned if the pool is in use.
+func (c *PoolController) deleteUnusedPool(p *rookalpha.Pool) (string, error) {
+	var err error
+	for i := 0; i < deleteMaxRetries; i++ {
+		if i > 0 {
+			logger.Infof("retrying the deletion of pool %s in %s. %+v", p.Name, deleteRetryInterval, err)
+			<-time.After(deleteRetryInterval)
+		}
+
+		var reason string
+		if reason, err = tryDeleteUnusedPool(c.context, p); err == nil {
+			return reason, nil
+		}
+	}
+	return "", err
+}
+
+// a single attempt to delete the pool. A nil error means the pool is in use or confirmed to be gone.
+func tryDeleteUnusedPool(context *clusterd.Context, p *rookalpha.Pool) (string, error) {
+	if !forceDelete(p) {
+		reason, err := poolUsage(context, p)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if the pool is in use. %+v", err)
+		}
+		if reason != "" {
+			return reason, nil
+		}
+	}
+
+	if err := deletePool(context, p); err != nil {
+		return "", err
+	}
+	exists, err := poolExists(context, p)
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm the pool was deleted. %+v", err)
+	}
+	if exists {
+		return "", fmt.Errorf("pool %s still exists after it was deleted", p.Name)
+	}
+	return "", nil
+}
+
+// creates the crd of a pool again after the crd was deleted without a finalizer while the pool could not be deleted,
+// so the pool keeps being managed and can be deleted through its crd later
+func (c *PoolController) restorePoolCRD(p *rookalpha.Pool) {
+	pool := &rookalpha.Pool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        p.Name,
+			Namespace:   p.Namespace,
+			Labels:      p.Labels,
+			Annotations: p.Annotations,
+			Finalizers:  []string{finalizerName},
+		},
+		Spec: p.Spec,
+	}
+	if _, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Create(pool); err != nil {
+		logger.Errorf("failed to create the crd of pool %s again. the pool is no longer managed. %+v", p.Name, err)
+		return
+	}
+	logger.Infof("created the crd of pool %s again since the pool was not deleted", p.Name)
+}
+
+// checks if the pool is still used by volumes, images, file systems, or object stores. The reason is returned if the
+// pool is in use, otherwise an empty string.
+func poolUsage(context *clusterd.Context, p *rookalpha.Pool) (string, error) {
+	exists, err := poolExists(context, p)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if the pool exists. %+v", err)
+	}
+	if !exists {
+		return "", nil
+	}
+
+	volumes, err := poolVolumes(context, p)
+	if err != nil {
+		return "", err
+	}
+	if len(volumes) > 0 {
+		return fmt.Sprintf("it is used by the persistent volumes %s", strings.Join(volumes, ", ")), nil
+	}
+
+	images, err := ceph.ListImages(context, p.Namespace, p.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list images. %+v", err)
+	}
+	if len(images) > 0 {
+		return fmt.Sprintf("it has %d rbd images", len(images)), nil
+	}
+
+	filesystems, err := ceph.ListFilesystems(context, p.Namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to list file systems. %+v", err)
+	}
+	for _, fs := range filesystems {
+		if fs.MetadataPool == p.Name || contains(fs.DataPools, p.Name) {
+			return fmt.Sprintf("it is used by file system %s", fs.Name), nil
+		}
+	}
+
+	apps, err := ceph.GetPoolApplications(context, p.Namespace, p.Name)
+	if err != nil {
+		return "", err
+	}
+	if contains(apps, "rgw") {
+		return "it is used by an object store", nil
+	}
+
+	// the objects in the pool are not counted since an rbd pool keeps its rbd_directory and rbd_info objects
+	// after all its images are removed
+	return "", nil
+}
+
+// gets the persistent volumes that the flex driver mounts from the pool
+func poolVolumes(context *clusterd.Context, p *rookalpha.Pool) ([]string, error) {
+	pvs, err := context.Clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes. %+v", err)
+	}
+
+	var volumes []string
+	for _, pv := range pvs.Items {
+		flex := pv.Spec.FlexVolume
+		if flex == nil || flex.Driver != flexDriverName || flex.Options[flexvolume.PoolKey] != p.Name {
+			continue
+		}
+
+		// pools in other clusters can have the same name
+		clusterName, err := flexvolume.GetVolumeClusterName(context.Clientset, &pv)
+		if err == nil {
+			if clusterName != p.Namespace {
+				continue
+			}
+		} else {
+			// assume the volume is in the pool if its cluster is unknown
+			logger.Warningf("failed to get the cluster of volume %s. %+v", pv.Name, err)
+		}
+		volumes = append(volumes, pv.Name)
+	}
+	return volumes, nil
+}
+
+func forceDelete(p *rookalpha.Pool) bool {
+	return p.Annotations[ForceDeleteAnnotation] == "true"
+}
+
+func hasFinalizer(p *rookalpha.Pool) bool {
+	return contains(p.Finalizers, finalizerName)
+}
+
+func (c *PoolController) addFinalizer(p *rookalpha.Pool) error {
+	if hasFinalizer(p) {
+		return nil
+	}
+
+	// get the latest pool since the status may have been updated
+	pool, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pool. %+v", err)
+	}
+	if hasFinalizer(pool) {
+		return nil
+	}
+	pool.Finalizers = append(pool.Finalizers, finalizerName)
+	if _, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Update(pool); err != nil {
+		return fmt.Errorf("failed to update pool. %+v", err)
+	}
+
+	logger.Infof("added finalizer to pool %s", p.Name)
+	return nil
+}
+
+func (c *PoolController) removeFinalizer(p *rookalpha.Pool) error {
+	pool, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pool. %+v", err)
+	}
+	for i, finalizer := range pool.Finalizers {
+		if finalizer == finalizerName {
+			pool.Finalizers = append(pool.Finalizers[:i], pool.Finalizers[i+1:]...)
+			break
+		}
+	}
+	if _, err := c.context.RookClientset.RookV1alpha1().Pools(p.Namespace).Update(pool); err != nil {
+		return fmt.Errorf("failed to update pool. %+v", err)
+	}
+
+	logger.Infof("removed finalizer from pool %s", p.Name)
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/rbd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// the keys of the secret of a mirroring peer
+	peerClusterKey = "cluster"
+	peerClientKey  = "client"
+	peerMonHostKey = "monHost"
+	peerKeyKey     = "key"
+
+	defaultPeerClient = "client.admin"
+)
+
+var (
+	mirroringModes          = []string{"pool", "image"}
+	mirroringStatusInterval = time.Minute
+)
+
+// a peer cluster as found in the secret of the peer
+type mirroringPeer struct {
+	cluster string
+	client  string
+	monHost string
+	key     string
+}
+
+// enables the mirroring of the pool in the mode of the spec and registers the peers of the spec. The peers that are no
+// longer in the spec are removed.
+func configureMirroring(context *clusterd.Context, p *rookalpha.Pool) error {
+	info, err := ceph.GetPoolMirroringInfo(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if info.Mode != p.Spec.Mirroring.Mode {
+		if err := ceph.EnablePoolMirroring(context, p.Namespace, p.Name, p.Spec.Mirroring.Mode); err != nil {
+			return err
+		}
+	}
+
+	wanted := map[string]bool{}
+	for _, peerSpec := range p.Spec.Mirroring.Peers {
+		peer, err := loadMirroringPeer(context, p.Namespace, peerSpec.SecretName)
+		if err != nil {
+			return err
+		}
+		if peer.cluster == p.Namespace {
+			return fmt.Errorf("peer cluster %s in secret %s must not have the name of the local cluster", peer.cluster, peerSpec.SecretName)
+		}
+
+		// the rbd-mirror daemons find the config of the peer cluster by its name
+		if err := savePeerConfig(context, p.Namespace, peer); err != nil {
+			return err
+		}
+
+		wanted[peerName(peer.client, peer.cluster)] = true
+		if !peerRegistered(info.Peers, peer) {
+			if err := ceph.AddPoolMirroringPeer(context, p.Namespace, p.Name, peer.client, peer.cluster); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, peer := range info.Peers {
+		if !wanted[peerName(peer.ClientName, peer.ClusterName)] {
+			if err := ceph.RemovePoolMirroringPeer(context, p.Namespace, p.Name, peer.UUID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removes the peers of the pool and disables its mirroring
+func disableMirroring(context *clusterd.Context, p *rookalpha.Pool) error {
+	info, err := ceph.GetPoolMirroringInfo(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if info.Mode == ceph.MirroringModeDisabled {
+		return nil
+	}
+
+	for _, peer := range info.Peers {
+		if err := ceph.RemovePoolMirroringPeer(context, p.Namespace, p.Name, peer.UUID); err != nil {
+			return err
+		}
+	}
+	return ceph.DisablePoolMirroring(context, p.Namespace, p.Name)
+}
+
+// gets the mirroring status of the pool and its images
+func mirroringStatus(context *clusterd.Context, p *rookalpha.Pool) (*rookalpha.MirroringStatus, error) {
+	status, err := ceph.GetPoolMirroringStatus(context, p.Namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &rookalpha.MirroringStatus{Health: status.Summary.Health}
+	for _, image := range status.Images {
+		result.Images = append(result.Images, rookalpha.ImageMirroringStatus{
+			Name:        image.Name,
+			State:       image.State,
+			Description: image.Description,
+		})
+	}
+	return result, nil
+}
+
+// refreshes the mirroring status of the mirrored pools periodically until the stop channel is closed
+func (c *PoolController) watchMirroringStatus(namespace string, stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the mirroring status checks in namespace %s", namespace)
+			return
+		case <-time.After(mirroringStatusInterval):
+			c.refreshMirroringStatus(namespace)
+		}
+	}
+}
+
+func (c *PoolController) refreshMirroringStatus(namespace string) {
+	pools, err := c.context.RookClientset.RookV1alpha1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		logger.Warningf("failed to list pools to refresh their mirroring status. %+v", err)
+		return
+	}
+
+	for i := range pools.Items {
+		p := &pools.Items[i]
+		if p.Spec.Mirroring.Mode == "" || p.DeletionTimestamp != nil || p.Status.State != rookalpha.PoolCreated {
+			continue
+		}
+
+		mirroring, err := mirroringStatus(c.context, p)
+		if err != nil {
+			logger.Warningf("failed to get the mirroring status of pool %s. %+v", p.Name, err)
+			continue
+		}
+		status := p.Status.DeepCopy()
+		status.Mirroring = mirroring
+		c.saveStatus(p, *status)
+	}
+}
+
+// loads the cluster name, client name, mon endpoints, and key of a peer cluster from its secret
+func loadMirroringPeer(context *clusterd.Context, namespace, secretName string) (*mirroringPeer, error) {
+	secret, err := context.Clientset.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirroring peer secret %s. %+v", secretName, err)
+	}
+
+	peer := &mirroringPeer{
+		cluster: string(secret.Data[peerClusterKey]),
+		client:  string(secret.Data[peerClientKey]),
+		monHost: string(secret.Data[peerMonHostKey]),
+		key:     string(secret.Data[peerKeyKey]),
+	}
+	if peer.client == "" {
+		peer.client = defaultPeerClient
+	}
+	if peer.cluster == "" || peer.monHost == "" || peer.key == "" {
+		return nil, fmt.Errorf("mirroring peer secret %s must have the %s, %s, and %s", secretName, peerClusterKey, peerMonHostKey, peerKeyKey)
+	}
+	return peer, nil
+}
+
+// saves the config and keyring of the peer cluster in the secret mounted by the rbd-mirror daemons. The files are named
+// as ceph expects for a cluster: <cluster>.conf and <cluster>.<client>.keyring.
+func savePeerConfig(context *clusterd.Context, namespace string, peer *mirroringPeer) error {
+	config := fmt.Sprintf("[global]\nmon host = %s\n", peer.monHost)
+	keyring := fmt.Sprintf("[%s]\n\tkey = %s\n", peer.client, peer.key)
+	configName := fmt.Sprintf("%s.conf", peer.cluster)
+	keyringName := fmt.Sprintf("%s.%s.keyring", peer.cluster, peer.client)
+
+	secrets := context.Clientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(rbd.PeersSecretName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get rbd-mirror peers secret. %+v", err)
+		}
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: rbd.PeersSecretName, Namespace: namespace},
+			Data:       map[string][]byte{configName: []byte(config), keyringName: []byte(keyring)},
+			Type:       k8sutil.RookType,
+		}
+		if _, err := secrets.Create(secret); err != nil {
+			return fmt.Errorf("failed to create rbd-mirror peers secret. %+v", err)
+		}
+		return nil
+	}
+
+	if string(secret.Data[configName]) == config && string(secret.Data[keyringName]) == keyring {
+		return nil
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[configName] = []byte(config)
+	secret.Data[keyringName] = []byte(keyring)
+	if _, err := secrets.Update(secret); err != nil {
+		return fmt.Errorf("failed to update rbd-mirror peers secret. %+v", err)
+	}
+	logger.Infof("saved the config of mirroring peer cluster %s", peer.cluster)
+	return nil
+}
+
+func peerRegistered(peers []ceph.MirroringPeer, peer *mirroringPeer) bool {
+	for _, p := range peers {
+		if p.ClusterName == peer.cluster && p.ClientName == peer.client {
+			return true
+		}
+	}
+	return false
+}
+
+func peerName(client, cluster string) string {
+	return fmt.Sprintf("%s@%s", client, cluster)
+}
+
+func validateMirroring(m rookalpha.MirroringSpec) error {
+	if m.Mode == "" {
+		if len(m.Peers) > 0 {
+			return fmt.Errorf("mirroring peers require a mirroring mode")
+		}
+		return nil
+	}
+	if !contains(mirroringModes, m.Mode) {
+		return fmt.Errorf("unrecognized mirroring mode %s", m.Mode)
+	}
+	for _, peer := range m.Peers {
+		if peer.SecretName == "" {
+			return fmt.Errorf("missing secret name of mirroring peer")
+		}
+	}
+	return nil
+}
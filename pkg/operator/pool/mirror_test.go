@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/cluster/ceph/rbd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigureMirroring(t *testing.T) {
+	mode := "disabled"
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if args[0] == "mirror" && args[2] == "info" {
+				return fmt.Sprintf(`{"mode":"%s","peers":[{"uuid":"1234","cluster_name":"old","client_name":"client.admin"}]}`, mode), nil
+			}
+			commands = append(commands, cephCommand(args))
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	p := &rookalpha.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Mirroring = rookalpha.MirroringSpec{Mode: "pool", Peers: []rookalpha.MirroringPeerSpec{{SecretName: "site-b"}}}
+
+	// fail when the peer secret is not found
+	err := configureMirroring(context, p)
+	assert.NotNil(t, err)
+
+	// the mirroring is enabled, the new peer is added, and the peer no longer in the spec is removed
+	peerSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "site-b", Namespace: "myns"},
+		Data: map[string][]byte{
+			"cluster": []byte("siteb"),
+			"monHost": []byte("10.0.0.1:6790,10.0.0.2:6790"),
+			"key":     []byte("mysecurekey"),
+		},
+	}
+	_, err = clientset.CoreV1().Secrets("myns").Create(peerSecret)
+	assert.Nil(t, err)
+	commands = []string{}
+	err = configureMirroring(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"mirror pool enable mypool pool",
+		"mirror pool peer add mypool client.admin@siteb",
+		"mirror pool peer remove mypool 1234",
+	}, commands)
+
+	// the config of the peer is saved for the rbd-mirror daemons
+	secret, err := clientset.CoreV1().Secrets("myns").Get(rbd.PeersSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "[global]\nmon host = 10.0.0.1:6790,10.0.0.2:6790\n", string(secret.Data["siteb.conf"]))
+	assert.Equal(t, "[client.admin]\n\tkey = mysecurekey\n", string(secret.Data["siteb.client.admin.keyring"]))
+
+	// the peer cannot have the name of the local cluster
+	peerSecret.Data["cluster"] = []byte("myns")
+	_, err = clientset.CoreV1().Secrets("myns").Update(peerSecret)
+	assert.Nil(t, err)
+	err = configureMirroring(context, p)
+	assert.NotNil(t, err)
+
+	// the peers are removed before the mirroring is disabled
+	mode = "pool"
+	commands = []string{}
+	err = disableMirroring(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mirror pool peer remove mypool 1234", "mirror pool disable mypool"}, commands)
+}
+
+func TestValidateMirroring(t *testing.T) {
+	assert.Nil(t, validateMirroring(rookalpha.MirroringSpec{}))
+	assert.Nil(t, validateMirroring(rookalpha.MirroringSpec{Mode: "image", Peers: []rookalpha.MirroringPeerSpec{{SecretName: "site-b"}}}))
+
+	assert.NotNil(t, validateMirroring(rookalpha.MirroringSpec{Mode: "all"}))
+	assert.NotNil(t, validateMirroring(rookalpha.MirroringSpec{Peers: []rookalpha.MirroringPeerSpec{{SecretName: "site-b"}}}))
+	assert.NotNil(t, validateMirroring(rookalpha.MirroringSpec{Mode: "pool", Peers: []rookalpha.MirroringPeerSpec{{}}}))
+}
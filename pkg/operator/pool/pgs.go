@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	pgAutoscalerModule = "pg_autoscaler"
+
+	// the pg count of a pool at most doubles in one step so only part of the data moves at a time
+	pgGrowthFactor = 2
+)
+
+var pgCheckInterval = 5 * time.Minute
+
+// the pg states in which data is still moving. The other states such as scrubbing can be combined with active+clean.
+var movingPGStates = map[string]bool{
+	"degraded":      true,
+	"peering":       true,
+	"recovering":    true,
+	"recovery_wait": true,
+	"backfilling":   true,
+	"backfill_wait": true,
+	"remapped":      true,
+}
+
+// checks the pg counts of the pools periodically until the stop channel is closed
+func (c *PoolController) watchPGCounts(namespace string, stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the pg count checks in namespace %s", namespace)
+			return
+		case <-time.After(pgCheckInterval):
+			if err := reconcilePGCounts(c.context, namespace); err != nil {
+				logger.Warningf("failed to check the pg counts of the pools in namespace %s. %+v", namespace, err)
+			}
+		}
+	}
+}
+
+// grows the placement groups of the pools with an expected data percent toward the count for the current number
+// of osds. If the pg autoscaler of the mgr is available, it sizes the pools instead.
+func reconcilePGCounts(context *clusterd.Context, namespace string) error {
+	pools, err := context.RookClientset.RookV1alpha1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pools. %+v", err)
+	}
+
+	autoscale, err := ceph.MgrModuleAvailable(context, namespace, pgAutoscalerModule)
+	if err != nil {
+		return err
+	}
+
+	status, err := ceph.Status(context, namespace)
+	if err != nil {
+		return err
+	}
+
+	for i := range pools.Items {
+		p := &pools.Items[i]
+		if p.Spec.ExpectedDataPercent == 0 || p.DeletionTimestamp != nil {
+			continue
+		}
+
+		if autoscale {
+			if err := enablePGAutoscale(context, p); err != nil {
+				logger.Warningf("failed to enable the pg autoscaler for pool %s. %+v", p.Name, err)
+			}
+			continue
+		}
+
+		changed, err := growPGCount(context, p, status)
+		if err != nil {
+			logger.Warningf("failed to grow the pg count of pool %s. %+v", p.Name, err)
+			continue
+		}
+		if changed {
+			// the other pools wait for the placement groups to be clean again
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// runs the next step to grow the placement groups of the pool. The pgp_num follows the pg_num once the new
+// placement groups are created, and the pg_num only grows when all the placement groups are clean.
+func growPGCount(context *clusterd.Context, p *rookalpha.Pool, status ceph.CephStatus) (bool, error) {
+	details, err := ceph.GetPoolDetails(context, p.Namespace, p.Name)
+	if err != nil {
+		return false, err
+	}
+
+	target := ceph.ComputePGCount(status.OsdMap.OsdMap.NumOsd, p.Spec.Width(), p.Spec.ExpectedDataPercent)
+	if details.PGPCount >= details.PGCount && details.PGCount >= target {
+		// the pg count is never decreased
+		return false, nil
+	}
+
+	if !pgsClean(status) {
+		logger.Infof("waiting for the placement groups to be clean before growing the pg count of pool %s", p.Name)
+		return false, nil
+	}
+
+	if details.PGPCount < details.PGCount {
+		logger.Infof("setting pgp_num of pool %s to %d", p.Name, details.PGCount)
+		return true, ceph.SetPoolProperty(context, p.Namespace, p.Name, "pgp_num", strconv.Itoa(details.PGCount))
+	}
+
+	next := details.PGCount * pgGrowthFactor
+	if next > target {
+		next = target
+	}
+	logger.Infof("growing pg_num of pool %s from %d to %d (target %d)", p.Name, details.PGCount, next, target)
+	return true, ceph.SetPoolProperty(context, p.Namespace, p.Name, "pg_num", strconv.Itoa(next))
+}
+
+// whether all the pgs are active and clean with no data moving
+func pgsClean(status ceph.CephStatus) bool {
+	for _, state := range status.PgMap.PgsByState {
+		if state.Count > 0 && !pgStateClean(state.StateName) {
+			return false
+		}
+	}
+	return true
+}
+
+// whether the pg state, such as active+clean+scrubbing, is active and clean
+func pgStateClean(stateName string) bool {
+	active, clean := false, false
+	for _, state := range strings.Split(stateName, "+") {
+		switch {
+		case state == "active":
+			active = true
+		case state == "clean":
+			clean = true
+		case movingPGStates[state]:
+			return false
+		}
+	}
+	return active && clean
+}
+
+// computes the pg count of the pool for the current number of osds
+func targetPGCount(context *clusterd.Context, namespace string, spec *rookalpha.PoolSpec) (int, error) {
+	status, err := ceph.Status(context, namespace)
+	if err != nil {
+		return 0, err
+	}
+	return ceph.ComputePGCount(status.OsdMap.OsdMap.NumOsd, spec.Width(), spec.ExpectedDataPercent), nil
+}
+
+// lets the mgr size the placement groups of the pool from its expected share of the data
+func enablePGAutoscale(context *clusterd.Context, p *rookalpha.Pool) error {
+	if err := ceph.MgrEnableModule(context, p.Namespace, pgAutoscalerModule, false); err != nil {
+		return err
+	}
+	if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "pg_autoscale_mode", "on"); err != nil {
+		return err
+	}
+	ratio := strconv.FormatFloat(float64(p.Spec.ExpectedDataPercent)/100, 'f', -1, 64)
+	return ceph.SetPoolProperty(context, p.Namespace, p.Name, "target_size_ratio", ratio)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the number of random bytes in the passphrase of an encrypted volume
+const volumePassphraseBytes = 32
+
+// generateVolumeKey creates the secret with a new random passphrase for an encrypted volume
+func (p *RookVolumeProvisioner) generateVolumeKey(clusterName, image string) error {
+	buf := make([]byte, volumePassphraseBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate the passphrase of volume %s. %+v", image, err)
+	}
+	return p.saveVolumeKey(clusterName, image, flexvolume.VolumeKeySecretData(base64.StdEncoding.EncodeToString(buf)))
+}
+
+// saveVolumeKey stores the passphrase of an encrypted volume in a secret of the cluster namespace for the agents
+func (p *RookVolumeProvisioner) saveVolumeKey(clusterName, image string, data map[string][]byte) error {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      flexvolume.VolumeKeySecretName(image),
+			Namespace: clusterName,
+		},
+		Data: data,
+		Type: k8sutil.RookType,
+	}
+	secrets := p.context.Clientset.CoreV1().Secrets(clusterName)
+	if _, err := secrets.Create(secret); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to save the passphrase of volume %s. %+v", image, err)
+		}
+		if _, err := secrets.Update(secret); err != nil {
+			return fmt.Errorf("failed to update the passphrase of volume %s. %+v", image, err)
+		}
+	}
+	return nil
+}
+
+// getVolumeKey returns the data of the secret with the passphrase of a volume, or nil if the volume is not encrypted
+func (p *RookVolumeProvisioner) getVolumeKey(clusterName, image string) (map[string][]byte, error) {
+	secretName := flexvolume.VolumeKeySecretName(image)
+	secret, err := p.context.Clientset.CoreV1().Secrets(clusterName).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the passphrase of volume %s. %+v", image, err)
+	}
+	return secret.Data, nil
+}
+
+// deleteVolumeKey deletes the secret with the passphrase of an encrypted volume
+func (p *RookVolumeProvisioner) deleteVolumeKey(clusterName, image string) error {
+	secretName := flexvolume.VolumeKeySecretName(image)
+	err := p.context.Clientset.CoreV1().Secrets(clusterName).Delete(secretName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the passphrase of volume %s. %+v", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	cephtest "github.com/rook/rook/pkg/daemon/ceph/test"
+	"github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProvisionEncryptedImage(t *testing.T) {
+	clientset := test.New(3)
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if strings.Contains(command, "ceph-authtool") {
+				cephtest.CreateConfigDir(path.Join(configDir, "testCluster"))
+			}
+			if command == "rbd" && (args[0] == "create" || args[0] == "ls") {
+				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
+			}
+			if command == "rbd" && args[0] == "snap" {
+				return "[]", nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Clientset: clientset, Executor: executor, ConfigDir: configDir}
+	provisioner := New(context)
+
+	volume := newVolumeOptions(newStorageClass("class-1", "rook.io/block", map[string]string{"pool": "testpool", "clusterName": "testCluster", "encrypted": "true"}),
+		newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "true", pv.Spec.FlexVolume.Options["encrypted"])
+
+	// a passphrase is generated for the volume in the cluster namespace
+	secret, err := clientset.CoreV1().Secrets("testCluster").Get("rook-ceph-volume-key-pvc-uid-1-1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 44, len(secret.Data["passphrase"]))
+
+	// the passphrase is deleted with the volume
+	err = provisioner.Delete(pv)
+	assert.Nil(t, err)
+	_, err = clientset.CoreV1().Secrets("testCluster").Get("rook-ceph-volume-key-pvc-uid-1-1", metav1.GetOptions{})
+	assert.NotNil(t, err)
+
+	_, err = parseClassParameters(map[string]string{"pool": "testpool", "encrypted": "maybe"})
+	assert.NotNil(t, err)
+}
+
+func TestProvisionEncryptedImageFailure(t *testing.T) {
+	clientset := test.New(3)
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	createErr := fmt.Errorf("mock create failure")
+	deleted := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if strings.Contains(command, "ceph-authtool") {
+				cephtest.CreateConfigDir(path.Join(configDir, "testCluster"))
+			}
+			if command == "rbd" && args[0] == "create" {
+				return "", createErr
+			}
+			if command == "rbd" && args[0] == "ls" {
+				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
+			}
+			if command == "rbd" && args[0] == "rm" {
+				deleted = append(deleted, args[1])
+			}
+			if command == "rbd" && args[0] == "snap" {
+				return "[]", nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Clientset: clientset, Executor: executor, ConfigDir: configDir}
+	cfg, err := parseClassParameters(map[string]string{"pool": "testpool", "clusterName": "testCluster", "encrypted": "true"})
+	assert.Nil(t, err)
+	provisioner := New(context)
+
+	// no passphrase is saved when the image cannot be created
+	err = provisioner.provisionImage(cfg, "pvc-uid-1-1", 1048576)
+	assert.NotNil(t, err)
+	_, err = clientset.CoreV1().Secrets("testCluster").Get("rook-ceph-volume-key-pvc-uid-1-1", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the image is deleted when its passphrase cannot be saved
+	createErr = nil
+	clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("mock secret failure")
+	})
+	err = provisioner.provisionImage(cfg, "pvc-uid-1-1", 1048576)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"testpool/pvc-uid-1-1"}, deleted)
+}
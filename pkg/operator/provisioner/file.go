@@ -0,0 +1,374 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	opmon "github.com/rook/rook/pkg/operator/cluster/ceph/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/operator/provisioner/controller"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// the file system type that the flex driver mounts with the ceph kernel client
+	cephFSType = "ceph"
+
+	// the directory of the file system under which the volumes are created when the storage class has no path
+	defaultFileVolumeRoot = "/volumes"
+
+	// the job that creates and removes the directories of the volumes in the file system
+	volumeDirAppName    = "rook-ceph-volume-dir"
+	volumeDirJobNameFmt = "rook-ceph-volume-dir-%s"
+)
+
+var (
+	volumeDirJobInterval = 2 * time.Second
+	volumeDirJobTimeout  = 5 * time.Minute
+)
+
+// RookFileProvisioner is used to provision the volumes of Rook shared file systems on Kubernetes. Each volume is a
+// directory of the file system with a quota of the requested size that is only accessible by its own cephx client.
+type RookFileProvisioner struct {
+	context   *clusterd.Context
+	rookImage string
+}
+
+type fileProvisionerConfig struct {
+	// Required: The name of the file system to provision volumes from.
+	fsName string
+
+	// Optional: Name of the cluster. Default is `rook`
+	clusterName string
+
+	// Optional: The directory of the file system where the volume directories are created. Default is `/volumes`
+	rootPath string
+
+	// Optional: How the file system is mounted on the nodes, `kernel` or `fuse`. Default is `kernel` on the nodes where
+	// the ceph kernel module can be loaded, and `fuse` on the other nodes
+	mounter string
+}
+
+// NewFileProvisioner creates RookFileProvisioner
+func NewFileProvisioner(context *clusterd.Context, rookImage string) controller.Provisioner {
+	return &RookFileProvisioner{
+		context:   context,
+		rookImage: rookImage,
+	}
+}
+
+// Provision creates the directory of the new volume with a quota of the requested size and a cephx client restricted to
+// the directory, and returns a PV object representing it. The nodes only get the key of the client of the volume.
+func (p *RookFileProvisioner) Provision(options controller.VolumeOptions) (*v1.PersistentVolume, error) {
+	if options.PVC.Spec.Selector != nil {
+		return nil, fmt.Errorf("claim Selector is not supported")
+	}
+
+	cfg, err := parseFileClassParameters(options.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("creating file volume with configuration %+v", *cfg)
+
+	capacity := options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
+	requestBytes := capacity.Value()
+	if requestBytes <= 0 {
+		return nil, fmt.Errorf("file volume %s must request a size", options.PVName)
+	}
+
+	dataPools, err := getFilesystemDataPools(p.context, cfg.clusterName, cfg.fsName)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath := path.Join(cfg.rootPath, options.PVName)
+	if err := p.createVolumeDir(cfg.clusterName, cfg.fsName, volumePath, requestBytes); err != nil {
+		return nil, err
+	}
+	client := options.PVName
+	if err := p.createClient(cfg, client, volumePath, dataPools); err != nil {
+		if err := p.deleteVolumeDir(cfg.clusterName, cfg.fsName, volumePath); err != nil {
+			logger.Warningf("failed to delete the directory %s of the volume that was not provisioned. %+v", volumePath, err)
+		}
+		return nil, err
+	}
+
+	flexOptions := map[string]string{
+		flexvolume.ClusterNameKey: cfg.clusterName,
+		flexvolume.FsNameKey:      cfg.fsName,
+		flexvolume.PathKey:        volumePath,
+		flexvolume.ClientKey:      client,
+	}
+	if cfg.mounter != "" {
+		flexOptions[flexvolume.MounterKey] = cfg.mounter
+	}
+
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: options.PVName,
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: options.PersistentVolumeReclaimPolicy,
+			AccessModes:                   options.PVC.Spec.AccessModes,
+			Capacity: v1.ResourceList{
+				v1.ResourceName(v1.ResourceStorage): capacity,
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				FlexVolume: &v1.FlexVolumeSource{
+					Driver:  flexdriver,
+					FSType:  cephFSType,
+					Options: flexOptions,
+				},
+			},
+		},
+	}
+	logger.Infof("successfully created Rook file volume %+v", pv.Spec.PersistentVolumeSource.FlexVolume)
+	return pv, nil
+}
+
+// createClient creates a cephx client that can only access the given path of the file system and stores its key in a
+// secret of the cluster namespace for the agents
+func (p *RookFileProvisioner) createClient(cfg *fileProvisionerConfig, client, volumePath string, dataPools []string) error {
+	if len(dataPools) == 0 {
+		return fmt.Errorf("filesystem %s has no data pools for the client %s", cfg.fsName, client)
+	}
+	osdCaps := make([]string, 0, len(dataPools))
+	for _, pool := range dataPools {
+		osdCaps = append(osdCaps, fmt.Sprintf("allow rw pool=%s", pool))
+	}
+	access := []string{
+		"mon", "allow r",
+		"mds", fmt.Sprintf("allow rw path=%s", volumePath),
+		"osd", strings.Join(osdCaps, ", "),
+	}
+
+	key, err := ceph.AuthGetOrCreateKey(p.context, cfg.clusterName, getClientEntity(client), access)
+	if err != nil {
+		return fmt.Errorf("failed to create client %s for file volume path %s: %+v", client, volumePath, err)
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      flexvolume.FilesystemClientSecretName(client),
+			Namespace: cfg.clusterName,
+		},
+		Data: flexvolume.FilesystemClientSecretData(key),
+		Type: k8sutil.RookType,
+	}
+	secrets := p.context.Clientset.CoreV1().Secrets(cfg.clusterName)
+	if _, err := secrets.Create(secret); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to save the key of client %s. %+v", client, err)
+		}
+		if _, err := secrets.Update(secret); err != nil {
+			return fmt.Errorf("failed to update the key of client %s. %+v", client, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the cephx client of the volume, the secret with its key, and the directory of the volume with its
+// content.
+func (p *RookFileProvisioner) Delete(volume *v1.PersistentVolume) error {
+	logger.Infof("Deleting file volume %s", volume.Name)
+	flex := volume.Spec.PersistentVolumeSource.FlexVolume
+	if flex == nil {
+		return fmt.Errorf("Failed to delete rook file volume %s: %v", volume.Name, "PersistentVolume is not a FlexVolume")
+	}
+	client := flex.Options[flexvolume.ClientKey]
+	clusterName := flex.Options[flexvolume.ClusterNameKey]
+	if client == "" || clusterName == "" {
+		return fmt.Errorf("Failed to delete rook file volume %s: %v", volume.Name, "PersistentVolume has no client defined for the FlexVolume")
+	}
+
+	if err := ceph.AuthDelete(p.context, clusterName, getClientEntity(client)); err != nil {
+		return fmt.Errorf("Failed to delete client of rook file volume %s: %v", volume.Name, err)
+	}
+	secretName := flexvolume.FilesystemClientSecretName(client)
+	err := p.context.Clientset.CoreV1().Secrets(clusterName).Delete(secretName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Failed to delete secret %s of rook file volume %s: %v", secretName, volume.Name, err)
+	}
+	volumePath := flex.Options[flexvolume.PathKey]
+	fsName := flex.Options[flexvolume.FsNameKey]
+	if volumePath == "" || fsName == "" {
+		return fmt.Errorf("Failed to delete rook file volume %s: %v", volume.Name, "PersistentVolume has no path defined for the FlexVolume")
+	}
+	if err := p.deleteVolumeDir(clusterName, fsName, volumePath); err != nil {
+		return fmt.Errorf("Failed to delete directory of rook file volume %s: %v", volume.Name, err)
+	}
+	logger.Infof("succeeded deleting file volume %s", volume.Name)
+	return nil
+}
+
+// createVolumeDir creates the directory of a volume in the file system with a quota of the requested size
+func (p *RookFileProvisioner) createVolumeDir(clusterName, fsName, volumePath string, quota int64) error {
+	args := []string{"filesystem", "create-volume-dir", fmt.Sprintf("--quota-bytes=%d", quota)}
+	if err := p.runVolumeDirJob(clusterName, fsName, volumePath, args); err != nil {
+		return fmt.Errorf("failed to create directory %s in filesystem %s. %+v", volumePath, fsName, err)
+	}
+	logger.Infof("created directory %s in filesystem %s with a quota of %d bytes", volumePath, fsName, quota)
+	return nil
+}
+
+// deleteVolumeDir removes the directory of a volume and its content from the file system
+func (p *RookFileProvisioner) deleteVolumeDir(clusterName, fsName, volumePath string) error {
+	args := []string{"filesystem", "delete-volume-dir"}
+	if err := p.runVolumeDirJob(clusterName, fsName, volumePath, args); err != nil {
+		return fmt.Errorf("failed to remove directory %s from filesystem %s. %+v", volumePath, fsName, err)
+	}
+	logger.Infof("removed directory %s from filesystem %s", volumePath, fsName)
+	return nil
+}
+
+// runVolumeDirJob manages the directory of a volume in a job of the cluster namespace that mounts the root of the file
+// system as the admin with ceph-fuse. Only the job needs to be privileged for the mount, so the operator is not, and
+// the admin key is never passed to the nodes where the volumes are used. The job is removed after it completes.
+func (p *RookFileProvisioner) runVolumeDirJob(clusterName, fsName, volumePath string, args []string) error {
+	job := p.makeVolumeDirJob(clusterName, fsName, volumePath, args)
+	if err := k8sutil.RunReplaceableJob(p.context.Clientset, job); err != nil {
+		return fmt.Errorf("failed to run job %s. %+v", job.Name, err)
+	}
+	if err := k8sutil.WaitForJobCompletion(p.context.Clientset, clusterName, job.Name, volumeDirJobInterval, volumeDirJobTimeout); err != nil {
+		return err
+	}
+	if err := k8sutil.DeleteBatchJob(p.context.Clientset, clusterName, job.Name); err != nil {
+		logger.Warningf("failed to remove completed job %s. %+v", job.Name, err)
+	}
+	return nil
+}
+
+func (p *RookFileProvisioner) makeVolumeDirJob(clusterName, fsName, volumePath string, args []string) *batch.Job {
+	name := fmt.Sprintf(volumeDirJobNameFmt, path.Base(volumePath))
+	args = append(args, fmt.Sprintf("--fs-name=%s", fsName), fmt.Sprintf("--volume-path=%s", volumePath))
+
+	privileged := true
+	runAsUser := int64(0)
+	container := v1.Container{
+		Name:  volumeDirAppName,
+		Image: p.rookImage,
+		Args:  args,
+		VolumeMounts: []v1.VolumeMount{
+			{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+			k8sutil.ConfigOverrideMount(),
+		},
+		Env: []v1.EnvVar{
+			opmon.ClusterNameEnvVar(clusterName),
+			opmon.EndpointEnvVar(),
+			opmon.AdminSecretEnvVar(),
+			k8sutil.ConfigDirEnvVar(),
+			k8sutil.ConfigOverrideEnvVar(),
+		},
+		// ceph-fuse needs the fuse device to mount the file system
+		SecurityContext: &v1.SecurityContext{
+			Privileged: &privileged,
+			RunAsUser:  &runAsUser,
+		},
+	}
+
+	labels := map[string]string{
+		k8sutil.AppAttr:     volumeDirAppName,
+		k8sutil.ClusterAttr: clusterName,
+	}
+	return &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: clusterName,
+			Labels:    labels,
+		},
+		Spec: batch.JobSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   volumeDirAppName,
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					Containers:    []v1.Container{container},
+					RestartPolicy: v1.RestartPolicyOnFailure,
+					Volumes: []v1.Volume{
+						{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+						k8sutil.ConfigOverrideVolume(),
+					},
+				},
+			},
+		},
+	}
+}
+
+func getFilesystemDataPools(context *clusterd.Context, clusterName, fsName string) ([]string, error) {
+	filesystems, err := ceph.ListFilesystems(context, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filesystems in cluster %s. %+v", clusterName, err)
+	}
+	for _, fs := range filesystems {
+		if fs.Name == fsName {
+			return fs.DataPools, nil
+		}
+	}
+	return nil, fmt.Errorf("filesystem %s not found in cluster %s", fsName, clusterName)
+}
+
+func getClientEntity(client string) string {
+	return fmt.Sprintf("client.%s", client)
+}
+
+func parseFileClassParameters(params map[string]string) (*fileProvisionerConfig, error) {
+	var cfg fileProvisionerConfig
+
+	for k, v := range params {
+		switch strings.ToLower(k) {
+		case "fsname":
+			cfg.fsName = v
+		case "clustername":
+			cfg.clusterName = v
+		case "path":
+			cfg.rootPath = v
+		case "mounter":
+			cfg.mounter = v
+		default:
+			return nil, fmt.Errorf("invalid option %q for volume plugin %s", k, "rookFileProvisioner")
+		}
+	}
+
+	if len(cfg.fsName) == 0 {
+		return nil, fmt.Errorf("StorageClass for provisioner %s must contain 'fsName' parameter", "rookFileProvisioner")
+	}
+
+	if cfg.mounter != "" && cfg.mounter != flexvolume.MounterKernel && cfg.mounter != flexvolume.MounterFuse {
+		return nil, fmt.Errorf("invalid mounter %s for volume plugin %s", cfg.mounter, "rookFileProvisioner")
+	}
+
+	if len(cfg.clusterName) == 0 {
+		cfg.clusterName = k8sutil.DefaultClusterName
+	}
+
+	if len(cfg.rootPath) == 0 {
+		cfg.rootPath = defaultFileVolumeRoot
+	}
+	cfg.rootPath = path.Join("/", cfg.rootPath)
+
+	return &cfg, nil
+}
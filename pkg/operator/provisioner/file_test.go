@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProvisionFilesystem(t *testing.T) {
+	var authArgs []string
+	deleted := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "fs" && args[1] == "ls" {
+				return `[{"name":"myfs","metadata_pool":"myfs-metadata","data_pools":["myfs-data0","myfs-data1"]}]`, nil
+			}
+			if args[0] == "auth" && args[1] == "get-or-create-key" {
+				authArgs = args
+				return `{"key":"mysecretkey"}`, nil
+			}
+			if args[0] == "auth" && args[1] == "del" {
+				deleted = args[2]
+			}
+			return "", nil
+		},
+	}
+	clientset := test.New(3)
+	// the volume directory jobs complete as soon as they are created
+	jobs := []*batch.Job{}
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batch.Job)
+		job.Status.Succeeded = 1
+		jobs = append(jobs, job)
+		return false, nil, nil
+	})
+	context := &clusterd.Context{Clientset: clientset, Executor: executor}
+	provisioner := NewFileProvisioner(context, "rook/rook:myversion")
+
+	// the file system name is required
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil)
+	claim.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+	volume := newVolumeOptions(newStorageClass("class-1", "rook.io/file", map[string]string{"clusterName": "testCluster"}), claim)
+	_, err := provisioner.Provision(volume)
+	assert.NotNil(t, err)
+
+	// the file system must exist
+	volume = newVolumeOptions(newStorageClass("class-1", "rook.io/file", map[string]string{"fsName": "otherfs", "clusterName": "testCluster"}), claim)
+	_, err = provisioner.Provision(volume)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(jobs))
+
+	volume = newVolumeOptions(newStorageClass("class-1", "rook.io/file", map[string]string{"fsName": "myfs", "clusterName": "testCluster"}), claim)
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "pvc-uid-1-1", pv.Name)
+	assert.Equal(t, []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}, pv.Spec.AccessModes)
+	flex := pv.Spec.PersistentVolumeSource.FlexVolume
+	assert.Equal(t, "rook.io/rook", flex.Driver)
+	assert.Equal(t, "ceph", flex.FSType)
+	assert.Equal(t, "testCluster", flex.Options["clusterName"])
+	assert.Equal(t, "myfs", flex.Options["fsName"])
+	assert.Equal(t, "/volumes/pvc-uid-1-1", flex.Options["path"])
+	assert.Equal(t, "pvc-uid-1-1", flex.Options["client"])
+
+	// the directory of the volume is created with a quota by a privileged job in the cluster namespace
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "testCluster", jobs[0].Namespace)
+	assert.Equal(t, "rook-ceph-volume-dir-pvc-uid-1-1", jobs[0].Name)
+	container := jobs[0].Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "rook/rook:myversion", container.Image)
+	assert.Equal(t, []string{"filesystem", "create-volume-dir", "--quota-bytes=1048576", "--fs-name=myfs", "--volume-path=/volumes/pvc-uid-1-1"}, container.Args)
+	assert.True(t, *container.SecurityContext.Privileged)
+	_, err = clientset.BatchV1().Jobs("testCluster").Get("rook-ceph-volume-dir-pvc-uid-1-1", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the client is restricted to the volume path and the data pools of the file system
+	assert.Equal(t, []string{"auth", "get-or-create-key", "client.pvc-uid-1-1",
+		"mon", "allow r",
+		"mds", "allow rw path=/volumes/pvc-uid-1-1",
+		"osd", "allow rw pool=myfs-data0, allow rw pool=myfs-data1"}, authArgs[:9])
+	secret, err := clientset.CoreV1().Secrets("testCluster").Get("rook-ceph-client-pvc-uid-1-1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "mysecretkey", string(secret.Data["key"]))
+
+	// the client, its secret, and the directory are removed with the volume
+	err = provisioner.Delete(pv)
+	assert.Nil(t, err)
+	assert.Equal(t, "client.pvc-uid-1-1", deleted)
+	_, err = clientset.CoreV1().Secrets("testCluster").Get("rook-ceph-client-pvc-uid-1-1", metav1.GetOptions{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(jobs))
+	assert.Equal(t, []string{"filesystem", "delete-volume-dir", "--fs-name=myfs", "--volume-path=/volumes/pvc-uid-1-1"},
+		jobs[1].Spec.Template.Spec.Containers[0].Args)
+}
+
+func TestCreateClientWithoutDataPools(t *testing.T) {
+	context := &clusterd.Context{Clientset: test.New(3), Executor: &exectest.MockExecutor{}}
+	provisioner := &RookFileProvisioner{context: context}
+	cfg := &fileProvisionerConfig{fsName: "myfs", clusterName: "testCluster"}
+
+	// a client without access to any data pool would get an invalid osd cap
+	err := provisioner.createClient(cfg, "pvc-uid-1-1", "/volumes/pvc-uid-1-1", []string{})
+	assert.NotNil(t, err)
+}
+
+func TestParseFileClassParameters(t *testing.T) {
+	cfg, err := parseFileClassParameters(map[string]string{"fsName": "myfs", "path": "k8s/"})
+	assert.Nil(t, err)
+	assert.Equal(t, "myfs", cfg.fsName)
+	assert.Equal(t, "rook", cfg.clusterName)
+	assert.Equal(t, "/k8s", cfg.rootPath)
+
+	_, err = parseFileClassParameters(map[string]string{"fsName": "myfs", "pool": "mypool"})
+	assert.NotNil(t, err)
+
+	cfg, err = parseFileClassParameters(map[string]string{"fsName": "myfs", "mounter": "fuse"})
+	assert.Nil(t, err)
+	assert.Equal(t, "fuse", cfg.mounter)
+
+	_, err = parseFileClassParameters(map[string]string{"fsName": "myfs", "mounter": "rbd-nbd"})
+	assert.NotNil(t, err)
+}
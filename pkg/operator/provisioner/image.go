@@ -0,0 +1,99 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+// the rbd image features and the features they depend on
+var imageFeatureDependencies = map[string][]string{
+	"layering":       {},
+	"striping":       {},
+	"exclusive-lock": {},
+	"object-map":     {"exclusive-lock"},
+	"fast-diff":      {"object-map"},
+	"deep-flatten":   {},
+	"journaling":     {"exclusive-lock"},
+}
+
+// validateImageOptions checks the image options of a storage class before any image is created with them
+func validateImageOptions(opts ceph.ImageOptions) error {
+	switch opts.Format {
+	case "", "2":
+	case "1":
+		if opts.DataPool != "" || opts.Features != "" || opts.StripeUnit != "" || opts.StripeCount != "" {
+			return fmt.Errorf("images of format 1 cannot have a data pool, features, or striping")
+		}
+	default:
+		return fmt.Errorf("invalid image format %s", opts.Format)
+	}
+
+	if opts.Features != "" {
+		features := strings.Split(opts.Features, ",")
+		for _, feature := range features {
+			dependencies, ok := imageFeatureDependencies[feature]
+			if !ok {
+				return fmt.Errorf("unknown image feature %s", feature)
+			}
+			for _, dependency := range dependencies {
+				if !contains(features, dependency) {
+					return fmt.Errorf("image feature %s requires feature %s", feature, dependency)
+				}
+			}
+		}
+	}
+
+	if (opts.StripeUnit == "") != (opts.StripeCount == "") {
+		return fmt.Errorf("the stripe unit and the stripe count must be set together")
+	}
+	if opts.StripeCount != "" {
+		if count, err := strconv.Atoi(opts.StripeCount); err != nil || count <= 0 {
+			return fmt.Errorf("invalid stripe count %s", opts.StripeCount)
+		}
+	}
+	return nil
+}
+
+// addImageOptions records the image options that are set in the options of a volume
+func addImageOptions(flexOptions map[string]string, opts ceph.ImageOptions) {
+	for key, value := range map[string]string{
+		flexvolume.DataPoolKey:      opts.DataPool,
+		flexvolume.ImageFormatKey:   opts.Format,
+		flexvolume.ImageFeaturesKey: opts.Features,
+		flexvolume.ObjectSizeKey:    opts.ObjectSize,
+		flexvolume.StripeUnitKey:    opts.StripeUnit,
+		flexvolume.StripeCountKey:   opts.StripeCount,
+	} {
+		if value != "" {
+			flexOptions[key] = value
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
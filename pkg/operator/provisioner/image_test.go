@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"testing"
+
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateImageOptions(t *testing.T) {
+	assert.Nil(t, validateImageOptions(ceph.ImageOptions{}))
+	assert.Nil(t, validateImageOptions(ceph.ImageOptions{Format: "2", Features: "layering,exclusive-lock,object-map,fast-diff", DataPool: "ecpool"}))
+	assert.Nil(t, validateImageOptions(ceph.ImageOptions{ObjectSize: "8M", StripeUnit: "64K", StripeCount: "16"}))
+
+	// unknown format and features
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Format: "3"}))
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Features: "layering,foo"}))
+
+	// the features must be set with the features they depend on
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Features: "layering,object-map"}))
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Features: "exclusive-lock,fast-diff"}))
+
+	// format 1 images only support the object size
+	assert.Nil(t, validateImageOptions(ceph.ImageOptions{Format: "1", ObjectSize: "8M"}))
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Format: "1", DataPool: "ecpool"}))
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{Format: "1", Features: "layering"}))
+
+	// the stripe unit and count are set together
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{StripeUnit: "64K"}))
+	assert.NotNil(t, validateImageOptions(ceph.ImageOptions{StripeUnit: "64K", StripeCount: "0"}))
+}
+
+func TestParseClassImageOptions(t *testing.T) {
+	cfg, err := parseClassParameters(map[string]string{"pool": "replicapool", "dataPool": "ecpool", "imageFormat": "2",
+		"imageFeatures": "layering", "objectSize": "8M", "stripeUnit": "64K", "stripeCount": "16"})
+	assert.Nil(t, err)
+	assert.Equal(t, ceph.ImageOptions{DataPool: "ecpool", Format: "2", Features: "layering", ObjectSize: "8M", StripeUnit: "64K", StripeCount: "16"}, cfg.image)
+
+	flexOptions := map[string]string{}
+	addImageOptions(flexOptions, cfg.image)
+	assert.Equal(t, map[string]string{"dataPool": "ecpool", "imageFormat": "2", "imageFeatures": "layering",
+		"objectSize": "8M", "stripeUnit": "64K", "stripeCount": "16"}, flexOptions)
+
+	_, err = parseClassParameters(map[string]string{"pool": "replicapool", "imageFeatures": "fast-diff"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MigrateVolumes records the cluster on the rook block volumes that were provisioned before the cluster was stored in
+// their options. The cluster is taken from their storage class while it still exists, and is recorded in an
+// annotation since the source of a volume cannot be changed.
+func MigrateVolumes(context *clusterd.Context) error {
+	pvs, err := context.Clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volumes. %+v", err)
+	}
+
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if !needsMigration(pv) {
+			continue
+		}
+
+		clusterName, err := flexvolume.GetVolumeClusterName(context.Clientset, pv)
+		if err != nil {
+			logger.Warningf("failed to get the cluster of volume %s to record it. %+v", pv.Name, err)
+			continue
+		}
+		if pv.Annotations == nil {
+			pv.Annotations = map[string]string{}
+		}
+		pv.Annotations[flexvolume.ClusterNameAnnotation] = clusterName
+		if _, err := context.Clientset.CoreV1().PersistentVolumes().Update(pv); err != nil {
+			logger.Warningf("failed to record cluster %s on volume %s. %+v", clusterName, pv.Name, err)
+			continue
+		}
+		logger.Infof("recorded cluster %s on volume %s", clusterName, pv.Name)
+	}
+	return nil
+}
+
+// a rook block volume needs to be migrated if its cluster is neither in its options nor in its annotations
+func needsMigration(pv *v1.PersistentVolume) bool {
+	flex := pv.Spec.FlexVolume
+	if flex == nil || flex.Driver != flexdriver || flex.Options[flexvolume.ImageKey] == "" {
+		return false
+	}
+	return flex.Options[flexvolume.ClusterNameKey] == "" && pv.Annotations[flexvolume.ClusterNameAnnotation] == ""
+}
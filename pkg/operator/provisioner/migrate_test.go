@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigrateVolumes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset}
+
+	sc := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-block"},
+		Parameters: map[string]string{"pool": "pool1", "clusterName": "mycluster"},
+	}
+	_, err := clientset.StorageV1().StorageClasses().Create(sc)
+	assert.Nil(t, err)
+
+	newPV := func(name, storageClass string, options map[string]string) *v1.PersistentVolume {
+		flexOptions := map[string]string{"pool": "pool1", "image": name, "storageClass": storageClass}
+		for k, v := range options {
+			flexOptions[k] = v
+		}
+		pv := &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+				Driver:  "rook.io/rook",
+				Options: flexOptions,
+			}}},
+		}
+		_, err := clientset.CoreV1().PersistentVolumes().Create(pv)
+		assert.Nil(t, err)
+		return pv
+	}
+	newPV("pvc-old", "rook-block", nil)
+	newPV("pvc-new", "rook-block", map[string]string{"clusterName": "othercluster"})
+	newPV("pvc-orphan", "deleted-class", nil)
+
+	err = MigrateVolumes(context)
+	assert.Nil(t, err)
+
+	// the cluster of the storage class is recorded on the old volume
+	pv, err := clientset.CoreV1().PersistentVolumes().Get("pvc-old", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "mycluster", pv.Annotations["rook.io/clusterName"])
+
+	// the volume with the cluster in its options is not changed
+	pv, err = clientset.CoreV1().PersistentVolumes().Get("pvc-new", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pv.Annotations))
+
+	// the volume whose storage class was deleted cannot be migrated
+	pv, err = clientset.CoreV1().PersistentVolumes().Get("pvc-orphan", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pv.Annotations))
+}
@@ -19,14 +19,17 @@ package provisioner
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
 	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
-	"github.com/rook/rook/pkg/operator/cluster"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/operator/provisioner/controller"
+	"github.com/rook/rook/pkg/operator/snapshot"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -39,12 +42,10 @@ const (
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-provisioner")
 var flexdriver = fmt.Sprintf("%s/%s", flexvolume.FlexvolumeVendor, flexvolume.FlexvolumeDriver)
 
-// RookVolumeProvisioner is used to provision Rook volumes on Kubernetes
+// RookVolumeProvisioner is used to provision Rook volumes on Kubernetes. The parameters of each volume are recorded
+// in the options of its PV so the volume does not depend on the provisioner or its storage class after it is created.
 type RookVolumeProvisioner struct {
 	context *clusterd.Context
-
-	// Configuration of rook volume provisioner
-	provConfig provisionerConfig
 }
 
 type provisionerConfig struct {
@@ -56,6 +57,17 @@ type provisionerConfig struct {
 
 	// Optional: File system type used for mounting the image. Default is `ext4`
 	fstype string
+
+	// Optional: The data pool, format, features, object size and striping of the image. Default is the rbd defaults
+	image ceph.ImageOptions
+
+	// Optional: How the image is mapped on the nodes, `krbd` or `rbd-nbd`. Default is `krbd` on the nodes where the rbd
+	// kernel module can be loaded, and `rbd-nbd` on the other nodes
+	mounter string
+
+	// Optional: Whether the volumes are encrypted with LUKS on the nodes with a passphrase generated for each volume.
+	// Default is `false`
+	encrypted bool
 }
 
 // New creates RookVolumeProvisioner
@@ -77,9 +89,8 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 	if err != nil {
 		return nil, err
 	}
-	p.provConfig = *cfg
 
-	logger.Infof("creating volume with configuration %+v", p.provConfig)
+	logger.Infof("creating volume with configuration %+v", *cfg)
 
 	capacity := options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
 	requestBytes := capacity.Value()
@@ -91,10 +102,20 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 		return nil, err
 	}
 
-	if err := p.createVolume(imageName, p.provConfig.pool, requestBytes); err != nil {
-		return nil, err
+	// the volume is cloned from a snapshot if the claim requests to restore one
+	if snapshotName, ok := options.PVC.Annotations[snapshot.RestoreAnnotation]; ok {
+		if err := p.restoreVolume(cfg, options.PVC.Namespace, snapshotName, imageName, requestBytes); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := p.provisionImage(cfg, imageName, requestBytes); err != nil {
+			return nil, err
+		}
 	}
 
+	flexOptions := volumeOptions(cfg, imageName)
+	flexOptions[flexvolume.StorageClassKey] = storageClass
+
 	pv := &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: imageName,
@@ -107,13 +128,9 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 			},
 			PersistentVolumeSource: v1.PersistentVolumeSource{
 				FlexVolume: &v1.FlexVolumeSource{
-					Driver: flexdriver,
-					FSType: p.provConfig.fstype,
-					Options: map[string]string{
-						flexvolume.StorageClassKey: storageClass,
-						flexvolume.PoolKey:         p.provConfig.pool,
-						flexvolume.ImageKey:        imageName,
-					},
+					Driver:  flexdriver,
+					FSType:  cfg.fstype,
+					Options: flexOptions,
 				},
 			},
 		},
@@ -122,13 +139,80 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 	return pv, nil
 }
 
+// BlockImageOptions returns the options that a block volume with the parameters of a rook block storage class is
+// attached with, which include its cluster and pool
+func BlockImageOptions(parameters map[string]string, image string) (map[string]string, error) {
+	cfg, err := parseClassParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return volumeOptions(cfg, image), nil
+}
+
+// CreateBlockImage creates the image of a block volume with the parameters of a rook block storage class. The CSI
+// driver creates its block volumes with it.
+func CreateBlockImage(context *clusterd.Context, parameters map[string]string, image string, size int64) error {
+	cfg, err := parseClassParameters(parameters)
+	if err != nil {
+		return err
+	}
+	p := &RookVolumeProvisioner{context: context}
+	return p.provisionImage(cfg, image, size)
+}
+
+// DeleteBlockImage deletes the image of a block volume and the passphrase of the volume if it is encrypted
+func DeleteBlockImage(context *clusterd.Context, clusterName, pool, image string) error {
+	p := &RookVolumeProvisioner{context: context}
+	return p.deleteImage(clusterName, pool, image, true)
+}
+
+// provisionImage creates the image of a new volume and then the passphrase of the volume if it is encrypted. The image
+// is deleted when its passphrase cannot be saved, so that a failed volume leaves neither an image nor a secret behind.
+func (p *RookVolumeProvisioner) provisionImage(cfg *provisionerConfig, image string, size int64) error {
+	if err := p.createVolume(cfg, image, size); err != nil {
+		return err
+	}
+	if cfg.encrypted {
+		if err := p.generateVolumeKey(cfg.clusterName, image); err != nil {
+			p.deleteFailedImage(cfg.clusterName, cfg.pool, image)
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFailedImage deletes the image of a volume that failed to be provisioned
+func (p *RookVolumeProvisioner) deleteFailedImage(clusterName, pool, image string) {
+	if err := ceph.DeleteImage(p.context, clusterName, image, pool); err != nil {
+		logger.Errorf("failed to delete rook block image %s/%s of the failed volume. %+v", pool, image, err)
+	}
+}
+
+// volumeOptions returns the options that a volume is attached with on the nodes
+func volumeOptions(cfg *provisionerConfig, image string) map[string]string {
+	options := map[string]string{
+		flexvolume.ClusterNameKey: cfg.clusterName,
+		flexvolume.PoolKey:        cfg.pool,
+		flexvolume.ImageKey:       image,
+	}
+	addImageOptions(options, cfg.image)
+	if cfg.mounter != "" {
+		options[flexvolume.MounterKey] = cfg.mounter
+	}
+	if cfg.encrypted {
+		options[flexvolume.EncryptedKey] = "true"
+	}
+	return options
+}
+
 // createVolume creates a rook block volume.
-func (p *RookVolumeProvisioner) createVolume(image, pool string, size int64) error {
+func (p *RookVolumeProvisioner) createVolume(cfg *provisionerConfig, image string, size int64) error {
+	pool := cfg.pool
 	if image == "" || pool == "" || size == 0 {
 		return fmt.Errorf("image missing required fields (image=%s, pool=%s, size=%d)", image, pool, size)
 	}
 
-	createdImage, err := ceph.CreateImage(p.context, p.provConfig.clusterName, image, pool, uint64(size))
+	createdImage, err := ceph.CreateImageWithOptions(p.context, cfg.clusterName, image, pool, cfg.image, uint64(size))
 	if err != nil {
 		return fmt.Errorf("Failed to create rook block image %s/%s: %v", pool, image, err)
 	}
@@ -137,25 +221,96 @@ func (p *RookVolumeProvisioner) createVolume(image, pool string, size int64) err
 	return nil
 }
 
+// restoreVolume creates a rook block volume from the rbd snapshot of a volume snapshot. The clone is grown to the
+// requested size if it is larger than the snapshot.
+func (p *RookVolumeProvisioner) restoreVolume(cfg *provisionerConfig, namespace, snapshotName, image string, size int64) error {
+	pool := cfg.pool
+	if image == "" || pool == "" || size == 0 {
+		return fmt.Errorf("image missing required fields (image=%s, pool=%s, size=%d)", image, pool, size)
+	}
+
+	volumeSnapshot, err := p.context.RookClientset.RookV1alpha1().VolumeSnapshots(namespace).Get(snapshotName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get volume snapshot %s to restore. %+v", snapshotName, err)
+	}
+	status := volumeSnapshot.Status
+	if status.State != rookalpha.VolumeSnapshotCreated {
+		return fmt.Errorf("volume snapshot %s is not created. state=%s", snapshotName, status.State)
+	}
+	if status.ClusterName != cfg.clusterName {
+		return fmt.Errorf("volume snapshot %s in cluster %s cannot be restored in cluster %s", snapshotName, status.ClusterName, cfg.clusterName)
+	}
+	if uint64(size) < status.Size {
+		return fmt.Errorf("requested size %d is less than the size %d of volume snapshot %s", size, status.Size, snapshotName)
+	}
+
+	// the clone of an encrypted volume has the LUKS header of the volume, so it is encrypted with the same passphrase
+	sourceKey, err := p.getVolumeKey(status.ClusterName, status.Image)
+	if err != nil {
+		return err
+	}
+	if sourceKey == nil && cfg.encrypted {
+		return fmt.Errorf("volume snapshot %s of an unencrypted volume cannot be restored in an encrypted volume", snapshotName)
+	}
+
+	if err := ceph.CloneSnapshot(p.context, status.ClusterName, status.Pool, status.Image, status.Snapshot, pool, image); err != nil {
+		return fmt.Errorf("Failed to restore volume snapshot %s in rook block image %s/%s: %v", snapshotName, pool, image, err)
+	}
+	if uint64(size) > status.Size {
+		if err := ceph.ResizeImage(p.context, status.ClusterName, image, pool, uint64(size)); err != nil {
+			return fmt.Errorf("Failed to resize restored rook block image %s/%s: %v", pool, image, err)
+		}
+	}
+	if sourceKey != nil {
+		if err := p.saveVolumeKey(cfg.clusterName, image, sourceKey); err != nil {
+			p.deleteFailedImage(cfg.clusterName, pool, image)
+			return err
+		}
+		cfg.encrypted = true
+	}
+	logger.Infof("Rook block image %s restored from snapshot %s of image %s/%s", image, status.Snapshot, status.Pool, status.Image)
+
+	return nil
+}
+
 // Delete removes the storage asset that was created by Provision represented
 // by the given PV.
 func (p *RookVolumeProvisioner) Delete(volume *v1.PersistentVolume) error {
 	logger.Infof("Deleting volume %s", volume.Name)
 	if volume.Spec.PersistentVolumeSource.FlexVolume == nil {
-		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", p.provConfig.pool, volume.Name, "PersistentVolume is not a FlexVolume")
+		return fmt.Errorf("Failed to delete rook block image %s: %v", volume.Name, "PersistentVolume is not a FlexVolume")
 	}
-	if volume.Spec.PersistentVolumeSource.FlexVolume.Options == nil {
-		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", p.provConfig.pool, volume.Name, "PersistentVolume has no image defined for the FlexVolume")
+	options := volume.Spec.PersistentVolumeSource.FlexVolume.Options
+	name := options[flexvolume.ImageKey]
+	pool := options[flexvolume.PoolKey]
+	if name == "" || pool == "" {
+		return fmt.Errorf("Failed to delete rook block image %s: %v", volume.Name, "PersistentVolume has no image defined for the FlexVolume")
 	}
-	name := volume.Spec.PersistentVolumeSource.FlexVolume.Options[flexvolume.ImageKey]
-	err := ceph.DeleteImage(p.context, p.provConfig.clusterName, name, p.provConfig.pool)
+	clusterName, err := flexvolume.GetVolumeClusterName(p.context.Clientset, volume)
 	if err != nil {
-		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", p.provConfig.pool, volume.Name, err)
+		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", pool, name, err)
+	}
+	if err := p.deleteImage(clusterName, pool, name, options[flexvolume.EncryptedKey] == "true"); err != nil {
+		return err
 	}
 	logger.Infof("succeeded deleting volume %+v", volume)
 	return nil
 }
 
+// deleteImage deletes the image of a volume, and the passphrase of the volume if it is encrypted
+func (p *RookVolumeProvisioner) deleteImage(clusterName, pool, name string, encrypted bool) error {
+	err := ceph.DeleteImage(p.context, clusterName, name, pool)
+	if err != nil {
+		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", pool, name, err)
+	}
+	if encrypted {
+		if err := p.deleteVolumeKey(clusterName, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseStorageClass(options controller.VolumeOptions) (string, error) {
 	if options.PVC.Spec.StorageClassName != nil {
 		return *options.PVC.Spec.StorageClassName, nil
@@ -180,17 +335,45 @@ func parseClassParameters(params map[string]string) (*provisionerConfig, error)
 			cfg.clusterName = v
 		case "fstype":
 			cfg.fstype = v
+		case "datapool":
+			cfg.image.DataPool = v
+		case "imageformat":
+			cfg.image.Format = v
+		case "imagefeatures":
+			cfg.image.Features = v
+		case "objectsize":
+			cfg.image.ObjectSize = v
+		case "stripeunit":
+			cfg.image.StripeUnit = v
+		case "stripecount":
+			cfg.image.StripeCount = v
+		case "mounter":
+			cfg.mounter = v
+		case "encrypted":
+			encrypted, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid encrypted value %q for volume plugin %s", v, "rookVolumeProvisioner")
+			}
+			cfg.encrypted = encrypted
 		default:
 			return nil, fmt.Errorf("invalid option %q for volume plugin %s", k, "rookVolumeProvisioner")
 		}
 	}
 
+	if err := validateImageOptions(cfg.image); err != nil {
+		return nil, fmt.Errorf("invalid image options for volume plugin %s. %+v", "rookVolumeProvisioner", err)
+	}
+
+	if cfg.mounter != "" && cfg.mounter != flexvolume.MounterKRBD && cfg.mounter != flexvolume.MounterNBD {
+		return nil, fmt.Errorf("invalid mounter %s for volume plugin %s", cfg.mounter, "rookVolumeProvisioner")
+	}
+
 	if len(cfg.pool) == 0 {
 		return nil, fmt.Errorf("StorageClass for provisioner %s must contain 'pool' parameter", "rookVolumeProvisioner")
 	}
 
 	if len(cfg.clusterName) == 0 {
-		cfg.clusterName = cluster.DefaultClusterName
+		cfg.clusterName = k8sutil.DefaultClusterName
 	}
 
 	return &cfg, nil
@@ -23,7 +23,10 @@ import (
 	"strings"
 	"testing"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	cephtest "github.com/rook/rook/pkg/daemon/ceph/test"
 	"github.com/rook/rook/pkg/operator/provisioner/controller"
 	"github.com/rook/rook/pkg/operator/test"
@@ -77,6 +80,101 @@ func TestProvisionImage(t *testing.T) {
 	assert.Equal(t, "class-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["storageClass"])
 	assert.Equal(t, "testpool", pv.Spec.PersistentVolumeSource.FlexVolume.Options["pool"])
 	assert.Equal(t, "pvc-uid-1-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["image"])
+	assert.Equal(t, "testCluster", pv.Spec.PersistentVolumeSource.FlexVolume.Options["clusterName"])
+}
+
+func TestDeleteFromVolumeOptions(t *testing.T) {
+	var rmArgs []string
+	snapshots := "[]"
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "snap" && args[1] == "ls" {
+				return snapshots, nil
+			}
+			if command == "rbd" && args[0] == "rm" {
+				rmArgs = args
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Clientset: test.New(3), Executor: executor}
+	provisioner := New(context)
+
+	// the image is deleted from the pool and cluster recorded on the volume, not from the last provisioned volume
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-uid-1-1"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+			Driver:  "rook.io/rook",
+			Options: map[string]string{"storageClass": "class-1", "clusterName": "cluster2", "pool": "pool2", "image": "pvc-uid-1-1"},
+		}}},
+	}
+	err := provisioner.Delete(pv)
+	assert.Nil(t, err)
+	assert.Equal(t, "pool2/pvc-uid-1-1", rmArgs[1])
+	assert.Equal(t, "--cluster=cluster2", rmArgs[2])
+
+	// the volumes provisioned before the cluster was recorded in their options have it in an annotation
+	delete(pv.Spec.FlexVolume.Options, "clusterName")
+	pv.Annotations = map[string]string{"rook.io/clusterName": "cluster3"}
+	err = provisioner.Delete(pv)
+	assert.Nil(t, err)
+	assert.Equal(t, "--cluster=cluster3", rmArgs[2])
+
+	// the image is not deleted while it has snapshots
+	rmArgs = nil
+	snapshots = `[{"id":4,"name":"snap1","size":1048576},{"id":5,"name":"snap2","size":1048576}]`
+	err = provisioner.Delete(pv)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "has snapshots snap1,snap2")
+	assert.Nil(t, rmArgs)
+}
+
+func TestProvisionFromSnapshot(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			commands = append(commands, strings.Join(args[:2], " "))
+			return "", nil
+		},
+	}
+	rookClientset := rookfake.NewSimpleClientset()
+	context := &clusterd.Context{
+		Clientset:     test.New(3),
+		RookClientset: rookClientset,
+		Executor:      executor,
+	}
+
+	provisioner := New(context)
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil)
+	claim.Annotations = map[string]string{"rook.io/snapshot": "snap1"}
+	claim.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("2Mi")
+	volume := newVolumeOptions(newStorageClass("class-1", "rook.io/block", map[string]string{"pool": "testpool", "clusterName": "testCluster"}), claim)
+
+	// the volume snapshot must exist
+	_, err := provisioner.Provision(volume)
+	assert.NotNil(t, err)
+
+	// the volume snapshot must be in the same cluster
+	snapshot := &rookalpha.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "snap1", Namespace: v1.NamespaceDefault},
+		Status: rookalpha.VolumeSnapshotStatus{
+			State: rookalpha.VolumeSnapshotCreated, ClusterName: "otherCluster", Pool: "pool1", Image: "image1", Snapshot: "snap1", Size: 1048576,
+		},
+	}
+	_, err = rookClientset.RookV1alpha1().VolumeSnapshots(v1.NamespaceDefault).Create(snapshot)
+	assert.Nil(t, err)
+	_, err = provisioner.Provision(volume)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the snapshot is cloned and grown to the requested size
+	snapshot.Status.ClusterName = "testCluster"
+	_, err = rookClientset.RookV1alpha1().VolumeSnapshots(v1.NamespaceDefault).Update(snapshot)
+	assert.Nil(t, err)
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "pvc-uid-1-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["image"])
+	assert.Equal(t, []string{"clone pool1/image1@snap1", "resize testpool/pvc-uid-1-1"}, commands)
 }
 
 func TestParseClassParameters(t *testing.T) {
@@ -103,6 +201,7 @@ func TestParseClassParametersDefault(t *testing.T) {
 	assert.Equal(t, "testPool", provConfig.pool)
 	assert.Equal(t, "rook", provConfig.clusterName)
 	assert.Equal(t, "", provConfig.fstype)
+	assert.Equal(t, ceph.ImageOptions{}, provConfig.image)
 }
 
 func TestParseClassParametersNoPool(t *testing.T) {
@@ -170,3 +269,12 @@ func newClaim(name, claimUID, provisioner, volumeName, storageclassName string,
 	}
 	return claim
 }
+
+func TestParseClassMounter(t *testing.T) {
+	cfg, err := parseClassParameters(map[string]string{"pool": "replicapool", "mounter": "rbd-nbd"})
+	assert.Nil(t, err)
+	assert.Equal(t, "rbd-nbd", cfg.mounter)
+
+	_, err = parseClassParameters(map[string]string{"pool": "replicapool", "mounter": "fuse"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// the claims are resynced periodically so the expansions that failed are retried
+var resizeResyncPeriod = time.Minute
+
+// ResizeController expands the images of the rook block volumes when their claims request more storage
+type ResizeController struct {
+	context *clusterd.Context
+}
+
+// NewResizeController creates a controller that expands the rook block volumes
+func NewResizeController(context *clusterd.Context) *ResizeController {
+	return &ResizeController{context: context}
+}
+
+// Run watches the persistent volume claims in all namespaces until the stop channel is closed
+func (c *ResizeController) Run(stopCh chan struct{}) {
+	logger.Infof("watching the persistent volume claims for volume expansions")
+	source := cache.NewListWatchFromClient(c.context.Clientset.CoreV1().RESTClient(), "persistentvolumeclaims", v1.NamespaceAll, fields.Everything())
+	_, controller := cache.NewInformer(source, &v1.PersistentVolumeClaim{}, resizeResyncPeriod, cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+	})
+	controller.Run(stopCh)
+}
+
+func (c *ResizeController) onAdd(obj interface{}) {
+	c.resizeClaim(obj.(*v1.PersistentVolumeClaim))
+}
+
+func (c *ResizeController) onUpdate(oldObj, newObj interface{}) {
+	c.resizeClaim(newObj.(*v1.PersistentVolumeClaim))
+}
+
+func (c *ResizeController) resizeClaim(pvc *v1.PersistentVolumeClaim) {
+	if pvc.Status.Phase != v1.ClaimBound {
+		return
+	}
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	capacity := pvc.Status.Capacity[v1.ResourceStorage]
+	if requested.Cmp(capacity) <= 0 {
+		return
+	}
+
+	if err := expandVolume(c.context, pvc.DeepCopy()); err != nil {
+		logger.Errorf("failed to expand the volume of claim %s/%s. %+v", pvc.Namespace, pvc.Name, err)
+	}
+}
+
+// resizes the image of the rook block volume bound to the claim to the size requested by the claim. The
+// new size is set as the capacity of the volume and the claim. The agent on the node where the volume is attached
+// then resizes the LUKS device of an encrypted volume and grows its filesystem, or else the filesystem is grown when
+// the volume is next mounted.
+func expandVolume(context *clusterd.Context, pvc *v1.PersistentVolumeClaim) error {
+	pv, err := context.Clientset.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get persistent volume %s. %+v", pvc.Spec.VolumeName, err)
+	}
+	flex := pv.Spec.FlexVolume
+	if flex == nil || flex.Driver != flexdriver || flex.Options[flexvolume.ImageKey] == "" {
+		// not a rook block volume
+		return nil
+	}
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	current := pv.Spec.Capacity[v1.ResourceStorage]
+	if requested.Cmp(current) > 0 {
+		clusterName, err := flexvolume.GetVolumeClusterName(context.Clientset, pv)
+		if err != nil {
+			return fmt.Errorf("failed to get cluster of volume %s. %+v", pv.Name, err)
+		}
+
+		image := flex.Options[flexvolume.ImageKey]
+		pool := flex.Options[flexvolume.PoolKey]
+		logger.Infof("expanding rook block image %s/%s from %s to %s", pool, image, current.String(), requested.String())
+		if err := ceph.ResizeImage(context, clusterName, image, pool, uint64(requested.Value())); err != nil {
+			return err
+		}
+
+		if pv.Spec.Capacity == nil {
+			pv.Spec.Capacity = v1.ResourceList{}
+		}
+		pv.Spec.Capacity[v1.ResourceStorage] = requested
+		if _, err := context.Clientset.CoreV1().PersistentVolumes().Update(pv); err != nil {
+			return fmt.Errorf("failed to update the capacity of volume %s. %+v", pv.Name, err)
+		}
+	}
+
+	if pvc.Status.Capacity == nil {
+		pvc.Status.Capacity = v1.ResourceList{}
+	}
+	pvc.Status.Capacity[v1.ResourceStorage] = requested
+	if _, err := context.Clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(pvc); err != nil {
+		return fmt.Errorf("failed to update the capacity of claim %s. %+v", pvc.Name, err)
+	}
+	logger.Infof("expanded volume %s of claim %s/%s to %s", pv.Name, pvc.Namespace, pvc.Name, requested.String())
+	return nil
+}
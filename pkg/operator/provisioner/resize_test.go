@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExpandVolume(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			commands = append(commands, strings.Join(args[:5], " "))
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset, Executor: executor}
+
+	sc := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-block"},
+		Parameters: map[string]string{"pool": "pool1", "clusterName": "mycluster"},
+	}
+	_, err := clientset.StorageV1().StorageClasses().Create(sc)
+	assert.Nil(t, err)
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1234"},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+				Driver:  "rook.io/rook",
+				Options: map[string]string{"pool": "pool1", "image": "pvc-1234", "storageClass": "rook-block"},
+			}},
+		},
+	}
+	_, err = clientset.CoreV1().PersistentVolumes().Create(pv)
+	assert.Nil(t, err)
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "myns"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			VolumeName: "pvc-1234",
+			Resources:  v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}},
+		},
+		Status: v1.PersistentVolumeClaimStatus{
+			Phase:    v1.ClaimBound,
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+		},
+	}
+	_, err = clientset.CoreV1().PersistentVolumeClaims("myns").Create(pvc)
+	assert.Nil(t, err)
+	c := NewResizeController(context)
+
+	// nothing is resized when the claim requests the same size
+	c.resizeClaim(pvc)
+	assert.Equal(t, 0, len(commands))
+
+	// the image is resized and the new size is reflected on the volume and the claim
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("2Gi")
+	c.resizeClaim(pvc)
+	assert.Equal(t, []string{"resize pool1/pvc-1234 --size 2048 --cluster=mycluster"}, commands)
+	pv, err = clientset.CoreV1().PersistentVolumes().Get("pvc-1234", metav1.GetOptions{})
+	assert.Nil(t, err)
+	capacity := pv.Spec.Capacity[v1.ResourceStorage]
+	assert.Equal(t, "2Gi", capacity.String())
+	pvc, err = clientset.CoreV1().PersistentVolumeClaims("myns").Get("claim1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	capacity = pvc.Status.Capacity[v1.ResourceStorage]
+	assert.Equal(t, "2Gi", capacity.String())
+
+	// the claim is not resized again
+	c.resizeClaim(pvc)
+	assert.Equal(t, 1, len(commands))
+
+	// the image of an encrypted volume is resized, and its LUKS device is resized by the agent
+	pv.Spec.FlexVolume.Options["encrypted"] = "true"
+	_, err = clientset.CoreV1().PersistentVolumes().Update(pv)
+	assert.Nil(t, err)
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("3Gi")
+	c.resizeClaim(pvc)
+	assert.Equal(t, "resize pool1/pvc-1234 --size 3072 --cluster=mycluster", commands[1])
+}
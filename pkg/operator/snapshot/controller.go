@@ -0,0 +1,319 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snapshot to manage the snapshots of rook block volumes.
+package snapshot
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/coreos/pkg/capnslog"
+	opkit "github.com/rook/operator-kit"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/agent/flexvolume"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"k8s.io/api/core/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	customResourceName       = "volumesnapshot"
+	customResourceNamePlural = "volumesnapshots"
+
+	// RestoreAnnotation on a persistent volume claim is the name of the volume snapshot in the same namespace to
+	// restore in the new volume
+	RestoreAnnotation = "rook.io/snapshot"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-snapshot")
+
+var (
+	finalizerName  = fmt.Sprintf("%s.%s", customResourceName, rookalpha.CustomResourceGroup)
+	flexDriverName = fmt.Sprintf("%s/%s", flexvolume.FlexvolumeVendor, flexvolume.FlexvolumeDriver)
+)
+
+// VolumeSnapshotResource represents the VolumeSnapshot custom resource object
+var VolumeSnapshotResource = opkit.CustomResource{
+	Name:    customResourceName,
+	Plural:  customResourceNamePlural,
+	Group:   rookalpha.CustomResourceGroup,
+	Version: rookalpha.Version,
+	Scope:   apiextensionsv1beta1.NamespaceScoped,
+	Kind:    reflect.TypeOf(rookalpha.VolumeSnapshot{}).Name(),
+}
+
+// VolumeSnapshotController represents a controller object for volume snapshot custom resources
+type VolumeSnapshotController struct {
+	context *clusterd.Context
+}
+
+// NewVolumeSnapshotController create controller for watching volume snapshot custom resources created
+func NewVolumeSnapshotController(context *clusterd.Context) *VolumeSnapshotController {
+	return &VolumeSnapshotController{
+		context: context,
+	}
+}
+
+// StartWatch watches for instances of VolumeSnapshot custom resources and acts on them
+func (c *VolumeSnapshotController) StartWatch(namespace string, stopCh chan struct{}) error {
+
+	resourceHandlerFuncs := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+		DeleteFunc: c.onDelete,
+	}
+
+	logger.Infof("start watching volume snapshot resources in namespace %s", namespace)
+	watcher := opkit.NewWatcher(VolumeSnapshotResource, namespace, resourceHandlerFuncs, c.context.RookClientset.Rook().RESTClient())
+	go watcher.Watch(&rookalpha.VolumeSnapshot{}, stopCh)
+	return nil
+}
+
+func (c *VolumeSnapshotController) onAdd(obj interface{}) {
+	snapshot := obj.(*rookalpha.VolumeSnapshot).DeepCopy()
+	if snapshot.DeletionTimestamp != nil {
+		// the snapshot was deleted while the operator was down
+		c.handleDelete(snapshot)
+		return
+	}
+
+	// the snapshot was already taken before the operator restarted
+	if snapshot.Status.State == rookalpha.VolumeSnapshotCreated {
+		if err := c.addFinalizer(snapshot); err != nil {
+			logger.Errorf("failed to add finalizer to volume snapshot %s. %+v", snapshot.Name, err)
+		}
+		return
+	}
+
+	status := CreateSnapshot(c.context, snapshot)
+	if status.State == rookalpha.VolumeSnapshotFailed {
+		logger.Errorf("failed to create volume snapshot %s. %s", snapshot.Name, status.Message)
+	} else {
+		logger.Infof("created snapshot %s of image %s in pool %s", status.Snapshot, status.Image, status.Pool)
+	}
+
+	if err := c.updateStatus(snapshot.Namespace, snapshot.Name, status); err != nil {
+		logger.Errorf("failed to update the status of volume snapshot %s. %+v", snapshot.Name, err)
+	}
+}
+
+func (c *VolumeSnapshotController) onUpdate(oldObj, newObj interface{}) {
+	oldSnapshot := oldObj.(*rookalpha.VolumeSnapshot)
+	snapshot := newObj.(*rookalpha.VolumeSnapshot).DeepCopy()
+	if snapshot.DeletionTimestamp != nil {
+		c.handleDelete(snapshot)
+		return
+	}
+	if oldSnapshot.Spec != snapshot.Spec {
+		logger.Warningf("volume snapshot %s cannot be changed. create a new volume snapshot instead.", snapshot.Name)
+	}
+}
+
+func (c *VolumeSnapshotController) onDelete(obj interface{}) {
+	snapshot := obj.(*rookalpha.VolumeSnapshot)
+	if hasFinalizer(snapshot) || snapshot.Status.State != rookalpha.VolumeSnapshotCreated {
+		// the rbd snapshot was already deleted before the finalizer was removed
+		return
+	}
+
+	// the volume snapshot was created before the finalizer was added
+	if err := deleteSnapshot(c.context, &snapshot.Status); err != nil {
+		logger.Errorf("failed to delete volume snapshot %s. %+v", snapshot.Name, err)
+	}
+}
+
+// deletes the rbd snapshot when the volume snapshot is deleted. The finalizer keeps the volume snapshot until the rbd
+// snapshot is deleted so the snapshot is not leaked and the reason it could not be deleted is reported in the status.
+func (c *VolumeSnapshotController) handleDelete(snapshot *rookalpha.VolumeSnapshot) {
+	if !hasFinalizer(snapshot) {
+		return
+	}
+
+	if snapshot.Status.State == rookalpha.VolumeSnapshotCreated {
+		if err := deleteSnapshot(c.context, &snapshot.Status); err != nil {
+			logger.Errorf("failed to delete volume snapshot %s. %+v", snapshot.Name, err)
+			status := snapshot.Status
+			status.Message = fmt.Sprintf("failed to delete the snapshot. %+v", err)
+			if status.Message == snapshot.Status.Message {
+				// do not update the resource again for the same failure, which would only trigger another attempt
+				return
+			}
+			if err := c.updateStatus(snapshot.Namespace, snapshot.Name, &status); err != nil {
+				logger.Errorf("failed to update the status of volume snapshot %s. %+v", snapshot.Name, err)
+			}
+			return
+		}
+	}
+
+	if err := c.removeFinalizer(snapshot); err != nil {
+		logger.Errorf("failed to remove finalizer from volume snapshot %s. %+v", snapshot.Name, err)
+	}
+}
+
+// deletes the rbd snapshot of a volume snapshot. The snapshot is already gone if its image was deleted.
+func deleteSnapshot(context *clusterd.Context, status *rookalpha.VolumeSnapshotStatus) error {
+	images, err := ceph.ListImages(context, status.ClusterName, status.Pool)
+	if err != nil {
+		return fmt.Errorf("failed to list images in pool %s. %+v", status.Pool, err)
+	}
+	if !imageExists(images, status.Image) {
+		logger.Infof("image %s in pool %s of snapshot %s no longer exists", status.Image, status.Pool, status.Snapshot)
+		return nil
+	}
+
+	if err := ceph.DeleteSnapshot(context, status.ClusterName, status.Pool, status.Image, status.Snapshot); err != nil {
+		return err
+	}
+	logger.Infof("deleted snapshot %s of image %s in pool %s", status.Snapshot, status.Image, status.Pool)
+	return nil
+}
+
+func imageExists(images []ceph.CephBlockImage, name string) bool {
+	for _, image := range images {
+		if image.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSnapshot takes an rbd snapshot of the image of the volume bound to the claim of the volume snapshot. The
+// snapshot has the name of the volume snapshot and is protected so new volumes can be cloned from it.
+func CreateSnapshot(context *clusterd.Context, snapshot *rookalpha.VolumeSnapshot) *rookalpha.VolumeSnapshotStatus {
+	status := &rookalpha.VolumeSnapshotStatus{State: rookalpha.VolumeSnapshotFailed}
+	clusterName, pool, image, err := claimImage(context, snapshot.Namespace, snapshot.Spec.PersistentVolumeClaimName)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+
+	rbdSnapshot, err := ceph.CreateSnapshot(context, clusterName, pool, image, snapshot.Name)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+
+	return &rookalpha.VolumeSnapshotStatus{
+		State:       rookalpha.VolumeSnapshotCreated,
+		ClusterName: clusterName,
+		Pool:        pool,
+		Image:       image,
+		Snapshot:    rbdSnapshot.Name,
+		Size:        rbdSnapshot.Size,
+	}
+}
+
+// finds the cluster, pool, and image of the rook block volume bound to a persistent volume claim
+func claimImage(context *clusterd.Context, namespace, claimName string) (string, string, string, error) {
+	if claimName == "" {
+		return "", "", "", fmt.Errorf("missing persistent volume claim name")
+	}
+	pvc, err := context.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(claimName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get persistent volume claim %s. %+v", claimName, err)
+	}
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return "", "", "", fmt.Errorf("persistent volume claim %s is not bound", claimName)
+	}
+
+	pv, err := context.Clientset.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get persistent volume %s. %+v", pvc.Spec.VolumeName, err)
+	}
+	flex := pv.Spec.FlexVolume
+	if flex == nil || flex.Driver != flexDriverName || flex.Options[flexvolume.PoolKey] == "" || flex.Options[flexvolume.ImageKey] == "" {
+		return "", "", "", fmt.Errorf("persistent volume %s is not a rook block volume", pv.Name)
+	}
+
+	clusterName, err := flexvolume.GetVolumeClusterName(context.Clientset, pv)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get cluster of persistent volume %s. %+v", pv.Name, err)
+	}
+
+	return clusterName, flex.Options[flexvolume.PoolKey], flex.Options[flexvolume.ImageKey], nil
+}
+
+// saves the status in the volume snapshot resource. the latest resource is retrieved so the update does not conflict.
+// The finalizer is added in the same update when the rbd snapshot was created.
+func (c *VolumeSnapshotController) updateStatus(namespace, name string, status *rookalpha.VolumeSnapshotStatus) error {
+	snapshot, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get volume snapshot %s. %+v", name, err)
+	}
+
+	snapshot.Status = *status
+	if status.State == rookalpha.VolumeSnapshotCreated && !hasFinalizer(snapshot) && snapshot.DeletionTimestamp == nil {
+		snapshot.Finalizers = append(snapshot.Finalizers, finalizerName)
+	}
+	if _, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(namespace).Update(snapshot); err != nil {
+		return fmt.Errorf("failed to update volume snapshot %s. %+v", name, err)
+	}
+	return nil
+}
+
+func hasFinalizer(snapshot *rookalpha.VolumeSnapshot) bool {
+	for _, finalizer := range snapshot.Finalizers {
+		if finalizer == finalizerName {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *VolumeSnapshotController) addFinalizer(s *rookalpha.VolumeSnapshot) error {
+	if hasFinalizer(s) {
+		return nil
+	}
+
+	// get the latest snapshot since the status may have been updated
+	snapshot, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(s.Namespace).Get(s.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get volume snapshot. %+v", err)
+	}
+	if hasFinalizer(snapshot) {
+		return nil
+	}
+	snapshot.Finalizers = append(snapshot.Finalizers, finalizerName)
+	if _, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(s.Namespace).Update(snapshot); err != nil {
+		return fmt.Errorf("failed to update volume snapshot. %+v", err)
+	}
+
+	logger.Infof("added finalizer to volume snapshot %s", s.Name)
+	return nil
+}
+
+func (c *VolumeSnapshotController) removeFinalizer(s *rookalpha.VolumeSnapshot) error {
+	snapshot, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(s.Namespace).Get(s.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get volume snapshot. %+v", err)
+	}
+	for i, finalizer := range snapshot.Finalizers {
+		if finalizer == finalizerName {
+			snapshot.Finalizers = append(snapshot.Finalizers[:i], snapshot.Finalizers[i+1:]...)
+			break
+		}
+	}
+	if _, err := c.context.RookClientset.RookV1alpha1().VolumeSnapshots(s.Namespace).Update(snapshot); err != nil {
+		return fmt.Errorf("failed to update volume snapshot. %+v", err)
+	}
+
+	logger.Infof("removed finalizer from volume snapshot %s", s.Name)
+	return nil
+}
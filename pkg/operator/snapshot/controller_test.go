@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package snapshot
+
+import (
+	"fmt"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateSnapshot(t *testing.T) {
+	snapshotArgs := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] == "snap" && args[1] == "ls" {
+				snapshotArgs = args
+				return `[{"id":4,"name":"snap1","size":1048576}]`, nil
+			}
+			if args[0] == "info" {
+				return `{"protected":"true"}`, nil
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	snapshot := &rookalpha.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "snap1", Namespace: "myns"},
+		Spec:       rookalpha.VolumeSnapshotSpec{PersistentVolumeClaimName: "claim1"},
+	}
+
+	// fail when the claim is not found
+	status := CreateSnapshot(context, snapshot)
+	assert.Equal(t, rookalpha.VolumeSnapshotFailed, status.State)
+
+	// fail when the claim is not bound
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "myns"}}
+	_, err := clientset.CoreV1().PersistentVolumeClaims("myns").Create(pvc)
+	assert.Nil(t, err)
+	status = CreateSnapshot(context, snapshot)
+	assert.Equal(t, rookalpha.VolumeSnapshotFailed, status.State)
+
+	// the image of the bound volume is snapshotted in the cluster of the storage class
+	pvc.Spec.VolumeName = "pvc-1234"
+	pvc.Status.Phase = v1.ClaimBound
+	_, err = clientset.CoreV1().PersistentVolumeClaims("myns").Update(pvc)
+	assert.Nil(t, err)
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1234"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+			Driver:  "rook.io/rook",
+			Options: map[string]string{"pool": "pool1", "image": "pvc-1234", "storageClass": "rook-block"},
+		}}},
+	}
+	_, err = clientset.CoreV1().PersistentVolumes().Create(pv)
+	assert.Nil(t, err)
+	sc := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-block"},
+		Parameters: map[string]string{"pool": "pool1", "clusterName": "mycluster"},
+	}
+	_, err = clientset.StorageV1().StorageClasses().Create(sc)
+	assert.Nil(t, err)
+
+	status = CreateSnapshot(context, snapshot)
+	assert.Equal(t, rookalpha.VolumeSnapshotCreated, status.State)
+	assert.Equal(t, "", status.Message)
+	assert.Equal(t, "mycluster", status.ClusterName)
+	assert.Equal(t, "pool1", status.Pool)
+	assert.Equal(t, "pvc-1234", status.Image)
+	assert.Equal(t, "snap1", status.Snapshot)
+	assert.Equal(t, uint64(1048576), status.Size)
+	assert.Equal(t, "pool1/pvc-1234", snapshotArgs[2])
+	assert.Equal(t, "--cluster=mycluster", snapshotArgs[3])
+}
+
+func TestDeleteSnapshotFinalizer(t *testing.T) {
+	snapRemoved := false
+	removeErr := fmt.Errorf("mock failure")
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] == "ls" {
+				return `[{"image":"pvc-1234","size":1048576,"format":2}]`, nil
+			}
+			if args[0] == "snap" && args[1] == "ls" {
+				if snapRemoved {
+					return "[]", nil
+				}
+				return `[{"id":4,"name":"snap1","size":1048576}]`, nil
+			}
+			if args[0] == "info" {
+				return `{"protected":"false"}`, nil
+			}
+			if args[0] == "snap" && args[1] == "rm" {
+				if removeErr != nil {
+					return "", removeErr
+				}
+				snapRemoved = true
+			}
+			return "", nil
+		},
+	}
+	rookClientset := rookfake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: fake.NewSimpleClientset(), RookClientset: rookClientset}
+	controller := NewVolumeSnapshotController(context)
+
+	snapshot := &rookalpha.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "snap1", Namespace: "myns"},
+		Spec:       rookalpha.VolumeSnapshotSpec{PersistentVolumeClaimName: "claim1"},
+	}
+	_, err := rookClientset.RookV1alpha1().VolumeSnapshots("myns").Create(snapshot)
+	assert.Nil(t, err)
+
+	// the finalizer is added with the status when the snapshot is created
+	status := &rookalpha.VolumeSnapshotStatus{State: rookalpha.VolumeSnapshotCreated, ClusterName: "mycluster", Pool: "pool1", Image: "pvc-1234", Snapshot: "snap1"}
+	err = controller.updateStatus("myns", "snap1", status)
+	assert.Nil(t, err)
+	snapshot, err = rookClientset.RookV1alpha1().VolumeSnapshots("myns").Get("snap1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, hasFinalizer(snapshot))
+
+	// the finalizer is kept and the failure reported when the rbd snapshot cannot be deleted
+	now := metav1.Now()
+	snapshot.DeletionTimestamp = &now
+	controller.onUpdate(snapshot, snapshot)
+	snapshot, err = rookClientset.RookV1alpha1().VolumeSnapshots("myns").Get("snap1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, hasFinalizer(snapshot))
+	assert.Equal(t, rookalpha.VolumeSnapshotCreated, snapshot.Status.State)
+	assert.Contains(t, snapshot.Status.Message, "mock failure")
+
+	// the finalizer is removed after the rbd snapshot is deleted
+	removeErr = nil
+	controller.onUpdate(snapshot, snapshot)
+	assert.True(t, snapRemoved)
+	snapshot, err = rookClientset.RookV1alpha1().VolumeSnapshots("myns").Get("snap1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, hasFinalizer(snapshot))
+
+	// the finalizer is removed when the image of the snapshot no longer exists
+	snapshot.Finalizers = []string{finalizerName}
+	snapshot.Status.Image = "pvc-5678"
+	snapshot, err = rookClientset.RookV1alpha1().VolumeSnapshots("myns").Update(snapshot)
+	assert.Nil(t, err)
+	snapRemoved = false
+	controller.onUpdate(snapshot, snapshot)
+	assert.False(t, snapRemoved)
+	snapshot, err = rookClientset.RookV1alpha1().VolumeSnapshots("myns").Get("snap1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, hasFinalizer(snapshot))
+}
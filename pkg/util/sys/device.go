@@ -322,3 +322,29 @@ func parseKeyValuePairString(propsRaw string) map[string]string {
 
 	return propMap
 }
+
+// GrowFilesystemCommand returns the tool and arguments that grow the mounted filesystem of a device to the size of
+// the device. ext filesystems are grown through their device and xfs filesystems through their mount path.
+func GrowFilesystemCommand(devicePath, mountPath, fstype string) (string, []string, error) {
+	switch fstype {
+	case "", "ext3", "ext4":
+		return "resize2fs", []string{devicePath}, nil
+	case "xfs":
+		return "xfs_growfs", []string{mountPath}, nil
+	}
+	return "", nil, fmt.Errorf("growing a %s filesystem is not supported", fstype)
+}
+
+// GrowFilesystem grows the mounted filesystem of a device to the size of the device
+func GrowFilesystem(devicePath, mountPath, fstype string, executor exec.Executor) error {
+	tool, args, err := GrowFilesystemCommand(devicePath, mountPath, fstype)
+	if err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf("grow filesystem on %s", devicePath)
+	if err := executor.ExecuteCommand(false, cmd, tool, args...); err != nil {
+		return fmt.Errorf("command %s failed: %+v", cmd, err)
+	}
+	return nil
+}
@@ -122,6 +122,24 @@ func TestMountDeviceWithOptions(t *testing.T) {
 	MountDeviceWithOptions("/dev/abc1", "/tmp/mount1", "myfstype", "foo=bar,baz=biz", e)
 }
 
+func TestGrowFilesystem(t *testing.T) {
+	commands := []string{}
+	e := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, arg ...string) error {
+			commands = append(commands, command+" "+strings.Join(arg, " "))
+			return nil
+		},
+	}
+
+	// ext filesystems are grown through the device and xfs through the mount path
+	assert.Nil(t, GrowFilesystem("/dev/rbd0", "/tmp/mount1", "", e))
+	assert.Nil(t, GrowFilesystem("/dev/rbd0", "/tmp/mount1", "ext4", e))
+	assert.Nil(t, GrowFilesystem("/dev/rbd0", "/tmp/mount1", "xfs", e))
+	assert.Equal(t, []string{"resize2fs /dev/rbd0", "resize2fs /dev/rbd0", "xfs_growfs /tmp/mount1"}, commands)
+
+	assert.NotNil(t, GrowFilesystem("/dev/rbd0", "/tmp/mount1", "btrfs", e))
+}
+
 func TestGetPartitions(t *testing.T) {
 	run := 0
 	executor := &exectest.MockExecutor{
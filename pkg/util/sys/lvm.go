@@ -0,0 +1,206 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rook/rook/pkg/util/exec"
+)
+
+// UseAllFreeExtents is the size to create a logical volume with all the free space in the volume group
+const UseAllFreeExtents = -1
+
+// LogicalVolume is an LVM logical volume with its tags
+type LogicalVolume struct {
+	Name        string
+	VolumeGroup string
+	Path        string
+	Tags        map[string]string
+	// Devices are the names of the devices backing the logical volume
+	Devices []string
+}
+
+// VolumeGroup is an LVM volume group with its tags and free space
+type VolumeGroup struct {
+	Name   string
+	Tags   map[string]string
+	FreeMB int
+}
+
+type lvmReport struct {
+	Report []struct {
+		LV []struct {
+			Name        string `json:"lv_name"`
+			VolumeGroup string `json:"vg_name"`
+			Path        string `json:"lv_path"`
+			Tags        string `json:"lv_tags"`
+			Devices     string `json:"devices"`
+		} `json:"lv"`
+		VG []struct {
+			Name string `json:"vg_name"`
+			Tags string `json:"vg_tags"`
+			Free string `json:"vg_free"`
+		} `json:"vg"`
+	} `json:"report"`
+}
+
+// CreatePhysicalVolume initializes the device as an LVM physical volume
+func CreatePhysicalVolume(device string, executor exec.Executor) error {
+	cmd := fmt.Sprintf("pvcreate %s", device)
+	if err := executor.ExecuteCommand(false, cmd, "pvcreate", "--yes", "/dev/"+device); err != nil {
+		return fmt.Errorf("failed to create physical volume on /dev/%s. %+v", device, err)
+	}
+	return nil
+}
+
+// CreateVolumeGroup creates a volume group on the device with the given tags
+func CreateVolumeGroup(name, device string, tags map[string]string, executor exec.Executor) error {
+	args := append([]string{"--yes"}, tagArgs(tags)...)
+	args = append(args, name, "/dev/"+device)
+	cmd := fmt.Sprintf("vgcreate %s", name)
+	if err := executor.ExecuteCommand(false, cmd, "vgcreate", args...); err != nil {
+		return fmt.Errorf("failed to create volume group %s on /dev/%s. %+v", name, device, err)
+	}
+	return nil
+}
+
+// CreateLogicalVolume creates a logical volume in the volume group with the given tags. If the size
+// is UseAllFreeExtents, the logical volume takes all the free space in the volume group.
+func CreateLogicalVolume(name, volumeGroup string, sizeMB int, tags map[string]string, executor exec.Executor) error {
+	args := []string{"--yes", "--name", name}
+	if sizeMB == UseAllFreeExtents {
+		args = append(args, "--extents", "100%FREE")
+	} else {
+		args = append(args, "--size", fmt.Sprintf("%dm", sizeMB))
+	}
+	args = append(args, tagArgs(tags)...)
+	args = append(args, volumeGroup)
+
+	cmd := fmt.Sprintf("lvcreate %s/%s", volumeGroup, name)
+	if err := executor.ExecuteCommand(false, cmd, "lvcreate", args...); err != nil {
+		return fmt.Errorf("failed to create logical volume %s/%s. %+v", volumeGroup, name, err)
+	}
+	return nil
+}
+
+// AddLogicalVolumeTag adds a tag to an existing logical volume
+func AddLogicalVolumeTag(path, key, value string, executor exec.Executor) error {
+	cmd := fmt.Sprintf("lvchange %s", path)
+	if err := executor.ExecuteCommand(false, cmd, "lvchange", "--addtag", fmt.Sprintf("%s=%s", key, value), path); err != nil {
+		return fmt.Errorf("failed to add tag %s to logical volume %s. %+v", key, path, err)
+	}
+	return nil
+}
+
+// GetLogicalVolumes lists all the logical volumes on the host
+func GetLogicalVolumes(executor exec.Executor) ([]LogicalVolume, error) {
+	output, err := executor.ExecuteCommandWithOutput(false, "lvs", "lvs",
+		"--reportformat", "json", "--options", "lv_name,vg_name,lv_path,lv_tags,devices")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logical volumes. %+v", err)
+	}
+
+	return parseLogicalVolumes(output)
+}
+
+// GetVolumeGroups lists all the volume groups on the host
+func GetVolumeGroups(executor exec.Executor) ([]VolumeGroup, error) {
+	output, err := executor.ExecuteCommandWithOutput(false, "vgs", "vgs",
+		"--reportformat", "json", "--units", "m", "--nosuffix", "--options", "vg_name,vg_tags,vg_free")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume groups. %+v", err)
+	}
+
+	return parseVolumeGroups(output)
+}
+
+func parseLogicalVolumes(output string) ([]LogicalVolume, error) {
+	var report lvmReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse lvs output. %+v", err)
+	}
+
+	lvs := []LogicalVolume{}
+	for _, r := range report.Report {
+		for _, lv := range r.LV {
+			lvs = append(lvs, LogicalVolume{Name: lv.Name, VolumeGroup: lv.VolumeGroup, Path: lv.Path,
+				Tags: parseTags(lv.Tags), Devices: parseLVDevices(lv.Devices)})
+		}
+	}
+	return lvs, nil
+}
+
+func parseVolumeGroups(output string) ([]VolumeGroup, error) {
+	var report lvmReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse vgs output. %+v", err)
+	}
+
+	vgs := []VolumeGroup{}
+	for _, r := range report.Report {
+		for _, vg := range r.VG {
+			free, err := strconv.ParseFloat(strings.TrimSpace(vg.Free), 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse free space %s of volume group %s. %+v", vg.Free, vg.Name, err)
+			}
+			vgs = append(vgs, VolumeGroup{Name: vg.Name, Tags: parseTags(vg.Tags), FreeMB: int(free)})
+		}
+	}
+	return vgs, nil
+}
+
+// lvm reports the tags as a comma separated list. rook tags are in the form of key=value.
+func parseTags(raw string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(raw, ",") {
+		if tag == "" {
+			continue
+		}
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	return tags
+}
+
+// lvm reports the devices with their starting extent, e.g. "/dev/sdb(0),/dev/sdc(0)"
+func parseLVDevices(raw string) []string {
+	devices := []string{}
+	for _, device := range strings.Split(raw, ",") {
+		if i := strings.Index(device, "("); i >= 0 {
+			device = device[:i]
+		}
+		if device != "" {
+			devices = append(devices, strings.TrimPrefix(device, "/dev/"))
+		}
+	}
+	return devices
+}
+
+func tagArgs(tags map[string]string) []string {
+	args := []string{}
+	for k, v := range tags {
+		args = append(args, "--addtag", fmt.Sprintf("%s=%s", k, v))
+	}
+	return args
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"testing"
+
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogicalVolumes(t *testing.T) {
+	output := `  {
+      "report": [
+          {
+              "lv": [
+                  {"lv_name":"osd-block-1234", "vg_name":"rook-block-1234", "lv_path":"/dev/rook-block-1234/osd-block-1234", "lv_tags":"ceph.osd_fsid=1234,ceph.osd_id=3,ceph.type=block", "devices":"/dev/sdb(0)"},
+                  {"lv_name":"root", "vg_name":"system", "lv_path":"/dev/system/root", "lv_tags":""}
+              ]
+          }
+      ]
+  }`
+
+	lvs, err := parseLogicalVolumes(output)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(lvs))
+	assert.Equal(t, "osd-block-1234", lvs[0].Name)
+	assert.Equal(t, "rook-block-1234", lvs[0].VolumeGroup)
+	assert.Equal(t, "/dev/rook-block-1234/osd-block-1234", lvs[0].Path)
+	assert.Equal(t, map[string]string{"ceph.osd_fsid": "1234", "ceph.osd_id": "3", "ceph.type": "block"}, lvs[0].Tags)
+	assert.Equal(t, []string{"sdb"}, lvs[0].Devices)
+	assert.Equal(t, 0, len(lvs[1].Tags))
+	assert.Equal(t, 0, len(lvs[1].Devices))
+
+	_, err = parseLogicalVolumes("not json")
+	assert.NotNil(t, err)
+}
+
+func TestParseVolumeGroups(t *testing.T) {
+	output := `{"report": [{"vg": [{"vg_name":"rook-metadata-1", "vg_tags":"rook.metadata", "vg_free":"20479.50"}]}]}`
+
+	vgs, err := parseVolumeGroups(output)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(vgs))
+	assert.Equal(t, "rook-metadata-1", vgs[0].Name)
+	assert.Equal(t, 20479, vgs[0].FreeMB)
+	_, ok := vgs[0].Tags["rook.metadata"]
+	assert.True(t, ok)
+}
+
+func TestCreateLogicalVolume(t *testing.T) {
+	var lastArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			assert.Equal(t, "lvcreate", command)
+			lastArgs = args
+			return nil
+		},
+	}
+
+	err := CreateLogicalVolume("osd-db-1", "vg1", 1024, map[string]string{"ceph.type": "db"}, executor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--yes", "--name", "osd-db-1", "--size", "1024m", "--addtag", "ceph.type=db", "vg1"}, lastArgs)
+
+	err = CreateLogicalVolume("osd-block-1", "vg1", UseAllFreeExtents, nil, executor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--yes", "--name", "osd-block-1", "--extents", "100%FREE", "vg1"}, lastArgs)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/util/exec"
+)
+
+const (
+	smartHealthResultPrefix = "SMART overall-health self-assessment test result:"
+	smartHealthStatusPrefix = "SMART Health Status:"
+	smartAttributeHeader    = "ID# ATTRIBUTE_NAME"
+	smartFailingNow         = "FAILING_NOW"
+)
+
+// DeviceHealth is the SMART health data of a device
+type DeviceHealth struct {
+	Device string `json:"device"`
+	// Passed is the result of the overall health self-assessment of the device
+	Passed bool `json:"passed"`
+	// FailingAttributes are the attributes whose value is currently below the failure threshold
+	FailingAttributes []string `json:"failingAttributes,omitempty"`
+
+	Temperature        int       `json:"temperature"`
+	PowerOnHours       int       `json:"powerOnHours"`
+	ReallocatedSectors int       `json:"reallocatedSectors"`
+	PendingSectors     int       `json:"pendingSectors"`
+	Timestamp          time.Time `json:"timestamp"`
+}
+
+// PredictedFailure returns whether the SMART data indicates the device is failing or about to fail
+func (h *DeviceHealth) PredictedFailure() bool {
+	return !h.Passed || len(h.FailingAttributes) > 0
+}
+
+// GetDeviceHealth collects the SMART health data of the device with smartctl
+func GetDeviceHealth(device string, executor exec.Executor) (*DeviceHealth, error) {
+	cmd := fmt.Sprintf("smartctl %s", device)
+	output, err := executor.ExecuteCommandWithOutput(false, cmd, "smartctl", "--health", "--attributes", "/dev/"+device)
+	if err != nil && output == "" {
+		return nil, fmt.Errorf("failed to get SMART data for device %s. %+v", device, err)
+	}
+
+	// smartctl returns a non-zero exit status when the device is failing, which is not an error as long as the
+	// health data was reported
+	return parseSmartOutput(device, output)
+}
+
+func parseSmartOutput(device, output string) (*DeviceHealth, error) {
+	health := &DeviceHealth{Device: device, Timestamp: time.Now()}
+	foundStatus := false
+	inAttributes := false
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, smartHealthResultPrefix):
+			// ATA and NVMe devices
+			foundStatus = true
+			health.Passed = strings.TrimSpace(strings.TrimPrefix(line, smartHealthResultPrefix)) == "PASSED"
+		case strings.HasPrefix(line, smartHealthStatusPrefix):
+			// SCSI devices
+			foundStatus = true
+			health.Passed = strings.TrimSpace(strings.TrimPrefix(line, smartHealthStatusPrefix)) == "OK"
+		case strings.HasPrefix(line, smartAttributeHeader):
+			inAttributes = true
+		case line == "":
+			inAttributes = false
+		case inAttributes:
+			parseSmartAttribute(line, health)
+		case strings.HasPrefix(line, "Temperature:"), strings.HasPrefix(line, "Current Drive Temperature:"):
+			// NVMe and SCSI devices report the temperature outside the attribute table, e.g. "Temperature: 36 Celsius"
+			fields := strings.Fields(strings.SplitN(line, ":", 2)[1])
+			if len(fields) > 0 {
+				health.Temperature, _ = strconv.Atoi(fields[0])
+			}
+		case strings.HasPrefix(line, "Power On Hours:"):
+			fields := strings.Fields(strings.SplitN(line, ":", 2)[1])
+			if len(fields) > 0 {
+				health.PowerOnHours, _ = strconv.Atoi(strings.Replace(fields[0], ",", "", -1))
+			}
+		}
+	}
+
+	if !foundStatus {
+		return nil, fmt.Errorf("SMART health status not available for device %s", device)
+	}
+
+	return health, nil
+}
+
+// parse a line from the ATA attribute table. The columns are:
+// ID# ATTRIBUTE_NAME FLAG VALUE WORST THRESH TYPE UPDATED WHEN_FAILED RAW_VALUE
+func parseSmartAttribute(line string, health *DeviceHealth) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return
+	}
+
+	name := fields[1]
+	if fields[8] == smartFailingNow {
+		health.FailingAttributes = append(health.FailingAttributes, name)
+	}
+
+	raw, err := strconv.Atoi(fields[9])
+	if err != nil {
+		return
+	}
+	switch name {
+	case "Reallocated_Sector_Ct":
+		health.ReallocatedSectors = raw
+	case "Current_Pending_Sector":
+		health.PendingSectors = raw
+	case "Power_On_Hours":
+		health.PowerOnHours = raw
+	case "Temperature_Celsius":
+		health.Temperature = raw
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"errors"
+	"testing"
+
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+const ataSmartOutput = `smartctl 6.5 2016-01-24 r4214 [x86_64-linux-4.4.0-116-generic] (local build)
+
+=== START OF READ SMART DATA SECTION ===
+SMART overall-health self-assessment test result: PASSED
+
+SMART Attributes Data Structure revision number: 16
+Vendor Specific SMART Attributes with Thresholds:
+ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  1 Raw_Read_Error_Rate     0x000f   117   099   006    Pre-fail  Always       -       148287296
+  5 Reallocated_Sector_Ct   0x0033   100   100   010    Pre-fail  Always       -       8
+  9 Power_On_Hours          0x0032   085   085   000    Old_age   Always       -       13456
+194 Temperature_Celsius     0x0022   036   049   000    Old_age   Always       -       36 (0 15 0 0 0)
+197 Current_Pending_Sector  0x0012   100   100   000    Old_age   Always       -       2
+`
+
+func TestParseSmartOutput(t *testing.T) {
+	health, err := parseSmartOutput("sda", ataSmartOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, "sda", health.Device)
+	assert.True(t, health.Passed)
+	assert.False(t, health.PredictedFailure())
+	assert.Equal(t, 8, health.ReallocatedSectors)
+	assert.Equal(t, 2, health.PendingSectors)
+	assert.Equal(t, 13456, health.PowerOnHours)
+	assert.Equal(t, 36, health.Temperature)
+
+	// an attribute below its threshold predicts a failure even if the overall assessment passed
+	failing := `SMART overall-health self-assessment test result: PASSED
+ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  5 Reallocated_Sector_Ct   0x0033   005   005   010    Pre-fail  Always   FAILING_NOW 2040
+`
+	health, err = parseSmartOutput("sdb", failing)
+	assert.Nil(t, err)
+	assert.True(t, health.Passed)
+	assert.Equal(t, []string{"Reallocated_Sector_Ct"}, health.FailingAttributes)
+	assert.True(t, health.PredictedFailure())
+
+	// scsi devices report the status differently
+	health, err = parseSmartOutput("sdc", "SMART Health Status: FIRMWARE IMPENDING FAILURE\nCurrent Drive Temperature:     41 C")
+	assert.Nil(t, err)
+	assert.False(t, health.Passed)
+	assert.Equal(t, 41, health.Temperature)
+	assert.True(t, health.PredictedFailure())
+
+	// devices without SMART support
+	_, err = parseSmartOutput("vda", "SMART support is: Unavailable - device lacks SMART capability.")
+	assert.NotNil(t, err)
+}
+
+func TestGetDeviceHealth(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "smartctl", command)
+			assert.Equal(t, "/dev/sdb", args[len(args)-1])
+			// smartctl sets bit 3 of the exit status when the disk is failing
+			return "SMART overall-health self-assessment test result: FAILED!", errors.New("exit status 8")
+		},
+	}
+
+	health, err := GetDeviceHealth("sdb", executor)
+	assert.Nil(t, err)
+	assert.False(t, health.Passed)
+
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		return "", errors.New("not found")
+	}
+	_, err = GetDeviceHealth("sdb", executor)
+	assert.NotNil(t, err)
+}
@@ -56,6 +56,7 @@ rules:
   - events
   - persistentvolumes
   - persistentvolumeclaims
+  - persistentvolumeclaims/status
   verbs:
   - get
   - list
@@ -295,6 +295,8 @@ func (h *InstallHelper) UninstallRookFromMultipleNS(helmInstalled bool, systemNa
 			assert.NoError(h.T(), err, "rook-ceph-osd cluster role and binding cannot be deleted: %+v", err)
 		}
 
+		h.forceDeletePools(namespace)
+
 		_, err = h.k8shelper.DeleteResource([]string{"-n", namespace, "cluster", namespace})
 		h.checkError(err, fmt.Sprintf("cannot remove cluster %s", namespace))
 
@@ -307,7 +309,7 @@ func (h *InstallHelper) UninstallRookFromMultipleNS(helmInstalled bool, systemNa
 
 	logger.Infof("removing the operator from namespace %s", systemNamespace)
 	if h.k8shelper.VersionAtLeast("v1.7.0") {
-		_, err = h.k8shelper.DeleteResource([]string{"crd", "clusters.rook.io", "pools.rook.io", "objectstores.rook.io", "filesystems.rook.io"})
+		_, err = h.k8shelper.DeleteResource([]string{"crd", "clusters.rook.io", "pools.rook.io", "objectstores.rook.io", "filesystems.rook.io", "crushmaps.rook.io"})
 		h.checkError(err, "cannot delete CRDs")
 	} else {
 		_, err = h.k8shelper.DeleteResource([]string{"thirdpartyresources", "cluster.rook.io", "pool.rook.io", "objectstore.rook.io", "filesystem.rook.io"})
@@ -336,6 +338,29 @@ func (h *InstallHelper) checkError(err error, message string) {
 	assert.NoError(h.T(), err, "%s. %+v", message, err)
 }
 
+// allows the operator to delete the pools even if the tests left data in them
+func (h *InstallHelper) forceDeletePools(namespace string) {
+	if !h.k8shelper.VersionAtLeast("v1.7.0") {
+		return
+	}
+
+	pools, err := h.k8shelper.RookClientset.RookV1alpha1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		logger.Warningf("failed to list pools in namespace %s. %+v", namespace, err)
+		return
+	}
+	for i := range pools.Items {
+		p := &pools.Items[i]
+		if p.Annotations == nil {
+			p.Annotations = map[string]string{}
+		}
+		p.Annotations["rook.io/force-delete"] = "true"
+		if _, err := h.k8shelper.RookClientset.RookV1alpha1().Pools(namespace).Update(p); err != nil {
+			logger.Warningf("failed to annotate pool %s for deletion. %+v", p.Name, err)
+		}
+	}
+}
+
 func (h *InstallHelper) waitForCustomResourceDeletion(namespace string) error {
 	if !h.k8shelper.VersionAtLeast("v1.8.0") {
 		// v1.6 does not have finalizers for TPRs
@@ -19,6 +19,19 @@ spec:
     size: ` + replicaSize
 }
 
+// GetMirroredPoolDef returns the manifest of a pool with all its images mirrored from the peer in the secret, if any
+func GetMirroredPoolDef(poolName, namespace, peerSecretName string) string {
+	def := GetBlockPoolDef(poolName, namespace, "1") + `
+  mirroring:
+    mode: pool`
+	if peerSecretName != "" {
+		def += `
+    peers:
+    - secretName: ` + peerSecretName
+	}
+	return def
+}
+
 func GetBlockStorageClassDef(poolName string, storageClassName string, namespace string) string {
 	return `apiVersion: storage.k8s.io/v1
 kind: StorageClass
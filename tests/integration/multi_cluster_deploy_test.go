@@ -17,7 +17,9 @@ limitations under the License.
 package integration
 
 import (
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -45,6 +47,8 @@ import (
 // - Create a file system via the REST API
 // Object
 // - Create the object store via the CRD
+// RBD mirroring
+// - Mirror the images of a pool in the second cluster to the first cluster
 // *************************************************************
 func TestMultiClusterDeploySuite(t *testing.T) {
 	s := new(MultiClusterDeploySuite)
@@ -123,6 +127,68 @@ func (mrc *MultiClusterDeploySuite) TestObjectStoreOnMultiRookCluster() {
 	runObjectE2ETestLite(mrc.helper2, mrc.k8sh, mrc.Suite, mrc.namespace2, "default-c2", 1)
 }
 
+//Test the rbd mirroring of a pool from the second cluster to the first cluster
+func (mrc *MultiClusterDeploySuite) TestRBDMirroringBetweenRookClusters() {
+	poolName := "mirrored-pool"
+	peerSecretName := mrc.namespace2 + "-peer"
+
+	// start an rbd-mirror daemon in the first cluster
+	_, err := mrc.k8sh.Kubectl("-n", mrc.namespace1, "patch", "cluster", mrc.namespace1, "--type", "merge",
+		"-p", `{"spec":{"rbdMirroring":{"workers":1}}}`)
+	require.Nil(mrc.T(), err)
+	require.True(mrc.T(), mrc.k8sh.IsPodWithLabelRunning("app=rook-ceph-rbd-mirror", mrc.namespace1),
+		"Make sure rbd-mirror is in running state")
+
+	// the peer secret has the mon endpoints and the admin key of the second cluster
+	monEndpoints, err := mrc.k8sh.GetResource("-n", mrc.namespace2, "configmap", "rook-ceph-mon-endpoints", "-o", "jsonpath={.data.data}")
+	require.Nil(mrc.T(), err)
+	var monHosts []string
+	for _, endpoint := range strings.Split(monEndpoints, ",") {
+		monHosts = append(monHosts, endpoint[strings.Index(endpoint, "=")+1:])
+	}
+	encodedKey, err := mrc.k8sh.GetResource("-n", mrc.namespace2, "secret", "rook-ceph-mon", "-o", "jsonpath={.data.admin-secret}")
+	require.Nil(mrc.T(), err)
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	require.Nil(mrc.T(), err)
+	_, err = mrc.k8sh.Kubectl("-n", mrc.namespace1, "create", "secret", "generic", peerSecretName,
+		"--from-literal=cluster="+mrc.namespace2, "--from-literal=monHost="+strings.Join(monHosts, ","), "--from-literal=key="+string(key))
+	require.Nil(mrc.T(), err)
+
+	// the pool is mirrored in both clusters and the first cluster pulls the images from the second
+	_, err = installer.BlockResourceOperation(mrc.k8sh, installer.GetMirroredPoolDef(poolName, mrc.namespace2, ""), "create")
+	require.Nil(mrc.T(), err)
+	_, err = installer.BlockResourceOperation(mrc.k8sh, installer.GetMirroredPoolDef(poolName, mrc.namespace1, peerSecretName), "create")
+	require.Nil(mrc.T(), err)
+
+	// an image with journaling is created once the pool is ready in the second cluster
+	created := false
+	for i := 0; i < utils.RetryLoop && !created; i++ {
+		time.Sleep(utils.RetryInterval * time.Second)
+		_, err = mrc.k8sh.Kubectl("-n", mrc.namespace2, "exec", "rook-tools", "--", "rbd", "create", poolName+"/image1",
+			"--size", "10", "--image-feature", "layering,exclusive-lock,journaling")
+		created = err == nil
+	}
+	require.True(mrc.T(), created, "Make sure the image is created in the second cluster")
+
+	// the image is mirrored to the first cluster
+	mirrored := false
+	for i := 0; i < utils.RetryLoop && !mirrored; i++ {
+		time.Sleep(utils.RetryInterval * time.Second)
+		images, _ := mrc.k8sh.Kubectl("-n", mrc.namespace1, "exec", "rook-tools", "--", "rbd", "ls", poolName)
+		mirrored = strings.Contains(images, "image1")
+	}
+	require.True(mrc.T(), mirrored, "Make sure the image is mirrored to the first cluster")
+
+	// the mirroring status of the image is reported in the pool crd
+	reported := false
+	for i := 0; i < utils.RetryLoop && !reported; i++ {
+		time.Sleep(utils.RetryInterval * time.Second)
+		images, _ := mrc.k8sh.GetResource("-n", mrc.namespace1, "pool", poolName, "-o", "jsonpath={.status.mirroring.images[*].name}")
+		reported = strings.Contains(images, "image1")
+	}
+	require.True(mrc.T(), reported, "Make sure the mirroring status of the image is reported")
+}
+
 //MCTestOperations struct for handling panic and test suite tear down
 type MCTestOperations struct {
 	installer   *installer.InstallHelper